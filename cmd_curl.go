@@ -0,0 +1,542 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/pkg/client"
+)
+
+// curlUserAgent curl子命令默认的User-Agent
+const curlUserAgent = "quic_gwclient"
+
+// runCurl 按curl的参数构造HTTP请求，通过网关发送并输出响应
+func (c *cli) runCurl(ctx context.Context, args []string) error {
+	fs := c.newFlagSet("curl")
+	g := addGatewayFlags(fs, c.stderr)
+	method := fs.String("X", "", "请求方法，默认GET，指定了请求体时为POST")
+	head := fs.Bool("I", false, "发送HEAD请求，只输出响应头")
+	var headers []string
+	fs.Func("H", "请求头，格式为\"名称: 值\"，可以重复指定", func(s string) error {
+		if !strings.Contains(s, ":") {
+			return fmt.Errorf("请求头格式应为\"名称: 值\": %q", s)
+		}
+		headers = append(headers, s)
+		return nil
+	})
+	var data []string
+	fs.Func("d", "表单格式的请求体，多次指定时以&连接，@文件名读取文件并去掉换行，@-读取标准输入", func(s string) error {
+		data = append(data, s)
+		return nil
+	})
+	var dataBinary []string
+	fs.Func("data-binary", "按字节原样发送的请求体，@文件名读取文件，@-读取标准输入", func(s string) error {
+		dataBinary = append(dataBinary, s)
+		return nil
+	})
+	userAgent := fs.String("A", curlUserAgent, "User-Agent")
+	user := fs.String("u", "", "Basic认证的用户名和密码，格式为用户名:密码")
+	include := fs.Bool("i", false, "在输出中包含响应头")
+	output := fs.String("o", "-", "响应写入的文件，-表示标准输出")
+	verbose := fs.Bool("v", false, "在标准错误输出请求头和响应头")
+	silent := fs.Bool("s", false, "不输出错误信息")
+	showError := fs.Bool("S", false, "指定-s时仍然输出错误信息")
+	fail := fs.Bool("f", false, "HTTP响应状态码不小于400时不输出响应体，以退出码6退出")
+	writeOut := fs.String("w", "", "完成后在标准输出按格式输出变量，如\"%{http_code} %{time_total}\\n\"，@文件名读取格式，变量见-h")
+	usage := fs.Usage
+	fs.Usage = func() {
+		usage()
+		c.curlVariablesUsage()
+	}
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	err := c.curl(ctx, fs.Arg(0), g, &curlRequest{
+		method: *method, head: *head, headers: headers, data: data, dataBinary: dataBinary,
+		userAgent: *userAgent, user: *user, include: *include || *head, output: *output,
+		verbose: *verbose, fail: *fail, writeOut: *writeOut,
+	})
+	if err != nil && *silent && !*showError {
+		return quiet(err)
+	}
+	return err
+}
+
+// curlRequest curl子命令的参数
+type curlRequest struct {
+	method     string
+	head       bool
+	headers    []string
+	data       []string
+	dataBinary []string
+	userAgent  string
+	user       string
+	include    bool
+	output     string
+	verbose    bool
+	fail       bool
+	writeOut   string
+}
+
+// curl 执行curl子命令
+func (c *cli) curl(ctx context.Context, target string, g *gatewayFlags, r *curlRequest) error {
+	if target == "" {
+		return usageErrorf("未指定URL")
+	}
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+	format, err := c.curlWriteOutFormat(r.writeOut)
+	if err != nil {
+		return err
+	}
+	req, err := c.newCurlRequest(target, r)
+	if err != nil {
+		return err
+	}
+	if f, ok := req.Body.(io.Closer); ok {
+		defer f.Close()
+	}
+	closer, err := g.setup()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	payload, size, err := req.Reader()
+	if err != nil {
+		return usageErrorf("构造请求失败: %v", err)
+	}
+	sentHead := &headCapture{}
+	payload = io.TeeReader(payload, sentHead)
+
+	stats := &curlStats{url: target, start: time.Now(), uploaded: size}
+	defer func() {
+		if format != "" && stats.resp != nil {
+			io.WriteString(c.stdout, stats.expand(format))
+		}
+	}()
+
+	tc, err := g.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer tc.Close()
+	stats.handshake = time.Now()
+	stats.info = tc.ConnectionInfo()
+	if _, _, err := tc.SendInit(); err != nil {
+		return withExitCode(exitGateway, err)
+	}
+	stats.init = time.Now()
+
+	reqCtx, cancel := g.requestContext(ctx)
+	defer cancel()
+	resp, err := tc.SendTransferStream(reqCtx, payload)
+	if err != nil {
+		return requestError(reqCtx, err)
+	}
+	defer resp.Close()
+	stats.pretransfer = time.Now()
+	if r.verbose {
+		writePrefixed(c.stderr, "> ", sentHead.head())
+	}
+
+	br := bufio.NewReader(&firstByteReader{r: resp, at: &stats.starttransfer})
+	httpResp, rawHead, err := readCurlResponse(br, req.Method, c.curlHeadWriter(r))
+	if err != nil {
+		return requestError(reqCtx, fmt.Errorf("解析HTTP响应失败: %v", err))
+	}
+	defer httpResp.Body.Close()
+	stats.resp = httpResp
+	stats.headerSize = int64(len(rawHead))
+
+	if r.fail && httpResp.StatusCode >= 400 {
+		stats.total = time.Now()
+		return withExitCode(exitHTTP, fmt.Errorf("HTTP状态码 %d", httpResp.StatusCode))
+	}
+
+	out, err := c.createOutput(r.output)
+	if err != nil {
+		return err
+	}
+	if r.include {
+		out.Write(rawHead)
+	}
+	n, err := io.Copy(out, httpResp.Body)
+	stats.downloaded = n
+	stats.total = time.Now()
+	if closeErr := out.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("写入响应失败: %v", closeErr)
+	}
+	if err != nil {
+		return requestError(reqCtx, err)
+	}
+	return nil
+}
+
+// newCurlRequest 按参数构造请求
+func (c *cli) newCurlRequest(target string, r *curlRequest) (*client.HTTPRequest, error) {
+	if len(r.data) > 0 && len(r.dataBinary) > 0 {
+		return nil, usageErrorf("-d和-data-binary不能同时使用")
+	}
+	var body io.Reader
+	var bodyLen int64
+	var form bool
+	switch {
+	case len(r.data) > 0:
+		var parts []string
+		for _, d := range r.data {
+			value, err := c.readCurlData(d)
+			if err != nil {
+				return nil, err
+			}
+			// -d读取文件时去掉换行，与curl一致
+			parts = append(parts, strings.NewReplacer("\r", "", "\n", "").Replace(string(value)))
+		}
+		joined := strings.Join(parts, "&")
+		body, bodyLen, form = strings.NewReader(joined), int64(len(joined)), true
+	case len(r.dataBinary) == 1 && strings.HasPrefix(r.dataBinary[0], "@") && r.dataBinary[0] != "@-":
+		// 单个文件按流式发送，不读入内存
+		f, err := os.Open(r.dataBinary[0][1:])
+		if err != nil {
+			return nil, usageErrorf("打开请求体文件失败: %v", err)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, usageErrorf("读取请求体文件失败: %v", err)
+		}
+		body, bodyLen = f, info.Size()
+	case len(r.dataBinary) > 0:
+		var buf bytes.Buffer
+		for i, d := range r.dataBinary {
+			value, err := c.readCurlData(d)
+			if err != nil {
+				return nil, err
+			}
+			if i > 0 {
+				buf.WriteByte('&')
+			}
+			buf.Write(value)
+		}
+		body, bodyLen = &buf, int64(buf.Len())
+	}
+
+	method := r.method
+	switch {
+	case method != "":
+	case r.head:
+		method = http.MethodHead
+	case body != nil:
+		method = http.MethodPost
+	default:
+		method = http.MethodGet
+	}
+	req, err := client.NewHTTPRequest(method, target, body)
+	if err != nil {
+		return nil, usageErrorf("%v", err)
+	}
+	if body != nil {
+		req.ContentLength = bodyLen
+	}
+	if r.userAgent != "" {
+		req.Header.Set("User-Agent", r.userAgent)
+	}
+	req.Header.Set("Accept", "*/*")
+	if form {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if r.user != "" {
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(r.user)))
+	}
+	// -H指定的请求头替换同名的默认请求头，值为空时删除该请求头
+	custom := make(http.Header)
+	for _, h := range r.headers {
+		name, value, _ := strings.Cut(h, ":")
+		name = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+		if value = strings.TrimSpace(value); value == "" {
+			req.Header.Del(name)
+			delete(custom, name)
+			if name == "Host" {
+				req.Host = ""
+			}
+			continue
+		}
+		custom.Add(name, value)
+	}
+	for name, values := range custom {
+		req.Header[name] = values
+	}
+	return req, nil
+}
+
+// readCurlData 读取-d和-data-binary的值，@开头时读取文件，@-读取标准输入
+func (c *cli) readCurlData(s string) ([]byte, error) {
+	if !strings.HasPrefix(s, "@") {
+		return []byte(s), nil
+	}
+	if s == "@-" {
+		data, err := io.ReadAll(c.stdin)
+		if err != nil {
+			return nil, fmt.Errorf("读取标准输入失败: %v", err)
+		}
+		return data, nil
+	}
+	data, err := os.ReadFile(s[1:])
+	if err != nil {
+		return nil, usageErrorf("读取请求体文件失败: %v", err)
+	}
+	return data, nil
+}
+
+// curlHeadWriter 返回输出响应头的目标，-v时写入标准错误
+func (c *cli) curlHeadWriter(r *curlRequest) io.Writer {
+	if !r.verbose {
+		return io.Discard
+	}
+	return writerFunc(func(p []byte) (int, error) {
+		writePrefixed(c.stderr, "< ", bytes.TrimSuffix(p, []byte("\r\n\r\n")))
+		return len(p), nil
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+// writePrefixed 按行输出head，每行加上prefix
+func writePrefixed(w io.Writer, prefix string, head []byte) {
+	for _, line := range strings.Split(string(head), "\r\n") {
+		fmt.Fprintf(w, "%s%s\n", prefix, line)
+	}
+}
+
+// readCurlResponse 读取响应头并解析响应，跳过1xx的临时响应
+// 返回最终响应的原始响应头，每个响应头（包括临时响应）都写入verbose
+func readCurlResponse(br *bufio.Reader, method string, verbose io.Writer) (*http.Response, []byte, error) {
+	for {
+		var head bytes.Buffer
+		for {
+			line, err := br.ReadSlice('\n')
+			head.Write(line)
+			if err != nil {
+				if err == bufio.ErrBufferFull {
+					continue
+				}
+				return nil, nil, err
+			}
+			if len(line) <= 2 && strings.TrimRight(string(line), "\r\n") == "" {
+				break
+			}
+		}
+		verbose.Write(head.Bytes())
+
+		raw := head.Bytes()
+		resp, err := http.ReadResponse(bufio.NewReader(io.MultiReader(bytes.NewReader(raw), br)), &http.Request{Method: method})
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp.StatusCode >= 200 || resp.StatusCode == http.StatusSwitchingProtocols {
+			return resp, raw, nil
+		}
+	}
+}
+
+// headCapture 记录写入数据中第一个空行之前的部分，即请求行和请求头
+type headCapture struct {
+	buf  bytes.Buffer
+	done bool
+}
+
+func (h *headCapture) Write(p []byte) (int, error) {
+	if !h.done {
+		h.buf.Write(p)
+		if i := bytes.Index(h.buf.Bytes(), []byte("\r\n\r\n")); i >= 0 {
+			h.buf.Truncate(i)
+			h.done = true
+		}
+	}
+	return len(p), nil
+}
+
+// head 返回请求行和请求头，不含结尾的空行
+func (h *headCapture) head() []byte {
+	return h.buf.Bytes()
+}
+
+// firstByteReader 记录第一次读到数据的时间
+type firstByteReader struct {
+	r  io.Reader
+	at *time.Time
+}
+
+func (f *firstByteReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if n > 0 && f.at.IsZero() {
+		*f.at = time.Now()
+	}
+	return n, err
+}
+
+// curlStats -w输出的变量
+type curlStats struct {
+	url                                 string
+	info                                *client.ConnectionInfo
+	resp                                *http.Response
+	start, handshake, init, pretransfer time.Time
+	starttransfer, total                time.Time
+	uploaded, downloaded, headerSize    int64
+}
+
+// curlVariables -w支持的变量
+var curlVariables = map[string]struct {
+	desc  string
+	value func(s *curlStats) string
+}{
+	"http_code":          {"HTTP响应状态码", func(s *curlStats) string { return strconv.Itoa(s.resp.StatusCode) }},
+	"response_code":      {"同http_code", func(s *curlStats) string { return strconv.Itoa(s.resp.StatusCode) }},
+	"http_version":       {"响应的HTTP版本，如1.1", func(s *curlStats) string { return fmt.Sprintf("%d.%d", s.resp.ProtoMajor, s.resp.ProtoMinor) }},
+	"content_type":       {"响应的Content-Type", func(s *curlStats) string { return s.resp.Header.Get("Content-Type") }},
+	"size_download":      {"响应体字节数", func(s *curlStats) string { return strconv.FormatInt(s.downloaded, 10) }},
+	"size_header":        {"响应头字节数", func(s *curlStats) string { return strconv.FormatInt(s.headerSize, 10) }},
+	"size_upload":        {"请求字节数，包括请求行和请求头", func(s *curlStats) string { return strconv.FormatInt(s.uploaded, 10) }},
+	"time_handshake":     {"QUIC和TLS握手完成的时间", func(s *curlStats) string { return s.since(s.handshake) }},
+	"time_connect":       {"同time_handshake", func(s *curlStats) string { return s.since(s.handshake) }},
+	"time_appconnect":    {"同time_handshake", func(s *curlStats) string { return s.since(s.handshake) }},
+	"time_init":          {"网关INIT完成的时间", func(s *curlStats) string { return s.since(s.init) }},
+	"time_pretransfer":   {"请求发送完成的时间", func(s *curlStats) string { return s.since(s.pretransfer) }},
+	"time_starttransfer": {"收到第一个响应字节的时间", func(s *curlStats) string { return s.since(s.starttransfer) }},
+	"time_ttfb":          {"同time_starttransfer", func(s *curlStats) string { return s.since(s.starttransfer) }},
+	"time_total":         {"总耗时", func(s *curlStats) string { return s.since(s.total) }},
+	"remote_ip":          {"网关IP", func(s *curlStats) string { return s.addr(true, true) }},
+	"remote_port":        {"网关端口", func(s *curlStats) string { return s.addr(true, false) }},
+	"local_ip":           {"本地IP", func(s *curlStats) string { return s.addr(false, true) }},
+	"local_port":         {"本地端口", func(s *curlStats) string { return s.addr(false, false) }},
+	"alpn":               {"协商的ALPN协议", func(s *curlStats) string { return s.alpn() }},
+	"url_effective":      {"请求的URL", func(s *curlStats) string { return s.url }},
+}
+
+// since 返回从开始到t的秒数，与curl相同保留6位小数，t未记录时为0
+func (s *curlStats) since(t time.Time) string {
+	if t.IsZero() {
+		return "0.000000"
+	}
+	return strconv.FormatFloat(t.Sub(s.start).Seconds(), 'f', 6, 64)
+}
+
+// addr 返回网关（remote为true）或本地地址中的IP或端口，未建立连接时为空
+func (s *curlStats) addr(remote, ip bool) string {
+	if s.info == nil {
+		return ""
+	}
+	addr := s.info.LocalAddr
+	if remote {
+		addr = s.info.RemoteAddr
+	}
+	if addr == nil {
+		return ""
+	}
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return ""
+	}
+	if ip {
+		return host
+	}
+	return port
+}
+
+// alpn 返回协商的ALPN协议，未建立连接时为空
+func (s *curlStats) alpn() string {
+	if s.info == nil {
+		return ""
+	}
+	return s.info.ALPN
+}
+
+// expand 替换格式中的%{变量}，%%输出为%，格式已由curlWriteOutFormat检查
+func (s *curlStats) expand(format string) string {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(format, '%')
+		if i < 0 || i == len(format)-1 {
+			b.WriteString(format)
+			return b.String()
+		}
+		b.WriteString(format[:i])
+		switch format[i+1] {
+		case '%':
+			b.WriteByte('%')
+			format = format[i+2:]
+		case '{':
+			end := strings.IndexByte(format[i:], '}')
+			b.WriteString(curlVariables[format[i+2:i+end]].value(s))
+			format = format[i+end+1:]
+		default:
+			b.WriteByte('%')
+			format = format[i+1:]
+		}
+	}
+}
+
+// curlWriteOutFormat 读取-w的格式，处理转义字符并检查变量名，%%保留到expand时处理
+func (c *cli) curlWriteOutFormat(s string) (string, error) {
+	if strings.HasPrefix(s, "@") {
+		data, err := c.readCurlData(s)
+		if err != nil {
+			return "", err
+		}
+		s = string(data)
+	}
+	s = strings.NewReplacer(`\n`, "\n", `\r`, "\r", `\t`, "\t", `\\`, `\`).Replace(s)
+	for rest := s; ; {
+		i := strings.IndexByte(rest, '%')
+		if i < 0 || i == len(rest)-1 {
+			break
+		}
+		switch rest[i+1] {
+		case '%':
+			// %%为字面量%，%%{http_code}输出%{http_code}
+			rest = rest[i+2:]
+			continue
+		case '{':
+		default:
+			rest = rest[i+1:]
+			continue
+		}
+		end := strings.IndexByte(rest[i:], '}')
+		if end < 0 {
+			return "", usageErrorf("-w格式错误，缺少}: %s", rest[i:])
+		}
+		if _, ok := curlVariables[rest[i+2:i+end]]; !ok {
+			return "", usageErrorf("-w中不支持的变量: %s", rest[i:i+end+1])
+		}
+		rest = rest[i+end+1:]
+	}
+	return s, nil
+}
+
+// curlVariablesUsage 输出-w支持的变量
+func (c *cli) curlVariablesUsage() {
+	names := make([]string, 0, len(curlVariables))
+	for name := range curlVariables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(c.stderr, "\n-w支持的变量（时间为从开始运行起的秒数）:\n")
+	for _, name := range names {
+		fmt.Fprintf(c.stderr, "  %%{%-20s %s\n", name+"}", curlVariables[name].desc)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/laotiannai/quic_gwclient/proto"
+)
+
+func TestNewCurlRequest(t *testing.T) {
+	dir := t.TempDir()
+	formFile := filepath.Join(dir, "form.txt")
+	if err := os.WriteFile(formFile, []byte("b=2\r\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	binFile := filepath.Join(dir, "body.bin")
+	if err := os.WriteFile(binFile, []byte("line1\r\nline2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		url   string
+		stdin string
+		r     curlRequest
+		want  string
+	}{
+		{
+			name: "get",
+			url:  "http://backend:8080/path?q=1",
+			r:    curlRequest{userAgent: curlUserAgent},
+			want: "GET /path?q=1 HTTP/1.1\r\nHost: backend:8080\r\nAccept: */*\r\nUser-Agent: quic_gwclient\r\n\r\n",
+		},
+		{
+			name: "form data",
+			url:  "http://backend/form",
+			r:    curlRequest{data: []string{"a=1", "@" + formFile}},
+			want: "POST /form HTTP/1.1\r\nHost: backend\r\nAccept: */*\r\nContent-Length: 7\r\nContent-Type: application/x-www-form-urlencoded\r\n\r\na=1&b=2",
+		},
+		{
+			name: "binary file",
+			url:  "http://backend/upload",
+			r:    curlRequest{method: "PUT", dataBinary: []string{"@" + binFile}, headers: []string{"Content-Type: application/octet-stream"}},
+			want: "PUT /upload HTTP/1.1\r\nHost: backend\r\nAccept: */*\r\nContent-Length: 13\r\nContent-Type: application/octet-stream\r\n\r\nline1\r\nline2\n",
+		},
+		{
+			name:  "binary stdin",
+			url:   "http://backend/upload",
+			stdin: "raw\r\n",
+			r:     curlRequest{dataBinary: []string{"@-"}},
+			want:  "POST /upload HTTP/1.1\r\nHost: backend\r\nAccept: */*\r\nContent-Length: 5\r\n\r\nraw\r\n",
+		},
+		{
+			name: "headers override and remove defaults",
+			url:  "http://backend/",
+			r: curlRequest{head: true, userAgent: curlUserAgent, user: "alice:secret",
+				headers: []string{"Accept: text/html", "User-Agent:", "X-Trace: 1", "x-trace: 2"}},
+			want: "HEAD / HTTP/1.1\r\nHost: backend\r\nAccept: text/html\r\nAuthorization: Basic YWxpY2U6c2VjcmV0\r\nX-Trace: 1\r\nX-Trace: 2\r\n\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &cli{stdin: strings.NewReader(tt.stdin)}
+			req, err := c.newCurlRequest(tt.url, &tt.r)
+			if err != nil {
+				t.Fatalf("newCurlRequest failed: %v", err)
+			}
+			if got := req.String(); got != tt.want {
+				t.Errorf("Request = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	c := &cli{}
+	if _, err := c.newCurlRequest("http://backend/", &curlRequest{data: []string{"a"}, dataBinary: []string{"b"}}); exitCode(err) != exitUsage {
+		t.Errorf("Expected usage error for -d with -data-binary, got %v", err)
+	}
+}
+
+func TestCurlWriteOutFormat(t *testing.T) {
+	c := &cli{}
+	format, err := c.curlWriteOutFormat(`%{http_code}\t%{time_total}\n100%%`)
+	if err != nil {
+		t.Fatalf("curlWriteOutFormat failed: %v", err)
+	}
+	if format != "%{http_code}\t%{time_total}\n100%%" {
+		t.Errorf("Format = %q", format)
+	}
+
+	// %%{...}是字面量，不展开变量；未建立连接时地址和ALPN为空
+	format, err = c.curlWriteOutFormat(`%%{http_code} %{http_code} %{alpn}|%{remote_ip}|50% %`)
+	if err != nil {
+		t.Fatalf("curlWriteOutFormat failed: %v", err)
+	}
+	stats := &curlStats{resp: &http.Response{StatusCode: 200}}
+	if got := stats.expand(format); got != "%{http_code} 200 ||50% %" {
+		t.Errorf("Expanded = %q", got)
+	}
+	for _, bad := range []string{"%{unknown}", "%{http_code", "%%%{unknown}"} {
+		if _, err := c.curlWriteOutFormat(bad); exitCode(err) != exitUsage {
+			t.Errorf("Expected usage error for %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestCLI_Curl(t *testing.T) {
+	response := "HTTP/1.1 100 Continue\r\n\r\n" +
+		"HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n"
+	addr := startTestGateway(t, newTestRecording(proto.AUTH_STATUS_CODE_SUCCESS, response))
+
+	args := append([]string{"curl"}, gatewayArgs(addr)...)
+	args = append(args, "-i", "-v", "-w", `\n%{http_code} %{size_download} %{content_type} %{remote_ip}\n%{time_handshake} %{time_init} %{time_ttfb} %{time_total}`, "backend/hello")
+	code, stdout, stderr := runCLI(t, "", args...)
+	if code != exitOK {
+		t.Fatalf("Exit code = %d, stderr: %s", code, stderr)
+	}
+
+	head, rest, ok := strings.Cut(stdout, "\r\n\r\n")
+	if !ok || !strings.HasPrefix(head, "HTTP/1.1 200 OK\r\n") || !strings.Contains(head, "Transfer-Encoding: chunked") {
+		t.Fatalf("Unexpected response head in %q", stdout)
+	}
+	// 响应体按chunked编码解码
+	body, writeOut, _ := strings.Cut(rest, "\n")
+	if body != "hello world" {
+		t.Errorf("Body = %q, want %q", body, "hello world")
+	}
+	if !regexp.MustCompile(`^200 11 text/plain 127\.0\.0\.1\n(\d+\.\d{6} ){3}\d+\.\d{6}$`).MatchString(writeOut) {
+		t.Errorf("Unexpected write-out %q", writeOut)
+	}
+	for _, want := range []string{"> GET /hello HTTP/1.1", "> Host: backend", "< HTTP/1.1 100 Continue", "< HTTP/1.1 200 OK"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("Verbose output does not contain %q:\n%s", want, stderr)
+		}
+	}
+}
+
+func TestCLI_CurlFail(t *testing.T) {
+	response := "HTTP/1.1 503 Service Unavailable\r\nContent-Length: 4\r\n\r\nbusy"
+	addr := startTestGateway(t, newTestRecording(proto.AUTH_STATUS_CODE_SUCCESS, response))
+
+	args := append([]string{"curl"}, gatewayArgs(addr)...)
+	code, stdout, stderr := runCLI(t, "", append(args, "-f", "-s", "-w", "%{http_code}", "http://backend/")...)
+	if code != exitHTTP {
+		t.Errorf("Exit code = %d, want %d", code, exitHTTP)
+	}
+	// -f时不输出响应体，-s时不输出错误信息
+	if stdout != "503" || stderr != "" {
+		t.Errorf("Stdout = %q, stderr = %q", stdout, stderr)
+	}
+}
+
+func TestCLI_CurlHead(t *testing.T) {
+	response := "HTTP/1.1 200 OK\r\nContent-Length: 1024\r\n\r\n"
+	addr := startTestGateway(t, newTestRecording(proto.AUTH_STATUS_CODE_SUCCESS, response))
+	output := filepath.Join(t.TempDir(), "head.txt")
+
+	args := append([]string{"curl"}, gatewayArgs(addr)...)
+	code, _, stderr := runCLI(t, "", append(args, "-I", "-o", output, "http://backend/large.bin")...)
+	if code != exitOK {
+		t.Fatalf("Exit code = %d, stderr: %s", code, stderr)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != response {
+		t.Errorf("Output = %q, want %q", data, response)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/laotiannai/quic_gwclient/pkg/client"
+)
+
+// runForward 在本地监听TCP端口，通过网关转发收到的HTTP请求，直到收到中断信号
+func (c *cli) runForward(ctx context.Context, args []string) error {
+	fs := c.newFlagSet("forward")
+	g := addGatewayFlags(fs, c.stderr)
+	listen := fs.String("listen", "127.0.0.1:8080", "本地监听地址")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	closer, err := g.setup()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return usageErrorf("监听失败: %v", err)
+	}
+	fmt.Fprintf(c.stderr, "正在监听 %s，通过网关 %s 转发\n", ln.Addr(), g.addr)
+
+	var wg sync.WaitGroup
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.forwardConn(ctx, g, conn)
+		}()
+	}
+	wg.Wait()
+	// 中断是forward的正常结束方式
+	return nil
+}
+
+// forwardConn 为一个TCP连接建立独立的网关客户端，依次转发连接上的请求
+func (c *cli) forwardConn(ctx context.Context, g *gatewayFlags, conn net.Conn) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	tc, err := g.open(ctx)
+	if err != nil {
+		g.config.Logger.Warn("转发失败", "client", conn.RemoteAddr(), "error", err)
+		writeBadGateway(conn, err)
+		return
+	}
+	defer tc.Close()
+
+	br := bufio.NewReader(conn)
+	for {
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				g.config.Logger.Warn("读取请求失败", "client", conn.RemoteAddr(), "error", err)
+			}
+			return
+		}
+		if err := c.forwardRequest(ctx, g, tc, req, conn); err != nil {
+			g.config.Logger.Warn("转发失败", "client", conn.RemoteAddr(), "method", req.Method, "uri", req.RequestURI, "error", err)
+			return
+		}
+		if req.Close {
+			return
+		}
+	}
+}
+
+// forwardRequest 通过网关发送一个请求并将响应原样写回conn
+// 网关返回响应之前失败时向客户端返回502，之后失败时只能关闭连接
+func (c *cli) forwardRequest(ctx context.Context, g *gatewayFlags, tc *client.TransferClient, req *http.Request, conn net.Conn) error {
+	// 客户端没有User-Agent时保持没有，避免Request.Write填充Go的默认值
+	if _, ok := req.Header["User-Agent"]; !ok {
+		req.Header["User-Agent"] = []string{""}
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(req.Write(pw))
+	}()
+	defer pr.Close()
+
+	reqCtx, cancel := g.requestContext(ctx)
+	defer cancel()
+	resp, err := tc.SendTransferStream(reqCtx, pr)
+	if err != nil {
+		writeBadGateway(conn, err)
+		return err
+	}
+	defer resp.Close()
+	if _, err := io.Copy(conn, resp); err != nil {
+		return err
+	}
+	return nil
+}
+
+// writeBadGateway 向客户端返回502，响应体为错误信息
+func writeBadGateway(w io.Writer, err error) {
+	body := err.Error() + "\n"
+	fmt.Fprintf(w, "HTTP/1.1 502 Bad Gateway\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s", len(body), body)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+)
+
+// runInit 连接网关并完成INIT，输出连接信息
+func (c *cli) runInit(ctx context.Context, args []string) error {
+	fs := c.newFlagSet("init")
+	g := addGatewayFlags(fs, c.stderr)
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	closer, err := g.setup()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	start := time.Now()
+	tc, err := g.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer tc.Close()
+	connected := time.Now()
+	sent, received, err := tc.SendInit()
+	if err != nil {
+		return withExitCode(exitGateway, err)
+	}
+	initDone := time.Now()
+
+	info := tc.ConnectionInfo()
+	if info == nil {
+		return fmt.Errorf("连接已关闭")
+	}
+	fmt.Fprintf(c.stdout, "网关:       %s（本地 %s）\n", info.RemoteAddr, info.LocalAddr)
+	fmt.Fprintf(c.stdout, "ALPN:       %s\n", info.ALPN)
+	fmt.Fprintf(c.stdout, "TLS:        %s %s\n", tls.VersionName(info.TLSVersion), tls.CipherSuiteName(info.CipherSuite))
+	fmt.Fprintf(c.stdout, "会话恢复:   %v（0-RTT: %v）\n", info.Resumed, info.Used0RTT)
+	fmt.Fprintf(c.stdout, "握手次数:   %d\n", info.Attempts)
+	fmt.Fprintf(c.stdout, "会话ID:     %s\n", g.config.SessionID)
+	fmt.Fprintf(c.stdout, "加密会话:   %v\n", g.config.EnableAES)
+	fmt.Fprintf(c.stdout, "连接耗时:   %v\n", connected.Sub(start).Round(time.Microsecond))
+	fmt.Fprintf(c.stdout, "INIT耗时:   %v（发送 %d 字节，接收 %d 字节）\n", initDone.Sub(connected).Round(time.Microsecond), sent, received)
+	return nil
+}
+
+// runPing 重复建立新连接并完成INIT，统计耗时
+func (c *cli) runPing(ctx context.Context, args []string) error {
+	fs := c.newFlagSet("ping")
+	g := addGatewayFlags(fs, c.stderr)
+	count := fs.Int("c", 4, "次数，0表示直到中断")
+	interval := fs.Duration("i", time.Second, "两次之间的间隔")
+	noInit := fs.Bool("no-init", false, "只建立QUIC连接，不发送INIT")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	closer, err := g.setup()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	// 每次只尝试一次，失败计入统计
+	g.config.MaxRetries = 1
+
+	var ok int
+	var fastest, slowest, total time.Duration
+	seq := 0
+	for ; *count == 0 || seq < *count; seq++ {
+		if seq > 0 {
+			select {
+			case <-time.After(*interval):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		elapsed, line, err := ping(ctx, g, !*noInit)
+		if err != nil {
+			fmt.Fprintf(c.stdout, "seq=%d 失败: %v\n", seq+1, err)
+			continue
+		}
+		fmt.Fprintf(c.stdout, "seq=%d %s\n", seq+1, line)
+		ok++
+		total += elapsed
+		if ok == 1 || elapsed < fastest {
+			fastest = elapsed
+		}
+		if elapsed > slowest {
+			slowest = elapsed
+		}
+	}
+
+	fmt.Fprintf(c.stdout, "\n--- %s ---\n%d 次，成功 %d 次，失败 %d 次\n", g.addr, seq, ok, seq-ok)
+	if ok > 0 {
+		fmt.Fprintf(c.stdout, "耗时 最小/平均/最大 = %v/%v/%v\n",
+			fastest.Round(time.Microsecond), (total / time.Duration(ok)).Round(time.Microsecond), slowest.Round(time.Microsecond))
+	}
+	if ok == 0 && seq > 0 {
+		return withExitCode(exitConnect, fmt.Errorf("全部失败"))
+	}
+	return nil
+}
+
+// ping 建立一次连接，返回总耗时和输出的一行结果
+func ping(ctx context.Context, g *gatewayFlags, init bool) (time.Duration, string, error) {
+	start := time.Now()
+	tc, err := g.connect(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+	defer tc.Close()
+	connected := time.Now()
+	info := tc.ConnectionInfo()
+	if info == nil {
+		return 0, "", fmt.Errorf("连接已关闭")
+	}
+	line := fmt.Sprintf("remote=%s alpn=%s connect=%v", info.RemoteAddr, info.ALPN, connected.Sub(start).Round(time.Microsecond))
+	if !init {
+		return connected.Sub(start), line, nil
+	}
+
+	if _, _, err := tc.SendInit(); err != nil {
+		return 0, "", err
+	}
+	done := time.Now()
+	line += fmt.Sprintf(" init=%v", done.Sub(connected).Round(time.Microsecond))
+	return done.Sub(start), line, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/pkg/loadtest"
+)
+
+// runLoadtest 按指定的并发或速率持续发送请求，输出耗时分布、吞吐量和失败统计
+func (c *cli) runLoadtest(ctx context.Context, args []string) error {
+	defaults := loadtest.DefaultOptions()
+	fs := c.newFlagSet("loadtest")
+	g := addGatewayFlags(fs, c.stderr)
+	mixPath := fs.String("mix", "", "YAML格式的请求组合文件，按权重发送多种请求，每种请求可以有独立的断言")
+	url := fs.String("url", "", "发送GET请求的URL，不使用请求文件")
+	escaped := fs.Bool("escaped-crlf", false, "将请求文件中的字面量\\r\\n替换为CRLF，配置中legacy_escaped_crlf为true时同样替换")
+	concurrency := fs.Int("c", defaults.Concurrency, "并发数，即同时使用的连接数")
+	rate := fs.Float64("rate", 0, "每秒发出的请求数，0表示每个并发在上一个请求完成后立即发送下一个")
+	duration := fs.Duration("d", defaults.Duration, "持续时间，0表示只受-n限制")
+	requests := fs.Int("n", 0, "最多发送的请求数，0表示只受-d限制")
+	rampUp := fs.Duration("ramp-up", 0, "预热时间，在这段时间内逐个启动并发，或将速率从0线性增加到-rate")
+	assertStatus := fs.Int("assert-status", 0, "期望的HTTP响应状态码，不符时计为失败，不使用-mix时有效")
+	assertContains := fs.String("assert-contains", "", "响应中必须包含的内容，不使用-mix时有效")
+	maxLatency := fs.Duration("max-latency", 0, "单个请求的最大允许耗时，超过时计为失败，不使用-mix时有效")
+	jsonPath := fs.String("json", "", "将JSON格式的报告写入文件，-表示标准输出")
+	csvPath := fs.String("csv", "", "将CSV格式的报告写入文件，-表示标准输出")
+	progress := fs.Duration("progress", time.Second, "在标准错误输出进度的间隔，0表示不输出")
+	maxErrorRate := fs.Float64("max-error-rate", 1, "允许的失败比例，超过时以退出码1退出")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	closer, err := g.setup()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	var mix []*loadtest.Request
+	assert := loadtest.Assertion{Status: *assertStatus, Contains: *assertContains, MaxLatency: *maxLatency}
+	switch {
+	case *mixPath != "" && (*url != "" || fs.NArg() > 0):
+		return usageErrorf("-mix不能与-url或请求文件同时使用")
+	case *url != "" && fs.NArg() > 0:
+		return usageErrorf("-url不能与请求文件同时使用")
+	case *mixPath != "":
+		if mix, err = loadtest.LoadMix(*mixPath); err != nil {
+			return withExitCode(exitUsage, err)
+		}
+	case *url != "":
+		mix = []*loadtest.Request{{URL: *url, Assert: assert}}
+	default:
+		body, err := c.openRequest(fs.Arg(0), *escaped || g.config.LegacyEscapedCRLF)
+		if err != nil {
+			return err
+		}
+		payload, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return fmt.Errorf("读取请求失败: %v", err)
+		}
+		mix = []*loadtest.Request{{Name: "request", Payload: string(payload), Assert: assert}}
+	}
+
+	opts := &loadtest.Options{
+		Concurrency: *concurrency,
+		Rate:        *rate,
+		Duration:    *duration,
+		Requests:    *requests,
+		RampUp:      *rampUp,
+		Timeout:     g.timeout,
+	}
+	if *progress > 0 {
+		opts.ProgressInterval = *progress
+		opts.Progress = func(p *loadtest.Progress) {
+			fmt.Fprintf(c.stderr, "%v: 完成 %d，失败 %d，进行中 %d\n", p.Elapsed.Round(time.Second), p.Completed, p.Failed, p.InFlight)
+		}
+	}
+	// 每个连接只尝试一次，超时为-connect-timeout，失败计入报告
+	base := loadtest.ClientDialer(g.addr, g.config)
+	dial := func(ctx context.Context) (loadtest.Sender, error) {
+		ctx, cancel := context.WithTimeout(ctx, g.connectTimeout)
+		defer cancel()
+		return base(ctx)
+	}
+
+	report, err := loadtest.Run(ctx, dial, mix, opts)
+	if err != nil {
+		return withExitCode(exitUsage, err)
+	}
+
+	// JSON或CSV报告写入标准输出时，可读的报告改为写入标准错误
+	text := c.stdout
+	if *jsonPath == "-" || *csvPath == "-" {
+		text = c.stderr
+	}
+	if err := report.WriteText(text); err != nil {
+		return fmt.Errorf("输出报告失败: %v", err)
+	}
+	for _, out := range []struct {
+		path  string
+		write func(io.Writer) error
+	}{
+		{*jsonPath, report.WriteJSON},
+		{*csvPath, report.WriteCSV},
+	} {
+		if out.path == "" {
+			continue
+		}
+		w, err := c.createOutput(out.path)
+		if err != nil {
+			return err
+		}
+		err = out.write(w)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("写入报告失败: %v", err)
+		}
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		// 中断时已输出已完成请求的报告
+		return nil
+	case report.Requests > 0 && report.Errors[loadtest.ErrConnect] == report.Requests:
+		return withExitCode(exitConnect, fmt.Errorf("全部请求连接网关失败"))
+	case report.ErrorRate() > *maxErrorRate:
+		return withExitCode(exitFailure, fmt.Errorf("失败比例 %.2f%% 超过 %.2f%%", report.ErrorRate()*100, *maxErrorRate*100))
+	}
+	return nil
+}
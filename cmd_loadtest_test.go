@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/laotiannai/quic_gwclient/pkg/replay"
+	"github.com/laotiannai/quic_gwclient/proto"
+)
+
+// newLoadtestRecording 返回在一个连接上依次应答n个请求的录制
+func newLoadtestRecording(response string, n int) *replay.Recording {
+	rec := newTestRecording(proto.AUTH_STATUS_CODE_SUCCESS, response)
+	exchange := rec.Frames[2:]
+	for i := 1; i < n; i++ {
+		rec.Frames = append(rec.Frames, exchange...)
+	}
+	return rec
+}
+
+func TestCLI_Loadtest(t *testing.T) {
+	response := "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"
+	addr := startTestGateway(t, newLoadtestRecording(response, 3))
+
+	args := append([]string{"loadtest"}, gatewayArgs(addr)...)
+	args = append(args, "-c", "1", "-n", "3", "-d", "0", "-progress", "0", "-assert-status", "200", "-assert-contains", "ok", "-json", "-")
+	code, stdout, stderr := runCLI(t, "GET / HTTP/1.1\r\nHost: backend\r\n\r\n", args...)
+	if code != exitOK {
+		t.Fatalf("Exit code = %d, stderr: %s", code, stderr)
+	}
+	var report struct {
+		Requests    int         `json:"requests"`
+		Succeeded   int         `json:"succeeded"`
+		StatusCodes map[int]int `json:"status_codes"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("Invalid JSON report: %v\n%s", err, stdout)
+	}
+	if report.Requests != 3 || report.Succeeded != 3 || report.StatusCodes[200] != 3 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	// JSON写入标准输出时，可读的报告写入标准错误
+	if !strings.Contains(stderr, "请求:     3，成功3，失败0") {
+		t.Errorf("Text report not in stderr:\n%s", stderr)
+	}
+}
+
+func TestCLI_LoadtestMaxErrorRate(t *testing.T) {
+	response := "HTTP/1.1 503 Service Unavailable\r\nContent-Length: 0\r\n\r\n"
+	addr := startTestGateway(t, newLoadtestRecording(response, 2))
+
+	args := append([]string{"loadtest"}, gatewayArgs(addr)...)
+	args = append(args, "-c", "1", "-n", "2", "-d", "0", "-progress", "0", "-assert-status", "200", "-max-error-rate", "0.5", "-url", "backend/")
+	code, stdout, stderr := runCLI(t, "", args...)
+	if code != exitFailure {
+		t.Errorf("Exit code = %d, want %d, stderr: %s", code, exitFailure, stderr)
+	}
+	if !strings.Contains(stdout, "assert_status: 2") || !strings.Contains(stdout, "503: 2") {
+		t.Errorf("Unexpected report:\n%s", stdout)
+	}
+}
+
+func TestCLI_LoadtestUsage(t *testing.T) {
+	args := append([]string{"loadtest"}, gatewayArgs("127.0.0.1:1")...)
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"mix and url", []string{"-mix", "mix.yaml", "-url", "backend/"}},
+		{"url and file", []string{"-url", "backend/", "request.txt"}},
+		{"no concurrency", []string{"-url", "backend/", "-c", "0"}},
+		{"unbounded", []string{"-url", "backend/", "-d", "0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _, stderr := runCLI(t, "", append(args, tt.args...)...); code != exitUsage {
+				t.Errorf("Exit code = %d, want %d, stderr: %s", code, exitUsage, stderr)
+			}
+		})
+	}
+}
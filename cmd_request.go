@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/pkg/client"
+)
+
+// runRequest 发送原始请求并输出响应
+func (c *cli) runRequest(ctx context.Context, args []string) error {
+	fs := c.newFlagSet("request")
+	g := addGatewayFlags(fs, c.stderr)
+	output := fs.String("o", "-", "响应写入的文件，-表示标准输出")
+	escaped := fs.Bool("escaped-crlf", false, "将请求中的字面量\\r\\n替换为CRLF，兼容单行格式的旧版请求文件，配置中legacy_escaped_crlf为true时同样替换")
+	fail := fs.Bool("fail", false, "HTTP响应状态码不小于400时以退出码6退出")
+	stats := fs.Bool("stats", false, "在标准错误输出发送、接收的字节数和耗时")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	closer, err := g.setup()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	body, err := c.openRequest(fs.Arg(0), *escaped || g.config.LegacyEscapedCRLF)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	tc, err := g.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer tc.Close()
+
+	reqCtx, cancel := g.requestContext(ctx)
+	defer cancel()
+	start := time.Now()
+	resp, err := tc.SendTransferStream(reqCtx, body)
+	if err != nil {
+		return requestError(reqCtx, err)
+	}
+	defer resp.Close()
+
+	out, err := c.createOutput(*output)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(resp)
+	status := peekHTTPStatus(br)
+	_, err = io.Copy(out, br)
+	if closeErr := out.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("写入响应失败: %v", closeErr)
+	}
+	if *stats {
+		fmt.Fprintf(c.stderr, "发送 %d 字节，接收 %d 字节，耗时 %v\n", resp.SentBytes(), resp.ReceivedBytes(), time.Since(start).Round(time.Microsecond))
+	}
+	if err != nil {
+		return requestError(reqCtx, err)
+	}
+	if *fail && status >= 400 {
+		return withExitCode(exitHTTP, fmt.Errorf("HTTP状态码 %d", status))
+	}
+	return nil
+}
+
+// runDownload 发送请求并将响应保存为文件
+func (c *cli) runDownload(ctx context.Context, args []string) error {
+	defaults := client.DefaultDownloadOptions()
+	fs := c.newFlagSet("download")
+	g := addGatewayFlags(fs, c.stderr)
+	dir := fs.String("dir", ".", "文件保存的目录")
+	prefix := fs.String("prefix", defaults.FileNamePrefix, "文件名前缀，文件名为<前缀>_<MD5>.bin")
+	output := fs.String("o", "", "保存的文件路径，指定时忽略-dir和-prefix")
+	maxSize := fs.Int64("max-size", defaults.MaxDownloadSize, "最大下载字节数")
+	readTimeout := fs.Duration("read-timeout", defaults.ReadTimeout, "等待响应数据的超时，-timeout更小时使用-timeout")
+	raw := fs.Bool("raw", false, "不识别HTTP响应，保存收到的全部数据")
+	escaped := fs.Bool("escaped-crlf", false, "将请求中的字面量\\r\\n替换为CRLF，兼容单行格式的旧版请求文件，配置中legacy_escaped_crlf为true时同样替换")
+	fail := fs.Bool("fail", false, "HTTP响应状态码不小于400时以退出码6退出")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	closer, err := g.setup()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	body, err := c.openRequest(fs.Arg(0), *escaped || g.config.LegacyEscapedCRLF)
+	if err != nil {
+		return err
+	}
+	content, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return fmt.Errorf("读取请求失败: %v", err)
+	}
+
+	tc, err := g.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer tc.Close()
+
+	opts := client.DefaultDownloadOptions()
+	opts.SaveToFile = true
+	opts.SaveDir = *dir
+	opts.FileNamePrefix = *prefix
+	opts.MaxDownloadSize = *maxSize
+	opts.ReadTimeout = *readTimeout
+	// 下载接口不接受ctx，-timeout作为每次等待响应数据的上限
+	if g.timeout > 0 {
+		opts.ReadTimeout = min(opts.ReadTimeout, g.timeout)
+	}
+	opts.DetectHTTP = !*raw
+	result, err := tc.SendTransferRequestWithDownload(string(content), opts)
+	if err != nil {
+		return err
+	}
+
+	path := result.FilePath
+	if *output != "" {
+		if err := os.Rename(path, *output); err != nil {
+			return fmt.Errorf("移动下载文件失败: %v", err)
+		}
+		path = *output
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("读取下载文件失败: %v", err)
+	}
+	fmt.Fprintf(c.stdout, "已保存到 %s（%d 字节，MD5 %s）\n", path, info.Size(), result.MD5Sum)
+	if h := result.HTTPInfo; h != nil && h.IsHTTP {
+		fmt.Fprintf(c.stdout, "HTTP状态码 %d\n", h.StatusCode)
+		if *fail && h.StatusCode >= 400 {
+			return withExitCode(exitHTTP, fmt.Errorf("HTTP状态码 %d", h.StatusCode))
+		}
+	}
+	return nil
+}
+
+// openRequest 打开请求文件，path为空或-时读取标准输入
+func (c *cli) openRequest(path string, escaped bool) (io.ReadCloser, error) {
+	var r io.ReadCloser
+	if path == "" || path == "-" {
+		r = io.NopCloser(c.stdin)
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, withExitCode(exitUsage, fmt.Errorf("打开请求文件失败: %v", err))
+		}
+		r = f
+	}
+	if !escaped {
+		return r, nil
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("读取请求失败: %v", err)
+	}
+	data = bytes.ReplaceAll(data, []byte(`\r\n`), []byte("\r\n"))
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// createOutput 创建输出文件，path为-时写入标准输出
+func (c *cli) createOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopWriteCloser{c.stdout}, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("创建输出文件失败: %v", err)
+	}
+	return f, nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// peekHTTPStatus 预读响应的状态行，不是HTTP响应时返回0
+func peekHTTPStatus(br *bufio.Reader) int {
+	head, _ := br.Peek(len("HTTP/1.1 200"))
+	fields := strings.Fields(string(head))
+	if len(fields) != 2 || !strings.HasPrefix(fields[0], "HTTP/") {
+		return 0
+	}
+	status, _ := strconv.Atoi(fields[1])
+	return status
+}
+
+// requestError 请求超时时附加超时的退出码
+func requestError(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return withExitCode(exitTimeout, fmt.Errorf("请求超时: %v", err))
+	}
+	return err
+}
@@ -25,6 +25,7 @@ func main() {
 	opts.ConnectTimeout = 30 * time.Second
 	opts.ReadTimeout = 10 * time.Second
 	opts.MaxRetries = 3
+	opts.InsecureSkipVerify = true // 测试网关使用自签名证书
 	opts.MessageContent = "GET /index.html HTTP/1.1\r\n" +
 		"User-Agent: PostmanRuntime/7.26.8\r\n" +
 		"Accept: */*\r\n" +
@@ -65,16 +66,17 @@ func main() {
 		MessageContent: "GET /index.html HTTP/1.1\r\nUser-Agent: PostmanRuntime/7.26.8\r\nAccept: */*\r\nPostman-Token: d2aeeecc-1612-4518-94ef-e882b0767b44\r\nHost: 192.168.247.111:8089\r\nAccept-Encoding: gzip\r\nConnection: close\r\n\r\n",
 	}
 
+	// 网关地址、超时和TLS等连接配置，服务器信息和请求内容取自ipsInfo
+	gateway := client.DefaultRequestOptions()
+	gateway.ServerIP = "10.10.27.129"
+	gateway.ServerPort = "8002"
+	gateway.ConnectTimeout = 30 * time.Second
+	gateway.ReadTimeout = 10 * time.Second
+	gateway.MaxRetries = 3
+	gateway.RootCAFile = "gateway-ca.pem" // 校验网关证书的CA
+
 	// 发送请求
-	result = client.SendQuicRequestFromIPSInfo(
-		"10.10.27.129",
-		"8002",
-		30*time.Second,
-		10*time.Second,
-		3,
-		false,
-		ipsInfo,
-	)
+	result = client.SendQuicRequestWithIPSInfo(gateway, ipsInfo)
 
 	if result.Error != nil {
 		log.Printf("请求失败: %v", result.Error)
@@ -108,15 +110,7 @@ func main() {
 	// 批量处理
 	for i, info := range ipsInfoList {
 		log.Printf("处理第 %d 个请求...", i+1)
-		result = client.SendQuicRequestFromIPSInfo(
-			"10.10.27.129",
-			"8002",
-			30*time.Second,
-			10*time.Second,
-			3,
-			false,
-			info,
-		)
+		result = client.SendQuicRequestWithIPSInfo(gateway, info)
 
 		if result.Error != nil {
 			log.Printf("请求失败: %v", result.Error)
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/laotiannai/quic_gwclient/pkg/client"
+	"github.com/laotiannai/quic_gwclient/utils"
+)
+
+// 环境变量，对应的命令行参数未指定时使用
+const (
+	envGateway    = "QUIC_GW_ADDR"
+	envServerID   = "QUIC_GW_SERVER_ID"
+	envServerName = "QUIC_GW_SERVER_NAME"
+	envSessionID  = "QUIC_GW_SESSION_ID"
+	envProfiles   = "QUIC_GW_PROFILES"
+	envProfile    = "QUIC_GW_PROFILE"
+)
+
+// gatewayFlags 各子命令共用的网关、会话、超时、TLS和日志参数
+type gatewayFlags struct {
+	addr           string
+	serverID       string
+	connectTimeout time.Duration
+	timeout        time.Duration
+	logLevel       string
+	config         *client.Config
+	profilesPath   string
+	profile        string
+	trace          *frameTraceFlags
+	fs             *flag.FlagSet
+	stderr         io.Writer
+}
+
+// addGatewayFlags 注册各子命令共用的命令行参数，日志输出到stderr
+func addGatewayFlags(fs *flag.FlagSet, stderr io.Writer) *gatewayFlags {
+	g := &gatewayFlags{config: &client.Config{}, fs: fs, stderr: stderr}
+	config := g.config
+	// 配置文件
+	fs.StringVar(&g.profilesPath, "profiles", os.Getenv(envProfiles), "配置文件路径，默认取环境变量"+envProfiles+"，都为空时使用"+defaultProfilesPath())
+	fs.StringVar(&g.profile, "profile", os.Getenv(envProfile), "使用配置文件中的配置，默认取环境变量"+envProfile+"，命令行中指定的参数优先于配置")
+	// 网关和会话
+	fs.StringVar(&g.addr, "gateway", os.Getenv(envGateway), "网关地址host:port，默认取环境变量"+envGateway)
+	fs.StringVar(&g.serverID, "server-id", os.Getenv(envServerID), "INIT请求中的ServerID，默认取环境变量"+envServerID)
+	fs.StringVar(&config.ServerName, "server-name", os.Getenv(envServerName), "INIT请求中的ServerName，默认取环境变量"+envServerName)
+	fs.StringVar(&config.SessionID, "session-id", os.Getenv(envSessionID), "会话ID，默认取环境变量"+envSessionID+"，都为空时随机生成")
+	// 超时和重试
+	fs.DurationVar(&g.connectTimeout, "connect-timeout", 10*time.Second, "连接网关的超时，包括全部重试")
+	fs.DurationVar(&g.timeout, "timeout", time.Minute, "单个请求的超时，0表示不限制")
+	fs.IntVar(&config.MaxRetries, "retries", 3, "连接网关的最大尝试次数")
+	fs.DurationVar(&config.RetryInterval, "retry-interval", 2*time.Second, "连接失败后的重试间隔")
+	fs.BoolVar(&config.EnableConnectRetry, "alpn-retry", false, "握手失败时依次尝试其他ALPN协议组合")
+	fs.BoolVar(&config.Enable0RTT, "0rtt", false, "有可用的会话票据时使用0-RTT发送INIT")
+	fs.StringVar(&config.LocalAddr, "local-addr", "", "绑定的本地地址，如192.168.1.10:0")
+	// 加密会话
+	fs.BoolVar(&config.EnableAES, "aes", false, "使用AES加密会话")
+	fs.Func("cipher", "加密会话使用的加密套件："+cipherNames(), func(s string) error {
+		suite, err := utils.ParseCipherSuite(s)
+		if err != nil {
+			return err
+		}
+		config.CipherSuite = suite
+		return nil
+	})
+	fs.BoolVar(&config.EnableReplayProtection, "replay-protection", false, "加密帧携带序号，拒绝重放的帧，需要网关支持")
+	// TLS
+	fs.BoolVar(&config.InsecureSkipVerify, "insecure", false, "跳过网关证书校验，仅用于测试环境")
+	fs.StringVar(&config.RootCAFile, "ca-file", "", "校验网关证书使用的PEM格式根证书")
+	fs.StringVar(&config.ClientCertFile, "cert", "", "双向认证使用的PEM格式客户端证书")
+	fs.StringVar(&config.ClientKeyFile, "key", "", "双向认证使用的PEM格式客户端私钥")
+	fs.StringVar(&config.TLSServerName, "tls-server-name", "", "SNI和证书校验使用的服务器名称")
+	fs.Func("spki-pin", "固定的网关证书公钥指纹（SHA-256，base64编码），可以重复指定", func(s string) error {
+		config.SPKIPins = append(config.SPKIPins, s)
+		return nil
+	})
+	fs.StringVar(&g.logLevel, "log-level", "warn", "输出到标准错误的日志级别：error、warn、info、debug或trace")
+	addQUICFlags(fs, config)
+	g.trace = addFrameTraceFlags(fs)
+	return g
+}
+
+// cipherNames 返回支持的加密套件名称
+func cipherNames() string {
+	var names []string
+	for _, s := range []utils.CipherSuite{utils.CipherLegacyCBC, utils.CipherCBCPKCS7, utils.CipherGCM} {
+		names = append(names, s.String())
+	}
+	return strings.Join(names, "、")
+}
+
+// setup 检查参数并补全配置，返回的io.Closer在退出前关闭
+func (g *gatewayFlags) setup() (io.Closer, error) {
+	if err := g.applyProfile(); err != nil {
+		return nil, usageErrorf("%v", err)
+	}
+	if g.addr == "" {
+		return nil, usageErrorf("未指定网关地址，使用-gateway或环境变量%s", envGateway)
+	}
+	id, err := strconv.Atoi(g.serverID)
+	if err != nil || id <= 0 {
+		return nil, usageErrorf("ServerID必须为正整数，使用-server-id或环境变量%s", envServerID)
+	}
+	g.config.ServerID = id
+	if g.config.ServerName == "" {
+		return nil, usageErrorf("未指定ServerName，使用-server-name或环境变量%s", envServerName)
+	}
+	if g.config.SessionID == "" {
+		g.config.SessionID = uuid.NewString()
+	}
+	if g.config.MaxRetries <= 0 {
+		g.config.MaxRetries = 1
+	}
+
+	var level slog.Level
+	switch strings.ToLower(g.logLevel) {
+	case "trace":
+		level = client.LevelTrace
+	default:
+		if err := level.UnmarshalText([]byte(g.logLevel)); err != nil {
+			return nil, usageErrorf("不支持的日志级别: %s", g.logLevel)
+		}
+	}
+	g.config.Logger = slog.New(slog.NewTextHandler(g.stderr, &slog.HandlerOptions{Level: level}))
+
+	closer, err := g.trace.open(g.config, g.stderr)
+	if err != nil {
+		return nil, usageErrorf("%v", err)
+	}
+	return closer, nil
+}
+
+// defaultProfilesPath 返回默认的配置文件路径
+func defaultProfilesPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return filepath.Join("quic_gwclient", "profiles.yaml")
+	}
+	return filepath.Join(dir, "quic_gwclient", "profiles.yaml")
+}
+
+// applyProfile 加载-profile指定的配置，只填充命令行中没有指定的参数
+// 指定了-profiles而没有-profile时使用文件中的默认配置；配置中的值优先于环境变量
+func (g *gatewayFlags) applyProfile() error {
+	if g.profile == "" && g.profilesPath == "" {
+		return nil
+	}
+	path := g.profilesPath
+	if path == "" {
+		path = defaultProfilesPath()
+	}
+	file, err := client.LoadProfiles(path)
+	if err != nil {
+		return err
+	}
+	p, err := file.Profile(g.profile)
+	if err != nil {
+		return err
+	}
+	pc, err := p.Config()
+	if err != nil {
+		return err
+	}
+
+	set := make(map[string]bool)
+	g.fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	config := g.config
+	override(set, "gateway", &g.addr, p.Gateway)
+	if p.ServerID != 0 {
+		override(set, "server-id", &g.serverID, strconv.Itoa(p.ServerID))
+	}
+	override(set, "server-name", &config.ServerName, pc.ServerName)
+	override(set, "session-id", &config.SessionID, pc.SessionID)
+	override(set, "connect-timeout", &g.connectTimeout, p.ConnectTimeout)
+	override(set, "timeout", &g.timeout, p.ReadTimeout)
+	override(set, "retries", &config.MaxRetries, pc.MaxRetries)
+	override(set, "retry-interval", &config.RetryInterval, pc.RetryInterval)
+	override(set, "alpn-retry", &config.EnableConnectRetry, pc.EnableConnectRetry)
+	override(set, "0rtt", &config.Enable0RTT, pc.Enable0RTT)
+	override(set, "local-addr", &config.LocalAddr, pc.LocalAddr)
+	override(set, "aes", &config.EnableAES, pc.EnableAES)
+	override(set, "cipher", &config.CipherSuite, pc.CipherSuite)
+	override(set, "replay-protection", &config.EnableReplayProtection, pc.EnableReplayProtection)
+	override(set, "insecure", &config.InsecureSkipVerify, pc.InsecureSkipVerify)
+	override(set, "ca-file", &config.RootCAFile, pc.RootCAFile)
+	override(set, "cert", &config.ClientCertFile, pc.ClientCertFile)
+	override(set, "key", &config.ClientKeyFile, pc.ClientKeyFile)
+	override(set, "tls-server-name", &config.TLSServerName, pc.TLSServerName)
+	if !set["spki-pin"] && len(pc.SPKIPins) > 0 {
+		config.SPKIPins = pc.SPKIPins
+	}
+	// 没有对应的命令行参数
+	config.LocalInterface = pc.LocalInterface
+	config.LegacyEscapedCRLF = pc.LegacyEscapedCRLF
+	return nil
+}
+
+// override 命令行中没有指定参数name且配置中的值非零时，用配置中的值替换dst
+func override[T comparable](set map[string]bool, name string, dst *T, value T) {
+	var zero T
+	if !set[name] && value != zero {
+		*dst = value
+	}
+}
+
+// connect 创建客户端并连接网关，失败后按-retries和-retry-interval重试，总时间不超过-connect-timeout
+func (g *gatewayFlags) connect(ctx context.Context) (*client.TransferClient, error) {
+	c := client.NewTransferClient(g.addr, g.config)
+	ctx, cancel := context.WithTimeout(ctx, g.connectTimeout)
+	defer cancel()
+
+	var err error
+	for i := 0; i < g.config.MaxRetries; i++ {
+		if err = c.Connect(ctx); err == nil {
+			return c, nil
+		}
+		g.config.Logger.Warn("连接网关失败", "attempt", i+1, "error", err)
+		if i == g.config.MaxRetries-1 {
+			break
+		}
+		select {
+		case <-time.After(g.config.RetryInterval):
+		case <-ctx.Done():
+			return nil, withExitCode(exitConnect, fmt.Errorf("连接网关失败: %v", err))
+		}
+	}
+	return nil, withExitCode(exitConnect, fmt.Errorf("连接网关失败，已尝试 %d 次: %v", g.config.MaxRetries, err))
+}
+
+// open 连接网关并完成INIT
+func (g *gatewayFlags) open(ctx context.Context) (*client.TransferClient, error) {
+	c, err := g.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := c.SendInit(); err != nil {
+		c.Close()
+		return nil, withExitCode(exitGateway, err)
+	}
+	return c, nil
+}
+
+// requestContext 按-timeout返回单个请求使用的ctx
+func (g *gatewayFlags) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if g.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, g.timeout)
+}
+
+// addQUICFlags 注册QUIC传输参数相关的命令行参数，解析结果直接写入config
+// 未指定的参数保持config中的值，由NewTransferClient填充默认值
+func addQUICFlags(fs *flag.FlagSet, config *client.Config) {
+	fs.DurationVar(&config.KeepAlivePeriod, "keepalive", config.KeepAlivePeriod, "保活包间隔，默认2s，<0表示不发送保活包")
+	fs.DurationVar(&config.MaxIdleTimeout, "idle-timeout", config.MaxIdleTimeout, "连接空闲超时，默认30s")
+	fs.DurationVar(&config.HandshakeIdleTimeout, "handshake-timeout", config.HandshakeIdleTimeout, "握手阶段的空闲超时，默认10s")
+	fs.Int64Var(&config.MaxIncomingStreams, "max-streams", config.MaxIncomingStreams, "允许网关打开的最大并发流数，默认100")
+	fs.Uint64Var(&config.InitialStreamReceiveWindow, "stream-window", config.InitialStreamReceiveWindow, "流的初始接收窗口（字节），0表示使用quic-go默认值")
+	fs.Uint64Var(&config.MaxStreamReceiveWindow, "max-stream-window", config.MaxStreamReceiveWindow, "流的最大接收窗口（字节），0表示使用quic-go默认值")
+	fs.Uint64Var(&config.InitialConnectionReceiveWindow, "conn-window", config.InitialConnectionReceiveWindow, "连接的初始接收窗口（字节），0表示使用quic-go默认值")
+	fs.Uint64Var(&config.MaxConnectionReceiveWindow, "max-conn-window", config.MaxConnectionReceiveWindow, "连接的最大接收窗口（字节），0表示使用quic-go默认值")
+	fs.BoolVar(&config.DisablePathMTUDiscovery, "disable-pmtud", config.DisablePathMTUDiscovery, "关闭路径MTU探测")
+	fs.IntVar(&config.UDPReceiveBuffer, "udp-rcvbuf", config.UDPReceiveBuffer, "UDP套接字接收缓冲区大小（字节），默认1MB")
+	fs.IntVar(&config.UDPSendBuffer, "udp-sndbuf", config.UDPSendBuffer, "UDP套接字发送缓冲区大小（字节），默认1MB")
+	fs.Func("quic-versions", "支持的QUIC版本，逗号分隔，如\"1,2\"，默认只使用v1", func(s string) error {
+		versions, err := client.ParseQUICVersions(s)
+		if err != nil {
+			return err
+		}
+		config.QUICVersions = versions
+		return nil
+	})
+	fs.StringVar(&config.QlogDir, "qlog-dir", config.QlogDir, "为每个连接在该目录下写入qlog文件，用于排查握手和传输问题")
+	fs.StringVar(&config.KeyLogFile, "keylog", config.KeyLogFile, "以SSLKEYLOGFILE格式追加TLS会话密钥，用于Wireshark解密抓包，仅用于调试")
+}
+
+// frameTraceFlags 帧跟踪和会话录制相关的命令行参数，解析后通过open创建输出
+type frameTraceFlags struct {
+	path   string
+	record string
+	opts   *client.FrameTraceOptions
+}
+
+// addFrameTraceFlags 注册帧跟踪和会话录制相关的命令行参数
+func addFrameTraceFlags(fs *flag.FlagSet) *frameTraceFlags {
+	f := &frameTraceFlags{opts: client.DefaultFrameTraceOptions()}
+	fs.StringVar(&f.path, "frame-trace", "", "将收发的每个EMM帧写入该文件，\"-\"表示标准错误输出，可附在网关问题报告中")
+	fs.Func("frame-trace-format", "帧跟踪的输出格式，text或json（JSON Lines），默认text", func(s string) error {
+		format, err := client.ParseFrameTraceFormat(s)
+		if err != nil {
+			return err
+		}
+		f.opts.Format = format
+		return nil
+	})
+	fs.BoolVar(&f.opts.DumpBody, "frame-trace-body", f.opts.DumpBody, "帧跟踪中输出帧数据的十六进制内容")
+	fs.IntVar(&f.opts.MaxBodyBytes, "frame-trace-max-body", f.opts.MaxBodyBytes, "帧跟踪中每帧最多输出的数据字节数，<0表示不限制")
+	fs.StringVar(&f.record, "record", "", "将会话录制到该文件，可以用pkg/replay重放，不能与-frame-trace同时使用")
+	return f
+}
+
+// open 按参数创建帧跟踪输出或会话录制并写入config.FrameTracer，返回的io.Closer在退出前关闭
+// -frame-trace为-时写入stderr；未指定-frame-trace和-record时不做任何修改
+func (f *frameTraceFlags) open(config *client.Config, stderr io.Writer) (io.Closer, error) {
+	if f.record != "" {
+		if f.path != "" {
+			return nil, fmt.Errorf("-record不能与-frame-trace同时使用")
+		}
+		file, err := os.OpenFile(f.record, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("打开录制文件失败: %v", err)
+		}
+		config.FrameTracer = client.NewFrameRecorder(file)
+		return file, nil
+	}
+	if f.path == "" {
+		return io.NopCloser(nil), nil
+	}
+	if f.path == "-" {
+		config.FrameTracer = client.NewFrameTraceWriter(stderr, f.opts)
+		return io.NopCloser(nil), nil
+	}
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("打开帧跟踪文件失败: %v", err)
+	}
+	config.FrameTracer = client.NewFrameTraceWriter(file, f.opts)
+	return file, nil
+}
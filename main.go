@@ -2,194 +2,204 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
-	"time"
 
 	"github.com/laotiannai/quic_gwclient/pkg/client"
 )
 
-func main() {
-	// 启用调试模式
-	client.SetDebugMode(true)
-
-	// 设置日志格式
-	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
-	log.SetPrefix("[QUIC Client] ")
-	log.Println("=== QUIC客户端启动 ===")
-	log.Println("详细日志模式已启用")
-
-	// 创建客户端配置
-	config := &client.Config{
-		ServerID:   381634,
-		ServerName: "stresss_H5_nginx",
-		SessionID:  "abac17fd-e8e0-4600-b822-09f5755148d7",
-		// 设置重试参数
-		// EnableConnectRetry: false,
-		MaxRetries:    15,                     // 最大重试15次
-		RetryDelay:    500 * time.Millisecond, // 每次重试延迟500ms
-		RetryInterval: 2 * time.Second,        // 重试间隔2s
-	}
-	log.Printf("客户端配置 - ServerID: %d, ServerName: %s, SessionID: %s, MaxRetries: %d",
-		config.ServerID, config.ServerName, config.SessionID, config.MaxRetries)
-
-	// 创建客户端
-	serverAddr := "10.10.27.129:8002"
-	log.Printf("目标服务器地址: %s", serverAddr)
-	c := client.NewTransferClient(serverAddr, config)
-
-	// 设置上下文，支持超时和取消
-	timeout := 30 * time.Second
-	log.Printf("设置连接超时时间: %v", timeout)
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	// 连接服务器，使用配置的重试参数
-	var err error
-	log.Printf("开始连接服务器，最大重试次数: %d", config.MaxRetries)
-	for i := 0; i < config.MaxRetries; i++ {
-		log.Printf("===== 尝试连接服务器 (尝试 %d/%d) =====", i+1, config.MaxRetries)
-		startTime := time.Now()
-		err = c.Connect(ctx)
-		elapsedTime := time.Since(startTime)
-
-		if err == nil {
-			log.Printf("连接服务器成功！耗时: %v", elapsedTime)
-			break
-		}
+// 退出码
+const (
+	exitOK          = 0
+	exitFailure     = 1   // 请求失败或其他错误
+	exitUsage       = 2   // 命令行参数错误
+	exitConnect     = 3   // 连接网关失败
+	exitGateway     = 4   // 网关拒绝INIT或以错误码关闭链路
+	exitTimeout     = 5   // 请求超时
+	exitHTTP        = 6   // 指定-fail时HTTP响应状态码不小于400
+	exitInterrupted = 130 // 收到中断信号
+)
 
-		log.Printf("连接失败: %v, 耗时: %v", err, elapsedTime)
-		if i < config.MaxRetries-1 {
-			log.Printf("将在 %v 后重试...", config.RetryInterval)
-			time.Sleep(config.RetryInterval)
-		}
-	}
+// exitError 带退出码的错误
+type exitError struct {
+	code  int
+	err   error
+	quiet bool // 不输出错误信息
+}
 
-	if err != nil {
-		log.Fatalf("连接服务器失败，已尝试 %d 次: %v", config.MaxRetries, err)
-	}
-	defer c.Close()
-
-	// 发送初始化请求
-	log.Println("===== 开始发送初始化请求 =====")
-	startTime := time.Now()
-	sentBytes, receivedBytes, err := c.SendInitRequestNoAES()
-	if err != nil {
-		log.Fatalf("初始化请求失败: %v", err)
-	}
-	log.Printf("初始化请求成功，耗时: %v, 发送: %d 字节, 接收: %d 字节", time.Since(startTime), sentBytes, receivedBytes)
-
-	// 发送传输请求
-	log.Println("===== 开始发送传输请求 =====")
-	content := "GET /index.html HTTP/1.1\r\n" +
-		"User-Agent: PostmanRuntime/7.26.8\r\n" +
-		"Accept: */*\r\n" +
-		"Postman-Token: d2aeeecc-1612-4518-94ef-e882b0767b44\r\n" +
-		"Host: 192.168.247.111:8089\r\n" +
-		"Accept-Encoding: gzip\r\n" +
-		"Connection: close\r\n\r\n"
-	log.Printf("传输请求内容:\n%s", content)
-
-	// startTime = time.Now()
-	// response, sentBytes, receivedBytes, err := c.SendTransferRequestNoAES(content)
-	// if err != nil {
-	// 	log.Fatalf("传输请求失败: %v", err)
-	// }
-	// log.Printf("传输请求成功，耗时: %v, 发送: %d 字节, 接收: %d 字节", time.Since(startTime), sentBytes, receivedBytes)
-
-	// log.Printf("收到响应 (长度: %d 字节):\n%s", len(response), string(response))
-
-	// // 分析HTTP响应
-	// if len(response) > 0 {
-	// 	log.Println("===== HTTP响应分析 =====")
-	// 	analyzeHTTPResponse(response)
-	// }
-
-	// 示例3：使用简化的下载方法
-	filePath, err := c.DownloadFile(content, "./downloads", "simple")
-	if err != nil {
-		log.Fatalf("简化下载失败: %v", err)
-	}
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
 
-	log.Printf("文件已保存到: %s", filePath)
+// withExitCode 为err附加退出码
+func withExitCode(code int, err error) error {
+	return &exitError{code: code, err: err}
+}
 
-	// 等待中断信号
-	log.Println("客户端运行中，按Ctrl+C退出...")
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	<-sigCh
+// quiet 返回退出码不变、但不输出错误信息的错误
+func quiet(err error) error {
+	return &exitError{code: exitCode(err), err: err, quiet: true}
+}
 
-	log.Println("程序正在退出...")
+// usageErrorf 返回参数错误
+func usageErrorf(format string, args ...any) error {
+	return withExitCode(exitUsage, fmt.Errorf(format, args...))
 }
 
-// 分析HTTP响应
-func analyzeHTTPResponse(response []byte) {
-	responseStr := string(response)
+// errFlagParse 命令行参数解析失败，flag包已经输出了错误和用法
+var errFlagParse = withExitCode(exitUsage, errors.New("参数错误"))
+
+// exitCode 按错误类型返回退出码
+func exitCode(err error) int {
+	var e *exitError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &e):
+		return e.code
+	case errors.As(err, new(*client.GatewayError)):
+		return exitGateway
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return exitTimeout
+	}
+	return exitFailure
+}
 
-	// 查找HTTP状态行
-	var statusLine string
-	var headers string
-	var body string
+// command 子命令
+type command struct {
+	name string
+	args string // 用法中参数之后的部分
+	desc string
+	run  func(cli *cli, ctx context.Context, args []string) error
+}
 
-	// 分离状态行、头部和正文
-	parts := splitHTTPResponse(responseStr)
-	if len(parts) >= 1 {
-		statusLine = parts[0]
-		log.Printf("HTTP状态行: %s", statusLine)
+// commands 全部子命令，在init中赋值以避免与newFlagSet之间的初始化循环
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"init", "", "连接网关并完成INIT，输出连接信息和耗时", (*cli).runInit},
+		{"ping", "", "重复建立连接并完成INIT，统计握手和初始化耗时", (*cli).runPing},
+		{"request", "[请求文件]", "发送请求文件中的原始请求（未指定或为-时读取标准输入），将响应写入标准输出或-o指定的文件", (*cli).runRequest},
+		{"download", "[请求文件]", "发送请求并将响应数据保存为文件，HTTP响应只保存响应体", (*cli).runDownload},
+		{"curl", "<URL>", "按curl的参数构造HTTP请求，通过网关发送并输出响应头、响应体和耗时", (*cli).runCurl},
+		{"forward", "", "在本地监听TCP端口，将收到的HTTP请求通过网关转发并返回响应", (*cli).runForward},
+		{"loadtest", "[请求文件]", "按指定的并发或速率持续发送请求，输出耗时分布、吞吐量和按网关错误码分类的失败统计", (*cli).runLoadtest},
 	}
+}
 
-	if len(parts) >= 2 {
-		headers = parts[1]
-		log.Printf("HTTP头部:\n%s", headers)
+// cli 命令行程序的输入输出
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := (&cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}).run(ctx, os.Args[1:])
+	stop()
+	os.Exit(code)
+}
+
+// run 执行args指定的子命令并返回退出码
+func (c *cli) run(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		c.usage()
+		return exitUsage
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		c.usage()
+		return exitOK
 	}
 
-	if len(parts) >= 3 {
-		body = parts[2]
-		if len(body) > 200 {
-			log.Printf("HTTP正文 (前200字节):\n%s...", body[:200])
-		} else {
-			log.Printf("HTTP正文:\n%s", body)
+	var cmd *command
+	for _, candidate := range commands {
+		if candidate.name == args[0] {
+			cmd = candidate
 		}
 	}
-}
-
-// 分离HTTP响应的状态行、头部和正文
-func splitHTTPResponse(response string) []string {
-	result := make([]string, 0, 3)
+	if cmd == nil {
+		fmt.Fprintf(c.stderr, "未知的子命令: %s\n\n", args[0])
+		c.usage()
+		return exitUsage
+	}
 
-	// 查找第一个换行符，分离状态行
-	statusEnd := -1
-	for i := 0; i < len(response); i++ {
-		if response[i] == '\r' && i+1 < len(response) && response[i+1] == '\n' {
-			statusEnd = i
-			break
+	err := cmd.run(c, ctx, args[1:])
+	var e *exitError
+	quiet := errors.As(err, &e) && e.quiet
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case ctx.Err() != nil:
+		if !quiet {
+			fmt.Fprintf(c.stderr, "quic_gwclient %s: 已中断\n", cmd.name)
 		}
+		return exitInterrupted
+	case !quiet && !errors.Is(err, errFlagParse):
+		fmt.Fprintf(c.stderr, "quic_gwclient %s: %v\n", cmd.name, err)
 	}
+	return exitCode(err)
+}
 
-	if statusEnd != -1 {
-		result = append(result, response[:statusEnd])
+// usage 输出子命令列表和退出码
+func (c *cli) usage() {
+	var b strings.Builder
+	b.WriteString("用法: quic_gwclient <子命令> [参数]\n\n子命令:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, "  %-10s %s\n", cmd.name, cmd.desc)
+	}
+	fmt.Fprintf(&b, "\n运行 quic_gwclient <子命令> -h 查看子命令的参数。网关地址、ServerID、ServerName和会话ID可以通过环境变量%s、%s、%s和%s指定。\n",
+		envGateway, envServerID, envServerName, envSessionID)
+	b.WriteString("\n退出码:\n")
+	for _, e := range []struct {
+		code int
+		desc string
+	}{
+		{exitOK, "成功"},
+		{exitFailure, "请求失败或其他错误"},
+		{exitUsage, "命令行参数错误"},
+		{exitConnect, "连接网关失败"},
+		{exitGateway, "网关拒绝INIT或以错误码关闭链路"},
+		{exitTimeout, "请求超时"},
+		{exitHTTP, "指定-fail时HTTP响应状态码不小于400"},
+		{exitInterrupted, "收到中断信号"},
+	} {
+		fmt.Fprintf(&b, "  %-4d %s\n", e.code, e.desc)
+	}
+	io.WriteString(c.stderr, b.String())
+}
 
-		// 查找头部和正文的分隔
-		headerEnd := -1
-		for i := statusEnd + 2; i < len(response)-3; i++ {
-			if response[i] == '\r' && response[i+1] == '\n' &&
-				response[i+2] == '\r' && response[i+3] == '\n' {
-				headerEnd = i
-				break
+// newFlagSet 创建子命令的参数集，-h时输出子命令的用法
+func (c *cli) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		for _, cmd := range commands {
+			if cmd.name == name {
+				fmt.Fprintf(c.stderr, "用法: quic_gwclient %s [参数] %s\n\n%s\n\n参数:\n", name, cmd.args, cmd.desc)
 			}
 		}
+		fs.PrintDefaults()
+	}
+	return fs
+}
 
-		if headerEnd != -1 {
-			result = append(result, response[statusEnd+2:headerEnd])
-			result = append(result, response[headerEnd+4:])
-		} else {
-			result = append(result, response[statusEnd+2:])
+// parseFlags 解析参数，最多允许maxArgs个位置参数
+func parseFlags(fs *flag.FlagSet, args []string, maxArgs int) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
 		}
-	} else {
-		result = append(result, response)
+		return errFlagParse
 	}
-
-	return result
+	if fs.NArg() > maxArgs {
+		return usageErrorf("多余的参数: %s", strings.Join(fs.Args()[maxArgs:], " "))
+	}
+	return nil
 }
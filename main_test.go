@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/pkg/replay"
+	"github.com/laotiannai/quic_gwclient/proto"
+)
+
+const testResponse = "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello"
+
+// newTestRecording 构造一个连接上的会话：INIT的结果为initResult，之后的一个请求返回response
+func newTestRecording(initResult uint16, response string) *replay.Recording {
+	now := time.Now()
+	sent := func(cmd uint16) *replay.Frame {
+		return &replay.Frame{Time: now, Direction: replay.Sent,
+			Request: &proto.TransferHeader{Tag: proto.HEAD_TAG, Command: cmd}}
+	}
+	received := func(cmd, result uint16, body string) *replay.Frame {
+		return &replay.Frame{Time: now, Direction: replay.Received, Body: []byte(body),
+			Response: &proto.ResponseHeader{Tag: proto.HEAD_TAG, Command: cmd, Result: result, DataLen: uint32(len(body))}}
+	}
+	frames := []*replay.Frame{sent(proto.EMM_COMMAND_INIT), received(proto.EMM_COMMAND_INIT_ACK, initResult, "")}
+	if initResult == proto.AUTH_STATUS_CODE_SUCCESS {
+		frames = append(frames,
+			sent(proto.EMM_COMMAND_TRAN),
+			received(proto.EMM_COMMAND_TRAN_ACK, 0, response),
+			received(proto.EMM_COMMAND_LINK_CLOSE, proto.AUTH_STATUS_CODE_SUCCESS, ""))
+	}
+	return &replay.Recording{Frames: frames}
+}
+
+// startTestGateway 启动按rec应答的模拟网关，返回网关地址
+func startTestGateway(t *testing.T, rec *replay.Recording) string {
+	t.Helper()
+	srv := replay.NewServer(rec, nil)
+	if err := srv.Start("127.0.0.1:0"); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(func() {
+		srv.Close()
+		if err := srv.Err(); err != nil {
+			t.Errorf("Unexpected replay error: %v", err)
+		}
+	})
+	return srv.Addr().String()
+}
+
+// runCLI 执行命令行，返回退出码、标准输出和标准错误
+func runCLI(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	c := &cli{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	code := c.run(ctx, args)
+	return code, stdout.String(), stderr.String()
+}
+
+// gatewayArgs 返回连接模拟网关的公共参数
+func gatewayArgs(addr string) []string {
+	return []string{"-gateway", addr, "-server-id", "1", "-server-name", "test-server", "-insecure", "-retries", "1"}
+}
+
+func TestCLI_Usage(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"no command", nil, exitUsage},
+		{"help", []string{"help"}, exitOK},
+		{"unknown command", []string{"unknown"}, exitUsage},
+		{"unknown flag", []string{"init", "-unknown"}, exitUsage},
+		{"command help", []string{"request", "-h"}, exitOK},
+		{"extra args", []string{"init", "-gateway", "127.0.0.1:1", "extra"}, exitUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _, stderr := runCLI(t, "", tt.args...); code != tt.want {
+				t.Errorf("Exit code = %d, want %d, stderr: %s", code, tt.want, stderr)
+			}
+		})
+	}
+}
+
+func TestCLI_MissingGateway(t *testing.T) {
+	t.Setenv(envGateway, "")
+	code, _, stderr := runCLI(t, "", "init", "-server-id", "1", "-server-name", "test-server")
+	if code != exitUsage {
+		t.Errorf("Exit code = %d, want %d", code, exitUsage)
+	}
+	if !strings.Contains(stderr, envGateway) {
+		t.Errorf("Stderr %q does not mention %s", stderr, envGateway)
+	}
+}
+
+func TestCLI_EnvGateway(t *testing.T) {
+	addr := startTestGateway(t, newTestRecording(proto.AUTH_STATUS_CODE_SUCCESS, testResponse))
+	t.Setenv(envGateway, addr)
+	t.Setenv(envServerID, "1")
+	t.Setenv(envServerName, "test-server")
+
+	code, stdout, stderr := runCLI(t, "GET / HTTP/1.1\r\nHost: backend\r\n\r\n", "request", "-insecure")
+	if code != exitOK {
+		t.Fatalf("Exit code = %d, stderr: %s", code, stderr)
+	}
+	if stdout != testResponse {
+		t.Errorf("Stdout = %q, want %q", stdout, testResponse)
+	}
+}
+
+func TestCLI_Request(t *testing.T) {
+	addr := startTestGateway(t, newTestRecording(proto.AUTH_STATUS_CODE_SUCCESS, testResponse))
+	reqFile := filepath.Join(t.TempDir(), "request.txt")
+	if err := os.WriteFile(reqFile, []byte(`GET / HTTP/1.1\r\nHost: backend\r\n\r\n`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	args := append([]string{"request"}, gatewayArgs(addr)...)
+	code, stdout, stderr := runCLI(t, "", append(args, "-escaped-crlf", "-stats", reqFile)...)
+	if code != exitOK {
+		t.Fatalf("Exit code = %d, stderr: %s", code, stderr)
+	}
+	if stdout != testResponse {
+		t.Errorf("Stdout = %q, want %q", stdout, testResponse)
+	}
+	if !strings.Contains(stderr, "耗时") {
+		t.Errorf("Stderr %q does not contain stats", stderr)
+	}
+}
+
+func TestCLI_RequestFail(t *testing.T) {
+	response := "HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n"
+	addr := startTestGateway(t, newTestRecording(proto.AUTH_STATUS_CODE_SUCCESS, response))
+
+	args := append([]string{"request"}, gatewayArgs(addr)...)
+	code, stdout, stderr := runCLI(t, "GET /missing HTTP/1.1\r\nHost: backend\r\n\r\n", append(args, "-fail")...)
+	if code != exitHTTP {
+		t.Errorf("Exit code = %d, want %d, stderr: %s", code, exitHTTP, stderr)
+	}
+	if stdout != response {
+		t.Errorf("Stdout = %q, want %q", stdout, response)
+	}
+}
+
+func TestCLI_InitRejected(t *testing.T) {
+	addr := startTestGateway(t, newTestRecording(proto.AUTH_STATUS_CODE_ERR_TENNEL_FORBIDDEN, ""))
+
+	code, _, stderr := runCLI(t, "", append([]string{"init"}, gatewayArgs(addr)...)...)
+	if code != exitGateway {
+		t.Errorf("Exit code = %d, want %d, stderr: %s", code, exitGateway, stderr)
+	}
+}
+
+func TestCLI_ConnectFailed(t *testing.T) {
+	// 占用一个UDP端口但不应答，握手只能超时
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	args := append([]string{"init"}, gatewayArgs(pc.LocalAddr().String())...)
+	code, _, stderr := runCLI(t, "", append(args, "-connect-timeout", "300ms")...)
+	if code != exitConnect {
+		t.Errorf("Exit code = %d, want %d, stderr: %s", code, exitConnect, stderr)
+	}
+}
+
+func TestCLI_Download(t *testing.T) {
+	addr := startTestGateway(t, newTestRecording(proto.AUTH_STATUS_CODE_SUCCESS, testResponse))
+	output := filepath.Join(t.TempDir(), "body.txt")
+
+	args := append([]string{"download"}, gatewayArgs(addr)...)
+	code, stdout, stderr := runCLI(t, "GET / HTTP/1.1\r\nHost: backend\r\n\r\n", append(args, "-dir", t.TempDir(), "-o", output, "-raw")...)
+	if code != exitOK {
+		t.Fatalf("Exit code = %d, stderr: %s", code, stderr)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if string(data) != testResponse {
+		t.Errorf("Saved data = %q, want %q", data, testResponse)
+	}
+	if !strings.Contains(stdout, output) {
+		t.Errorf("Stdout %q does not contain the saved path", stdout)
+	}
+}
+
+func TestCLI_DownloadTimeout(t *testing.T) {
+	// 响应在3秒后才到达，-timeout小于-read-timeout时作为等待响应数据的上限
+	rec := newTestRecording(proto.AUTH_STATUS_CODE_SUCCESS, testResponse)
+	for _, f := range rec.Frames[3:] {
+		f.Time = f.Time.Add(3 * time.Second)
+	}
+	srv := replay.NewServer(rec, &replay.ServerOptions{PreserveTiming: true})
+	if err := srv.Start("127.0.0.1:0"); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer srv.Close()
+
+	start := time.Now()
+	args := append([]string{"download"}, gatewayArgs(srv.Addr().String())...)
+	_, _, stderr := runCLI(t, "GET / HTTP/1.1\r\nHost: backend\r\n\r\n", append(args, "-dir", t.TempDir(), "-raw", "-timeout", "200ms", "-frame-trace", "-")...)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Download took %v, -timeout not applied", elapsed)
+	}
+	// -frame-trace -写入命令的标准错误
+	if !strings.Contains(stderr, "INIT_ACK") {
+		t.Errorf("Frame trace not in stderr:\n%s", stderr)
+	}
+}
+
+func TestCLI_ForwardConn(t *testing.T) {
+	addr := startTestGateway(t, newTestRecording(proto.AUTH_STATUS_CODE_SUCCESS, testResponse))
+	c := &cli{stdout: io.Discard, stderr: io.Discard}
+	fs := c.newFlagSet("forward")
+	g := addGatewayFlags(fs, c.stderr)
+	if err := fs.Parse(gatewayArgs(addr)); err != nil {
+		t.Fatal(err)
+	}
+	closer, err := g.setup()
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	defer closer.Close()
+
+	local, remote := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.forwardConn(context.Background(), g, remote)
+	}()
+	defer func() {
+		local.Close()
+		<-done
+	}()
+
+	local.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := io.WriteString(local, "GET / HTTP/1.1\r\nHost: backend\r\nConnection: close\r\n\r\n"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(local), nil)
+	if err != nil {
+		t.Fatalf("ReadResponse failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "hello" {
+		t.Errorf("Response = %d %q, want 200 %q", resp.StatusCode, body, "hello")
+	}
+}
+
+func TestCLI_Profile(t *testing.T) {
+	addr := startTestGateway(t, newTestRecording(proto.AUTH_STATUS_CODE_SUCCESS, testResponse))
+	path := filepath.Join(t.TempDir(), "profiles.yaml")
+	profiles := `
+default: test
+profiles:
+  test:
+    gateway: ${TEST_CLI_GATEWAY}
+    server_id: 1
+    server_name: test-server
+    insecure_skip_verify: true
+    max_retries: 1
+    legacy_escaped_crlf: true
+  unreachable:
+    gateway: 127.0.0.1:1
+    server_id: 1
+    server_name: test-server
+`
+	if err := os.WriteFile(path, []byte(profiles), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_CLI_GATEWAY", addr)
+	// 配置中的值优先于环境变量
+	t.Setenv(envGateway, "127.0.0.1:1")
+
+	code, stdout, stderr := runCLI(t, `GET / HTTP/1.1\r\nHost: backend\r\n\r\n`, "request", "-profiles", path)
+	if code != exitOK {
+		t.Fatalf("Exit code = %d, stderr: %s", code, stderr)
+	}
+	if stdout != testResponse {
+		t.Errorf("Stdout = %q, want %q", stdout, testResponse)
+	}
+
+	t.Run("flags override profile", func(t *testing.T) {
+		addr := startTestGateway(t, newTestRecording(proto.AUTH_STATUS_CODE_SUCCESS, testResponse))
+		code, _, stderr := runCLI(t, "GET / HTTP/1.1\r\nHost: backend\r\n\r\n",
+			"request", "-profiles", path, "-profile", "unreachable", "-gateway", addr, "-insecure", "-retries", "1")
+		if code != exitOK {
+			t.Errorf("Exit code = %d, stderr: %s", code, stderr)
+		}
+	})
+
+	t.Run("missing profile", func(t *testing.T) {
+		code, _, stderr := runCLI(t, "", "init", "-profiles", path, "-profile", "missing")
+		if code != exitUsage || !strings.Contains(stderr, "unreachable") {
+			t.Errorf("Exit code = %d, stderr: %s", code, stderr)
+		}
+	})
+}
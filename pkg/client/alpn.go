@@ -0,0 +1,122 @@
+package client
+
+import (
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultALPNProtocols 默认按顺序尝试的ALPN协议组合
+var DefaultALPNProtocols = [][]string{
+	{"hq-interop", "h3-25", "h3-24", "h3-23"},
+	{"hq-29", "hq-28", "hq-27"},
+	{"h3-25", "h3-24", "h3-23"},
+	{"hq-interop"},
+	{"http/0.9"},
+}
+
+// ALPNCache 记录每个网关握手成功的ALPN协议组合，之后连接同一网关时优先使用
+type ALPNCache struct {
+	mu sync.Mutex
+	m  map[string][]string
+}
+
+// NewALPNCache 创建空的ALPN缓存
+func NewALPNCache() *ALPNCache {
+	return &ALPNCache{m: make(map[string][]string)}
+}
+
+// defaultALPNCache Config.ALPNCache为nil时使用的进程级缓存
+var defaultALPNCache = NewALPNCache()
+
+// Get 返回网关上次握手成功的协议组合
+func (a *ALPNCache) Get(gateway string) ([]string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	protocols, ok := a.m[gateway]
+	return slices.Clone(protocols), ok
+}
+
+// Set 记录网关握手成功的协议组合
+func (a *ALPNCache) Set(gateway string, protocols []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.m[gateway] = slices.Clone(protocols)
+}
+
+// Forget 删除网关的缓存记录
+func (a *ALPNCache) Forget(gateway string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.m, gateway)
+}
+
+// ConnectionInfo 当前连接的信息
+type ConnectionInfo struct {
+	RemoteAddr  net.Addr
+	LocalAddr   net.Addr
+	Network     string    // 连接使用的地址族，"udp4"或"udp6"
+	ALPN        string    // 协商得到的应用层协议
+	Protocols   []string  // 握手成功时提供的ALPN协议组合
+	TLSVersion  uint16    // 协商的TLS版本
+	CipherSuite uint16    // 协商的TLS加密套件
+	ServerName  string    // 握手使用的SNI
+	Resumed     bool      // 是否通过会话票据恢复了TLS会话
+	Used0RTT    bool      // 网关是否接受了0-RTT早期数据，握手完成后才有效
+	Attempts    int       // 本次连接的握手次数
+	ConnectedAt time.Time // 连接建立时间
+}
+
+// ConnectionInfo 返回当前连接的信息，未连接时返回nil
+func (c *TransferClient) ConnectionInfo() *ConnectionInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.info == nil || c.conn == nil || c.conn.Context().Err() != nil {
+		return nil
+	}
+	info := *c.info
+	info.Protocols = slices.Clone(info.Protocols)
+
+	state := c.conn.ConnectionState()
+	info.ALPN = state.TLS.NegotiatedProtocol
+	info.TLSVersion = state.TLS.Version
+	info.CipherSuite = state.TLS.CipherSuite
+	info.ServerName = state.TLS.ServerName
+	info.Resumed = state.TLS.DidResume
+	info.Used0RTT = state.Used0RTT
+	return &info
+}
+
+// alpnCache 返回使用的ALPN缓存
+func (c *TransferClient) alpnCache() *ALPNCache {
+	if c.config.ALPNCache != nil {
+		return c.config.ALPNCache
+	}
+	return defaultALPNCache
+}
+
+// alpnCandidates 返回本次连接要尝试的协议组合：缓存中的组合优先，未启用EnableConnectRetry时只尝试一组
+func (c *TransferClient) alpnCandidates() [][]string {
+	configured := c.config.ALPNProtocols
+	if len(configured) == 0 {
+		configured = DefaultALPNProtocols
+	}
+
+	candidates := make([][]string, 0, len(configured)+1)
+	if cached, ok := c.alpnCache().Get(c.serverAddr); ok {
+		candidates = append(candidates, cached)
+	}
+	for _, protocols := range configured {
+		if len(candidates) > 0 && slices.Equal(candidates[0], protocols) {
+			continue
+		}
+		candidates = append(candidates, protocols)
+	}
+
+	if !c.config.EnableConnectRetry {
+		return candidates[:1]
+	}
+	return candidates
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTransferClient_ALPNStrategy(t *testing.T) {
+	g := newTestGateway(t, echoHandler)
+	cache := NewALPNCache()
+	protocols := [][]string{{"unknown-proto"}, {"hq-29"}, {"hq-interop"}}
+
+	c := g.newTestClient(t, &Config{EnableConnectRetry: true, ALPNProtocols: protocols, ALPNCache: cache})
+	info := c.ConnectionInfo()
+	if info == nil {
+		t.Fatal("Expected connection info")
+	}
+	if info.ALPN != "hq-29" || info.Attempts != 2 {
+		t.Errorf("Expected hq-29 after 2 attempts, got %q after %d", info.ALPN, info.Attempts)
+	}
+	if cached, ok := cache.Get(g.addr); !ok || !slices.Equal(cached, []string{"hq-29"}) {
+		t.Errorf("Expected cached hq-29, got %v", cached)
+	}
+	if info.RemoteAddr.String() != g.addr {
+		t.Errorf("Unexpected remote address %v", info.RemoteAddr)
+	}
+
+	// 后续连接直接使用缓存的组合
+	again := g.newTestClient(t, &Config{EnableConnectRetry: true, ALPNProtocols: protocols, ALPNCache: cache})
+	if info := again.ConnectionInfo(); info.Attempts != 1 || info.ALPN != "hq-29" {
+		t.Errorf("Expected cached protocol on first attempt, got %q after %d", info.ALPN, info.Attempts)
+	}
+
+	c.Close()
+	if c.ConnectionInfo() != nil {
+		t.Error("Expected nil connection info after Close")
+	}
+}
+
+func TestTransferClient_ALPNWithoutRetry(t *testing.T) {
+	g := newTestGateway(t, echoHandler)
+	cache := NewALPNCache()
+
+	// 未启用EnableConnectRetry时只尝试第一组
+	c := NewTransferClient(g.addr, &Config{
+		ServerID: 1, ServerName: "test-server", SessionID: "test-session",
+		InsecureSkipVerify: true,
+		ALPNProtocols:      [][]string{{"unknown-proto"}, {"hq-29"}},
+		ALPNCache:          cache,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Connect(ctx); err == nil {
+		t.Fatal("Expected connect to fail with unsupported protocol")
+	}
+
+	// 缓存了可用组合后直接使用
+	cache.Set(g.addr, []string{"hq-interop"})
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect with cached protocol failed: %v", err)
+	}
+	defer c.Close()
+	if info := c.ConnectionInfo(); info.ALPN != "hq-interop" {
+		t.Errorf("Expected hq-interop, got %q", info.ALPN)
+	}
+}
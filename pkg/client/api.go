@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/laotiannai/quic_gwclient/utils"
 )
 
 // RequestOptions 请求选项配置
@@ -26,10 +28,34 @@ type RequestOptions struct {
 
 	// 请求内容
 	MessageContent string
+	// 使用构造器生成的HTTP请求，MessageContent为空时使用
+	HTTPRequest *HTTPRequest
+	// 兼容旧版：将MessageContent中的字面量\r\n替换为CRLF
+	LegacyEscapedCRLF bool
+	// 是否使用AES加密会话
+	EnableAES bool
+	// 加密会话使用的加密套件
+	CipherSuite utils.CipherSuite
+
+	// TLS配置，默认校验网关证书
+	RootCAFile         string
+	SPKIPins           []string
+	ClientCertFile     string
+	ClientKeyFile      string
+	TLSServerName      string
+	InsecureSkipVerify bool // 跳过网关证书校验，仅用于测试环境
+	// 有之前连接得到的会话票据时，INIT请求在0-RTT早期数据中发送
+	Enable0RTT bool
+	// 绑定的本地地址或网络接口，为空时由系统选择
+	LocalAddr      string
+	LocalInterface string
 
 	// 响应断言
 	ResponseAssertion string
 
+	// 指标钩子，为nil时不记录指标
+	Metrics Metrics
+
 	// 其他可选配置
 	AppName    string
 	Username   string
@@ -89,7 +115,7 @@ func SendQuicRequest(opts *RequestOptions) *RequestResult {
 		return result
 	}
 
-	if opts.MessageContent == "" {
+	if opts.MessageContent == "" && opts.HTTPRequest == nil {
 		result.Error = fmt.Errorf("请求内容不能为空")
 		return result
 	}
@@ -103,6 +129,19 @@ func SendQuicRequest(opts *RequestOptions) *RequestResult {
 		ServerName:         opts.ServerName,
 		SessionID:          opts.SessionID,
 		EnableConnectRetry: opts.EnableConnectRetry,
+		LegacyEscapedCRLF:  opts.LegacyEscapedCRLF,
+		EnableAES:          opts.EnableAES,
+		CipherSuite:        opts.CipherSuite,
+		RootCAFile:         opts.RootCAFile,
+		SPKIPins:           opts.SPKIPins,
+		ClientCertFile:     opts.ClientCertFile,
+		ClientKeyFile:      opts.ClientKeyFile,
+		TLSServerName:      opts.TLSServerName,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+		Enable0RTT:         opts.Enable0RTT,
+		LocalAddr:          opts.LocalAddr,
+		LocalInterface:     opts.LocalInterface,
+		Metrics:            opts.Metrics,
 	}
 
 	// 创建客户端
@@ -124,6 +163,7 @@ func SendQuicRequest(opts *RequestOptions) *RequestResult {
 
 		// log.Printf("连接失败: %v", err)
 		if i < opts.MaxRetries-1 {
+			c.metrics.Retry(RetryConnect)
 			retryDelay := time.Duration(i+1) * 2 * time.Second
 			// log.Printf("将在 %v 后重试...", retryDelay)
 			time.Sleep(retryDelay)
@@ -137,14 +177,23 @@ func SendQuicRequest(opts *RequestOptions) *RequestResult {
 	defer c.Close()
 
 	// 发送初始化请求
-	sentInitBytes, receivedInitBytes, err := c.SendInitRequestNoAES()
+	sentInitBytes, receivedInitBytes, err := c.SendInit()
 	if err != nil {
 		result.Error = fmt.Errorf("初始化请求失败: %v", err)
 		return result
 	}
 
 	// 发送传输请求
-	response, sentTransBytes, receivedTransBytes, err := c.SendTransferRequestNoAES(opts.MessageContent)
+	var response []byte
+	var sentTransBytes, receivedTransBytes int
+	switch {
+	case opts.EnableAES:
+		response, sentTransBytes, receivedTransBytes, err = sendEncrypted(c, opts)
+	case opts.MessageContent != "":
+		response, sentTransBytes, receivedTransBytes, err = c.SendTransferRequestNoAES(opts.MessageContent)
+	default:
+		response, sentTransBytes, receivedTransBytes, err = c.SendHTTPRequestNoAES(opts.HTTPRequest)
+	}
 	if err != nil {
 		result.Error = fmt.Errorf("传输请求失败: %v", err)
 		return result
@@ -168,32 +217,64 @@ func SendQuicRequest(opts *RequestOptions) *RequestResult {
 	return result
 }
 
-// SendQuicRequestFromIPSInfo 从IPSServerInfo发送QUIC请求
+// sendEncrypted 在加密会话中发送MessageContent或HTTPRequest
+func sendEncrypted(c *TransferClient, opts *RequestOptions) ([]byte, int, int, error) {
+	var payload []byte
+	if opts.MessageContent != "" {
+		content := opts.MessageContent
+		if opts.LegacyEscapedCRLF {
+			content = fixEscapedCRLF(content)
+		}
+		payload = []byte(content)
+	} else {
+		data, err := opts.HTTPRequest.Bytes()
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		payload = data
+	}
+	return c.SendTransferBytes(context.Background(), payload)
+}
+
+// SendQuicRequestFromIPSInfo 从IPSServerInfo发送QUIC请求，校验网关证书
+//
+// Deprecated: 无法配置TLS、0-RTT和本地地址，使用SendQuicRequestWithIPSInfo
 func SendQuicRequestFromIPSInfo(serverIP string, serverPort string, connectTimeout time.Duration, readTimeout time.Duration, maxRetries int, enableConnectRetry bool, ipsInfo *IPSServerInfo) *RequestResult {
-	opts := &RequestOptions{
+	return SendQuicRequestWithIPSInfo(&RequestOptions{
 		ServerIP:           serverIP,
 		ServerPort:         serverPort,
 		ConnectTimeout:     connectTimeout,
 		ReadTimeout:        readTimeout,
 		MaxRetries:         maxRetries,
 		EnableConnectRetry: enableConnectRetry,
-		ServerID:           ipsInfo.ServerID,
-		ServerName:         ipsInfo.ServerName,
-		SessionID:          ipsInfo.SessionID,
-		MessageContent:     ipsInfo.MessageContent,
-		ResponseAssertion:  ipsInfo.ResponseAssert,
-		AppName:            ipsInfo.AppName,
-		Username:           ipsInfo.Username,
-		ClientAddr:         ipsInfo.ClientAddr,
-		DeviceID:           ipsInfo.DeviceID,
-		DeviceType:         ipsInfo.DeviceType,
-		AppVersion:         ipsInfo.AppVersion,
-		TokenID:            ipsInfo.TokenID,
-		JSessionID:         ipsInfo.JSessionId,
-		Connectors:         ipsInfo.Connectors,
+	}, ipsInfo)
+}
+
+// SendQuicRequestWithIPSInfo 使用opts中的网关地址、超时、TLS等连接配置，从IPSServerInfo发送QUIC请求
+// opts中的服务器信息、请求内容和响应断言由ipsInfo覆盖，opts本身不会被修改，为nil时使用DefaultRequestOptions
+func SendQuicRequestWithIPSInfo(opts *RequestOptions, ipsInfo *IPSServerInfo) *RequestResult {
+	if opts == nil {
+		opts = DefaultRequestOptions()
 	}
+	merged := *opts
+	merged.ServerID = ipsInfo.ServerID
+	merged.ServerName = ipsInfo.ServerName
+	merged.SessionID = ipsInfo.SessionID
+	merged.MessageContent = ipsInfo.MessageContent
+	merged.HTTPRequest = nil
+	merged.LegacyEscapedCRLF = true // ipsserverinfo.dat中的请求内容为单行文本，换行以字面量\r\n表示
+	merged.ResponseAssertion = ipsInfo.ResponseAssert
+	merged.AppName = ipsInfo.AppName
+	merged.Username = ipsInfo.Username
+	merged.ClientAddr = ipsInfo.ClientAddr
+	merged.DeviceID = ipsInfo.DeviceID
+	merged.DeviceType = ipsInfo.DeviceType
+	merged.AppVersion = ipsInfo.AppVersion
+	merged.TokenID = ipsInfo.TokenID
+	merged.JSessionID = ipsInfo.JSessionId
+	merged.Connectors = ipsInfo.Connectors
 
-	return SendQuicRequest(opts)
+	return SendQuicRequest(&merged)
 }
 
 // IPSServerInfo IPS服务器信息结构体
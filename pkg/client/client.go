@@ -3,10 +3,14 @@ package client
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -16,15 +20,28 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/quic-go/quic-go"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // TransferClient QUIC传输客户端
 type TransferClient struct {
-	conn       quic.Connection
-	stream     quic.Stream
-	serverAddr string
-	config     *Config
-	mu         sync.Mutex // 添加互斥锁
+	conn        quic.Connection
+	stream      quic.Stream
+	serverAddr  string
+	config      *Config
+	session     *aesSession                                                  // 加密会话，SendInitRequest成功后建立
+	info        *ConnectionInfo                                              // 当前连接的信息
+	early       quic.EarlyConnection                                         // 使用0-RTT且握手尚未确认的连接，网关拒绝0-RTT时用于切换到完整握手
+	transport   *quic.Transport                                              // 当前连接使用的本地UDP套接字
+	initialized bool                                                         // 当前连接是否已完成INIT，迁移后据此重新初始化
+	datagram    *DatagramConn                                                // 当前连接上打开的数据报通道
+	log         *slog.Logger                                                 // 附加了会话ID和网关地址的日志
+	metrics     Metrics                                                      // 指标钩子，不为nil
+	tracer      trace.Tracer                                                 // 创建span使用的Tracer
+	keyLog      *os.File                                                     // Config.KeyLogFile打开后的文件，Close时关闭
+	lookupIP    func(ctx context.Context, host string) ([]net.IPAddr, error) // 解析网关主机名，为nil时使用net.DefaultResolver
+	mu          sync.Mutex                                                   // 添加互斥锁
 }
 
 // Config 客户端配置
@@ -32,12 +49,72 @@ type Config struct {
 	ServerID   int
 	ServerName string
 	SessionID  string
+	// INIT请求中的协议类型，默认proto.PROTO_TYPE_HTTP，使用数据报通道时为PROTO_TYPE_UDP、PROTO_TYPE_RTP或PROTO_TYPE_RTCP
+	ProtocolType int
 	// 重试配置
 	MaxRetries    int           // 最大重试次数，默认10次
 	RetryDelay    time.Duration // 重试延迟时间，默认500ms
 	RetryInterval time.Duration // 重试间隔时间，默认2s
 	// 连接配置
-	EnableConnectRetry bool // 是否在连接失败时重试，默认false
+	EnableConnectRetry bool          // 是否在连接失败时依次尝试ALPNProtocols中的其他协议组合，默认false
+	ALPNProtocols      [][]string    // 按顺序尝试的ALPN协议组合，默认DefaultALPNProtocols
+	ALPNCache          *ALPNCache    // 记录各网关握手成功的协议组合，默认使用进程级共享缓存
+	HappyEyeballsDelay time.Duration // 网关解析出多个地址时，上一个握手未完成多久后开始下一个地址的握手，默认250ms
+	// 会话恢复配置
+	SessionCache tls.ClientSessionCache // TLS会话票据缓存，默认使用进程级共享缓存
+	Enable0RTT   bool                   // 有可用的会话票据时使用0-RTT，在早期数据中发送INIT请求，默认false
+	// QUIC传输配置，窗口为0时使用quic-go的默认值
+	KeepAlivePeriod                time.Duration  // 保活包间隔，默认2s，<0表示不发送保活包
+	MaxIdleTimeout                 time.Duration  // 连接空闲超时，默认30s
+	HandshakeIdleTimeout           time.Duration  // 握手阶段的空闲超时，默认10s
+	MaxIncomingStreams             int64          // 允许网关打开的最大并发流数，默认100
+	InitialStreamReceiveWindow     uint64         // 流的初始接收窗口
+	MaxStreamReceiveWindow         uint64         // 流的最大接收窗口，高延迟链路下载时需要调大
+	InitialConnectionReceiveWindow uint64         // 连接的初始接收窗口
+	MaxConnectionReceiveWindow     uint64         // 连接的最大接收窗口
+	DisablePathMTUDiscovery        bool           // 关闭路径MTU探测，默认false
+	QUICVersions                   []quic.Version // 支持的QUIC版本，默认只使用quic.Version1
+	UDPReceiveBuffer               int            // UDP套接字接收缓冲区大小，默认1MB
+	UDPSendBuffer                  int            // UDP套接字发送缓冲区大小，默认1MB
+	// 本地网络配置
+	LocalAddr      string // 绑定的本地地址，如"192.168.1.10:0"，为空时由系统选择
+	LocalInterface string // 绑定的网络接口名，如"eth0"、"wlan0"，使用该接口上与网关地址族相同的第一个地址，LocalAddr非空时忽略
+	// 请求内容配置
+	LegacyEscapedCRLF bool // 兼容旧版：发送前将字符串请求中的字面量\r\n替换为CRLF，默认false
+	// 流式响应中等待下一个帧的超时，超时后丢弃该流并返回超时错误，默认10s
+	ResponseIdleTimeout time.Duration
+	// 加密配置
+	EnableAES bool // 是否使用AES加密会话，SendInit据此选择加密或不加密的初始化方式，默认false
+	// 加密会话使用的加密套件，通过包头Option字段与网关协商，默认utils.CipherLegacyCBC
+	CipherSuite utils.CipherSuite
+	// TLS配置，默认校验网关证书
+	RootCAs            *x509.CertPool                     // 校验网关证书的根证书池，nil时使用系统根证书
+	RootCAFile         string                             // PEM格式的根证书文件，追加到RootCAs
+	SPKIPins           []string                           // 固定的网关证书公钥指纹（SHA-256，base64编码），见SPKIPin
+	ClientCertificate  *tls.Certificate                   // 双向认证使用的客户端证书
+	ClientCertFile     string                             // PEM格式的客户端证书文件，ClientCertificate为nil时使用
+	ClientKeyFile      string                             // PEM格式的客户端私钥文件
+	TLSServerName      string                             // SNI和证书校验使用的服务器名称，为空时使用连接地址中的主机名
+	TLSMinVersion      uint16                             // TLS最低版本，QUIC要求TLS 1.3，默认tls.VersionTLS13
+	VerifyConnection   func(cs tls.ConnectionState) error // 握手完成后的自定义校验，在证书和SPKI校验之后调用
+	InsecureSkipVerify bool                               // 跳过网关证书校验，仅用于测试环境，SPKIPins仍然生效，默认false
+	// 会话安全配置，需要网关支持OPTION_SEQUENCED
+	EnableReplayProtection bool          // 加密帧携带序号，拒绝重放和乱序的帧，并支持会话密钥轮换，默认false
+	KeyRotationInterval    time.Duration // 会话密钥轮换周期，到期后在下一次请求前轮换，0表示不自动轮换
+	MaxClockSkew           time.Duration // 允许的网关时间偏差，默认5分钟
+	// 日志配置，为nil时使用SetLogger设置的默认日志，默认不输出
+	// 会话密钥和请求、响应数据只在LevelTrace级别输出，其他级别一律脱敏
+	Logger *slog.Logger
+	// 指标配置，为nil时不记录指标
+	Metrics Metrics
+	// 链路追踪配置
+	TracerProvider trace.TracerProvider          // 创建span使用的TracerProvider，为nil时使用otel.GetTracerProvider()
+	Propagator     propagation.TextMapPropagator // 注入隧道内HTTP请求头部的链路上下文格式，为nil时使用W3C Trace Context
+	// 协议调试配置，输出的文件包含可以解密流量的信息，仅用于调试
+	QlogDir    string // 非空时为每个连接在该目录下写入quic-go的qlog文件，文件名为<ODCID>_client.sqlog
+	KeyLogFile string // 非空时以SSLKEYLOGFILE格式向该文件追加TLS会话密钥，可用于Wireshark解密抓包
+	// 帧跟踪，非nil时观察流和数据报上收发的每个EMM帧，NewFrameTraceWriter可输出为文本或JSON Lines
+	FrameTracer FrameTracer
 }
 
 // NewTransferClient 创建新的传输客户端
@@ -52,11 +129,31 @@ func NewTransferClient(serverAddr string, config *Config) *TransferClient {
 	if config.RetryInterval <= 0 {
 		config.RetryInterval = 2 * time.Second
 	}
+	if config.MaxClockSkew <= 0 {
+		config.MaxClockSkew = 5 * time.Minute
+	}
+	if config.HappyEyeballsDelay <= 0 {
+		config.HappyEyeballsDelay = defaultHappyEyeballsDelay
+	}
+	if config.ResponseIdleTimeout <= 0 {
+		config.ResponseIdleTimeout = 10 * time.Second
+	}
+	if config.ProtocolType == 0 {
+		config.ProtocolType = proto.PROTO_TYPE_HTTP
+	}
+	config.setQUICDefaults()
 	// EnableConnectRetry默认为false，不需要设置默认值
 
+	metrics := config.Metrics
+	if metrics == nil {
+		metrics = NopMetrics{}
+	}
 	return &TransferClient{
 		serverAddr: serverAddr,
 		config:     config,
+		log:        newLogger(config, serverAddr),
+		metrics:    metrics,
+		tracer:     newTracer(config),
 	}
 }
 
@@ -65,6 +162,23 @@ func (c *TransferClient) Connect(ctx context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	return c.connectLocked(ctx)
+}
+
+// connectLocked 建立QUIC连接并打开流，调用方需持有c.mu
+func (c *TransferClient) connectLocked(ctx context.Context) (err error) {
+	ctx, span := c.startSpan(ctx, spanConnect)
+	defer func() {
+		if err == nil {
+			span.SetAttributes(
+				attrRemoteAddr.String(c.info.RemoteAddr.String()),
+				attrALPN.String(c.conn.ConnectionState().TLS.NegotiatedProtocol),
+				attrAttempts.Int(c.info.Attempts),
+			)
+		}
+		endSpan(span, err)
+	}()
+
 	// 解析服务器地址
 	host, port, err := net.SplitHostPort(c.serverAddr)
 	if err != nil {
@@ -80,113 +194,62 @@ func (c *TransferClient) Connect(ctx context.Context) error {
 		}
 	}
 
-	// 获取本地 IP 地址
-	localIP, err := getLocalIPv4()
+	addrs, err := c.resolveGateway(ctx, host, port)
 	if err != nil {
-		return fmt.Errorf("获取本地IP地址失败: %v", err)
+		return err
 	}
+	return c.connectFromLocked(ctx, host, addrs, c.localUDPAddr)
+}
 
-	// 创建本地 UDP 地址
-	laddr := &net.UDPAddr{
-		IP:   localIP,
-		Port: 0, // 随机端口
+// connectFromLocked 按Happy Eyeballs方式与网关地址列表建立QUIC连接，成功后替换当前连接，调用方需持有c.mu
+// localAddr返回连接各网关地址时绑定的本地地址，新连接建立失败时保留原有连接
+func (c *TransferClient) connectFromLocked(ctx context.Context, host string, addrs []*net.UDPAddr, localAddr func(*net.UDPAddr) (*net.UDPAddr, error)) error {
+	// TLS 配置
+	tlsConf, err := c.newTLSConfig(host)
+	if err != nil {
+		return fmt.Errorf("TLS配置错误: %v", err)
 	}
 
-	// 创建 UDP 连接
-	udpConn, err := net.ListenUDP("udp4", laddr)
+	// QUIC 配置
+	quicConfig, err := c.newQUICConfig()
 	if err != nil {
-		return fmt.Errorf("创建UDP连接失败: %v", err)
+		return fmt.Errorf("QUIC配置错误: %v", err)
 	}
-	defer func() {
-		if err != nil {
-			udpConn.Close()
-		}
-	}()
 
-	// 设置 UDP 连接选项
-	if err := udpConn.SetReadBuffer(1024 * 1024); err != nil {
-		// 继续执行，即使设置缓冲区失败
-	}
-	if err := udpConn.SetWriteBuffer(1024 * 1024); err != nil {
-		// 继续执行，即使设置缓冲区失败
-	}
+	tlsConf.ClientSessionCache = c.sessionCache()
 
-	// TLS 配置
-	tlsConf := &tls.Config{
-		InsecureSkipVerify: true,
-		NextProtos: []string{
-			"hq-interop",
-			"h3-25",
-			"h3-24",
-			"h3-23",
-			"hq-29",
-			"hq-28",
-			"hq-27",
-			"http/0.9",
-		},
-		ServerName: host,
-		MinVersion: tls.VersionTLS12,
-		MaxVersion: tls.VersionTLS13,
-		CipherSuites: []uint16{
-			tls.TLS_AES_128_GCM_SHA256,
-			tls.TLS_AES_256_GCM_SHA384,
-			tls.TLS_CHACHA20_POLY1305_SHA256,
-		},
-	}
-
-	// QUIC 配置
-	quicConfig := &quic.Config{
-		KeepAlivePeriod:         2 * time.Second,
-		MaxIdleTimeout:          30 * time.Second,
-		HandshakeIdleTimeout:    10 * time.Second,
-		MaxIncomingStreams:      100,
-		EnableDatagrams:         true,
-		DisablePathMTUDiscovery: false,
-		Versions:                []quic.Version{quic.Version1},
-	}
-
-	// 定义要尝试的协议组合
-	protocolCombinations := [][]string{
-		{"hq-interop", "h3-25", "h3-24", "h3-23"},
-		{"hq-29", "hq-28", "hq-27"},
-		{"h3-25", "h3-24", "h3-23"},
-		{"hq-interop"},
-		{"http/0.9"},
-	}
-
-	// 尝试不同的连接方式和协议组合
+	// 按ALPN策略依次尝试协议组合，每组在各网关地址上竞速握手，成功的组合记入缓存
 	var conn quic.Connection
+	var transport *quic.Transport
 	var connectionError error
-
-	if c.config.EnableConnectRetry {
-		// 启用连接重试逻辑：尝试不同的协议组合
-		// 首先尝试使用 quic.DialAddr
-		for _, protocols := range protocolCombinations {
-			tlsConf.NextProtos = protocols
-			conn, err = quic.DialAddr(ctx, c.serverAddr, tlsConf, quicConfig)
-			if err == nil {
-				break
-			}
-			connectionError = err
+	var protocols []string
+	attempts := 0
+	cache := c.alpnCache()
+	for i, candidate := range c.alpnCandidates() {
+		tlsConf.NextProtos = candidate
+		var n int
+		start := time.Now()
+		attemptCtx, span := c.startSpan(ctx, spanALPNAttempt, attrALPNCandidates.StringSlice(candidate))
+		conn, transport, n, err = c.raceDial(attemptCtx, addrs, localAddr, tlsConf, quicConfig)
+		attempts += n
+		span.SetAttributes(attrAttempts.Int(n))
+		if err == nil {
+			alpn := conn.ConnectionState().TLS.NegotiatedProtocol
+			span.SetAttributes(attrALPN.String(alpn))
+			endSpan(span, nil)
+			c.metrics.ConnectDone(alpn, time.Since(start), nil)
+			protocols = candidate
+			break
 		}
-
-		// 如果所有协议组合都失败，尝试使用 quic.DialAddrEarly
-		if conn == nil {
-			for _, protocols := range protocolCombinations {
-				tlsConf.NextProtos = protocols
-				conn, err = quic.DialAddrEarly(ctx, c.serverAddr, tlsConf, quicConfig)
-				if err == nil {
-					break
-				}
-				connectionError = err
-			}
+		endSpan(span, err)
+		c.metrics.ConnectDone(strings.Join(candidate, ","), time.Since(start), err)
+		connectionError = err
+		// 缓存的组合不再可用时删除，下次连接重新按配置顺序尝试
+		if i == 0 {
+			cache.Forget(c.serverAddr)
 		}
-	} else {
-		// 不启用连接重试逻辑：只尝试第一种协议组合
-		tlsConf.NextProtos = protocolCombinations[0]
-		conn, err = quic.DialAddr(ctx, c.serverAddr, tlsConf, quicConfig)
-		if err != nil {
-			connectionError = err
+		if ctx.Err() != nil {
+			break
 		}
 	}
 
@@ -194,139 +257,183 @@ func (c *TransferClient) Connect(ctx context.Context) error {
 	if conn == nil {
 		return fmt.Errorf("连接QUIC服务器失败: %v", connectionError)
 	}
+	cache.Set(c.serverAddr, protocols)
 
-	// 关闭旧的连接（如果存在）
-	if c.conn != nil {
-		c.conn.CloseWithError(0, "replacing old connection")
-	}
-
-	// 关闭旧的流（如果存在）
-	if c.stream != nil {
-		c.stream.Close()
-	}
-
-	c.conn = conn
-
-	// 尝试打开流
-	stream, err := conn.OpenStreamSync(ctx)
+	// 先在新连接上打开流，失败时关闭新连接及其UDP套接字，保留原有连接
+	traced := c.traceConn(conn)
+	stream, err := traced.OpenStreamSync(ctx)
 	if err != nil {
 		conn.CloseWithError(0, "failed to open stream")
+		if transport != nil {
+			closeTransport(transport)
+		}
 		return fmt.Errorf("打开QUIC流失败: %v", err)
 	}
+
+	// 关闭旧的流和连接（如果存在）
+	c.closeLocked("replacing old connection")
+
+	c.conn = traced
+	c.transport = transport
 	c.stream = stream
+	c.early = nil
+	if early, ok := conn.(quic.EarlyConnection); ok && c.config.Enable0RTT {
+		select {
+		case <-early.HandshakeComplete():
+		default:
+			c.early = early
+		}
+	}
+	// 新连接上网关没有会话状态，需要重新初始化
+	c.session = nil
+	c.initialized = false
+	c.info = &ConnectionInfo{
+		RemoteAddr:  conn.RemoteAddr(),
+		LocalAddr:   conn.LocalAddr(),
+		Network:     udpNetwork(conn.RemoteAddr().(*net.UDPAddr)),
+		Protocols:   protocols,
+		Attempts:    attempts,
+		ConnectedAt: time.Now(),
+	}
+
+	c.log.Debug("已连接网关", "remote", conn.RemoteAddr().String(), "local", conn.LocalAddr().String(),
+		"alpn", conn.ConnectionState().TLS.NegotiatedProtocol, "attempts", attempts, "0rtt", c.early != nil)
+	return nil
+}
 
+// reconnectLocked 连接断开后重新建立连接，原连接已完成INIT时在新连接上以相同的方式重新初始化，调用方需持有c.mu
+// 加密会话重连后仍发送加密的INIT，不会退回明文；重新初始化失败时关闭新连接，之后的请求返回"连接未建立"
+func (c *TransferClient) reconnectLocked(ctx context.Context) error {
+	initialized, encrypted := c.initialized, c.session != nil
+	if err := c.connectLocked(ctx); err != nil {
+		return err
+	}
+	if !initialized {
+		return nil
+	}
+	if _, _, err := c.reinitLocked(ctx, encrypted); err != nil {
+		c.closeLocked("reinitialization failed")
+		c.conn, c.stream = nil, nil
+		return fmt.Errorf("重新连接后初始化失败: %v", err)
+	}
 	return nil
 }
 
+// reinitLocked 在新连接上重新发送INIT，encrypted表示原会话是否加密，与Config.EnableAES无关，调用方需持有c.mu
+func (c *TransferClient) reinitLocked(ctx context.Context, encrypted bool) (int, int, error) {
+	if encrypted {
+		return c.initWith0RTTFallbackLocked(ctx, true, c.sendInitAESLocked)
+	}
+	return c.initWith0RTTFallbackLocked(ctx, false, c.sendInitNoAESLocked)
+}
+
 // Close 关闭连接
 func (c *TransferClient) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	c.closeLocked("normal closure")
+	if c.keyLog != nil {
+		c.keyLog.Close()
+		c.keyLog = nil
+	}
+	return nil
+}
+
+// closeLocked 关闭当前的流、连接以及连接使用的UDP套接字，调用方需持有c.mu
+func (c *TransferClient) closeLocked(reason string) {
+	if c.datagram != nil {
+		c.datagram.Close()
+		c.datagram = nil
+	}
 	if c.stream != nil {
 		c.stream.Close()
 	}
 	if c.conn != nil {
-		c.conn.CloseWithError(0, "normal closure")
+		c.conn.CloseWithError(0, reason)
+	}
+	if c.transport != nil {
+		closeTransport(c.transport)
+		c.transport = nil
 	}
-	return nil
 }
 
-// SendInitRequest 发送初始化请求
-func (c *TransferClient) SendInitRequest() error {
-	reqUUID, _ := uuid.NewUUID()
-	initTime := time.Now().Unix()
-	initAESKey := utils.NewKey(reqUUID.String(), initTime)
-
-	initBytes := c.transferInitByAES(c.config.ServerID, proto.PROTO_TYPE_HTTP, c.config.ServerName,
-		"si:"+c.config.SessionID, reqUUID, initTime, utils.InitKey)
+// SendInit 根据Config.EnableAES选择加密或不加密的方式发送初始化请求
+// 返回发送字节数、接收字节数以及可能的错误
+func (c *TransferClient) SendInit() (int, int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	if _, err := c.stream.Write(initBytes); err != nil {
-		return fmt.Errorf("发送初始化请求失败: %v", err)
-	}
+	return c.initLocked(context.Background())
+}
 
-	// 读取响应
-	responseBuffer := make([]byte, 1024)
-	n, err := c.stream.Read(responseBuffer)
-	if err != nil {
-		return fmt.Errorf("读取初始化响应失败: %v", err)
+// initLocked 根据Config.EnableAES发送初始化请求，调用方需持有c.mu
+func (c *TransferClient) initLocked(ctx context.Context) (int, int, error) {
+	if !c.config.EnableAES {
+		return c.initWith0RTTFallbackLocked(ctx, false, c.sendInitNoAESLocked)
 	}
+	return c.initWith0RTTFallbackLocked(ctx, true, c.sendInitAESLocked)
+}
 
-	_, cmd, _, result, _ := c.parseMessageByAES(responseBuffer, n, initAESKey)
-
-	if cmd != proto.EMM_COMMAND_INIT_ACK {
-		return fmt.Errorf("收到非预期的响应命令: %d", cmd)
-	}
-	if result != proto.AUTH_STATUS_CODE_SUCCESS {
-		return fmt.Errorf("初始化失败，错误码: %d", result)
-	}
+// SendInitRequest 发送AES加密的初始化请求，成功后客户端进入加密会话模式
+// 之后的SendTransferRequest、SendTransferBytes、SendTransferStream和下载请求都使用协商得到的会话密钥
+func (c *TransferClient) SendInitRequest() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	return nil
+	ctx := context.Background()
+	_, _, err := c.initWith0RTTFallbackLocked(ctx, true, c.sendInitAESLocked)
+	return err
 }
 
-// SendTransferRequest 发送传输请求
+// SendTransferRequest 在加密会话中发送传输请求，需先调用SendInitRequest
 func (c *TransferClient) SendTransferRequest(content string) ([]byte, error) {
-	reqUUID, _ := uuid.NewUUID()
-	initTime := time.Now().Unix()
-	initAESKey := utils.NewKey(reqUUID.String(), initTime)
-
 	// 处理消息内容
-	fixedContent := strings.Replace(content, "\\r\\n", "\r\n", -1)
-
-	requestInfo := c.transferRequestByAES(fixedContent, initAESKey)
-
-	if _, err := c.stream.Write(requestInfo); err != nil {
-		return nil, fmt.Errorf("发送传输请求失败: %v", err)
+	if c.config.LegacyEscapedCRLF {
+		content = fixEscapedCRLF(content)
 	}
 
-	// 读取响应
-	responseBuffer := make([]byte, 32*1024)
-	responseBytes := []byte{}
-	currentSize := 0
-
-	for {
-		n, err := c.stream.Read(responseBuffer[currentSize:])
-		if err != nil {
-			break
-		}
-		if n < 0 {
-			break
-		}
-
-		currentSize += n
-
-		_, cmd, _, _, body := c.parseMessageByAES(responseBuffer, currentSize, initAESKey)
-
-		if body != nil {
-			responseBytes = append(responseBytes, body...)
-		}
-
-		if cmd == proto.EMM_COMMAND_LINK_CLOSE {
-			break
-		}
+	c.mu.Lock()
+	encrypted := c.session != nil
+	c.mu.Unlock()
+	if !encrypted {
+		return nil, errSessionNotInitialized
 	}
 
-	return responseBytes, nil
+	response, _, _, err := c.SendTransferBytes(context.Background(), []byte(content))
+	return response, err
 }
 
 // SendInitRequestNoAES 发送不使用AES加密的初始化请求
+// 使用0-RTT时INIT请求在早期数据中发送，网关拒绝0-RTT时在完整握手后自动重发
 func (c *TransferClient) SendInitRequestNoAES() (int, int, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	return c.initWith0RTTFallbackLocked(context.Background(), false, c.sendInitNoAESLocked)
+}
+
+// sendInitNoAESLocked 发送不加密的初始化请求，调用方需持有c.mu
+func (c *TransferClient) sendInitNoAESLocked(ctx context.Context) (int, int, error) {
 	var sentBytes, receivedBytes int
 
-	if c.conn == nil || c.stream == nil {
+	if c.conn == nil {
 		return 0, 0, fmt.Errorf("连接未建立或已关闭")
 	}
+	if err := c.ensureStreamLocked(context.Background()); err != nil {
+		return 0, 0, err
+	}
 
-	initBytes := transferInit(c.config.ServerID, proto.PROTO_TYPE_HTTP, c.config.ServerName, "si:"+c.config.SessionID)
+	initBytes := transferInit(c.config.ServerID, c.config.ProtocolType, c.config.ServerName, "si:"+c.config.SessionID)
 	if initBytes == nil {
 		return 0, 0, fmt.Errorf("构造初始化请求失败")
 	}
 
 	n, err := c.stream.Write(initBytes)
 	sentBytes += n
+	if errors.Is(err, quic.Err0RTTRejected) {
+		return sentBytes, 0, err
+	}
 	if err != nil {
 		return sentBytes, 0, fmt.Errorf("发送初始化请求失败: %v", err)
 	}
@@ -359,8 +466,15 @@ func (c *TransferClient) SendInitRequestNoAES() (int, int, error) {
 		if n > 0 {
 			receivedBytes += n
 		}
+		// 网关应答后立即关闭流时，应答和EOF一起返回
+		if readErr == io.EOF && n > 0 {
+			readErr = nil
+		}
 
 		if readErr != nil {
+			if errors.Is(readErr, quic.Err0RTTRejected) {
+				return sentBytes, receivedBytes, readErr
+			}
 			if readErr == io.EOF {
 				if retry < maxRetries-1 {
 					newStream, streamErr := c.conn.OpenStreamSync(context.Background())
@@ -415,18 +529,51 @@ func (c *TransferClient) SendInitRequestNoAES() (int, int, error) {
 	if cmd != proto.EMM_COMMAND_INIT_ACK {
 		return sentBytes, receivedBytes, fmt.Errorf("收到非预期的响应命令: %d", cmd)
 	}
+	c.metrics.GatewayResult(cmd, result)
+	trace.SpanFromContext(ctx).SetAttributes(attrResultCode.Int(int(result)))
 	if result != proto.AUTH_STATUS_CODE_SUCCESS {
-		return sentBytes, receivedBytes, fmt.Errorf("初始化失败，错误码: %d", result)
+		return sentBytes, receivedBytes, &GatewayError{Command: cmd, Result: result}
 	}
 
+	c.initialized = true
+	c.log.Debug("初始化完成", "command", proto.EMM_COMMAND_INIT, "sent_bytes", sentBytes, "recv_bytes", receivedBytes, "aes", false)
 	return sentBytes, receivedBytes, nil
 }
 
 // SendTransferRequestNoAES 发送不使用AES加密的传输请求
+// 仅当Config.LegacyEscapedCRLF为true时才会将content中的字面量\r\n替换为CRLF
 func (c *TransferClient) SendTransferRequestNoAES(content string) ([]byte, int, int, error) {
+	if c.config.LegacyEscapedCRLF {
+		content = fixEscapedCRLF(content)
+	}
+	return c.sendTransferNoAES([]byte(content))
+}
+
+// SendHTTPRequestNoAES 使用HTTPRequest构造器生成请求字节，并以不加密的方式发送
+func (c *TransferClient) SendHTTPRequestNoAES(req *HTTPRequest) ([]byte, int, int, error) {
+	payload, err := req.Bytes()
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("构造HTTP请求失败: %v", err)
+	}
+	return c.sendTransferNoAES(payload)
+}
+
+// sendTransferNoAES 将payload原样封装为EMM_COMMAND_TRAN帧发送并读取响应
+func (c *TransferClient) sendTransferNoAES(payload []byte) ([]byte, int, int, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	start := time.Now()
+	ctx, span := c.startSpan(context.Background(), spanTransfer, attrAES.Bool(false))
+	data, sentBytes, receivedBytes, err := c.sendTransferNoAESLocked(c.injectTraceContext(ctx, payload))
+	c.metrics.TransferDone(time.Since(start), int64(sentBytes), int64(receivedBytes), err)
+	span.SetAttributes(attrSentBytes.Int(sentBytes), attrReceivedBytes.Int(receivedBytes))
+	endSpan(span, err)
+	return data, sentBytes, receivedBytes, err
+}
+
+// sendTransferNoAESLocked 发送不加密的传输请求并读取响应，失败时按Config.MaxRetries重试，调用方需持有c.mu
+func (c *TransferClient) sendTransferNoAESLocked(payload []byte) ([]byte, int, int, error) {
 	var sentBytes, receivedBytes int
 
 	if c.conn == nil {
@@ -434,14 +581,12 @@ func (c *TransferClient) SendTransferRequestNoAES(content string) ([]byte, int,
 	}
 
 	if c.conn.Context().Err() != nil {
-		if err := c.Connect(context.Background()); err != nil {
+		if err := c.reconnectLocked(context.Background()); err != nil {
 			return nil, 0, 0, fmt.Errorf("重新建立连接失败: %v", err)
 		}
 	}
 
-	fixedContent := strings.Replace(content, "\\r\\n", "\r\n", -1)
-
-	requestInfo := transferRequest(fixedContent)
+	requestInfo := transferRequest(payload)
 
 	// 设置读取超时
 	readTimeout := 10 * time.Second
@@ -450,6 +595,9 @@ func (c *TransferClient) SendTransferRequestNoAES(content string) ([]byte, int,
 	var responseBytes []byte
 
 	for retry := 0; retry < maxRetries; retry++ {
+		if retry > 0 {
+			c.metrics.Retry(RetryTransfer)
+		}
 		if c.stream == nil {
 			stream, err := c.conn.OpenStreamSync(context.Background())
 			if err != nil {
@@ -495,7 +643,8 @@ func (c *TransferClient) SendTransferRequestNoAES(content string) ([]byte, int,
 			c.stream = nil
 
 			if strings.Contains(err.Error(), "Application error 0x0") {
-				if err := c.Connect(context.Background()); err != nil {
+				if err := c.reconnectLocked(context.Background()); err != nil && c.conn == nil {
+					return nil, sentBytes, receivedBytes, fmt.Errorf("重新建立连接失败: %v", err)
 				}
 			}
 
@@ -581,7 +730,7 @@ func transferInit(serverid int, protocoltype int, appname string, sessionid stri
 	return result
 }
 
-func transferRequest(requestinfo string) []byte {
+func transferRequest(requestinfo []byte) []byte {
 	head := proto.TransferHeader{
 		Tag:       proto.HEAD_TAG,
 		Version:   proto.PROTO_VERSION,
@@ -600,7 +749,7 @@ func transferRequest(requestinfo string) []byte {
 	}
 
 	buf.WriteBytes(headBytes)
-	buf.WriteBytes([]byte(requestinfo))
+	buf.WriteBytes(requestinfo)
 
 	result := buf.Bytes()
 
@@ -608,14 +757,14 @@ func transferRequest(requestinfo string) []byte {
 }
 
 func (c *TransferClient) transferInitByAES(serverID int, protocolType int, serverName string,
-	sessionID string, reqUUID uuid.UUID, timeStamp int64, initAESKey string) []byte {
+	sessionID string, reqUUID uuid.UUID, timeStamp int64, initAESKey string, option uint8) ([]byte, error) {
 	msg := &proto.UdpMessage{
 		Head: proto.TransferHeader{
 			Tag:       proto.HEAD_TAG,
 			Version:   proto.PROTO_VERSION,
 			Command:   proto.EMM_COMMAND_INIT,
 			ProtoType: uint8(protocolType),
-			Option:    0,
+			Option:    option,
 			Reserve:   0,
 		},
 	}
@@ -632,48 +781,16 @@ func (c *TransferClient) transferInitByAES(serverID int, protocolType int, serve
 
 	rawBody := bodyBuf.Bytes()
 
-	encryptedBody, err := utils.EncryptAES([]byte(initAESKey), rawBody)
+	suite := utils.CipherSuite(option & proto.OPTION_CIPHER_MASK)
+	encryptedBody, err := suite.Encrypt([]byte(initAESKey), rawBody)
 	if err != nil {
-	} else {
+		return nil, err
 	}
 
 	msg.Body = encryptedBody
 	msg.Head.DataLen = uint32(len(encryptedBody))
 
-	data, err := msg.Marshal()
-	if err != nil {
-	} else {
-	}
-	return data
-}
-
-func (c *TransferClient) transferRequestByAES(content string, initAESKey string) []byte {
-	msg := &proto.UdpMessage{
-		Head: proto.TransferHeader{
-			Tag:       proto.HEAD_TAG,
-			Version:   proto.PROTO_VERSION,
-			Command:   proto.EMM_COMMAND_TRAN,
-			ProtoType: uint8(proto.PROTO_TYPE_HTTP),
-			Option:    0,
-			Reserve:   0,
-		},
-	}
-
-	rawContent := []byte(content)
-
-	encryptedBody, err := utils.EncryptAES([]byte(initAESKey), rawContent)
-	if err != nil {
-	} else {
-	}
-
-	msg.Body = encryptedBody
-	msg.Head.DataLen = uint32(len(encryptedBody))
-
-	data, err := msg.Marshal()
-	if err != nil {
-	} else {
-	}
-	return data
+	return msg.Marshal()
 }
 
 func parseMessage(message []byte, msgLength int) (int, uint16, uint32, uint16, string) {
@@ -717,70 +834,6 @@ func parseMessage(message []byte, msgLength int) (int, uint16, uint32, uint16, s
 	return msglen, msg.Head.Command, msg.Head.DataLen, msg.Head.Result, ""
 }
 
-func (c *TransferClient) parseMessageByAES(message []byte, length int, initAESKey string) (int, uint16, uint32, uint16, []byte) {
-	resp := &proto.UdpResponseMessage{}
-	resp.ParseHead(message[:proto.RESPONSE_HEAD_LEN])
-
-	if resp.Head.DataLen > 0 {
-		resp.ParseBody(message, int(resp.Head.DataLen))
-		if len(resp.Body) > 0 {
-			decryptedBody, err := utils.DecryptAES([]byte(initAESKey), resp.Body)
-			if err != nil {
-				return resp.Head.Len(), resp.Head.Command, resp.Head.DataLen, resp.Head.Result, nil
-			}
-
-			return resp.Head.Len(), resp.Head.Command, resp.Head.DataLen, resp.Head.Result, decryptedBody
-		}
-	}
-
-	return resp.Head.Len(), resp.Head.Command, resp.Head.DataLen, resp.Head.Result, nil
-}
-
-func getLocalIPv4() (net.IP, error) {
-	interfaces, err := net.Interfaces()
-	if err != nil {
-		return nil, fmt.Errorf("获取网络接口失败: %v", err)
-	}
-
-	for _, iface := range interfaces {
-		if iface.Flags&net.FlagUp == 0 {
-			continue
-		}
-		if iface.Flags&net.FlagLoopback != 0 {
-			continue
-		}
-
-		addrs, err := iface.Addrs()
-		if err != nil {
-			continue
-		}
-
-		for _, addr := range addrs {
-			ipNet, ok := addr.(*net.IPNet)
-			if !ok {
-				continue
-			}
-
-			ip := ipNet.IP.To4()
-			if ip == nil {
-				continue
-			}
-
-			if ip[0] == 127 {
-				continue
-			}
-
-			if ip[0] == 169 && ip[1] == 254 {
-				continue
-			}
-
-			return ip, nil
-		}
-	}
-
-	return nil, fmt.Errorf("未找到合适的IPv4地址")
-}
-
 func checkNetworkConnectivity(host string, port string) error {
 	address := net.JoinHostPort(host, port)
 	conn, err := net.DialTimeout("tcp", address, 5*time.Second)
@@ -2,8 +2,11 @@ package client
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
+
+	"github.com/laotiannai/quic_gwclient/proto"
 )
 
 func TestNewTransferClient(t *testing.T) {
@@ -98,3 +101,17 @@ func TestTransferClient_SendTransferRequest(t *testing.T) {
 
 	defer client.Close()
 }
+
+func TestTransferClient_InitRejected(t *testing.T) {
+	for _, aes := range []bool{false, true} {
+		g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: aes})
+		g.rejectInit.Store(true)
+		c := g.newTestClient(t, &Config{EnableAES: aes})
+
+		_, _, err := c.SendInit()
+		var gwErr *GatewayError
+		if !errors.As(err, &gwErr) || gwErr.Command != proto.EMM_COMMAND_INIT_ACK || gwErr.Result == proto.AUTH_STATUS_CODE_SUCCESS {
+			t.Errorf("aes=%v: expected INIT_ACK GatewayError, got %v", aes, err)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/proto"
+	"github.com/quic-go/quic-go"
+)
+
+// datagramReplayWindow 协商了序号时数据报防重放窗口的大小，早于窗口的数据报被丢弃
+const datagramReplayWindow = 64
+
+var errDatagramReplay = errors.New("数据报序号重复或过旧")
+
+// DatagramConn 基于QUIC数据报的不可靠传输通道，实现net.PacketConn
+// 每个数据报携带一个完整的EMM帧：发送EMM_COMMAND_TRAN，网关以EMM_COMMAND_TRAN_ACK返回，
+// 数据报之间没有顺序保证，丢失后不会重传，也不会阻塞其他数据报，适合RTP/RTCP等实时媒体流
+// 网关按INIT中的协议类型转发数据，WriteTo的目标地址被忽略，ReadFrom返回的地址总是网关地址
+type DatagramConn struct {
+	conn      quic.Connection
+	protoType uint8
+	ctx       context.Context
+	cancel    context.CancelCauseFunc
+
+	mu            sync.Mutex
+	session       *aesSession // 数据报使用的加密会话副本，sendSeq为数据报的发送序号，nil表示不加密
+	replay        replayWindow
+	readDeadline  time.Time
+	writeDeadline time.Time
+	readWake      chan struct{} // 读超时时间修改时关闭，唤醒阻塞的ReadFrom
+}
+
+// replayWindow 数据报防重放窗口，记录最近datagramReplayWindow个序号的接收情况
+type replayWindow struct {
+	next uint64 // 已收到的最大序号+1
+	mask uint64 // 第i位表示序号next-1-i已收到
+}
+
+// accept 检查序号是否可以接收，可以接收时记录该序号
+func (w *replayWindow) accept(seq uint64) bool {
+	if seq >= w.next {
+		if shift := seq - w.next + 1; shift >= datagramReplayWindow {
+			w.mask = 0
+		} else {
+			w.mask <<= shift
+		}
+		w.mask |= 1
+		w.next = seq + 1
+		return true
+	}
+	diff := w.next - 1 - seq
+	if diff >= datagramReplayWindow || w.mask&(1<<diff) != 0 {
+		return false
+	}
+	w.mask |= 1 << diff
+	return true
+}
+
+var _ net.PacketConn = (*DatagramConn)(nil)
+
+// isDatagramProtocol 判断协议类型是否通过数据报通道转发
+func isDatagramProtocol(protocolType int) bool {
+	switch protocolType {
+	case proto.PROTO_TYPE_UDP, proto.PROTO_TYPE_RTP, proto.PROTO_TYPE_RTCP:
+		return true
+	}
+	return false
+}
+
+// OpenDatagramConn 在当前连接上打开数据报通道，需要先完成INIT，且Config.ProtocolType为
+// PROTO_TYPE_UDP、PROTO_TYPE_RTP或PROTO_TYPE_RTCP
+// 建立了加密会话时数据报使用会话密钥加密，协商了序号时按窗口拒绝重放的数据报，允许乱序
+// 同一连接上同时只能打开一个数据报通道，连接关闭、重连或迁移后通道失效，需要重新打开
+func (c *TransferClient) OpenDatagramConn() (*DatagramConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !isDatagramProtocol(c.config.ProtocolType) {
+		return nil, fmt.Errorf("协议类型%#x不支持数据报通道", c.config.ProtocolType)
+	}
+	if c.conn == nil {
+		return nil, errNotConnected
+	}
+	if !c.initialized {
+		return nil, fmt.Errorf("连接未初始化，请先调用SendInit")
+	}
+	if !c.conn.ConnectionState().SupportsDatagrams {
+		return nil, fmt.Errorf("网关不支持QUIC数据报")
+	}
+	if c.datagram != nil && c.datagram.ctx.Err() == nil {
+		return nil, fmt.Errorf("数据报通道已打开")
+	}
+
+	ctx, cancel := context.WithCancelCause(c.conn.Context())
+	d := &DatagramConn{
+		conn:      c.conn,
+		protoType: uint8(c.config.ProtocolType),
+		ctx:       ctx,
+		cancel:    cancel,
+		readWake:  make(chan struct{}),
+	}
+	c.datagram = d
+	c.syncDatagramLocked()
+	return d, nil
+}
+
+// syncDatagramLocked 加密会话建立或密钥轮换后更新数据报通道的密钥，调用方需持有c.mu
+// 数据报的序号与流上的帧序号相互独立，切换密钥时保持不变
+func (c *TransferClient) syncDatagramLocked() {
+	d := c.datagram
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if c.session == nil {
+		d.session = nil
+		return
+	}
+	var sendSeq uint64
+	if d.session != nil {
+		sendSeq = d.session.sendSeq
+	}
+	s := *c.session
+	s.sendSeq, s.recvSeq = sendSeq, 0
+	d.session = &s
+}
+
+// ReadFrom 读取一个数据报的数据，p不足以容纳数据时多余部分被丢弃
+// 格式错误、解密失败或重放的数据报被直接丢弃，网关以错误码关闭链路时返回*GatewayError
+func (d *DatagramConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		d.mu.Lock()
+		deadline, wake := d.readDeadline, d.readWake
+		d.mu.Unlock()
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return 0, nil, os.ErrDeadlineExceeded
+		}
+
+		ctx, cancel := d.ctx, context.CancelFunc(nil)
+		if deadline.IsZero() {
+			ctx, cancel = context.WithCancel(ctx)
+		} else {
+			ctx, cancel = context.WithDeadline(ctx, deadline)
+		}
+		go func() {
+			select {
+			case <-wake:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		data, err := d.conn.ReceiveDatagram(ctx)
+		cancel()
+		if err != nil {
+			if d.ctx.Err() != nil {
+				if cause := context.Cause(d.ctx); errors.Is(cause, net.ErrClosed) || errors.As(cause, new(*GatewayError)) {
+					return 0, nil, cause
+				}
+				return 0, nil, fmt.Errorf("连接已关闭: %v", context.Cause(d.ctx))
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				return 0, nil, os.ErrDeadlineExceeded
+			}
+			if errors.Is(err, context.Canceled) {
+				// 读超时时间被修改，按新的时间重新等待
+				continue
+			}
+			return 0, nil, fmt.Errorf("接收数据报失败: %v", err)
+		}
+
+		payload, err := d.open(data)
+		if err != nil {
+			var gwErr *GatewayError
+			if errors.As(err, &gwErr) {
+				d.cancel(gwErr)
+				return 0, nil, gwErr
+			}
+			continue
+		}
+		return copy(p, payload), d.conn.RemoteAddr(), nil
+	}
+}
+
+// open 解析网关返回的数据报并解密数据
+func (d *DatagramConn) open(data []byte) ([]byte, error) {
+	if len(data) < proto.RESPONSE_HEAD_LEN {
+		return nil, fmt.Errorf("数据报长度不足: %d 字节", len(data))
+	}
+	msg := &proto.UdpResponseMessage{}
+	msg.ParseHead(data)
+	if msg.Head.Tag != proto.HEAD_TAG {
+		return nil, errInvalidFrameTag
+	}
+	if int(msg.Head.DataLen) != len(data)-proto.RESPONSE_HEAD_LEN {
+		return nil, fmt.Errorf("数据报长度与包头不一致: %d/%d", msg.Head.DataLen, len(data)-proto.RESPONSE_HEAD_LEN)
+	}
+	msg.Body = data[proto.RESPONSE_HEAD_LEN:]
+
+	switch msg.Head.Command {
+	case proto.EMM_COMMAND_TRAN_ACK:
+	case proto.EMM_COMMAND_LINK_CLOSE:
+		if msg.Head.Result != 0 && msg.Head.Result != proto.AUTH_STATUS_CODE_SUCCESS {
+			return nil, &GatewayError{Result: msg.Head.Result}
+		}
+		return nil, fmt.Errorf("数据报中收到非预期的命令: %d", msg.Head.Command)
+	default:
+		return nil, fmt.Errorf("数据报中收到非预期的命令: %d", msg.Head.Command)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.session
+	if s == nil {
+		return msg.Body, nil
+	}
+	if msg.Head.Option != s.option() {
+		return nil, fmt.Errorf("数据报加密选项不一致: %#x", msg.Head.Option)
+	}
+	plain, err := s.suite.Decrypt(s.key, msg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("解密数据报失败: %v", err)
+	}
+	if msg.Head.OriginLen > 0 && int(msg.Head.OriginLen) < len(plain) {
+		plain = plain[:msg.Head.OriginLen]
+	}
+	if !s.sequenced {
+		return plain, nil
+	}
+	if len(plain) < 8 || !d.replay.accept(binary.BigEndian.Uint64(plain)) {
+		return nil, errDatagramReplay
+	}
+	return plain[8:], nil
+}
+
+// WriteTo 将p作为一个数据报发送给网关，addr被忽略
+// 数据报超过路径允许的大小时返回的错误包含*quic.DatagramTooLargeError
+func (d *DatagramConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if d.ctx.Err() != nil {
+		return 0, net.ErrClosed
+	}
+
+	d.mu.Lock()
+	if !d.writeDeadline.IsZero() && !time.Now().Before(d.writeDeadline) {
+		d.mu.Unlock()
+		return 0, os.ErrDeadlineExceeded
+	}
+	body, option := p, uint8(0)
+	if s := d.session; s != nil {
+		sealed, err := s.seal(p)
+		if err != nil {
+			d.mu.Unlock()
+			return 0, fmt.Errorf("加密数据报失败: %v", err)
+		}
+		body, option = sealed, s.option()
+	}
+	d.mu.Unlock()
+
+	frame, err := newTransferFrame(proto.EMM_COMMAND_TRAN, d.protoType, option, body)
+	if err != nil {
+		return 0, err
+	}
+	if err := d.conn.SendDatagram(frame); err != nil {
+		return 0, fmt.Errorf("发送数据报失败: %w", err)
+	}
+	return len(p), nil
+}
+
+// Close 关闭数据报通道，不影响QUIC连接和流上的请求
+func (d *DatagramConn) Close() error {
+	d.cancel(net.ErrClosed)
+	return nil
+}
+
+// LocalAddr 返回本地地址
+func (d *DatagramConn) LocalAddr() net.Addr {
+	return d.conn.LocalAddr()
+}
+
+// RemoteAddr 返回网关地址
+func (d *DatagramConn) RemoteAddr() net.Addr {
+	return d.conn.RemoteAddr()
+}
+
+// SetDeadline 同时设置读写超时时间
+func (d *DatagramConn) SetDeadline(t time.Time) error {
+	d.SetReadDeadline(t)
+	return d.SetWriteDeadline(t)
+}
+
+// SetReadDeadline 设置读超时时间，对阻塞中的ReadFrom同样生效
+func (d *DatagramConn) SetReadDeadline(t time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.readDeadline = t
+	close(d.readWake)
+	d.readWake = make(chan struct{})
+	return nil
+}
+
+// SetWriteDeadline 设置写超时时间，数据报发送不会阻塞，超时后WriteTo直接返回错误
+func (d *DatagramConn) SetWriteDeadline(t time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.writeDeadline = t
+	return nil
+}
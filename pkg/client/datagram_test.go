@@ -0,0 +1,187 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/proto"
+	"github.com/laotiannai/quic_gwclient/utils"
+)
+
+func TestReplayWindow(t *testing.T) {
+	var w replayWindow
+	for _, tc := range []struct {
+		seq  uint64
+		want bool
+	}{
+		{0, true}, {2, true}, {1, true}, {2, false}, {0, false},
+		{100, true}, {36, false}, {37, true}, {99, true}, {37, false},
+	} {
+		if got := w.accept(tc.seq); got != tc.want {
+			t.Errorf("accept(%d) = %v, want %v", tc.seq, got, tc.want)
+		}
+	}
+}
+
+// openTestDatagramConn 连接测试网关，完成INIT后打开数据报通道
+func (g *testGateway) openTestDatagramConn(t *testing.T, config *Config) (*TransferClient, *DatagramConn) {
+	t.Helper()
+
+	config.ProtocolType = proto.PROTO_TYPE_RTP
+	c := g.newTestClient(t, config)
+	if _, _, err := c.SendInit(); err != nil {
+		t.Fatalf("SendInit failed: %v", err)
+	}
+	d, err := c.OpenDatagramConn()
+	if err != nil {
+		t.Fatalf("OpenDatagramConn failed: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return c, d
+}
+
+// echoDatagram 发送一个数据报并等待回显
+func echoDatagram(t *testing.T, d *DatagramConn, payload string) {
+	t.Helper()
+
+	if _, err := d.WriteTo([]byte(payload), nil); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	d.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1500)
+	n, addr, err := d.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+	if string(buf[:n]) != payload {
+		t.Errorf("Expected %q, got %q", payload, buf[:n])
+	}
+	if addr.String() != d.RemoteAddr().String() {
+		t.Errorf("Unexpected source address %v", addr)
+	}
+}
+
+func TestDatagramConn_Echo(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		opts   gatewayOptions
+		config func() *Config
+	}{
+		{"plain", gatewayOptions{}, func() *Config { return &Config{} }},
+		{"aes", gatewayOptions{aes: true}, func() *Config { return &Config{EnableAES: true, CipherSuite: utils.CipherCBCPKCS7} }},
+		{"sequenced", gatewayOptions{aes: true, duplicateDatagrams: true}, func() *Config {
+			return &Config{EnableAES: true, CipherSuite: utils.CipherGCM, EnableReplayProtection: true}
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newTestGatewayWithOptions(t, echoHandler, tc.opts)
+			c, d := g.openTestDatagramConn(t, tc.config())
+
+			for i := 0; i < 5; i++ {
+				echoDatagram(t, d, fmt.Sprintf("rtp packet %d", i))
+			}
+
+			// 重放的数据报被丢弃
+			if tc.opts.duplicateDatagrams {
+				d.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+				if _, _, err := d.ReadFrom(make([]byte, 1500)); !errors.Is(err, os.ErrDeadlineExceeded) {
+					t.Errorf("Expected duplicate datagram to be dropped, got %v", err)
+				}
+			}
+
+			// 数据报与流上的请求可以同时使用
+			if _, _, _, err := c.SendTransferBytes(context.Background(), []byte("GET / HTTP/1.1\r\n\r\n")); err != nil {
+				t.Fatalf("SendTransferBytes failed: %v", err)
+			}
+			echoDatagram(t, d, "after transfer")
+
+			var datagrams int
+			for _, head := range g.receivedHeaders() {
+				if head.Command == proto.EMM_COMMAND_TRAN && head.ProtoType == uint8(proto.PROTO_TYPE_RTP) {
+					datagrams++
+				}
+			}
+			if datagrams != 6 {
+				t.Errorf("Expected 6 datagrams at the gateway, got %d", datagrams)
+			}
+		})
+	}
+}
+
+func TestDatagramConn_KeyRotation(t *testing.T) {
+	g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: true})
+	c, d := g.openTestDatagramConn(t, &Config{EnableAES: true, CipherSuite: utils.CipherGCM, EnableReplayProtection: true})
+
+	echoDatagram(t, d, "before rotation")
+	if err := c.RotateSessionKey(context.Background()); err != nil {
+		t.Fatalf("RotateSessionKey failed: %v", err)
+	}
+	echoDatagram(t, d, "after rotation")
+}
+
+func TestDatagramConn_Errors(t *testing.T) {
+	g := newTestGateway(t, echoHandler)
+
+	c := g.newTestClient(t, &Config{})
+	c.SendInit()
+	if _, err := c.OpenDatagramConn(); err == nil {
+		t.Error("Expected error for HTTP protocol type")
+	}
+	c = g.newTestClient(t, &Config{ProtocolType: proto.PROTO_TYPE_UDP})
+	if _, err := c.OpenDatagramConn(); err == nil {
+		t.Error("Expected error before INIT")
+	}
+
+	c, d := g.openTestDatagramConn(t, &Config{})
+	if _, err := c.OpenDatagramConn(); err == nil {
+		t.Error("Expected error for second datagram conn")
+	}
+
+	// 阻塞中的ReadFrom在修改超时时间后返回
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := d.ReadFrom(make([]byte, 1500))
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	d.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	select {
+	case err := <-done:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("Expected deadline error, got %v", err)
+		}
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Errorf("Expected timeout net.Error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ReadFrom did not return after deadline")
+	}
+	d.SetReadDeadline(time.Time{})
+
+	g.backendDown.Store(true)
+	d.WriteTo([]byte("lost"), nil)
+	var gwErr *GatewayError
+	if _, _, err := d.ReadFrom(make([]byte, 1500)); !errors.As(err, &gwErr) || gwErr.Result != proto.AUTH_STATUS_CODE_ERR_CONN_FAILED {
+		t.Errorf("Expected gateway error, got %v", err)
+	}
+	if _, err := d.WriteTo([]byte("closed"), nil); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected closed error, got %v", err)
+	}
+	g.backendDown.Store(false)
+
+	// 关闭客户端后数据报通道失效
+	d, err := c.OpenDatagramConn()
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	c.Close()
+	if _, _, err := d.ReadFrom(make([]byte, 1500)); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected closed error after client Close, got %v", err)
+	}
+}
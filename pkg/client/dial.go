@@ -0,0 +1,144 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// defaultHappyEyeballsDelay 默认的握手错开时间，取RFC 8305建议的250ms
+const defaultHappyEyeballsDelay = 250 * time.Millisecond
+
+// resolveGateway 解析网关地址的A和AAAA记录，返回IPv6优先、两个地址族交替排列的地址列表
+func (c *TransferClient) resolveGateway(ctx context.Context, host, port string) ([]*net.UDPAddr, error) {
+	portNum, err := net.LookupPort("udp", port)
+	if err != nil {
+		return nil, fmt.Errorf("解析服务器端口失败: %v", err)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return []*net.UDPAddr{{IP: ip, Port: portNum}}, nil
+	}
+
+	lookup := c.lookupIP
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupIPAddr
+	}
+	ips, err := lookup(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("解析服务器地址失败: %v", err)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("解析服务器地址失败: %s没有可用的地址", host)
+	}
+
+	var v6, v4 []*net.UDPAddr
+	for _, ip := range ips {
+		addr := &net.UDPAddr{IP: ip.IP, Port: portNum, Zone: ip.Zone}
+		if ip.IP.To4() != nil {
+			v4 = append(v4, addr)
+		} else {
+			v6 = append(v6, addr)
+		}
+	}
+	addrs := make([]*net.UDPAddr, 0, len(ips))
+	for i := 0; i < len(v6) || i < len(v4); i++ {
+		if i < len(v6) {
+			addrs = append(addrs, v6[i])
+		}
+		if i < len(v4) {
+			addrs = append(addrs, v4[i])
+		}
+	}
+	return addrs, nil
+}
+
+// udpNetwork 返回地址所属的地址族
+func udpNetwork(addr *net.UDPAddr) string {
+	if addr.IP.To4() != nil {
+		return "udp4"
+	}
+	return "udp6"
+}
+
+// dialResult 一次握手尝试的结果
+type dialResult struct {
+	conn      quic.Connection
+	transport *quic.Transport
+	err       error
+}
+
+// raceDial 按Happy Eyeballs（RFC 8305）方式依次对各网关地址发起握手：
+// 上一个握手在HappyEyeballsDelay内未完成或已失败时开始下一个，第一个成功的连接胜出，其余连接被取消并关闭
+// 返回胜出的连接、其使用的Transport以及发起的握手次数
+func (c *TransferClient) raceDial(ctx context.Context, addrs []*net.UDPAddr, localAddr func(*net.UDPAddr) (*net.UDPAddr, error), tlsConf *tls.Config, quicConfig *quic.Config) (quic.Connection, *quic.Transport, int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult, len(addrs))
+	attempt := func(raddr *net.UDPAddr) {
+		laddr, err := localAddr(raddr)
+		if err != nil {
+			results <- dialResult{err: err}
+			return
+		}
+		transport, err := c.newTransport(udpNetwork(raddr), laddr)
+		if err != nil {
+			results <- dialResult{err: fmt.Errorf("%v: %v", raddr, err)}
+			return
+		}
+		conn, err := c.dial(ctx, transport, raddr, tlsConf.Clone(), quicConfig)
+		if err != nil {
+			closeTransport(transport)
+			results <- dialResult{err: fmt.Errorf("%v: %v", raddr, err)}
+			return
+		}
+		results <- dialResult{conn: conn, transport: transport}
+	}
+
+	timer := time.NewTimer(c.config.HappyEyeballsDelay)
+	defer timer.Stop()
+
+	var errs []string
+	started, pending := 0, 0
+	startNext := func() {
+		if started < len(addrs) {
+			go attempt(addrs[started])
+			started++
+			pending++
+			timer.Reset(c.config.HappyEyeballsDelay)
+		}
+	}
+
+	startNext()
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err != nil {
+				// 握手失败时立即开始下一个地址
+				errs = append(errs, r.err.Error())
+				startNext()
+				continue
+			}
+			// 关闭仍在握手的其他连接
+			cancel()
+			go func(pending int) {
+				for ; pending > 0; pending-- {
+					if r := <-results; r.conn != nil {
+						r.conn.CloseWithError(0, "lost happy eyeballs race")
+						closeTransport(r.transport)
+					}
+				}
+			}(pending)
+			return r.conn, r.transport, started, nil
+		case <-timer.C:
+			startNext()
+		}
+	}
+	return nil, nil, started, fmt.Errorf("%s", strings.Join(errs, "; "))
+}
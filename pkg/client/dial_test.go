@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeLookup 返回固定解析结果的lookupIP
+func fakeLookup(ips ...string) func(context.Context, string) ([]net.IPAddr, error) {
+	return func(context.Context, string) ([]net.IPAddr, error) {
+		addrs := make([]net.IPAddr, 0, len(ips))
+		for _, ip := range ips {
+			addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+		}
+		return addrs, nil
+	}
+}
+
+// connectDualStack 通过主机名localhost连接测试网关，解析结果由lookup决定
+func (g *testGateway) connectDualStack(t *testing.T, lookup func(context.Context, string) ([]net.IPAddr, error)) (*TransferClient, error) {
+	t.Helper()
+
+	_, port, _ := net.SplitHostPort(g.addr)
+	config := &Config{ServerID: 1, ServerName: "test-server", SessionID: "test-session", HappyEyeballsDelay: 50 * time.Millisecond}
+	config.RootCAs = x509.NewCertPool()
+	config.RootCAs.AddCert(g.cert)
+	c := NewTransferClient(net.JoinHostPort("localhost", port), config)
+	c.lookupIP = lookup
+	t.Cleanup(func() { c.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return c, c.Connect(ctx)
+}
+
+func TestTransferClient_ResolveGatewayOrder(t *testing.T) {
+	c := NewTransferClient("gateway:8002", &Config{})
+	c.lookupIP = fakeLookup("10.0.0.1", "10.0.0.2", "fd00::1", "10.0.0.3", "fd00::2")
+
+	addrs, err := c.resolveGateway(context.Background(), "gateway", "8002")
+	if err != nil {
+		t.Fatalf("resolveGateway failed: %v", err)
+	}
+	want := []string{"[fd00::1]:8002", "10.0.0.1:8002", "[fd00::2]:8002", "10.0.0.2:8002", "10.0.0.3:8002"}
+	if len(addrs) != len(want) {
+		t.Fatalf("Expected %d addresses, got %v", len(want), addrs)
+	}
+	for i, addr := range addrs {
+		if addr.String() != want[i] {
+			t.Errorf("Address %d: expected %s, got %s", i, want[i], addr)
+		}
+	}
+
+	if _, err := c.resolveGateway(context.Background(), "127.0.0.1", "no-such-port"); err == nil {
+		t.Error("Expected error for invalid port")
+	}
+}
+
+func TestTransferClient_HappyEyeballs(t *testing.T) {
+	t.Run("ipv6 preferred", func(t *testing.T) {
+		g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{listenAddr: "[::1]:0"})
+		c, err := g.connectDualStack(t, fakeLookup("127.0.0.1", "::1"))
+		if err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if info := c.ConnectionInfo(); info.Network != "udp6" || info.Attempts != 1 {
+			t.Errorf("Expected udp6 on first attempt, got %s after %d", info.Network, info.Attempts)
+		}
+		if _, _, err := c.SendInit(); err != nil {
+			t.Errorf("SendInit over IPv6 failed: %v", err)
+		}
+	})
+
+	t.Run("fallback to ipv4", func(t *testing.T) {
+		// IPv6地址上没有网关，错开时间到期后IPv4握手胜出
+		g := newTestGateway(t, echoHandler)
+		c, err := g.connectDualStack(t, fakeLookup("::1", "127.0.0.1"))
+		if err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if info := c.ConnectionInfo(); info.Network != "udp4" || info.Attempts != 2 {
+			t.Errorf("Expected udp4 after 2 attempts, got %s after %d", info.Network, info.Attempts)
+		}
+	})
+
+	t.Run("resolve failure", func(t *testing.T) {
+		g := newTestGateway(t, echoHandler)
+		lookupErr := errors.New("no such host")
+		_, err := g.connectDualStack(t, func(context.Context, string) ([]net.IPAddr, error) { return nil, lookupErr })
+		if err == nil {
+			t.Error("Expected connect to fail when resolution fails")
+		}
+	})
+}
@@ -2,11 +2,12 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"path/filepath"
@@ -18,21 +19,6 @@ import (
 	"github.com/laotiannai/quic_gwclient/proto"
 )
 
-// DebugMode 是否启用调试模式
-var DebugMode bool = false
-
-// SetDebugMode 设置调试模式
-func SetDebugMode(enable bool) {
-	DebugMode = enable
-}
-
-// debugLog 输出调试日志
-func debugLog(format string, args ...interface{}) {
-	if DebugMode {
-		log.Printf("[QUIC-DEBUG] "+format, args...)
-	}
-}
-
 // DownloadOptions 下载选项结构体
 type DownloadOptions struct {
 	// 是否将响应保存为本地文件
@@ -95,12 +81,12 @@ type HTTPResponseInfo struct {
 }
 
 // SendTransferRequestWithDownload 发送传输请求并支持大型数据下载
-func (c *TransferClient) SendTransferRequestWithDownload(content string, options *DownloadOptions) (*DownloadResult, error) {
+func (c *TransferClient) SendTransferRequestWithDownload(content string, options *DownloadOptions) (_ *DownloadResult, err error) {
 	if options == nil {
 		options = DefaultDownloadOptions()
 	}
 
-	debugLog("开始下载请求，SaveToFile=%v, DetectHTTP=%v", options.SaveToFile, options.DetectHTTP)
+	c.log.Debug("开始下载请求", "save_to_file", options.SaveToFile, "detect_http", options.DetectHTTP)
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -110,23 +96,39 @@ func (c *TransferClient) SendTransferRequestWithDownload(content string, options
 		ReceivedBytes: 0,
 	}
 
+	ctx, span := c.startSpan(context.Background(), spanDownload, attrAES.Bool(c.session != nil))
+	defer func() {
+		span.SetAttributes(attrSentBytes.Int(result.SentBytes), attrReceivedBytes.Int(result.ReceivedBytes))
+		endSpan(span, err)
+	}()
+
 	if c.conn == nil {
 		return nil, fmt.Errorf("连接未建立")
 	}
 
 	if c.conn.Context().Err() != nil {
-		debugLog("连接已关闭，尝试重新连接")
-		if err := c.Connect(c.conn.Context()); err != nil {
+		c.log.Debug("连接已关闭，尝试重新连接")
+		if err := c.reconnectLocked(context.Background()); err != nil {
 			return nil, fmt.Errorf("重新建立连接失败: %v", err)
 		}
 	}
 
-	requestInfo := transferRequest(content)
-	debugLog("请求数据准备完成，大小: %d 字节", len(requestInfo))
+	if c.session != nil {
+		return c.downloadEncryptedLocked(ctx, content, result, options)
+	}
+
+	// 加密会话的下载经由TransferResponse记录指标
+	start := time.Now()
+	defer func() {
+		c.metrics.TransferDone(time.Since(start), int64(result.SentBytes), int64(result.ReceivedBytes), err)
+	}()
+
+	requestInfo := transferRequest(c.injectTraceContext(ctx, []byte(content)))
+	c.log.Log(context.Background(), LevelTrace, "请求数据准备完成", "bytes", len(requestInfo), "payload", sensitive(requestInfo))
 
 	// 发送请求
 	if c.stream == nil {
-		debugLog("创建新的数据流")
+		c.log.Debug("创建新的数据流")
 		stream, err := c.conn.OpenStreamSync(c.conn.Context())
 		if err != nil {
 			return nil, fmt.Errorf("无法创建流: %v", err)
@@ -136,7 +138,7 @@ func (c *TransferClient) SendTransferRequestWithDownload(content string, options
 
 	n, err := c.stream.Write(requestInfo)
 	result.SentBytes += n
-	debugLog("已发送请求数据: %d 字节", n)
+	c.log.Debug("已发送请求数据", "stream_id", c.stream.StreamID(), "bytes", n)
 
 	if err != nil {
 		c.stream.Close()
@@ -156,12 +158,12 @@ func (c *TransferClient) SendTransferRequestWithDownload(content string, options
 	var packetCount int = 0                       // 收到的数据包数量
 
 	readTimeout := options.ReadTimeout
-	debugLog("设置读取超时: %v, 最大重试次数: %d", readTimeout, options.MaxRetries)
+	c.log.Debug("设置读取超时", "timeout", readTimeout, "max_retries", options.MaxRetries)
 
 	// 循环读取，直到确定不再有数据或达到最大重试次数
 	for !isComplete && retries <= options.MaxRetries {
 		if err := c.stream.SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
-			debugLog("设置读取超时失败: %v", err)
+			c.log.Debug("设置读取超时失败", "error", err)
 		}
 
 		responseBuffer := make([]byte, 8*1024) // 使用更大的缓冲区
@@ -178,7 +180,7 @@ func (c *TransferClient) SendTransferRequestWithDownload(content string, options
 			result.ReceivedBytes += readBytes
 			chunk := responseBuffer[:readBytes]
 			totalRawResponse = append(totalRawResponse, chunk...)
-			debugLog("收到数据包 #%d: %d 字节, 总计已接收: %d 字节", packetCount, readBytes, result.ReceivedBytes)
+			c.log.Debug("收到数据包", "stream_id", c.stream.StreamID(), "packet", packetCount, "bytes", readBytes, "total_bytes", result.ReceivedBytes)
 
 			// 直接保存原始数据，不经过解析（避免丢失数据）
 			// 此处对chunk进行处理，去除协议包后，并保存纯净数据包
@@ -191,27 +193,26 @@ func (c *TransferClient) SendTransferRequestWithDownload(content string, options
 			totalPureResponse = append(totalPureResponse, body...)
 
 			if cmd == proto.EMM_COMMAND_LINK_CLOSE {
-				debugLog("收到关闭连接命令，停止接收")
+				c.log.Debug("收到关闭连接命令，停止接收", "command", cmd)
 				isComplete = true
 				break
 			}
 
 			// 如果是完整的消息并且不需要继续接收
 			if respLen > 0 && respLen <= readBytes && !requireContinue {
-				debugLog("收到完整消息且不需要继续接收")
+				c.log.Debug("收到完整消息且不需要继续接收")
 				isComplete = true
 				break
 			}
 		} else {
 			// 连续无数据计数增加
 			noDataCount++
-			debugLog("未收到数据，连续无数据次数: %d", noDataCount)
+			c.log.Debug("未收到数据", "no_data_count", noDataCount)
 
 			// 如果多次读取都没有数据，可能是传输已完成
 			if noDataCount >= 3 {
 				if time.Since(lastReadTime) > noDataTimeThreshold {
-					debugLog("长时间(%v)未收到新数据且连续%d次无数据，认为传输已完成",
-						time.Since(lastReadTime), noDataCount)
+					c.log.Debug("长时间未收到新数据，认为传输已完成", "idle", time.Since(lastReadTime), "no_data_count", noDataCount)
 					isComplete = true
 					break
 				}
@@ -222,53 +223,57 @@ func (c *TransferClient) SendTransferRequestWithDownload(content string, options
 		if err != nil {
 			if err == io.EOF {
 				// EOF表示数据传输完成
-				debugLog("收到EOF，数据接收完成")
+				c.log.Debug("收到EOF，数据接收完成")
 				isComplete = true
 				break
 			}
 
 			// 处理超时错误，可能是因为服务器暂时没有更多数据发送
 			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-				debugLog("读取超时，可能是切包的间隔或传输已完成")
+				c.log.Debug("读取超时，可能是切包的间隔或传输已完成")
 
 				// 如果已经有一段时间没有收到新数据，可能是传输完成了
 				if time.Since(lastReadTime) > noDataTimeThreshold {
-					debugLog("超过%v未收到新数据，认为传输完成", noDataTimeThreshold)
+					c.log.Debug("长时间未收到新数据，认为传输完成", "threshold", noDataTimeThreshold)
 					isComplete = true
 					break
 				}
 
-				// 继续尝试读取
-				debugLog("继续尝试读取数据...")
 				continue
 			}
 
 			// 处理其他错误
-			debugLog("读取错误: %v", err)
+			c.log.Debug("读取错误", "error", err)
 			c.stream.Close()
 			c.stream = nil
 
 			// 特定的应用错误可能需要重新连接
 			if err.Error() == "Application error 0x0" {
-				debugLog("应用错误0x0，尝试重新连接")
-				if connErr := c.Connect(c.conn.Context()); connErr != nil {
-					debugLog("重新连接失败: %v", connErr)
+				c.log.Debug("应用错误0x0，尝试重新连接")
+				if connErr := c.reconnectLocked(ctx); connErr != nil {
+					c.log.Warn("重新连接失败", "error", connErr)
+					return nil, fmt.Errorf("读取响应失败: %v，重新建立连接失败: %v", err, connErr)
 				}
 			}
 
 			// 检查是否需要重试
 			retries++
-			debugLog("重试 #%d/%d", retries, options.MaxRetries)
-			if retries <= options.MaxRetries {
+			c.log.Debug("重试", "retry", retries, "max_retries", options.MaxRetries)
+			// 流已关闭且没有重新连接时无法继续读取
+			if retries <= options.MaxRetries && c.stream != nil {
+				c.metrics.Retry(RetryDownload)
+				_, retrySpan := c.startSpan(ctx, spanDownloadRetry, attrRetry.Int(retries))
+				retrySpan.RecordError(err)
 				sleepTime := time.Duration(retries) * time.Second
-				debugLog("等待 %v 后重试", sleepTime)
+				c.log.Debug("等待后重试", "delay", sleepTime)
 				time.Sleep(sleepTime)
+				retrySpan.End()
 				continue
 			}
 
 			// 如果已经接收到一些数据，则不返回错误而是返回已收到的数据
 			if len(totalRawResponse) > 0 {
-				debugLog("达到最大重试次数，但已接收一些数据，继续处理")
+				c.log.Debug("达到最大重试次数，但已接收一些数据，继续处理")
 				break
 			}
 
@@ -277,14 +282,14 @@ func (c *TransferClient) SendTransferRequestWithDownload(content string, options
 
 		// 检查下载大小是否超过限制
 		if int64(len(totalRawResponse)) > options.MaxDownloadSize {
-			debugLog("下载大小超过限制: %d > %d 字节", len(totalRawResponse), options.MaxDownloadSize)
+			c.log.Warn("下载大小超过限制", "bytes", len(totalRawResponse), "limit", options.MaxDownloadSize)
 			return nil, fmt.Errorf("下载大小超过限制: %d 字节", options.MaxDownloadSize)
 		}
 
 		// 服务器持续发送数据，减少超时时间，加快读取速度
 		if requireContinue && !isComplete {
 			readTimeout = 5 * time.Second
-			debugLog("调整读取超时为 %v 并继续读取", readTimeout)
+			c.log.Debug("调整读取超时并继续读取", "timeout", readTimeout)
 			continue
 		}
 	}
@@ -292,42 +297,37 @@ func (c *TransferClient) SendTransferRequestWithDownload(content string, options
 	// 重置读取超时
 	if c.stream != nil {
 		if err := c.stream.SetReadDeadline(time.Time{}); err != nil {
-			debugLog("重置读取超时失败: %v", err)
+			c.log.Debug("重置读取超时失败", "error", err)
 		}
 	}
 
-	debugLog("数据接收完成，接收了 %d 个数据包，共 %d 字节", packetCount, len(totalRawResponse))
+	c.log.Debug("数据接收完成", "packets", packetCount, "bytes", len(totalRawResponse))
 
-	// 分析所有接收到的数据，提取纯净响应
-	debugLog("开始分析数据并提取内容...")
+	return c.finishDownload(result, totalRawResponse, totalPureResponse, packetCount, options)
+}
 
+// finishDownload 解析接收到的数据，填充下载结果并按需保存文件
+func (c *TransferClient) finishDownload(result *DownloadResult, totalRawResponse []byte, totalPureResponse []byte, packetCount int, options *DownloadOptions) (*DownloadResult, error) {
 	// 填充结果
 	result.RawData = totalRawResponse
 	result.PureData = string(totalPureResponse)
-	fmt.Println("result.PureData111111111111111111: ", result.PureData)
-	// fmt.Println("result.RawData1111111111111111111: ", result.RawData)
-	debugLog("数据统计，原始数据: %d 字节, 纯净数据: %d 字节", len(result.RawData), len(result.PureData))
-	debugLog("原始数据与纯净数据的比例: %.2f%%", float64(len(result.PureData))/float64(len(result.RawData))*100)
 
 	// 先检测HTTP响应并解析，无论是否要保存文件
 	if len(result.PureData) > 0 && (result.HTTPInfo == nil || result.HTTPInfo.Body == nil || len(result.HTTPInfo.Body) == 0) {
-		if isHTTPResponse(result.PureData) {
-			debugLog("检测到HTTP响应，尝试解析")
+		if isHTTPResponse(c.log, result.PureData) {
+			c.log.Debug("检测到HTTP响应，尝试解析")
 
 			// 特别处理：只接收一次数据的情况，可能需要额外跳过协议头
 			if packetCount == 1 {
-				debugLog("只接收到一个数据包，尝试特殊处理")
+				c.log.Debug("只接收到一个数据包，尝试特殊处理")
 
-				// 打印前100字节，便于调试
-				if len(result.PureData) > 0 {
-					printHexData("PureData前100字节", []byte(result.PureData), 100)
-				}
+				traceData(c.log, "PureData前100字节", result.PureData, 100)
 
 				headerBodySplit := strings.Index(result.PureData, "\r\n\r\n")
 				if headerBodySplit != -1 && headerBodySplit+4+proto.RESPONSE_HEAD_LEN < len(result.PureData) {
 					// 先提取HTTP头部
 					httpHeaders := result.PureData[:headerBodySplit]
-					debugLog("HTTP头部长度: %d 字节", len(httpHeaders))
+					c.log.Debug("HTTP头部长度", "bytes", len(httpHeaders))
 
 					// 解析HTTP状态码
 					statusCode := 0
@@ -347,17 +347,17 @@ func (c *TransferClient) SendTransferRequestWithDownload(content string, options
 					normalBodyStart := headerBodySplit + 4
 					specialBodyStart := headerBodySplit + 4 + proto.RESPONSE_HEAD_LEN
 
-					debugLog("标准HTTP体起始位置: %d, 特殊处理后起始位置: %d", normalBodyStart, specialBodyStart)
+					c.log.Debug("HTTP体起始位置", "normal", normalBodyStart, "special", specialBodyStart)
 
 					// 前后取出20字节，查看周围内容
 					if normalBodyStart > 20 && normalBodyStart+20 < len(result.PureData) {
 						surroundingData := result.PureData[normalBodyStart-20 : normalBodyStart+20]
-						printHexData("标准HTTP体起始点周围数据", []byte(surroundingData), 40)
+						traceData(c.log, "标准HTTP体起始点周围数据", surroundingData, 40)
 					}
 
 					if specialBodyStart > 20 && specialBodyStart+20 < len(result.PureData) {
 						surroundingData := result.PureData[specialBodyStart-20 : specialBodyStart+20]
-						printHexData("特殊处理后HTTP体起始点周围数据", []byte(surroundingData), 40)
+						traceData(c.log, "特殊处理后HTTP体起始点周围数据", surroundingData, 40)
 					}
 
 					// 直接将HTTP头部后面的内容加上额外的RESPONSE_HEAD_LEN字节
@@ -366,8 +366,7 @@ func (c *TransferClient) SendTransferRequestWithDownload(content string, options
 						body = result.PureData[specialBodyStart:]
 					}
 
-					debugLog("特殊处理：提取HTTP头部后，跳过额外的%d字节作为响应体起始点", proto.RESPONSE_HEAD_LEN)
-					debugLog("状态码: %d, Content-Length: %d, 实际body长度: %d", statusCode, contentLength, len(body))
+					c.log.Debug("特殊处理：跳过额外的包头作为响应体起始点", "skip", proto.RESPONSE_HEAD_LEN, "status", statusCode, "content_length", contentLength, "body_bytes", len(body))
 
 					// 比较特殊处理前后body的前20字节
 					normalBody := ""
@@ -386,8 +385,8 @@ func (c *TransferClient) SendTransferRequestWithDownload(content string, options
 							specialBodyLen = len(body)
 						}
 
-						printHexData("标准处理body前20字节", []byte(normalBody[:normalBodyLen]), normalBodyLen)
-						printHexData("特殊处理body前20字节", []byte(body[:specialBodyLen]), specialBodyLen)
+						traceData(c.log, "标准处理body前20字节", normalBody, normalBodyLen)
+						traceData(c.log, "特殊处理body前20字节", body, specialBodyLen)
 					}
 
 					// 创建HTTP响应结构
@@ -415,57 +414,55 @@ func (c *TransferClient) SendTransferRequestWithDownload(content string, options
 
 					// 如果提取的内容长度与内容长度头匹配，则使用此特殊处理的结果
 					if contentLength > 0 && contentLength <= len(body) {
-						debugLog("内容长度匹配，采用特殊处理结果")
+						c.log.Debug("内容长度匹配，采用特殊处理结果")
 						result.HTTPInfo = httpInfo
 					} else {
-						debugLog("内容长度不匹配，尝试常规解析")
-						regularHttpInfo, err := parseHTTPResponse(result.PureData)
+						c.log.Debug("内容长度不匹配，尝试常规解析")
+						regularHttpInfo, err := parseHTTPResponse(c.log, result.PureData)
 						if err == nil && regularHttpInfo != nil {
 							result.HTTPInfo = regularHttpInfo
 
 							// 如果常规解析得到的body也为空，则尝试使用特殊处理的body
 							if len(regularHttpInfo.Body) == 0 && len(body) > 0 {
-								debugLog("常规解析得到空body，使用特殊处理的body")
+								c.log.Debug("常规解析得到空body，使用特殊处理的body")
 								regularHttpInfo.Body = []byte(body)
 							}
 						} else {
 							// 常规解析失败，使用特殊处理的结果
-							debugLog("常规解析失败，使用特殊处理结果: %v", err)
+							c.log.Debug("常规解析失败，使用特殊处理结果", "error", err)
 							result.HTTPInfo = httpInfo
 						}
 					}
 				} else {
 					// 特殊处理失败，尝试常规解析
-					debugLog("无法进行特殊处理，尝试常规解析")
-					httpInfo, err := parseHTTPResponse(result.PureData)
+					c.log.Debug("无法进行特殊处理，尝试常规解析")
+					httpInfo, err := parseHTTPResponse(c.log, result.PureData)
 					if err == nil && httpInfo != nil {
 						result.HTTPInfo = httpInfo
 					} else {
-						debugLog("解析HTTP响应失败: %v", err)
+						c.log.Debug("解析HTTP响应失败", "error", err)
 					}
 				}
 			} else {
 				// 多个数据包的情况，使用常规解析
-				httpInfo, err := parseHTTPResponse(result.PureData)
+				httpInfo, err := parseHTTPResponse(c.log, result.PureData)
 				if err == nil && httpInfo != nil {
 					result.HTTPInfo = httpInfo
-					debugLog("成功解析HTTP响应, 状态码: %d, 响应体: %d 字节",
-						httpInfo.StatusCode, len(httpInfo.Body))
+					c.log.Debug("成功解析HTTP响应", "status", httpInfo.StatusCode, "body_bytes", len(httpInfo.Body))
 
 					// 额外检查：如果HTTP响应体为空但Content-Length不为0，重新尝试提取
 					if len(httpInfo.Body) == 0 {
 						if cl, exists := httpInfo.Headers["Content-Length"]; exists {
 							contentLength, _ := strconv.Atoi(cl)
 							if contentLength > 0 {
-								debugLog("HTTP响应体为空但Content-Length为%d，尝试直接提取", contentLength)
+								c.log.Debug("HTTP响应体为空，尝试直接提取", "content_length", contentLength)
 								// 尝试直接从PureData中提取响应体
 								headerBodySplit := strings.Index(result.PureData, "\r\n\r\n")
 								if headerBodySplit != -1 && headerBodySplit+4 < len(result.PureData) {
 									directBody := result.PureData[headerBodySplit+4:]
-									debugLog("直接提取的响应体长度: %d", len(directBody))
+									c.log.Debug("直接提取的响应体", "bytes", len(directBody))
 									if len(directBody) > 0 {
 										httpInfo.Body = []byte(directBody)
-										debugLog("更新HTTP响应体，新大小: %d 字节", len(httpInfo.Body))
 									}
 								}
 							}
@@ -480,41 +477,33 @@ func (c *TransferClient) SendTransferRequestWithDownload(content string, options
 						}
 
 						if expectedSize > 0 && len(result.PureData) >= expectedSize {
-							debugLog("HTTP状态码为200，但响应体为空，使用全部纯净数据作为响应体")
+							c.log.Debug("HTTP状态码为200但响应体为空，使用全部纯净数据作为响应体")
 							// 尝试使用全部纯净数据
 							httpInfo.Body = []byte(result.PureData)
-							debugLog("使用纯净数据作为响应体，大小: %d 字节", len(httpInfo.Body))
+							c.log.Debug("使用纯净数据作为响应体", "bytes", len(httpInfo.Body))
 						}
 					}
 				} else {
-					debugLog("解析HTTP响应失败: %v", err)
+					c.log.Debug("解析HTTP响应失败", "error", err)
 				}
 			}
 
 			// 无论使用哪种方法，如果解析成功，记录一下结果
 			if result.HTTPInfo != nil {
-				debugLog("最终HTTP解析结果 - 状态码: %d, 响应体大小: %d 字节",
-					result.HTTPInfo.StatusCode, len(result.HTTPInfo.Body))
+				c.log.Debug("HTTP解析结果", "status", result.HTTPInfo.StatusCode, "body_bytes", len(result.HTTPInfo.Body))
 			}
 		} else {
-			debugLog("未检测到HTTP响应，将作为二进制数据处理")
+			c.log.Debug("未检测到HTTP响应，将作为二进制数据处理")
 		}
 	}
 
-	// 详细记录各种数据大小
-	fmt.Println("数据统计信息:")
-	fmt.Printf("- 收到数据包: %d 个\n", packetCount)
-	fmt.Printf("- 原始数据总大小: %d 字节\n", len(result.RawData))
-	fmt.Printf("- 解析后纯净数据大小: %d 字节\n", len(result.PureData))
+	// 记录各种数据大小
+	attrs := []any{"packets", packetCount, "raw_bytes", len(result.RawData), "pure_bytes", len(result.PureData)}
 	if result.HTTPInfo != nil {
-		fmt.Printf("- HTTP状态码: %d\n", result.HTTPInfo.StatusCode)
-		fmt.Printf("- HTTP响应体大小: %d 字节\n", len(result.HTTPInfo.Body))
-		for key, value := range result.HTTPInfo.Headers {
-			if key == "Content-Type" || key == "Content-Length" {
-				fmt.Printf("- HTTP头: %s: %s\n", key, value)
-			}
-		}
+		attrs = append(attrs, "http_status", result.HTTPInfo.StatusCode, "http_body_bytes", len(result.HTTPInfo.Body),
+			"content_type", result.HTTPInfo.Headers["Content-Type"])
 	}
+	c.log.Debug("数据统计", attrs...)
 
 	// 计算保存内容的MD5
 	var contentToSave string
@@ -522,19 +511,19 @@ func (c *TransferClient) SendTransferRequestWithDownload(content string, options
 	// 确定要保存的内容，无论是否要保存文件
 	if result.HTTPInfo != nil && result.HTTPInfo.IsHTTP && options.DetectHTTP {
 		contentToSave = string(result.HTTPInfo.Body)
-		debugLog("使用HTTP响应体作为内容: %d 字节", len(contentToSave))
+		c.log.Debug("使用HTTP响应体作为内容", "bytes", len(contentToSave))
 	} else {
 		contentToSave = result.PureData
-		debugLog("使用纯净数据作为内容: %d 字节", len(contentToSave))
+		c.log.Debug("使用纯净数据作为内容", "bytes", len(contentToSave))
 	}
 
 	// 计算MD5
 	md5sum := md5.Sum([]byte(contentToSave))
 	result.MD5Sum = fmt.Sprintf("%x", md5sum)
-	debugLog("计算内容MD5: %s", result.MD5Sum)
+	c.log.Debug("计算内容MD5", "md5", result.MD5Sum)
 
 	// 检查并清理EMM包头
-	cleanedContent := cleanEMMHeader([]byte(contentToSave))
+	cleanedContent := cleanEMMHeader(c.log, []byte(contentToSave))
 
 	// 根据SaveToFile选项决定是否保存文件
 	if options.SaveToFile {
@@ -545,7 +534,6 @@ func (c *TransferClient) SendTransferRequestWithDownload(content string, options
 
 		// 确保目录存在
 		if err := os.MkdirAll(saveDir, 0755); err != nil {
-			debugLog("创建保存目录失败: %v", err)
 			return result, fmt.Errorf("创建保存目录失败: %v", err)
 		}
 
@@ -553,25 +541,57 @@ func (c *TransferClient) SendTransferRequestWithDownload(content string, options
 		fileName := fmt.Sprintf("%s_%s.bin", options.FileNamePrefix, result.MD5Sum)
 		filePath := filepath.Join(saveDir, fileName)
 		result.FilePath = filePath
-		debugLog("文件将保存为: %s", filePath)
+		c.log.Debug("文件将保存为", "path", filePath)
 
 		// 写入文件（即使内容为空也创建文件）
 		if err := os.WriteFile(filePath, cleanedContent, 0644); err != nil {
-			debugLog("保存文件失败: %v", err)
 			return result, fmt.Errorf("保存文件失败: %v", err)
 		}
 
-		debugLog("文件保存成功: %s (%d 字节)", filePath, len(cleanedContent))
+		c.log.Debug("文件保存成功", "path", filePath, "bytes", len(cleanedContent))
 	} else {
-		debugLog("不保存文件，仅返回内存中的数据")
+		c.log.Debug("不保存文件，仅返回内存中的数据")
 	}
 
 	return result, nil
 }
 
+// downloadEncryptedLocked 加密会话下按帧接收并解密响应，调用方需持有c.mu
+func (c *TransferClient) downloadEncryptedLocked(ctx context.Context, content string, result *DownloadResult, options *DownloadOptions) (*DownloadResult, error) {
+	resp, err := c.startTransferLocked(ctx, strings.NewReader(content), DefaultUploadOptions())
+	if err != nil {
+		return nil, err
+	}
+	var raw bytes.Buffer
+	resp.raw = &raw
+	if options.ReadTimeout > 0 {
+		resp.idleTimeout = options.ReadTimeout
+	}
+
+	// 边读边检查大小限制，超过限制时多读的一个字节用于判断，剩余数据留在流上，finishLocked会丢弃该流
+	var body io.Reader = resp
+	if options.MaxDownloadSize > 0 {
+		body = io.LimitReader(resp, options.MaxDownloadSize+1)
+	}
+	pure, err := io.ReadAll(body)
+	resp.finishLocked()
+	result.SentBytes = int(resp.SentBytes())
+	result.ReceivedBytes = int(resp.ReceivedBytes())
+	if err != nil {
+		// 已收到部分数据时同样返回错误，避免把被截断的响应当作完整下载保存
+		return nil, fmt.Errorf("接收响应失败: %w", err)
+	}
+	if options.MaxDownloadSize > 0 && int64(len(pure)) > options.MaxDownloadSize {
+		return nil, fmt.Errorf("下载大小超过限制: %d 字节", options.MaxDownloadSize)
+	}
+	c.log.Debug("加密数据接收完成", "packets", resp.frames, "bytes", raw.Len())
+
+	return c.finishDownload(result, raw.Bytes(), pure, resp.frames, options)
+}
+
 // DownloadFile 使用指定的请求下载文件并保存到本地
 func (c *TransferClient) DownloadFile(content string, saveDir string, fileNamePrefix string) (string, error) {
-	debugLog("使用简化下载函数，保存到目录: %s, 前缀: %s", saveDir, fileNamePrefix)
+	c.log.Debug("使用简化下载函数", "save_dir", saveDir, "prefix", fileNamePrefix)
 
 	options := DefaultDownloadOptions()
 	options.SaveToFile = true
@@ -583,50 +603,41 @@ func (c *TransferClient) DownloadFile(content string, saveDir string, fileNamePr
 	options.MaxRetries = 5
 	options.ReadTimeout = 60 * time.Second
 
-	debugLog("设置下载选项: SaveToFile=true, SaveDir=%s, FileNamePrefix=%s, MaxRetries=%d, ReadTimeout=%v",
-		saveDir, fileNamePrefix, options.MaxRetries, options.ReadTimeout)
-
 	// 确保目录存在
 	if saveDir != "" {
 		if err := os.MkdirAll(saveDir, 0755); err != nil {
-			debugLog("创建保存目录失败: %v", err)
 			return "", fmt.Errorf("创建保存目录失败: %v", err)
 		}
-		debugLog("保存目录已创建或已存在: %s", saveDir)
 	}
 
 	result, err := c.SendTransferRequestWithDownload(content, options)
 	if err != nil {
-		debugLog("下载失败: %v", err)
 		return "", err
 	}
 
-	fmt.Println("下载结果数据统计:")
-	fmt.Printf("- 发送字节数: %d\n", result.SentBytes)
-	fmt.Printf("- 接收字节数: %d\n", result.ReceivedBytes)
-	fmt.Printf("- 原始数据大小: %d 字节\n", len(result.RawData))
-	fmt.Printf("- 纯净数据大小: %d 字节\n", len(result.PureData))
+	attrs := []any{"sent_bytes", result.SentBytes, "received_bytes", result.ReceivedBytes,
+		"raw_bytes", len(result.RawData), "pure_bytes", len(result.PureData)}
 	if result.HTTPInfo != nil {
-		fmt.Printf("- HTTP状态码: %d\n", result.HTTPInfo.StatusCode)
-		fmt.Printf("- HTTP响应体大小: %d 字节\n", len(result.HTTPInfo.Body))
+		attrs = append(attrs, "http_status", result.HTTPInfo.StatusCode, "http_body_bytes", len(result.HTTPInfo.Body))
 	}
+	c.log.Debug("下载结果", attrs...)
 
 	if result.FilePath == "" {
-		fmt.Println("警告: 未能设置文件路径，但下载可能已成功")
+		c.log.Warn("未能设置文件路径，但下载可能已成功")
 
 		// 确定要保存的内容
 		var contentToSave string
 		if result.HTTPInfo != nil && result.HTTPInfo.IsHTTP {
 			contentToSave = string(result.HTTPInfo.Body)
-			fmt.Printf("使用HTTP响应体作为保存内容: %d 字节\n", len(contentToSave))
+			c.log.Debug("使用HTTP响应体作为保存内容", "bytes", len(contentToSave))
 		} else if len(result.PureData) > 0 {
 			contentToSave = result.PureData
-			fmt.Printf("使用纯净数据作为保存内容: %d 字节\n", len(contentToSave))
+			c.log.Debug("使用纯净数据作为保存内容", "bytes", len(contentToSave))
 		} else if len(result.RawData) > 0 {
 			contentToSave = string(result.RawData)
-			fmt.Printf("使用原始数据作为保存内容: %d 字节\n", len(contentToSave))
+			c.log.Debug("使用原始数据作为保存内容", "bytes", len(contentToSave))
 		} else {
-			fmt.Println("所有数据均为空，将创建空文件")
+			c.log.Debug("所有数据均为空，将创建空文件")
 			contentToSave = ""
 		}
 
@@ -640,32 +651,31 @@ func (c *TransferClient) DownloadFile(content string, saveDir string, fileNamePr
 		// 生成文件名
 		fileName := fmt.Sprintf("%s_%s.bin", fileNamePrefix, md5str)
 		filePath := filepath.Join(saveDir, fileName)
-		fmt.Printf("将数据保存到: %s\n", filePath)
+		c.log.Debug("将数据保存到文件", "path", filePath)
 
 		// 使用保存函数保存内容
-		if err := saveContentToFile(filePath, []byte(contentToSave)); err != nil {
-			fmt.Printf("创建文件失败: %v\n", err)
+		if err := saveContentToFile(c.log, filePath, []byte(contentToSave)); err != nil {
 			return "", fmt.Errorf("保存文件失败: %v", err)
 		}
 
-		fmt.Printf("文件创建成功: %s\n", filePath)
+		c.log.Debug("文件创建成功", "path", filePath)
 		return filePath, nil
 	}
 
-	debugLog("文件下载成功: %s", result.FilePath)
+	c.log.Debug("文件下载成功", "path", result.FilePath)
 	return result.FilePath, nil
 }
 
 // 判断数据是否为HTTP响应
-func isHTTPResponse(data string) bool {
+func isHTTPResponse(logger *slog.Logger, data string) bool {
 	if len(data) < 10 {
-		debugLog("数据太短，无法判断是否为HTTP响应")
+		logger.Debug("数据太短，无法判断是否为HTTP响应")
 		return false
 	}
 
 	// 检查是否以HTTP/开头，这是最明确的标识
 	if strings.HasPrefix(data, "HTTP/") {
-		debugLog("数据以HTTP/开头，确认为HTTP响应")
+		logger.Debug("数据以HTTP/开头，确认为HTTP响应")
 		return true
 	}
 
@@ -677,7 +687,7 @@ func isHTTPResponse(data string) bool {
 		trimmedPrefix := strings.TrimSpace(prefix)
 		if len(trimmedPrefix) == 0 || strings.Contains(trimmedPrefix, "\n") {
 			// 前缀为空白或包含换行，可能是有效的HTTP响应
-			debugLog("在位置%d找到HTTP/标记，前导数据可能为噪声", httpPosition)
+			logger.Debug("找到HTTP/标记，前导数据可能为噪声", "offset", httpPosition)
 			return true
 		}
 	}
@@ -699,35 +709,35 @@ func isHTTPResponse(data string) bool {
 	for _, header := range commonHeaders {
 		if strings.Contains(data, header) {
 			headerCount++
-			debugLog("找到HTTP头部: %s", header)
+			logger.Debug("找到HTTP头部", "header", header)
 		}
 	}
 
 	// 如果包含多个HTTP头部字段，可能是HTTP响应
 	if headerCount >= 2 {
-		debugLog("找到%d个HTTP头部字段，可能是HTTP响应", headerCount)
+		logger.Debug("找到多个HTTP头部字段，可能是HTTP响应", "headers", headerCount)
 
 		// 检查是否包含常见的HTTP状态行模式
 		statusLinePattern := regexp.MustCompile(`(?i)HTTP/\d\.\d\s+\d{3}\s+`)
 		if statusLinePattern.MatchString(data) {
-			debugLog("匹配到HTTP状态行模式，确认为HTTP响应")
+			logger.Debug("匹配到HTTP状态行模式，确认为HTTP响应")
 			return true
 		}
 
 		// 检查是否有头部和主体分隔符
 		if strings.Contains(data, "\r\n\r\n") || strings.Contains(data, "\n\n") {
-			debugLog("找到头部和主体分隔符，确认为HTTP响应")
+			logger.Debug("找到头部和主体分隔符，确认为HTTP响应")
 			return true
 		}
 
 		// 如果找到足够多的HTTP头部，也认为是HTTP响应
 		if headerCount >= 3 {
-			debugLog("找到%d个HTTP头部字段，确认为HTTP响应", headerCount)
+			logger.Debug("找到足够多的HTTP头部字段，确认为HTTP响应", "headers", headerCount)
 			return true
 		}
 	}
 
-	debugLog("未检测到HTTP响应特征")
+	logger.Debug("未检测到HTTP响应特征")
 	return false
 }
 
@@ -757,28 +767,22 @@ func analyzeSpecialChars(data string) string {
 }
 
 // 解析HTTP响应
-func parseHTTPResponse(data string) (*HTTPResponseInfo, error) {
+func parseHTTPResponse(logger *slog.Logger, data string) (*HTTPResponseInfo, error) {
 	if len(data) == 0 {
 		return nil, errors.New("空的HTTP响应")
 	}
 
-	debugLog("开始解析HTTP响应，数据长度: %d 字节", len(data))
-	specialChars := analyzeSpecialChars(data)
-	debugLog("响应中的特殊字符: %s", specialChars)
-
-	if len(data) > 200 {
-		debugLog("HTTP响应前200字节: %s", data[:200])
-	} else {
-		debugLog("HTTP响应全文: %s", data)
-	}
+	logger.Debug("开始解析HTTP响应", "bytes", len(data))
+	logger.Debug("响应中的特殊字符", "chars", analyzeSpecialChars(data))
+	traceData(logger, "HTTP响应内容", data, 200)
 
 	// 检查是否有可能被截断的HTTP头
 	if !strings.HasPrefix(data, "HTTP/") {
-		debugLog("警告: 响应不是以HTTP/开头，可能不是完整的HTTP响应或被截断")
+		logger.Debug("响应不是以HTTP/开头，可能不是完整的HTTP响应或被截断")
 		// 尝试在响应中查找HTTP头的开始
 		httpHeaderStart := strings.Index(data, "HTTP/")
 		if httpHeaderStart > 0 {
-			debugLog("在位置 %d 找到HTTP头开始标记，尝试从此处解析", httpHeaderStart)
+			logger.Debug("找到HTTP头开始标记，尝试从此处解析", "offset", httpHeaderStart)
 			data = data[httpHeaderStart:]
 		}
 	}
@@ -791,15 +795,14 @@ func parseHTTPResponse(data string) (*HTTPResponseInfo, error) {
 	// 查找头部和主体分隔符
 	headerBodySplit := strings.Index(data, "\r\n\r\n")
 	if headerBodySplit == -1 {
-		debugLog("未找到标准头部和主体分隔符\\r\\n\\r\\n，尝试其他分隔符")
+		logger.Debug("未找到\\r\\n\\r\\n分隔符，尝试其他分隔符")
 		// 尝试使用\n\n作为分隔符
 		headerBodySplit = strings.Index(data, "\n\n")
 		if headerBodySplit == -1 {
-			debugLog("也未找到\\n\\n分隔符")
 			// 如果没有找到分隔符，可能是不完整的响应
 			return nil, errors.New("HTTP响应不完整，缺少头部和主体分隔符")
 		}
-		debugLog("使用\\n\\n作为分隔符，位置: %d", headerBodySplit)
+		logger.Debug("使用\\n\\n作为分隔符", "offset", headerBodySplit)
 		// 提取头部和主体
 		headers := data[:headerBodySplit]
 		body := data[headerBodySplit+2:] // +2 跳过\n\n
@@ -807,15 +810,12 @@ func parseHTTPResponse(data string) (*HTTPResponseInfo, error) {
 		// 将\n替换为\r\n以保持统一处理
 		headers = strings.ReplaceAll(headers, "\n", "\r\n")
 
-		debugLog("提取的头部长度: %d 字节", len(headers))
-		debugLog("提取的主体长度: %d 字节", len(body))
-
 		// 重新赋值数据，以便后续处理
 		data = headers + "\r\n\r\n" + body
 		headerBodySplit = len(headers)
 	}
 
-	debugLog("找到头部和主体分隔符，位置: %d", headerBodySplit)
+	logger.Debug("找到头部和主体分隔符", "offset", headerBodySplit)
 
 	// 提取头部和主体
 	headers := data[:headerBodySplit]
@@ -824,8 +824,7 @@ func parseHTTPResponse(data string) (*HTTPResponseInfo, error) {
 		body = data[headerBodySplit+4:]
 	}
 
-	debugLog("提取的头部长度: %d 字节", len(headers))
-	debugLog("提取的主体长度: %d 字节", len(body))
+	logger.Debug("提取头部和主体", "header_bytes", len(headers), "body_bytes", len(body))
 
 	// 解析第一行（状态行）
 	headerLines := strings.Split(headers, "\r\n")
@@ -833,13 +832,11 @@ func parseHTTPResponse(data string) (*HTTPResponseInfo, error) {
 		// 尝试用\n分割
 		headerLines = strings.Split(headers, "\n")
 		if len(headerLines) == 0 {
-			debugLog("解析的头部行数为0")
 			return nil, errors.New("HTTP响应头部格式错误")
 		}
 	}
 
-	debugLog("头部行数: %d", len(headerLines))
-	debugLog("状态行: %s", headerLines[0])
+	logger.Debug("头部行数", "lines", len(headerLines))
 
 	// 解析状态码
 	statusLine := headerLines[0]
@@ -848,12 +845,12 @@ func parseHTTPResponse(data string) (*HTTPResponseInfo, error) {
 		statusCode, err := strconv.Atoi(statusMatch[1])
 		if err == nil {
 			result.StatusCode = statusCode
-			debugLog("解析到状态码: %d", statusCode)
+			logger.Debug("解析到状态码", "status", statusCode)
 		} else {
-			debugLog("状态码解析失败: %v", err)
+			logger.Debug("状态码解析失败", "error", err)
 		}
 	} else {
-		debugLog("未匹配到状态码，状态行: %s", statusLine)
+		logger.Debug("未匹配到状态码")
 	}
 
 	// 解析其他头部字段
@@ -868,9 +865,9 @@ func parseHTTPResponse(data string) (*HTTPResponseInfo, error) {
 			key := strings.TrimSpace(parts[0])
 			value := strings.TrimSpace(parts[1])
 			result.Headers[key] = value
-			debugLog("解析到头部: %s: %s", key, value)
+			logger.Log(context.Background(), LevelTrace, "解析到头部", "key", key, "value", sensitive(value))
 		} else {
-			debugLog("无法解析头部行: %s", line)
+			logger.Log(context.Background(), LevelTrace, "无法解析头部行", "line", sensitive(line))
 		}
 	}
 
@@ -879,48 +876,44 @@ func parseHTTPResponse(data string) (*HTTPResponseInfo, error) {
 	if cl, exists := result.Headers["Content-Length"]; exists {
 		if len, err := strconv.Atoi(cl); err == nil {
 			contentLength = len
-			debugLog("Content-Length: %d", contentLength)
+			logger.Debug("Content-Length", "content_length", contentLength)
 		} else {
-			debugLog("Content-Length解析失败: %v", err)
+			logger.Debug("Content-Length解析失败", "error", err)
 		}
 	} else {
-		debugLog("未找到Content-Length头")
+		logger.Debug("未找到Content-Length头")
 	}
 
 	// 处理Transfer-Encoding: chunked
 	if encoding, exists := result.Headers["Transfer-Encoding"]; exists && strings.ToLower(encoding) == "chunked" {
-		debugLog("检测到分块编码，尝试解析")
-		unchunkedBody, err := parseChunkedBody([]byte(body))
+		logger.Debug("检测到分块编码，尝试解析")
+		unchunkedBody, err := parseChunkedBody(logger, []byte(body))
 		if err == nil {
-			debugLog("分块编码解析成功，解码后长度: %d 字节", len(unchunkedBody))
+			logger.Debug("分块编码解析成功", "bytes", len(unchunkedBody))
 			body = string(unchunkedBody)
 		} else {
-			debugLog("分块编码解析失败: %v", err)
+			logger.Debug("分块编码解析失败", "error", err)
 		}
 	}
 
 	// 记录最终解析的主体大小
 	bodyBytes := []byte(body)
-	debugLog("最终主体大小: %d 字节", len(bodyBytes))
+	logger.Debug("最终主体大小", "bytes", len(bodyBytes))
 
 	// 如果主体长度为0但HTTP响应有内容，可能是解析问题
 	if len(bodyBytes) == 0 && contentLength > 0 {
-		debugLog("警告: 主体长度为0但Content-Length不为0，可能存在解析问题")
+		logger.Debug("主体长度为0但Content-Length不为0，可能存在解析问题")
 		// 尝试直接获取原始内容的主体部分
 		if headerBodySplit+4 < len(data) {
 			rawBody := data[headerBodySplit+4:]
-			debugLog("直接提取的主体长度: %d 字节", len(rawBody))
+			logger.Debug("直接提取的主体", "bytes", len(rawBody))
 			bodyBytes = []byte(rawBody)
 		}
 	}
 
 	// 检查主体大小与Content-Length是否匹配
 	if contentLength > 0 && len(bodyBytes) != contentLength {
-		debugLog("警告: 主体大小(%d)与Content-Length(%d)不匹配", len(bodyBytes), contentLength)
-		// 如果主体小于Content-Length，可能是被截断了
-		if len(bodyBytes) < contentLength {
-			debugLog("主体可能被截断，尝试使用原始数据")
-		}
+		logger.Debug("主体大小与Content-Length不匹配", "bytes", len(bodyBytes), "content_length", contentLength)
 	}
 
 	result.Body = bodyBytes
@@ -928,19 +921,14 @@ func parseHTTPResponse(data string) (*HTTPResponseInfo, error) {
 }
 
 // 解析分块编码的响应体
-func parseChunkedBody(chunkedBody []byte) ([]byte, error) {
+func parseChunkedBody(logger *slog.Logger, chunkedBody []byte) ([]byte, error) {
 	if len(chunkedBody) == 0 {
-		debugLog("分块编码响应为空")
+		logger.Debug("分块编码响应为空")
 		return []byte{}, nil
 	}
 
-	debugLog("开始解析分块编码响应，大小: %d 字节", len(chunkedBody))
-	// 打印前50个字节用于调试
-	previewSize := 50
-	if len(chunkedBody) < previewSize {
-		previewSize = len(chunkedBody)
-	}
-	debugLog("分块编码预览: %s", string(chunkedBody[:previewSize]))
+	logger.Debug("开始解析分块编码响应", "bytes", len(chunkedBody))
+	traceData(logger, "分块编码预览", string(chunkedBody[:min(len(chunkedBody), 50)]), 50)
 
 	var result []byte
 	remaining := chunkedBody
@@ -948,7 +936,7 @@ func parseChunkedBody(chunkedBody []byte) ([]byte, error) {
 	chunkIndex := 0
 	for len(remaining) > 0 {
 		chunkIndex++
-		debugLog("解析第%d个分块，剩余数据: %d 字节", chunkIndex, len(remaining))
+		logger.Debug("解析分块", "index", chunkIndex, "remaining", len(remaining))
 
 		// 查找块大小行结束
 		chunkSizeEnd := bytes.Index(remaining, []byte("\r\n"))
@@ -956,37 +944,30 @@ func parseChunkedBody(chunkedBody []byte) ([]byte, error) {
 			// 尝试只用\n作为分隔符
 			chunkSizeEnd = bytes.Index(remaining, []byte("\n"))
 			if chunkSizeEnd == -1 {
-				debugLog("无法找到块大小行结束标记")
 				return nil, errors.New("无效的分块编码：找不到块大小行结束")
 			}
-			debugLog("使用\\n作为分隔符，位置: %d", chunkSizeEnd)
-		} else {
-			debugLog("使用\\r\\n作为分隔符，位置: %d", chunkSizeEnd)
 		}
 
 		// 解析块大小（十六进制）
 		chunkSizeHex := string(remaining[:chunkSizeEnd])
 		chunkSizeHex = strings.TrimSpace(chunkSizeHex)
-		debugLog("块大小Hex字符串: '%s'", chunkSizeHex)
 
 		// 检查分块大小是否包含扩展信息（分号后的内容）
 		semicolonIndex := strings.Index(chunkSizeHex, ";")
 		if semicolonIndex != -1 {
-			debugLog("块大小包含扩展信息，去除")
 			chunkSizeHex = chunkSizeHex[:semicolonIndex]
 		}
 
 		chunkSize, err := strconv.ParseInt(chunkSizeHex, 16, 64)
 		if err != nil {
-			debugLog("解析块大小失败: %v, 块大小字符串: '%s'", err, chunkSizeHex)
 			return nil, fmt.Errorf("无效的分块大小: %s, 错误: %v", chunkSizeHex, err)
 		}
 
-		debugLog("分块大小: %d 字节", chunkSize)
+		logger.Debug("分块大小", "bytes", chunkSize)
 
 		// 如果块大小为0，表示分块结束
 		if chunkSize == 0 {
-			debugLog("遇到大小为0的块，分块编码结束")
+			logger.Debug("遇到大小为0的块，分块编码结束")
 			break
 		}
 
@@ -1001,96 +982,42 @@ func parseChunkedBody(chunkedBody []byte) ([]byte, error) {
 
 		// 检查是否超出范围
 		if chunkEnd > len(remaining) {
-			debugLog("块结束位置(%d)超出剩余数据范围(%d)", chunkEnd, len(remaining))
-			// 使用剩余所有数据
-			debugLog("使用所有剩余数据作为块内容")
+			logger.Debug("块结束位置超出剩余数据范围，使用所有剩余数据作为块内容", "end", chunkEnd, "remaining", len(remaining))
 			result = append(result, remaining[chunkStart:]...)
 			break
 		}
 
-		// 添加块内容到结果
-		debugLog("添加块内容，起始位置: %d, 结束位置: %d, 大小: %d 字节",
-			chunkStart, chunkEnd, chunkEnd-chunkStart)
 		result = append(result, remaining[chunkStart:chunkEnd]...)
 
 		// 检查块结束后是否有\r\n
 		if chunkEnd+2 <= len(remaining) && bytes.Equal(remaining[chunkEnd:chunkEnd+2], []byte("\r\n")) {
 			// 移动到下一个块
 			remaining = remaining[chunkEnd+2:] // +2 跳过块结尾的\r\n
-			debugLog("使用\\r\\n作为块尾分隔符，移动到下一个块，剩余: %d 字节", len(remaining))
 		} else if chunkEnd+1 <= len(remaining) && remaining[chunkEnd] == '\n' {
 			// 只有\n作为分隔符
 			remaining = remaining[chunkEnd+1:] // +1 跳过块结尾的\n
-			debugLog("使用\\n作为块尾分隔符，移动到下一个块，剩余: %d 字节", len(remaining))
 		} else {
 			// 没有找到预期的分隔符，但继续处理剩余数据
 			if chunkEnd < len(remaining) {
 				remaining = remaining[chunkEnd:]
-				debugLog("未找到块尾分隔符，直接移动到下一个位置，剩余: %d 字节", len(remaining))
 			} else {
 				// 已经处理完所有数据
-				debugLog("已处理完所有分块数据")
 				break
 			}
 		}
 	}
 
-	debugLog("分块编码解析完成，解析后数据大小: %d 字节", len(result))
+	logger.Debug("分块编码解析完成", "bytes", len(result))
 	return result, nil
 }
 
-// 打印数据的十六进制表示，用于调试
-func printHexData(name string, data []byte, maxLen int) {
-	if len(data) == 0 {
-		debugLog("%s: 空数据", name)
-		return
-	}
-
-	if len(data) > maxLen {
-		data = data[:maxLen]
-	}
-
-	var hexStr strings.Builder
-	var asciiStr strings.Builder
-
-	hexStr.WriteString(fmt.Sprintf("%s (长度=%d):\n", name, len(data)))
-
-	for i, b := range data {
-		// 每16个字节一行
-		if i%16 == 0 && i > 0 {
-			hexStr.WriteString("  ")
-			hexStr.WriteString(asciiStr.String())
-			hexStr.WriteString("\n")
-			asciiStr.Reset()
-		}
-
-		// 写入十六进制表示
-		hexStr.WriteString(fmt.Sprintf(" %02X", b))
-
-		// 写入ASCII表示（对于可打印字符）
-		if b >= 32 && b <= 126 {
-			asciiStr.WriteByte(b)
-		} else {
-			asciiStr.WriteString(".")
-		}
-	}
-
-	// 补齐最后一行
-	remainder := len(data) % 16
-	if remainder > 0 {
-		// 补齐空格
-		for i := 0; i < (16-remainder)*3; i++ {
-			hexStr.WriteString(" ")
-		}
-		hexStr.WriteString("  ")
-		hexStr.WriteString(asciiStr.String())
-	}
-
-	debugLog("%s", hexStr.String())
+// traceData 在跟踪日志中输出数据的前maxLen字节，用于调试
+func traceData(logger *slog.Logger, name string, data string, maxLen int) {
+	logger.Log(context.Background(), LevelTrace, name, "bytes", len(data), "data", sensitive(data[:min(len(data), maxLen)]))
 }
 
 // 检查并清理EMM包头
-func cleanEMMHeader(data []byte) []byte {
+func cleanEMMHeader(logger *slog.Logger, data []byte) []byte {
 	// 检查数据长度是否足够
 	if len(data) < 24 { // 至少需要包含"EMM:"和20字节的头部
 		return data
@@ -1113,7 +1040,7 @@ func cleanEMMHeader(data []byte) []byte {
 				// 跳过EMM包头（20字节）
 				lastEnd = i + 20
 				foundHeaders++
-				debugLog("在位置 %d 发现并移除EMM包头", i)
+				logger.Debug("发现并移除EMM包头", "offset", i)
 			}
 		}
 	}
@@ -1125,25 +1052,24 @@ func cleanEMMHeader(data []byte) []byte {
 
 	// 如果没有找到EMM包头或者清理后数据为空，返回原始数据
 	if foundHeaders == 0 || len(cleanedData) == 0 {
-		debugLog("未发现EMM包头或清理后数据为空，保持原始数据不变")
+		logger.Debug("未发现EMM包头或清理后数据为空，保持原始数据不变")
 		return data
 	}
 
-	debugLog("清理了 %d 个EMM包头，数据大小从 %d 减少到 %d 字节", foundHeaders, len(data), len(cleanedData))
+	logger.Debug("清理EMM包头", "headers", foundHeaders, "bytes", len(data), "cleaned_bytes", len(cleanedData))
 	return cleanedData
 }
 
 // 保存内容到文件，并进行EMM包头检查
-func saveContentToFile(filePath string, content []byte) error {
+func saveContentToFile(logger *slog.Logger, filePath string, content []byte) error {
 	// 清理EMM包头
-	cleanedContent := cleanEMMHeader(content)
+	cleanedContent := cleanEMMHeader(logger, content)
 
 	// 写入文件
 	if err := os.WriteFile(filePath, cleanedContent, 0644); err != nil {
-		debugLog("保存文件失败: %v", err)
 		return fmt.Errorf("保存文件失败: %v", err)
 	}
 
-	debugLog("文件保存成功: %s (%d 字节)", filePath, len(cleanedContent))
+	logger.Debug("文件保存成功", "path", filePath, "bytes", len(cleanedContent))
 	return nil
 }
@@ -0,0 +1,558 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/proto"
+	"github.com/quic-go/quic-go"
+)
+
+// BalancePolicy 多网关节点的选择策略
+type BalancePolicy int
+
+const (
+	BalanceRoundRobin   BalancePolicy = iota // 按权重平滑轮询
+	BalanceLeastLatency                      // 选择链路心跳RTT最小的节点，尚未测量的节点优先
+	BalanceRandom                            // 按权重随机
+)
+
+// String 返回策略名称
+func (p BalancePolicy) String() string {
+	switch p {
+	case BalanceRoundRobin:
+		return "round-robin"
+	case BalanceLeastLatency:
+		return "least-latency"
+	case BalanceRandom:
+		return "random"
+	default:
+		return fmt.Sprintf("BalancePolicy(%d)", int(p))
+	}
+}
+
+// ParseBalancePolicy 按名称解析选择策略
+func ParseBalancePolicy(name string) (BalancePolicy, error) {
+	for _, p := range []BalancePolicy{BalanceRoundRobin, BalanceLeastLatency, BalanceRandom} {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("未知的负载均衡策略: %s", name)
+}
+
+// Endpoint 网关节点
+type Endpoint struct {
+	Addr     string `json:"addr" yaml:"addr"`         // 网关地址，host:port
+	Weight   int    `json:"weight" yaml:"weight"`     // 权重，<=0时按1处理
+	Priority int    `json:"priority" yaml:"priority"` // 优先级，值越小越优先，只有更优先的节点都不可用时才使用后面的节点
+}
+
+// FailoverOptions 多网关故障转移配置
+type FailoverOptions struct {
+	Policy         BalancePolicy // 节点选择策略，默认BalanceRoundRobin
+	MaxFailures    int           // 连续失败多少次后标记节点为不可用，默认3
+	ConnectTimeout time.Duration // 单个节点连接和初始化的超时时间，默认10s
+	ProbeInterval  time.Duration // 后台探测的间隔，重新连接不可用的节点并在当前连接上发送链路心跳刷新RTT，默认30s，<0表示不探测
+}
+
+// DefaultFailoverOptions 返回默认的故障转移配置
+func DefaultFailoverOptions() *FailoverOptions {
+	return &FailoverOptions{
+		Policy:         BalanceRoundRobin,
+		MaxFailures:    3,
+		ConnectTimeout: 10 * time.Second,
+		ProbeInterval:  30 * time.Second,
+	}
+}
+
+// EndpointStatus 网关节点的健康状态
+type EndpointStatus struct {
+	Endpoint
+	Healthy   bool
+	Failures  int           // 连续失败次数
+	RTT       time.Duration // 链路心跳往返时间的滑动平均，0表示尚未测量
+	LastError error         // 最近一次失败的原因
+}
+
+// endpointState 节点的内部状态，由FailoverClient.stateMu保护
+type endpointState struct {
+	EndpointStatus
+	currentWeight int  // 平滑加权轮询的当前权重
+	active        bool // 是否为当前使用的节点
+}
+
+// FailoverClient 连接多个网关节点的客户端，按策略选择节点，
+// 节点连接、初始化失败或请求遇到连接层错误、AUTH_STATUS_CODE_ERR_CONN_FAILED时自动切换到其他节点重发请求
+type FailoverClient struct {
+	config *Config
+	opts   *FailoverOptions
+
+	stateMu   sync.Mutex
+	endpoints []*endpointState
+	rand      *rand.Rand
+
+	mu      sync.Mutex // 串行化请求，保护client和current
+	client  *TransferClient
+	current *endpointState
+
+	resolver   Resolver // 可选，定期刷新节点列表
+	resolveErr error    // 最近一次刷新的错误，由stateMu保护
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	wg       sync.WaitGroup // 后台探测和刷新任务
+}
+
+// NewFailoverClient 创建多网关客户端，config作为连接每个节点的配置模板
+func NewFailoverClient(endpoints []Endpoint, config *Config, opts *FailoverOptions) (*FailoverClient, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("至少需要一个网关节点")
+	}
+	if opts == nil {
+		opts = DefaultFailoverOptions()
+	}
+	defaults := DefaultFailoverOptions()
+	if opts.MaxFailures <= 0 {
+		opts.MaxFailures = defaults.MaxFailures
+	}
+	if opts.ConnectTimeout <= 0 {
+		opts.ConnectTimeout = defaults.ConnectTimeout
+	}
+	if opts.ProbeInterval == 0 {
+		opts.ProbeInterval = defaults.ProbeInterval
+	}
+
+	f := &FailoverClient{
+		config: config,
+		opts:   opts,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		stop:   make(chan struct{}),
+	}
+	if err := f.setEndpoints(endpoints); err != nil {
+		return nil, err
+	}
+
+	if opts.ProbeInterval > 0 {
+		f.wg.Add(1)
+		go f.probeLoop()
+	}
+	return f, nil
+}
+
+// setEndpoints 替换节点列表，已有节点保留健康状态和RTT
+func (f *FailoverClient) setEndpoints(endpoints []Endpoint) error {
+	f.stateMu.Lock()
+	defer f.stateMu.Unlock()
+
+	for _, ep := range endpoints {
+		if ep.Addr == "" {
+			return fmt.Errorf("网关节点地址不能为空")
+		}
+	}
+
+	existing := make(map[string]*endpointState, len(f.endpoints))
+	for _, ep := range f.endpoints {
+		existing[ep.Addr] = ep
+	}
+	states := make([]*endpointState, 0, len(endpoints))
+	for _, ep := range endpoints {
+		if ep.Weight <= 0 {
+			ep.Weight = 1
+		}
+		if state, ok := existing[ep.Addr]; ok {
+			state.Endpoint = ep
+			states = append(states, state)
+			continue
+		}
+		states = append(states, &endpointState{EndpointStatus: EndpointStatus{Endpoint: ep, Healthy: true}})
+	}
+	f.endpoints = states
+	f.reportPoolLocked()
+	return nil
+}
+
+// Connect 按策略选择节点并完成连接和初始化，已连接时直接返回
+func (f *FailoverClient) Connect(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.client != nil {
+		return nil
+	}
+	return f.connectLocked(ctx, make(map[*endpointState]bool))
+}
+
+// connectLocked 依次尝试未在tried中的节点，直到某个节点连接和初始化成功，调用方需持有f.mu
+func (f *FailoverClient) connectLocked(ctx context.Context, tried map[*endpointState]bool) error {
+	var lastErr error
+	for {
+		ep := f.pick(tried)
+		if ep == nil {
+			if lastErr == nil {
+				lastErr = errors.New("没有可用的节点")
+			}
+			return fmt.Errorf("所有网关节点均不可用: %v", lastErr)
+		}
+		tried[ep] = true
+
+		c, rtt, err := f.dial(ctx, ep)
+		if err != nil {
+			f.markFailure(ep, err)
+			lastErr = fmt.Errorf("%s: %v", ep.Addr, err)
+			if ctx.Err() != nil {
+				return lastErr
+			}
+			continue
+		}
+		f.markSuccess(ep, rtt)
+		f.setCurrentLocked(c, ep)
+		return nil
+	}
+}
+
+// dial 连接节点并发送初始化请求，返回客户端和初始化后一次链路心跳的往返时间
+// 心跳不经过后端，不受INIT时网关连接后端等处理耗时的影响
+func (f *FailoverClient) dial(ctx context.Context, ep *endpointState) (*TransferClient, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.opts.ConnectTimeout)
+	defer cancel()
+
+	config := *f.config
+	c := NewTransferClient(ep.Addr, &config)
+	if err := c.Connect(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	c.mu.Lock()
+	_, _, err := c.initLocked(ctx)
+	var rtt time.Duration
+	if err == nil {
+		rtt, err = c.heartbeatLocked(ctx)
+	}
+	c.mu.Unlock()
+	if err != nil {
+		c.Close()
+		return nil, 0, err
+	}
+	return c, rtt, nil
+}
+
+// setCurrentLocked 切换当前使用的节点，关闭原有连接，调用方需持有f.mu
+func (f *FailoverClient) setCurrentLocked(c *TransferClient, ep *endpointState) {
+	if f.client != nil {
+		f.client.Close()
+	}
+	f.client, f.current = c, ep
+
+	f.stateMu.Lock()
+	defer f.stateMu.Unlock()
+	for _, e := range f.endpoints {
+		e.active = e == ep
+	}
+}
+
+// SendTransferBytes 发送二进制请求并读取完整响应体，节点故障时在其他节点上重发请求
+// 每个节点最多尝试一次，请求可能已被故障节点部分处理，调用方应只对可重发的请求使用
+func (f *FailoverClient) SendTransferBytes(ctx context.Context, payload []byte) ([]byte, int, int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tried := make(map[*endpointState]bool)
+	for {
+		if f.client == nil {
+			if err := f.connectLocked(ctx, tried); err != nil {
+				return nil, 0, 0, err
+			}
+		}
+		ep := f.current
+		tried[ep] = true
+
+		data, sent, received, failover, err := f.transferLocked(ctx, payload)
+		if err == nil {
+			f.markSuccess(ep, 0)
+			return data, sent, received, nil
+		}
+		if !failover || ctx.Err() != nil {
+			return data, sent, received, err
+		}
+
+		// 当前节点故障，切换到其他节点
+		f.markFailure(ep, err)
+		f.setCurrentLocked(nil, nil)
+		f.metrics().Retry(RetryFailover)
+	}
+}
+
+// transferLocked 在当前节点上发送请求，failover表示错误是否应切换节点，调用方需持有f.mu
+func (f *FailoverClient) transferLocked(ctx context.Context, payload []byte) (data []byte, sent, received int, failover bool, err error) {
+	resp, err := f.client.SendTransferStream(ctx, bytes.NewReader(payload))
+	if err != nil {
+		// 请求未能发出，连接或流已不可用
+		return nil, 0, 0, true, err
+	}
+	defer resp.Close()
+
+	data, err = io.ReadAll(resp)
+	sent, received = int(resp.SentBytes()), int(resp.ReceivedBytes())
+	if err != nil {
+		return data, sent, received, shouldFailover(err), fmt.Errorf("读取响应失败: %v", err)
+	}
+	return data, sent, received, false, nil
+}
+
+// shouldFailover 判断读取响应的错误是否应切换节点：网关返回后端连接失败或连接层出错时切换，
+// 网关以其他错误码拒绝请求、解密失败等错误直接返回
+func shouldFailover(err error) bool {
+	var gatewayErr *GatewayError
+	if errors.As(err, &gatewayErr) {
+		return gatewayErr.Result == proto.AUTH_STATUS_CODE_ERR_CONN_FAILED
+	}
+	var netErr net.Error
+	var appErr *quic.ApplicationError
+	var transportErr *quic.TransportError
+	var streamErr *quic.StreamError
+	var resetErr *quic.StatelessResetError
+	return errors.As(err, &netErr) || errors.As(err, &appErr) || errors.As(err, &transportErr) ||
+		errors.As(err, &streamErr) || errors.As(err, &resetErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// pick 按策略从未尝试过的节点中选择一个，健康节点优先，全部不可用时也会尝试不可用的节点
+func (f *FailoverClient) pick(tried map[*endpointState]bool) *endpointState {
+	f.stateMu.Lock()
+	defer f.stateMu.Unlock()
+
+	var healthy, unhealthy []*endpointState
+	for _, ep := range f.endpoints {
+		if tried[ep] {
+			continue
+		}
+		if ep.Healthy {
+			healthy = append(healthy, ep)
+		} else {
+			unhealthy = append(unhealthy, ep)
+		}
+	}
+	candidates := healthy
+	if len(candidates) == 0 {
+		candidates = unhealthy
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	// 只在优先级最高的一组节点中选择
+	top := candidates[0].Priority
+	for _, ep := range candidates {
+		top = min(top, ep.Priority)
+	}
+	candidates = slices.DeleteFunc(candidates, func(ep *endpointState) bool { return ep.Priority != top })
+
+	switch f.opts.Policy {
+	case BalanceLeastLatency:
+		best := candidates[0]
+		for _, ep := range candidates[1:] {
+			if ep.RTT < best.RTT {
+				best = ep
+			}
+		}
+		return best
+	case BalanceRandom:
+		total := 0
+		for _, ep := range candidates {
+			total += ep.Weight
+		}
+		n := f.rand.Intn(total)
+		for _, ep := range candidates {
+			if n -= ep.Weight; n < 0 {
+				return ep
+			}
+		}
+		return candidates[len(candidates)-1]
+	default:
+		// 平滑加权轮询：每轮各节点加上自身权重，选中当前权重最大的节点并减去总权重
+		total := 0
+		var best *endpointState
+		for _, ep := range candidates {
+			ep.currentWeight += ep.Weight
+			total += ep.Weight
+			if best == nil || ep.currentWeight > best.currentWeight {
+				best = ep
+			}
+		}
+		best.currentWeight -= total
+		return best
+	}
+}
+
+// markFailure 记录节点失败，连续失败达到MaxFailures时标记为不可用
+func (f *FailoverClient) markFailure(ep *endpointState, err error) {
+	f.stateMu.Lock()
+	defer f.stateMu.Unlock()
+
+	ep.Failures++
+	ep.LastError = err
+	if ep.Failures >= f.opts.MaxFailures {
+		ep.Healthy = false
+	}
+	f.reportPoolLocked()
+}
+
+// markSuccess 记录节点成功，rtt大于0时更新RTT的滑动平均
+func (f *FailoverClient) markSuccess(ep *endpointState, rtt time.Duration) {
+	f.stateMu.Lock()
+	defer f.stateMu.Unlock()
+
+	ep.Failures = 0
+	ep.Healthy = true
+	ep.LastError = nil
+	if rtt > 0 {
+		if ep.RTT == 0 {
+			ep.RTT = rtt
+		} else {
+			ep.RTT = (ep.RTT*7 + rtt) / 8
+		}
+	}
+	f.reportPoolLocked()
+}
+
+// metrics 返回配置中的指标钩子
+func (f *FailoverClient) metrics() Metrics {
+	if f.config.Metrics == nil {
+		return NopMetrics{}
+	}
+	return f.config.Metrics
+}
+
+// reportPoolLocked 向指标钩子报告可用节点数，调用方需持有f.stateMu
+func (f *FailoverClient) reportPoolLocked() {
+	healthy := 0
+	for _, ep := range f.endpoints {
+		if ep.Healthy {
+			healthy++
+		}
+	}
+	f.metrics().PoolUsage(healthy, len(f.endpoints))
+}
+
+// probeLoop 定期探测节点，直到Close
+func (f *FailoverClient) probeLoop() {
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(f.opts.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			f.probe()
+		}
+	}
+}
+
+// probe 在当前连接上发送链路心跳刷新RTT，对不可用的节点发起连接和初始化，成功后恢复为可用
+// 其他可用的空闲节点不探测，保留上次使用时测得的RTT
+func (f *FailoverClient) probe() {
+	f.stateMu.Lock()
+	var targets []*endpointState
+	for _, ep := range f.endpoints {
+		if !ep.Healthy {
+			targets = append(targets, ep)
+		}
+	}
+	f.stateMu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-f.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	f.heartbeat(ctx)
+	for _, ep := range targets {
+		c, rtt, err := f.dial(ctx, ep)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			f.markFailure(ep, err)
+			continue
+		}
+		c.Close()
+		f.markSuccess(ep, rtt)
+	}
+}
+
+// heartbeat 在当前连接上发送链路心跳，成功时更新当前节点的RTT，失败时记录失败并关闭连接，下次请求重新选择节点
+// 有请求正在进行时跳过，连接显然可用
+func (f *FailoverClient) heartbeat(ctx context.Context) {
+	if !f.mu.TryLock() {
+		return
+	}
+	defer f.mu.Unlock()
+	if f.client == nil {
+		return
+	}
+
+	hbCtx, cancel := context.WithTimeout(ctx, f.opts.ConnectTimeout)
+	defer cancel()
+	ep := f.current
+	rtt, err := f.client.Heartbeat(hbCtx)
+	if err != nil {
+		if ctx.Err() != nil {
+			// Close中止了探测
+			return
+		}
+		f.markFailure(ep, err)
+		f.setCurrentLocked(nil, nil)
+		return
+	}
+	f.markSuccess(ep, rtt)
+}
+
+// Endpoints 返回各节点的当前状态
+func (f *FailoverClient) Endpoints() []EndpointStatus {
+	f.stateMu.Lock()
+	defer f.stateMu.Unlock()
+
+	status := make([]EndpointStatus, 0, len(f.endpoints))
+	for _, ep := range f.endpoints {
+		status = append(status, ep.EndpointStatus)
+	}
+	return status
+}
+
+// Current 返回当前使用的节点地址，未连接时返回空字符串
+func (f *FailoverClient) Current() string {
+	f.stateMu.Lock()
+	defer f.stateMu.Unlock()
+
+	for _, ep := range f.endpoints {
+		if ep.active {
+			return ep.Addr
+		}
+	}
+	return ""
+}
+
+// Close 停止后台任务并关闭当前连接
+func (f *FailoverClient) Close() error {
+	f.stopOnce.Do(func() { close(f.stop) })
+	f.wg.Wait()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setCurrentLocked(nil, nil)
+	return nil
+}
@@ -0,0 +1,221 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/proto"
+)
+
+// failoverTestConfig 返回连接多个测试网关使用的配置模板和节点列表
+func failoverTestConfig(gateways ...*testGateway) (*Config, []Endpoint) {
+	pool := x509.NewCertPool()
+	endpoints := make([]Endpoint, 0, len(gateways))
+	for _, g := range gateways {
+		pool.AddCert(g.cert)
+		endpoints = append(endpoints, Endpoint{Addr: g.addr})
+	}
+	return &Config{ServerID: 1, ServerName: "test-server", SessionID: "test-session", RootCAs: pool, MaxRetries: 1}, endpoints
+}
+
+// newTestFailoverClient 创建连接多个测试网关的FailoverClient
+func newTestFailoverClient(t *testing.T, opts *FailoverOptions, gateways ...*testGateway) *FailoverClient {
+	t.Helper()
+
+	config, endpoints := failoverTestConfig(gateways...)
+	f, err := NewFailoverClient(endpoints, config, opts)
+	if err != nil {
+		t.Fatalf("NewFailoverClient failed: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+// endpointStatus 返回地址对应节点的状态
+func (f *FailoverClient) endpointStatus(t *testing.T, addr string) EndpointStatus {
+	t.Helper()
+	for _, status := range f.Endpoints() {
+		if status.Addr == addr {
+			return status
+		}
+	}
+	t.Fatalf("Endpoint %s not found", addr)
+	return EndpointStatus{}
+}
+
+func TestFailoverClient_Policies(t *testing.T) {
+	endpoints := []Endpoint{{Addr: "a:1", Weight: 2}, {Addr: "b:1"}}
+
+	f, err := NewFailoverClient(endpoints, &Config{}, &FailoverOptions{ProbeInterval: -1})
+	if err != nil {
+		t.Fatalf("NewFailoverClient failed: %v", err)
+	}
+	var order []string
+	for i := 0; i < 6; i++ {
+		order = append(order, f.pick(nil).Addr)
+	}
+	if want := []string{"a:1", "b:1", "a:1", "a:1", "b:1", "a:1"}; !slices.Equal(order, want) {
+		t.Errorf("Unexpected weighted round-robin order %v", order)
+	}
+
+	// 已尝试过的节点和不可用的节点不会被优先选中
+	f.endpoints[0].Healthy = false
+	if ep := f.pick(nil); ep.Addr != "b:1" {
+		t.Errorf("Expected healthy endpoint b:1, got %s", ep.Addr)
+	}
+	if ep := f.pick(map[*endpointState]bool{f.endpoints[1]: true}); ep == nil || ep.Addr != "a:1" {
+		t.Errorf("Expected unhealthy endpoint when no healthy one is left, got %v", ep)
+	}
+
+	f, _ = NewFailoverClient(endpoints, &Config{}, &FailoverOptions{Policy: BalanceLeastLatency, ProbeInterval: -1})
+	f.endpoints[0].RTT, f.endpoints[1].RTT = 20*time.Millisecond, 5*time.Millisecond
+	if ep := f.pick(nil); ep.Addr != "b:1" {
+		t.Errorf("Expected lowest RTT endpoint b:1, got %s", ep.Addr)
+	}
+
+	f, _ = NewFailoverClient(endpoints, &Config{}, &FailoverOptions{Policy: BalanceRandom, ProbeInterval: -1})
+	counts := map[string]int{}
+	for i := 0; i < 300; i++ {
+		counts[f.pick(nil).Addr]++
+	}
+	if counts["a:1"] <= counts["b:1"] {
+		t.Errorf("Expected weighted random to favour a:1, got %v", counts)
+	}
+
+	if _, err := ParseBalancePolicy("least-latency"); err != nil {
+		t.Errorf("ParseBalancePolicy failed: %v", err)
+	}
+	if _, err := NewFailoverClient(nil, &Config{}, nil); err == nil {
+		t.Error("Expected error without endpoints")
+	}
+}
+
+func TestFailoverClient_Failover(t *testing.T) {
+	payload := []byte("POST /echo HTTP/1.1\r\nHost: backend\r\nContent-Length: 8\r\n\r\nfailover")
+
+	for _, tc := range []struct {
+		name string
+		fail func(g *testGateway)
+	}{
+		{"conn failed", func(g *testGateway) { g.backendDown.Store(true) }},
+		{"stream reset", func(g *testGateway) { g.resetStream.Store(true) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g1 := newTestGateway(t, echoHandler)
+			g2 := newTestGateway(t, echoHandler)
+			f := newTestFailoverClient(t, &FailoverOptions{ProbeInterval: -1}, g1, g2)
+
+			if err := f.Connect(context.Background()); err != nil {
+				t.Fatalf("Connect failed: %v", err)
+			}
+			if f.Current() != g1.addr {
+				t.Fatalf("Expected first endpoint, got %s", f.Current())
+			}
+			tc.fail(g1)
+
+			resp, _, _, err := f.SendTransferBytes(context.Background(), payload)
+			if err != nil {
+				t.Fatalf("SendTransferBytes failed: %v", err)
+			}
+			if !bytes.HasSuffix(resp, []byte("failover")) {
+				t.Errorf("Unexpected response: %q", resp)
+			}
+			if f.Current() != g2.addr {
+				t.Errorf("Expected failover to %s, got %s", g2.addr, f.Current())
+			}
+			if status := f.endpointStatus(t, g1.addr); status.Failures != 1 || status.LastError == nil {
+				t.Errorf("Expected one recorded failure, got %+v", status)
+			}
+		})
+	}
+
+	t.Run("all endpoints down", func(t *testing.T) {
+		g1 := newTestGateway(t, echoHandler)
+		g2 := newTestGateway(t, echoHandler)
+		g1.backendDown.Store(true)
+		g2.backendDown.Store(true)
+		f := newTestFailoverClient(t, &FailoverOptions{ProbeInterval: -1}, g1, g2)
+		if _, _, _, err := f.SendTransferBytes(context.Background(), payload); err == nil {
+			t.Error("Expected error when every endpoint fails")
+		}
+	})
+}
+
+func TestFailoverClient_HealthAndProbe(t *testing.T) {
+	g1 := newTestGateway(t, echoHandler)
+	g2 := newTestGateway(t, echoHandler)
+	g1.rejectInit.Store(true)
+
+	f := newTestFailoverClient(t, &FailoverOptions{MaxFailures: 1, ProbeInterval: 50 * time.Millisecond}, g1, g2)
+	if err := f.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if f.Current() != g2.addr {
+		t.Errorf("Expected %s after init failure, got %s", g2.addr, f.Current())
+	}
+	if status := f.endpointStatus(t, g1.addr); status.Healthy {
+		t.Errorf("Expected %s to be unhealthy, got %+v", g1.addr, status)
+	}
+	if status := f.endpointStatus(t, g2.addr); !status.Healthy || status.RTT <= 0 {
+		t.Errorf("Expected healthy endpoint with measured RTT, got %+v", status)
+	}
+
+	// 节点恢复后由后台探测重新标记为可用
+	g1.rejectInit.Store(false)
+	deadline := time.Now().Add(5 * time.Second)
+	for !f.endpointStatus(t, g1.addr).Healthy {
+		if time.Now().After(deadline) {
+			t.Fatal("Endpoint was not re-probed")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if status := f.endpointStatus(t, g1.addr); status.Failures != 0 || status.RTT <= 0 {
+		t.Errorf("Unexpected status after probe: %+v", status)
+	}
+}
+
+func TestFailoverClient_HeartbeatProbe(t *testing.T) {
+	g1 := newTestGateway(t, echoHandler)
+	g2 := newTestGateway(t, echoHandler)
+
+	f := newTestFailoverClient(t, &FailoverOptions{Policy: BalanceLeastLatency, ProbeInterval: 20 * time.Millisecond}, g1, g2)
+	if err := f.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	active, idle := g1, g2
+	if f.Current() == g2.addr {
+		active, idle = g2, g1
+	}
+
+	// 当前连接上定期发送链路心跳，不重新连接和初始化
+	count := func(g *testGateway, command uint16) int {
+		n := 0
+		for _, h := range g.receivedHeaders() {
+			if h.Command == command {
+				n++
+			}
+		}
+		return n
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for count(active, proto.EMM_COMMAND_LINK_HEART_BEAT) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("No heartbeats on active connection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := count(active, proto.EMM_COMMAND_INIT); n != 1 {
+		t.Errorf("Expected 1 INIT on active endpoint, got %d", n)
+	}
+	if status := f.endpointStatus(t, active.addr); !status.Healthy || status.RTT <= 0 {
+		t.Errorf("Expected heartbeat RTT, got %+v", status)
+	}
+	// 可用的空闲节点不探测
+	if n := len(idle.receivedHeaders()); n != 0 {
+		t.Errorf("Expected no probes on idle endpoint, got %d frames", n)
+	}
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/laotiannai/quic_gwclient/proto"
+)
+
+// DefaultTransferFrameSize 单个EMM_COMMAND_TRAN帧默认携带的最大数据长度
+const DefaultTransferFrameSize = 32 * 1024
+
+// MaxTransferFrameSize 单个EMM_COMMAND_TRAN帧允许携带的最大数据长度
+const MaxTransferFrameSize = 16 * 1024 * 1024
+
+// maxResponseFrameSize 单个响应帧允许的最大数据长度，防止异常包头导致分配过大内存
+const maxResponseFrameSize = 64 * 1024 * 1024
+
+var errInvalidFrameTag = errors.New("响应帧包头标志错误")
+
+// newTransferFrame 构造请求帧，返回包头和数据拼接后的字节，option为包头Option字段
+func newTransferFrame(command uint16, protoType uint8, option uint8, body []byte) ([]byte, error) {
+	msg := &proto.UdpMessage{
+		Head: proto.TransferHeader{
+			Tag:       proto.HEAD_TAG,
+			Version:   proto.PROTO_VERSION,
+			Command:   command,
+			ProtoType: protoType,
+			Option:    option,
+			Reserve:   0,
+			DataLen:   uint32(len(body)),
+		},
+		Body: body,
+	}
+	return msg.Marshal()
+}
+
+// readResponseFrame 从r中读取一个完整的响应帧（包头和数据）
+func readResponseFrame(r io.Reader) (*proto.UdpResponseMessage, error) {
+	headBuf := make([]byte, proto.RESPONSE_HEAD_LEN)
+	if _, err := io.ReadFull(r, headBuf); err != nil {
+		return nil, err
+	}
+
+	msg := &proto.UdpResponseMessage{}
+	if err := msg.ParseHead(headBuf); err != nil {
+		return nil, err
+	}
+	if msg.Head.Tag != proto.HEAD_TAG {
+		return nil, errInvalidFrameTag
+	}
+	if msg.Head.DataLen > maxResponseFrameSize {
+		return nil, fmt.Errorf("响应帧数据长度过大: %d 字节", msg.Head.DataLen)
+	}
+
+	if msg.Head.DataLen > 0 {
+		msg.Body = make([]byte, msg.Head.DataLen)
+		if _, err := io.ReadFull(r, msg.Body); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+
+	return msg, nil
+}
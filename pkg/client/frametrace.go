@@ -0,0 +1,436 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/proto"
+	"github.com/quic-go/quic-go"
+)
+
+// FrameDirection EMM帧的方向
+type FrameDirection string
+
+const (
+	FrameSent     FrameDirection = "send" // 客户端发出的请求帧
+	FrameReceived FrameDirection = "recv" // 网关返回的响应帧
+)
+
+// FrameEvent 一个完整的EMM帧，由FrameTracer观察
+type FrameEvent struct {
+	Time      time.Time
+	Direction FrameDirection
+	Conn      uint64                // 连接序号，进程内每个跟踪的连接递增，区分重连前后ID相同的流
+	StreamID  int64                 // 所在的QUIC流，数据报为-1
+	Datagram  bool                  // 帧通过QUIC数据报收发
+	Request   *proto.TransferHeader // 请求帧的包头，Direction为FrameSent时有效
+	Response  *proto.ResponseHeader // 响应帧的包头，Direction为FrameReceived时有效
+	Body      []byte                // 帧数据，加密会话中为密文，只在TraceFrame调用期间有效
+	// Err 非nil表示帧无法完整解析：包头标志或长度错误时同一方向的后续数据不再跟踪，
+	// 流或数据报在帧中间结束时为io.ErrUnexpectedEOF，包头不完整时Request和Response都为nil
+	Err error
+}
+
+// Command 返回帧的命令字
+func (ev *FrameEvent) Command() uint16 {
+	switch {
+	case ev.Request != nil:
+		return ev.Request.Command
+	case ev.Response != nil:
+		return ev.Response.Command
+	}
+	return 0
+}
+
+// FrameTracer 观察客户端在流和数据报上收发的每个EMM帧，通过Config.FrameTracer注入
+// 方法在收发数据的goroutine中同步调用，实现需要并发安全，耗时会直接计入请求耗时
+type FrameTracer interface {
+	TraceFrame(ev *FrameEvent)
+}
+
+// FrameTracerFunc 将函数适配为FrameTracer
+type FrameTracerFunc func(ev *FrameEvent)
+
+func (f FrameTracerFunc) TraceFrame(ev *FrameEvent) { f(ev) }
+
+// FrameTraceFormat 帧跟踪的输出格式
+type FrameTraceFormat string
+
+const (
+	FrameTraceText FrameTraceFormat = "text" // 每帧一行包头字段，帧数据以hexdump格式跟在后面
+	FrameTraceJSON FrameTraceFormat = "json" // 每帧一行JSON，帧数据为十六进制字符串
+)
+
+// ParseFrameTraceFormat 解析命令行中的输出格式
+func ParseFrameTraceFormat(s string) (FrameTraceFormat, error) {
+	switch f := FrameTraceFormat(strings.ToLower(strings.TrimSpace(s))); f {
+	case FrameTraceText, FrameTraceJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("不支持的帧跟踪格式: %q", s)
+}
+
+// FrameTraceOptions 帧跟踪输出选项
+type FrameTraceOptions struct {
+	Format       FrameTraceFormat // 输出格式，默认FrameTraceText
+	DumpBody     bool             // 是否输出帧数据，默认true
+	MaxBodyBytes int              // 每帧最多输出的数据字节数，默认4096，<0表示不限制
+}
+
+// DefaultFrameTraceOptions 返回默认的帧跟踪输出选项
+func DefaultFrameTraceOptions() *FrameTraceOptions {
+	return &FrameTraceOptions{
+		Format:       FrameTraceText,
+		DumpBody:     true,
+		MaxBodyBytes: 4096,
+	}
+}
+
+// NewFrameRecorder 创建录制会话使用的FrameTraceWriter，以JSON Lines格式输出带完整帧数据的记录，
+// 录制的文件可以由pkg/replay读取，作为模拟网关重放或向其他网关重新发送其中的请求
+func NewFrameRecorder(w io.Writer) *FrameTraceWriter {
+	return NewFrameTraceWriter(w, &FrameTraceOptions{Format: FrameTraceJSON, DumpBody: true, MaxBodyBytes: -1})
+}
+
+// FrameTraceWriter 将帧以可读文本或JSON Lines格式写入io.Writer的FrameTracer，可以直接附在网关问题报告中
+// 帧数据包含请求和响应内容，INIT和KEY_UPDATE请求中还有可以推导会话密钥的数据，输出只应用于调试
+type FrameTraceWriter struct {
+	mu   sync.Mutex
+	w    io.Writer
+	opts FrameTraceOptions
+	err  error
+}
+
+// NewFrameTraceWriter 创建帧跟踪输出，opts为nil时使用DefaultFrameTraceOptions
+func NewFrameTraceWriter(w io.Writer, opts *FrameTraceOptions) *FrameTraceWriter {
+	if opts == nil {
+		opts = DefaultFrameTraceOptions()
+	}
+	t := &FrameTraceWriter{w: w, opts: *opts}
+	if t.opts.Format == "" {
+		t.opts.Format = FrameTraceText
+	}
+	return t
+}
+
+// Err 返回第一次写入失败的错误，写入失败后不再输出
+func (t *FrameTraceWriter) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// TraceFrame 实现FrameTracer
+func (t *FrameTraceWriter) TraceFrame(ev *FrameEvent) {
+	body, truncated := ev.Body, false
+	if !t.opts.DumpBody {
+		body = nil
+	} else if t.opts.MaxBodyBytes >= 0 && len(body) > t.opts.MaxBodyBytes {
+		body, truncated = body[:t.opts.MaxBodyBytes], true
+	}
+
+	var buf []byte
+	if t.opts.Format == FrameTraceJSON {
+		buf = appendFrameJSON(ev, body, truncated)
+	} else {
+		buf = appendFrameText(ev, body, truncated)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err == nil {
+		_, t.err = t.w.Write(buf)
+	}
+}
+
+// commandNames 日志和帧跟踪中显示的命令字名称
+var commandNames = map[uint16]string{
+	proto.EMM_COMMAND_HEART_BEAT:          "HEART_BEAT",
+	proto.EMM_COMMAND_INIT:                "INIT",
+	proto.EMM_COMMAND_INIT_ACK:            "INIT_ACK",
+	proto.EMM_COMMAND_AUTH:                "AUTH",
+	proto.EMM_COMMAND_AUTH_ACK:            "AUTH_ACK",
+	proto.EMM_COMMAND_TRAN:                "TRAN",
+	proto.EMM_COMMAND_TRAN_ACK:            "TRAN_ACK",
+	proto.EMM_COMMAND_KEY_UPDATE:          "KEY_UPDATE",
+	proto.EMM_COMMAND_KEY_UPDATE_ACK:      "KEY_UPDATE_ACK",
+	proto.EMM_COMMAND_LINK_CLOSE:          "LINK_CLOSE",
+	proto.EMM_COMMAND_LINK_CLOSE_ACK:      "LINK_CLOSE_ACK",
+	proto.EMM_COMMAND_LINK_HEART_BEAT:     "LINK_HEART_BEAT",
+	proto.EMM_COMMAND_LINK_HEART_BEAT_ACK: "LINK_HEART_BEAT_ACK",
+}
+
+// commandName 返回命令字名称，未知命令字返回数字
+func commandName(command uint16) string {
+	if name, ok := commandNames[command]; ok {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", command)
+}
+
+// frameTraceTimeFormat 帧跟踪中的时间格式，精确到微秒
+const frameTraceTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// appendFrameText 以文本格式输出一帧：第一行为方向、位置和包头字段，之后是帧数据的hexdump
+func appendFrameText(ev *FrameEvent, body []byte, truncated bool) []byte {
+	var b strings.Builder
+	b.WriteString(ev.Time.Format(frameTraceTimeFormat))
+	fmt.Fprintf(&b, " %s conn=%d", ev.Direction, ev.Conn)
+	if ev.Datagram {
+		b.WriteString(" datagram")
+	} else {
+		fmt.Fprintf(&b, " stream=%d", ev.StreamID)
+	}
+	if h := ev.Request; h != nil {
+		fmt.Fprintf(&b, " %s version=%d proto_type=%d option=%d reserve=%d data_len=%d crc=%d",
+			commandName(h.Command), h.Version, h.ProtoType, h.Option, h.Reserve, h.DataLen, h.Crc)
+	}
+	if r := ev.Response; r != nil {
+		fmt.Fprintf(&b, " %s version=%d result=%d option=%d reserve=%d data_len=%d origin_len=%d",
+			commandName(r.Command), r.Version, r.Result, r.Option, r.Reserve, r.DataLen, r.OriginLen)
+	}
+	if ev.Err != nil {
+		fmt.Fprintf(&b, " error=%q", ev.Err.Error())
+	}
+	b.WriteByte('\n')
+	if len(body) > 0 {
+		b.WriteString(hex.Dump(body))
+	}
+	if truncated {
+		fmt.Fprintf(&b, "... %d bytes total\n", len(ev.Body))
+	}
+	return []byte(b.String())
+}
+
+// frameRecord JSON格式中的一帧，请求帧和响应帧特有的字段只在对应方向出现
+// pkg/replay按该格式读取录制的会话，修改字段时需要保持兼容
+type frameRecord struct {
+	Time          string         `json:"time"`
+	Direction     FrameDirection `json:"dir"`
+	Conn          uint64         `json:"conn"`
+	StreamID      int64          `json:"stream_id"`
+	Datagram      bool           `json:"datagram,omitempty"`
+	Command       *uint16        `json:"command,omitempty"`
+	CommandName   string         `json:"command_name,omitempty"`
+	Version       *uint16        `json:"version,omitempty"`
+	ProtoType     *uint8         `json:"proto_type,omitempty"`
+	Result        *uint16        `json:"result,omitempty"`
+	Option        *uint8         `json:"option,omitempty"`
+	Reserve       *uint16        `json:"reserve,omitempty"`
+	DataLen       *uint32        `json:"data_len,omitempty"`
+	Crc           *uint32        `json:"crc,omitempty"`
+	OriginLen     *uint32        `json:"origin_len,omitempty"`
+	Body          string         `json:"body,omitempty"`
+	BodyTruncated bool           `json:"body_truncated,omitempty"`
+	Error         string         `json:"error,omitempty"`
+}
+
+// appendFrameJSON 以JSON Lines格式输出一帧
+func appendFrameJSON(ev *FrameEvent, body []byte, truncated bool) []byte {
+	rec := frameRecord{
+		Time:          ev.Time.Format(frameTraceTimeFormat),
+		Direction:     ev.Direction,
+		Conn:          ev.Conn,
+		StreamID:      ev.StreamID,
+		Datagram:      ev.Datagram,
+		Body:          hex.EncodeToString(body),
+		BodyTruncated: truncated,
+	}
+	if h := ev.Request; h != nil {
+		rec.Command, rec.Version, rec.ProtoType = &h.Command, &h.Version, &h.ProtoType
+		rec.Option, rec.Reserve, rec.DataLen, rec.Crc = &h.Option, &h.Reserve, &h.DataLen, &h.Crc
+	}
+	if r := ev.Response; r != nil {
+		reserve := uint16(r.Reserve)
+		rec.Command, rec.Version, rec.Result = &r.Command, &r.Version, &r.Result
+		rec.Option, rec.Reserve, rec.DataLen, rec.OriginLen = &r.Option, &reserve, &r.DataLen, &r.OriginLen
+	}
+	if rec.Command != nil {
+		rec.CommandName = commandName(*rec.Command)
+	}
+	if ev.Err != nil {
+		rec.Error = ev.Err.Error()
+	}
+	buf, _ := json.Marshal(rec)
+	return append(buf, '\n')
+}
+
+// frameScanner 从一个方向的字节流中切分EMM帧并交给FrameTracer
+// 请求帧和响应帧的包头长度相同，包头标志和数据长度也在相同的位置
+type frameScanner struct {
+	tracer   FrameTracer
+	dir      FrameDirection
+	conn     uint64
+	streamID int64
+	datagram bool
+	buf      []byte // 当前帧已收到的字节
+	broken   bool   // 出现无法解析的包头后不再跟踪
+}
+
+// write 处理流上的一段数据，每凑齐一帧调用一次TraceFrame
+func (s *frameScanner) write(p []byte) {
+	for len(p) > 0 && !s.broken {
+		if len(s.buf) < proto.RESPONSE_HEAD_LEN {
+			n := min(proto.RESPONSE_HEAD_LEN-len(s.buf), len(p))
+			s.buf = append(s.buf, p[:n]...)
+			p = p[n:]
+			if len(s.buf) < proto.RESPONSE_HEAD_LEN {
+				return
+			}
+			if err := checkFrameHead(s.buf); err != nil {
+				s.broken = true
+				s.emit(err)
+				return
+			}
+		}
+		total := proto.RESPONSE_HEAD_LEN + int(binary.BigEndian.Uint32(s.buf[12:16]))
+		n := min(total-len(s.buf), len(p))
+		s.buf = append(s.buf, p[:n]...)
+		p = p[n:]
+		if len(s.buf) == total {
+			s.emit(nil)
+			s.buf = s.buf[:0]
+		}
+	}
+}
+
+// flush 数据结束时报告未完整的帧
+func (s *frameScanner) flush() {
+	if len(s.buf) > 0 && !s.broken {
+		s.emit(io.ErrUnexpectedEOF)
+		s.buf = s.buf[:0]
+	}
+}
+
+// checkFrameHead 检查包头标志和数据长度
+func checkFrameHead(head []byte) error {
+	if binary.BigEndian.Uint32(head) != proto.HEAD_TAG {
+		return errInvalidFrameTag
+	}
+	if n := binary.BigEndian.Uint32(head[12:16]); n > maxResponseFrameSize {
+		return fmt.Errorf("帧数据长度过大: %d 字节", n)
+	}
+	return nil
+}
+
+// emit 解码当前帧的包头并调用TraceFrame
+func (s *frameScanner) emit(err error) {
+	ev := &FrameEvent{
+		Time:      time.Now(),
+		Direction: s.dir,
+		Conn:      s.conn,
+		StreamID:  s.streamID,
+		Datagram:  s.datagram,
+		Body:      s.buf,
+		Err:       err,
+	}
+	if len(s.buf) >= proto.RESPONSE_HEAD_LEN {
+		head := s.buf[:proto.RESPONSE_HEAD_LEN]
+		ev.Body = s.buf[proto.RESPONSE_HEAD_LEN:]
+		if s.dir == FrameSent {
+			ev.Request = &proto.TransferHeader{}
+			ev.Request.UnMarshal(head)
+		} else {
+			ev.Response = &proto.ResponseHeader{}
+			ev.Response.UnMarshal(head)
+		}
+	}
+	s.tracer.TraceFrame(ev)
+}
+
+// tracedConns 已跟踪的连接数，用于分配FrameEvent.Conn
+var tracedConns atomic.Uint64
+
+// traceConn 配置了FrameTracer时包装conn，跟踪其上所有流和数据报中的EMM帧
+func (c *TransferClient) traceConn(conn quic.Connection) quic.Connection {
+	if c.config.FrameTracer == nil {
+		return conn
+	}
+	return &tracedConn{Connection: conn, tracer: c.config.FrameTracer, id: tracedConns.Add(1)}
+}
+
+// tracedConn 包装quic.Connection，打开的流和收发的数据报都经过FrameTracer
+type tracedConn struct {
+	quic.Connection
+	tracer FrameTracer
+	id     uint64
+}
+
+func (c *tracedConn) OpenStream() (quic.Stream, error) {
+	return c.wrap(c.Connection.OpenStream())
+}
+
+func (c *tracedConn) OpenStreamSync(ctx context.Context) (quic.Stream, error) {
+	return c.wrap(c.Connection.OpenStreamSync(ctx))
+}
+
+func (c *tracedConn) AcceptStream(ctx context.Context) (quic.Stream, error) {
+	return c.wrap(c.Connection.AcceptStream(ctx))
+}
+
+func (c *tracedConn) wrap(stream quic.Stream, err error) (quic.Stream, error) {
+	if err != nil {
+		return nil, err
+	}
+	id := int64(stream.StreamID())
+	return &tracedStream{
+		Stream: stream,
+		send:   frameScanner{tracer: c.tracer, dir: FrameSent, conn: c.id, streamID: id},
+		recv:   frameScanner{tracer: c.tracer, dir: FrameReceived, conn: c.id, streamID: id},
+	}, nil
+}
+
+func (c *tracedConn) SendDatagram(payload []byte) error {
+	if err := c.Connection.SendDatagram(payload); err != nil {
+		return err
+	}
+	c.traceDatagram(FrameSent, payload)
+	return nil
+}
+
+func (c *tracedConn) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	data, err := c.Connection.ReceiveDatagram(ctx)
+	if err == nil {
+		c.traceDatagram(FrameReceived, data)
+	}
+	return data, err
+}
+
+// traceDatagram 每个数据报携带一个完整的帧
+func (c *tracedConn) traceDatagram(dir FrameDirection, data []byte) {
+	s := frameScanner{tracer: c.tracer, dir: dir, conn: c.id, streamID: -1, datagram: true}
+	s.write(data)
+	s.flush()
+}
+
+// tracedStream 包装quic.Stream，按帧跟踪写入和读取的数据
+// 读写各自只在一个goroutine中进行，两个方向的状态互不共享，不需要加锁
+type tracedStream struct {
+	quic.Stream
+	send frameScanner
+	recv frameScanner
+}
+
+func (s *tracedStream) Write(p []byte) (int, error) {
+	n, err := s.Stream.Write(p)
+	s.send.write(p[:n])
+	return n, err
+}
+
+func (s *tracedStream) Read(p []byte) (int, error) {
+	n, err := s.Stream.Read(p)
+	s.recv.write(p[:n])
+	// 读超时后流还可以继续读取，只在流结束时报告未完整的帧
+	if err == io.EOF {
+		s.recv.flush()
+	}
+	return n, err
+}
@@ -0,0 +1,194 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/proto"
+)
+
+// frameRecorder 记录FrameTracer观察到的帧
+type frameRecorder struct {
+	mu     sync.Mutex
+	events []FrameEvent
+}
+
+func (r *frameRecorder) TraceFrame(ev *FrameEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := *ev
+	e.Body = bytes.Clone(ev.Body)
+	r.events = append(r.events, e)
+}
+
+// find 返回第一个方向和命令字匹配的帧
+func (r *frameRecorder) find(dir FrameDirection, command uint16) *FrameEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.events {
+		if r.events[i].Direction == dir && r.events[i].Command() == command {
+			return &r.events[i]
+		}
+	}
+	return nil
+}
+
+func TestFrameTracer_Transfer(t *testing.T) {
+	rec := &frameRecorder{}
+	g := newTestGateway(t, echoHandler)
+	c := g.newTestClient(t, &Config{FrameTracer: rec})
+	if _, _, err := c.SendInit(); err != nil {
+		t.Fatalf("SendInit failed: %v", err)
+	}
+
+	payload := []byte("POST /echo HTTP/1.1\r\nHost: backend\r\nContent-Length: 5\r\n\r\nhello")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, _, _, err := c.SendTransferBytes(ctx, payload); err != nil {
+		t.Fatalf("SendTransferBytes failed: %v", err)
+	}
+
+	if ev := rec.find(FrameSent, proto.EMM_COMMAND_INIT); ev == nil || ev.Request.Tag != proto.HEAD_TAG || ev.Datagram {
+		t.Errorf("Expected INIT frame, got %+v", ev)
+	}
+	if ev := rec.find(FrameReceived, proto.EMM_COMMAND_INIT_ACK); ev == nil || ev.Response.Result != proto.AUTH_STATUS_CODE_SUCCESS {
+		t.Errorf("Expected successful INIT_ACK frame, got %+v", ev)
+	}
+	tran := rec.find(FrameSent, proto.EMM_COMMAND_TRAN)
+	if tran == nil || !bytes.Equal(tran.Body, payload) || int(tran.Request.DataLen) != len(payload) {
+		t.Fatalf("Expected TRAN frame with the payload, got %+v", tran)
+	}
+	ack := rec.find(FrameReceived, proto.EMM_COMMAND_TRAN_ACK)
+	if ack == nil || ack.StreamID != tran.StreamID || !bytes.Contains(ack.Body, []byte("hello")) {
+		t.Errorf("Expected TRAN_ACK frame on stream %d, got %+v", tran.StreamID, ack)
+	}
+	for _, ev := range rec.events {
+		if ev.Err != nil {
+			t.Errorf("Unexpected trace error: %+v", ev)
+		}
+	}
+}
+
+func TestFrameTracer_Datagram(t *testing.T) {
+	rec := &frameRecorder{}
+	g := newTestGateway(t, echoHandler)
+	_, d := g.openTestDatagramConn(t, &Config{FrameTracer: rec})
+	echoDatagram(t, d, "rtp")
+
+	for _, dir := range []FrameDirection{FrameSent, FrameReceived} {
+		command := proto.EMM_COMMAND_TRAN
+		if dir == FrameReceived {
+			command = proto.EMM_COMMAND_TRAN_ACK
+		}
+		ev := rec.find(dir, command)
+		if ev == nil || !ev.Datagram || ev.StreamID != -1 || ev.Conn == 0 || string(ev.Body) != "rtp" {
+			t.Errorf("Expected %s datagram frame, got %+v", dir, ev)
+		}
+	}
+}
+
+func TestFrameScanner(t *testing.T) {
+	first, _ := newTransferFrame(proto.EMM_COMMAND_TRAN, uint8(proto.PROTO_TYPE_HTTP), 0, []byte("hello"))
+	second, _ := newTransferFrame(proto.EMM_COMMAND_LINK_CLOSE, uint8(proto.PROTO_TYPE_HTTP), 0, nil)
+	data := append(append([]byte{}, first...), second...)
+
+	rec := &frameRecorder{}
+	s := frameScanner{tracer: rec, dir: FrameSent, streamID: 4}
+	// 逐字节写入，帧可以跨多次写入
+	for i := range data {
+		s.write(data[i : i+1])
+	}
+	if len(rec.events) != 2 {
+		t.Fatalf("Expected 2 frames, got %d", len(rec.events))
+	}
+	if ev := rec.events[0]; ev.Command() != proto.EMM_COMMAND_TRAN || string(ev.Body) != "hello" || ev.StreamID != 4 {
+		t.Errorf("Unexpected first frame: %+v", ev)
+	}
+	if ev := rec.events[1]; ev.Command() != proto.EMM_COMMAND_LINK_CLOSE || len(ev.Body) != 0 {
+		t.Errorf("Unexpected second frame: %+v", ev)
+	}
+
+	// 帧中间结束
+	s.write(first[:len(first)-1])
+	s.flush()
+	if ev := rec.events[2]; !errors.Is(ev.Err, io.ErrUnexpectedEOF) || ev.Request == nil || string(ev.Body) != "hell" {
+		t.Errorf("Expected truncated frame, got %+v", ev)
+	}
+
+	// 包头标志错误后不再跟踪
+	bad := bytes.Repeat([]byte{0xff}, proto.RESPONSE_HEAD_LEN)
+	s.write(append(bad, first...))
+	if len(rec.events) != 4 || !errors.Is(rec.events[3].Err, errInvalidFrameTag) {
+		t.Errorf("Expected one invalid frame, got %+v", rec.events[3:])
+	}
+}
+
+func TestFrameTraceWriter(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)
+	events := []*FrameEvent{
+		{
+			Time: at, Direction: FrameSent, StreamID: 0,
+			Request: &proto.TransferHeader{Tag: proto.HEAD_TAG, Version: 1, Command: proto.EMM_COMMAND_TRAN, ProtoType: 1, DataLen: 5},
+			Body:    []byte("hello"),
+		},
+		{
+			Time: at, Direction: FrameReceived, StreamID: -1, Datagram: true,
+			Response: &proto.ResponseHeader{Tag: proto.HEAD_TAG, Version: 1, Command: 99, Result: 8002, DataLen: 5},
+			Body:     []byte("world"),
+			Err:      io.ErrUnexpectedEOF,
+		},
+	}
+
+	var buf bytes.Buffer
+	w := NewFrameTraceWriter(&buf, &FrameTraceOptions{Format: FrameTraceText, DumpBody: true, MaxBodyBytes: 3})
+	for _, ev := range events {
+		w.TraceFrame(ev)
+	}
+	want := "2024-01-02T03:04:05.000006Z send conn=0 stream=0 TRAN version=1 proto_type=1 option=0 reserve=0 data_len=5 crc=0\n" +
+		"00000000  68 65 6c                                          |hel|\n" +
+		"... 5 bytes total\n" +
+		"2024-01-02T03:04:05.000006Z recv conn=0 datagram UNKNOWN(99) version=1 result=8002 option=0 reserve=0 data_len=5 origin_len=0 error=\"unexpected EOF\"\n" +
+		"00000000  77 6f 72                                          |wor|\n" +
+		"... 5 bytes total\n"
+	if buf.String() != want {
+		t.Errorf("Unexpected text output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	w = NewFrameTraceWriter(&buf, &FrameTraceOptions{Format: FrameTraceJSON})
+	for _, ev := range events {
+		w.TraceFrame(ev)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 JSON lines, got %q", buf.String())
+	}
+	var sent, recv map[string]any
+	json.Unmarshal([]byte(lines[0]), &sent)
+	json.Unmarshal([]byte(lines[1]), &recv)
+	if sent["command_name"] != "TRAN" || sent["proto_type"] != 1.0 || sent["body"] != nil || sent["result"] != nil {
+		t.Errorf("Unexpected JSON for sent frame: %s", lines[0])
+	}
+	if recv["result"] != 8002.0 || recv["datagram"] != true || recv["error"] != "unexpected EOF" || recv["crc"] != nil {
+		t.Errorf("Unexpected JSON for received frame: %s", lines[1])
+	}
+	if w.Err() != nil {
+		t.Errorf("Unexpected write error: %v", w.Err())
+	}
+}
+
+func TestParseFrameTraceFormat(t *testing.T) {
+	if f, err := ParseFrameTraceFormat(" JSON "); err != nil || f != FrameTraceJSON {
+		t.Errorf("ParseFrameTraceFormat(JSON) = %q, %v", f, err)
+	}
+	if _, err := ParseFrameTraceFormat("xml"); err == nil {
+		t.Error("Expected error for unsupported format")
+	}
+}
@@ -0,0 +1,616 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/proto"
+	"github.com/laotiannai/quic_gwclient/utils"
+	"github.com/quic-go/quic-go"
+)
+
+// testGateway 测试用网关，按EMM协议处理INIT和TRAN请求，并将透传的HTTP请求交给handler处理
+type testGateway struct {
+	t        *testing.T
+	ln       *quic.EarlyListener
+	addr     string
+	handler  http.Handler
+	cert     *x509.Certificate
+	opts     gatewayOptions
+	mu       sync.Mutex
+	requests []*proto.TransferHeader
+	seenIDs  map[string]bool // 已使用过的INIT和密钥轮换请求ID
+
+	reject0RTT  atomic.Bool // 更换会话票据密钥，使之前签发的票据失效并拒绝0-RTT
+	rejectInit  atomic.Bool // 以错误码拒绝INIT请求
+	backendDown atomic.Bool // TRAN请求以AUTH_STATUS_CODE_ERR_CONN_FAILED关闭链路，模拟后端不可达
+	resetStream atomic.Bool // 收到TRAN请求时重置流
+}
+
+// gatewayOptions 测试网关行为选项
+type gatewayOptions struct {
+	// 按加密会话处理INIT和TRAN请求
+	aes bool
+	// 只支持旧版加密套件，INIT_ACK中总是确认CipherLegacyCBC
+	legacyOnly bool
+	// 不支持OPTION_SEQUENCED，INIT_ACK中去掉该标志
+	noSequence bool
+	// 允许的客户端时间偏差，默认5分钟
+	maxSkew time.Duration
+	// 网关时钟相对本地时钟的偏移，用于模拟时间不同步
+	clockOffset time.Duration
+	// 重复发送第一个TRAN_ACK帧，模拟重放
+	replayResponse bool
+	// 发送第一个TRAN_ACK帧后暂停的时间，模拟网关发送中途停顿
+	stall time.Duration
+	// 要求客户端证书并用该证书池校验
+	clientCAs *x509.CertPool
+	// 监听地址，默认127.0.0.1:0
+	listenAddr string
+	// 每个数据报应答发送两次，模拟重放
+	duplicateDatagrams bool
+}
+
+func newTestGateway(t *testing.T, handler http.Handler) *testGateway {
+	t.Helper()
+	return newTestGatewayWithOptions(t, handler, gatewayOptions{})
+}
+
+func newTestGatewayWithOptions(t *testing.T, handler http.Handler, opts gatewayOptions) *testGateway {
+	t.Helper()
+
+	if opts.maxSkew == 0 {
+		opts.maxSkew = 5 * time.Minute
+	}
+	if opts.listenAddr == "" {
+		opts.listenAddr = "127.0.0.1:0"
+	}
+
+	cert, leaf := newTestCertificate(t)
+	tlsConf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"hq-interop", "hq-29", "h3-25", "http/0.9"},
+	}
+	if opts.clientCAs != nil {
+		tlsConf.ClientAuth = tls.RequireAndVerifyClientCert
+		tlsConf.ClientCAs = opts.clientCAs
+	}
+
+	g := &testGateway{}
+	tlsConf.SetSessionTicketKeys([][32]byte{{1}})
+	tlsConf.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		if !g.reject0RTT.Load() {
+			return nil, nil
+		}
+		rotated := tlsConf.Clone()
+		rotated.SetSessionTicketKeys([][32]byte{{2}})
+		return rotated, nil
+	}
+
+	ln, err := quic.ListenAddrEarly(opts.listenAddr, tlsConf, &quic.Config{EnableDatagrams: true, Allow0RTT: true})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	*g = testGateway{
+		t:       t,
+		ln:      ln,
+		addr:    ln.Addr().String(),
+		handler: handler,
+		cert:    leaf,
+		opts:    opts,
+		seenIDs: make(map[string]bool),
+	}
+	go g.serve()
+	t.Cleanup(func() { ln.Close() })
+	return g
+}
+
+func (g *testGateway) serve() {
+	for {
+		conn, err := g.ln.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		go func() {
+			// 加密会话属于连接，同一连接上的新流沿用会话密钥
+			sess := &gatewaySession{}
+			go g.serveDatagrams(conn, sess)
+			for {
+				stream, err := conn.AcceptStream(context.Background())
+				if err != nil {
+					return
+				}
+				gs := &gatewayStream{stream: stream, sess: sess}
+				go g.handleStream(gs)
+			}
+		}()
+	}
+}
+
+// gatewaySession 测试网关上一个连接的加密会话
+type gatewaySession struct {
+	mu        sync.Mutex
+	key       []byte
+	suite     utils.CipherSuite
+	sequenced bool
+}
+
+func (s *gatewaySession) state() ([]byte, utils.CipherSuite, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.key, s.suite, s.sequenced
+}
+
+// gatewayStream 测试网关上的一个流，帧序号按流计算
+type gatewayStream struct {
+	stream  quic.Stream
+	sess    *gatewaySession
+	writeMu sync.Mutex
+	sendSeq uint64 // 由writeMu保护
+	recvSeq uint64
+}
+
+// open 解密请求帧数据并校验帧序号
+func (gs *gatewayStream) open(msg *proto.UdpMessage) ([]byte, error) {
+	key, suite, sequenced := gs.sess.state()
+	if key == nil {
+		return msg.Body, nil
+	}
+	option := uint8(suite)
+	if sequenced {
+		option |= proto.OPTION_SEQUENCED
+	}
+	if msg.Head.Option != option {
+		return nil, errors.New("unexpected option")
+	}
+	plain, err := suite.Decrypt(key, msg.Body)
+	if err != nil {
+		return nil, err
+	}
+	if suite == utils.CipherLegacyCBC {
+		// 旧版套件使用零填充，测试请求体不以0结尾，直接去掉填充
+		plain = bytes.TrimRight(plain, "\x00")
+	}
+	if !sequenced {
+		return plain, nil
+	}
+	if len(plain) < 8 || binary.BigEndian.Uint64(plain) != gs.recvSeq {
+		return nil, errors.New("unexpected sequence")
+	}
+	gs.recvSeq++
+	return plain[8:], nil
+}
+
+// writeSealedLocked 写入加密的响应帧，调用方需持有writeMu
+func (gs *gatewayStream) writeSealedLocked(command uint16, body []byte) error {
+	key, suite, sequenced := gs.sess.state()
+	head := &proto.ResponseHeader{Command: command, Result: proto.AUTH_STATUS_CODE_SUCCESS, Option: uint8(suite)}
+	if sequenced {
+		head.Option |= proto.OPTION_SEQUENCED
+		body = append(binary.BigEndian.AppendUint64(nil, gs.sendSeq), body...)
+		gs.sendSeq++
+	}
+	sealed, err := suite.Encrypt(key, body)
+	if err != nil {
+		return err
+	}
+	head.OriginLen = uint32(len(body))
+	return writeFrame(gs.stream, head, sealed)
+}
+
+// writeLocked 按会话状态写入响应帧，调用方需持有writeMu
+func (gs *gatewayStream) writeLocked(command uint16, body []byte) error {
+	if key, _, _ := gs.sess.state(); key != nil {
+		return gs.writeSealedLocked(command, body)
+	}
+	return writeResponseFrame(gs.stream, command, proto.AUTH_STATUS_CODE_SUCCESS, body)
+}
+
+// reject 以错误码关闭链路
+func (gs *gatewayStream) reject(command uint16) {
+	gs.writeMu.Lock()
+	defer gs.writeMu.Unlock()
+	writeResponseFrame(gs.stream, command, proto.AUTH_STATUS_CODE_ERR_UNKNOW, nil)
+}
+
+// now 返回网关时钟
+func (g *testGateway) now() time.Time {
+	return time.Now().Add(g.opts.clockOffset)
+}
+
+// checkFreshness 检查请求ID未被使用过且时间戳在允许的偏差范围内
+func (g *testGateway) checkFreshness(reqID string, timestamp int64) error {
+	skew := g.now().Sub(time.Unix(timestamp, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > g.opts.maxSkew {
+		return errors.New("timestamp out of window")
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.seenIDs[reqID] {
+		return errors.New("replayed request id")
+	}
+	g.seenIDs[reqID] = true
+	return nil
+}
+
+func (g *testGateway) handleStream(gs *gatewayStream) {
+	stream := gs.stream
+	defer stream.Close()
+
+	var backend *io.PipeWriter
+	defer func() {
+		if backend != nil {
+			backend.Close()
+		}
+	}()
+
+	for {
+		msg, err := readTransferFrame(stream)
+		if err != nil {
+			return
+		}
+
+		g.mu.Lock()
+		head := msg.Head
+		g.requests = append(g.requests, &head)
+		g.mu.Unlock()
+
+		switch msg.Head.Command {
+		case proto.EMM_COMMAND_INIT:
+			if g.rejectInit.Load() {
+				gs.reject(proto.EMM_COMMAND_INIT_ACK)
+				continue
+			}
+			if !g.opts.aes {
+				gs.writeMu.Lock()
+				writeResponseFrame(stream, proto.EMM_COMMAND_INIT_ACK, proto.AUTH_STATUS_CODE_SUCCESS, nil)
+				gs.writeMu.Unlock()
+				continue
+			}
+			if !g.handleAESInit(gs, msg) {
+				gs.reject(proto.EMM_COMMAND_INIT_ACK)
+			}
+		case proto.EMM_COMMAND_LINK_HEART_BEAT:
+			gs.writeMu.Lock()
+			writeResponseFrame(stream, proto.EMM_COMMAND_LINK_HEART_BEAT_ACK, proto.AUTH_STATUS_CODE_SUCCESS, nil)
+			gs.writeMu.Unlock()
+		case proto.EMM_COMMAND_KEY_UPDATE:
+			if !g.handleKeyUpdate(gs, msg) {
+				gs.reject(proto.EMM_COMMAND_KEY_UPDATE_ACK)
+				return
+			}
+		case proto.EMM_COMMAND_TRAN:
+			if g.backendDown.Load() {
+				gs.writeMu.Lock()
+				writeResponseFrame(stream, proto.EMM_COMMAND_LINK_CLOSE, proto.AUTH_STATUS_CODE_ERR_CONN_FAILED, nil)
+				gs.writeMu.Unlock()
+				return
+			}
+			if g.resetStream.Load() {
+				stream.CancelRead(0)
+				stream.CancelWrite(0)
+				return
+			}
+			body, err := gs.open(msg)
+			if err != nil {
+				gs.reject(proto.EMM_COMMAND_LINK_CLOSE)
+				return
+			}
+			if backend == nil {
+				pr, pw := io.Pipe()
+				backend = pw
+				go g.serveHTTP(pr, gs)
+			}
+			backend.Write(body)
+		}
+	}
+}
+
+// handleAESInit 处理加密的INIT请求，成功时以会话密钥加密的网关时间戳应答
+func (g *testGateway) handleAESInit(gs *gatewayStream, msg *proto.UdpMessage) bool {
+	suite := utils.CipherSuite(msg.Head.Option & proto.OPTION_CIPHER_MASK)
+	sequenced := msg.Head.Option&proto.OPTION_SEQUENCED != 0
+	key, reqID, timestamp, err := parseAESInit(msg.Body, suite)
+	if err != nil {
+		return false
+	}
+	if err := g.checkFreshness(reqID, timestamp); err != nil {
+		return false
+	}
+	if g.opts.legacyOnly {
+		suite = utils.CipherLegacyCBC
+	}
+	if g.opts.noSequence {
+		sequenced = false
+	}
+
+	gs.sess.mu.Lock()
+	gs.sess.key, gs.sess.suite, gs.sess.sequenced = key, suite, sequenced
+	gs.sess.mu.Unlock()
+
+	gs.writeMu.Lock()
+	defer gs.writeMu.Unlock()
+	if !sequenced {
+		option := uint8(suite)
+		writeFrame(gs.stream, &proto.ResponseHeader{Command: proto.EMM_COMMAND_INIT_ACK, Result: proto.AUTH_STATUS_CODE_SUCCESS, Option: option}, nil)
+		return true
+	}
+	gs.writeSealedLocked(proto.EMM_COMMAND_INIT_ACK, binary.BigEndian.AppendUint64(nil, uint64(g.now().Unix())))
+	return true
+}
+
+// handleKeyUpdate 处理密钥轮换请求：用旧密钥解密，派生新密钥后用新密钥加密应答
+func (g *testGateway) handleKeyUpdate(gs *gatewayStream, msg *proto.UdpMessage) bool {
+	if _, _, sequenced := gs.sess.state(); !sequenced {
+		return false
+	}
+	plain, err := gs.open(msg)
+	if err != nil {
+		return false
+	}
+	fields := bytes.SplitN(plain, []byte{0}, 2)
+	if len(fields) != 2 || len(fields[1]) < 8 {
+		return false
+	}
+	reqID := string(fields[0])
+	timestamp := int64(binary.BigEndian.Uint64(fields[1][:8]))
+	if err := g.checkFreshness(reqID, timestamp); err != nil {
+		return false
+	}
+
+	gs.writeMu.Lock()
+	defer gs.writeMu.Unlock()
+	gs.sess.mu.Lock()
+	gs.sess.key = []byte(utils.NewKey(reqID, timestamp))
+	gs.sess.mu.Unlock()
+	gs.writeSealedLocked(proto.EMM_COMMAND_KEY_UPDATE_ACK, binary.BigEndian.AppendUint64(nil, uint64(g.now().Unix())))
+	return true
+}
+
+// serveHTTP 从透传数据中解析HTTP请求，将响应切分为多个TRAN_ACK帧返回，并以LINK_CLOSE结束
+// 建立了加密会话时响应帧使用会话密钥加密
+func (g *testGateway) serveHTTP(r io.Reader, gs *gatewayStream) {
+	br := bufio.NewReader(r)
+	for {
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		rec := httptest.NewRecorder()
+		g.handler.ServeHTTP(rec, req)
+		io.Copy(io.Discard, req.Body)
+
+		resp := rec.Result()
+		resp.ContentLength = int64(rec.Body.Len())
+		data, err := httputil.DumpResponse(resp, true)
+		if err != nil {
+			return
+		}
+
+		gs.writeMu.Lock()
+		first := true
+		for len(data) > 0 {
+			n := min(len(data), 16*1024)
+			gs.writeLocked(proto.EMM_COMMAND_TRAN_ACK, data[:n])
+			if first && g.opts.replayResponse {
+				// 以相同序号重发上一帧
+				gs.sendSeq--
+				gs.writeLocked(proto.EMM_COMMAND_TRAN_ACK, data[:n])
+			}
+			if first && g.opts.stall > 0 {
+				time.Sleep(g.opts.stall)
+			}
+			first = false
+			data = data[n:]
+		}
+		writeResponseFrame(gs.stream, proto.EMM_COMMAND_LINK_CLOSE, proto.AUTH_STATUS_CODE_SUCCESS, nil)
+		gs.writeMu.Unlock()
+	}
+}
+
+// serveDatagrams 将收到的数据报原样回显，建立了加密会话时按数据报格式解密和加密
+func (g *testGateway) serveDatagrams(conn quic.Connection, sess *gatewaySession) {
+	var sendSeq uint64
+	for {
+		data, err := conn.ReceiveDatagram(context.Background())
+		if err != nil {
+			return
+		}
+		if len(data) < proto.REQUEST_HEAD_LEN {
+			continue
+		}
+		msg := &proto.UdpMessage{}
+		msg.ParseHead(data)
+		msg.Body = data[proto.REQUEST_HEAD_LEN:]
+		g.mu.Lock()
+		head := msg.Head
+		g.requests = append(g.requests, &head)
+		g.mu.Unlock()
+
+		if g.backendDown.Load() {
+			frame, _ := (&proto.UdpResponseMessage{Head: proto.ResponseHeader{
+				Tag: proto.HEAD_TAG, Version: proto.PROTO_VERSION, Command: proto.EMM_COMMAND_LINK_CLOSE,
+				Result: proto.AUTH_STATUS_CODE_ERR_CONN_FAILED,
+			}}).Marshal()
+			conn.SendDatagram(frame)
+			continue
+		}
+
+		key, suite, sequenced := sess.state()
+		resp := proto.ResponseHeader{
+			Tag: proto.HEAD_TAG, Version: proto.PROTO_VERSION, Command: proto.EMM_COMMAND_TRAN_ACK,
+			Result: proto.AUTH_STATUS_CODE_SUCCESS,
+		}
+		body := msg.Body
+		if key != nil {
+			plain, err := suite.Decrypt(key, body)
+			if err != nil {
+				continue
+			}
+			if suite == utils.CipherLegacyCBC {
+				plain = bytes.TrimRight(plain, "\x00")
+			}
+			resp.Option = uint8(suite)
+			if sequenced {
+				if len(plain) < 8 {
+					continue
+				}
+				resp.Option |= proto.OPTION_SEQUENCED
+				plain = append(binary.BigEndian.AppendUint64(nil, sendSeq), plain[8:]...)
+				sendSeq++
+			}
+			resp.OriginLen = uint32(len(plain))
+			if body, err = suite.Encrypt(key, plain); err != nil {
+				continue
+			}
+		}
+		resp.DataLen = uint32(len(body))
+		frame, _ := (&proto.UdpResponseMessage{Head: resp, Body: body}).Marshal()
+		conn.SendDatagram(frame)
+		if g.opts.duplicateDatagrams {
+			conn.SendDatagram(frame)
+		}
+	}
+}
+
+func (g *testGateway) receivedHeaders() []*proto.TransferHeader {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]*proto.TransferHeader(nil), g.requests...)
+}
+
+// newTestClient 创建连接到测试网关的客户端
+func (g *testGateway) newTestClient(t *testing.T, config *Config) *TransferClient {
+	t.Helper()
+
+	if config == nil {
+		config = &Config{}
+	}
+	if config.ServerID == 0 {
+		config.ServerID = 1
+	}
+	if config.ServerName == "" {
+		config.ServerName = "test-server"
+	}
+	if config.SessionID == "" {
+		config.SessionID = "test-session"
+	}
+	config.MaxRetries = 1
+	if config.RootCAs == nil && config.RootCAFile == "" && !config.InsecureSkipVerify {
+		config.RootCAs = x509.NewCertPool()
+		config.RootCAs.AddCert(g.cert)
+	}
+
+	c := NewTransferClient(g.addr, config)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func readTransferFrame(r io.Reader) (*proto.UdpMessage, error) {
+	headBuf := make([]byte, proto.REQUEST_HEAD_LEN)
+	if _, err := io.ReadFull(r, headBuf); err != nil {
+		return nil, err
+	}
+	msg := &proto.UdpMessage{}
+	msg.ParseHead(headBuf)
+	if msg.Head.Tag != proto.HEAD_TAG {
+		return nil, errors.New("invalid tag")
+	}
+	msg.Body = make([]byte, msg.Head.DataLen)
+	if _, err := io.ReadFull(r, msg.Body); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func writeResponseFrame(w io.Writer, command uint16, result uint16, body []byte) error {
+	return writeFrame(w, &proto.ResponseHeader{Command: command, Result: result, OriginLen: uint32(len(body))}, body)
+}
+
+// writeFrame 按head写入响应帧，自动填充Tag、Version和DataLen
+func writeFrame(w io.Writer, head *proto.ResponseHeader, body []byte) error {
+	head.Tag = proto.HEAD_TAG
+	head.Version = proto.PROTO_VERSION
+	head.DataLen = uint32(len(body))
+	msg := &proto.UdpResponseMessage{Head: *head, Body: body}
+	data, _ := msg.Marshal()
+	_, err := w.Write(data)
+	return err
+}
+
+// parseAESInit 解密INIT请求体，返回按请求ID和时间戳派生的会话密钥
+// 请求体格式: ServerID(4) ServerName\0 SessionID\0 请求ID\0 时间戳(8)
+func parseAESInit(body []byte, suite utils.CipherSuite) ([]byte, string, int64, error) {
+	plain, err := suite.Decrypt([]byte(utils.InitKey), body)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if len(plain) < 4 {
+		return nil, "", 0, errors.New("init body too short")
+	}
+	fields := bytes.SplitN(plain[4:], []byte{0}, 4)
+	if len(fields) != 4 || len(fields[3]) < 8 {
+		return nil, "", 0, errors.New("invalid init body")
+	}
+	reqID := string(fields[2])
+	timestamp := int64(binary.BigEndian.Uint64(fields[3][:8]))
+	return []byte(utils.NewKey(reqID, timestamp)), reqID, timestamp, nil
+}
+
+func newTestCertificate(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test-gateway"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+		DNSNames:     []string{"localhost", "test-gateway"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, leaf
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/proto"
+)
+
+// Heartbeat 在当前连接上发送EMM_COMMAND_LINK_HEART_BEAT，返回从发送到收到应答的往返时间
+// 心跳不经过后端，往返时间只反映客户端到网关的链路
+func (c *TransferClient) Heartbeat(ctx context.Context) (time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.heartbeatLocked(ctx)
+}
+
+// heartbeatLocked 发送链路心跳并等待应答，调用方需持有c.mu
+func (c *TransferClient) heartbeatLocked(ctx context.Context) (time.Duration, error) {
+	if c.conn == nil {
+		return 0, errNotConnected
+	}
+	if err := c.ensureStreamLocked(ctx); err != nil {
+		return 0, err
+	}
+	frame, err := newTransferFrame(proto.EMM_COMMAND_LINK_HEART_BEAT, uint8(proto.PROTO_TYPE_HTTP), 0, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	if deadline, ok := ctx.Deadline(); ok {
+		c.stream.SetDeadline(deadline)
+	} else {
+		c.stream.SetDeadline(start.Add(10 * time.Second))
+	}
+	defer func() {
+		if c.stream != nil {
+			c.stream.SetDeadline(time.Time{})
+		}
+	}()
+
+	if _, err := c.stream.Write(frame); err != nil {
+		c.resetStreamLocked()
+		return 0, fmt.Errorf("发送心跳失败: %v", err)
+	}
+	msg, err := readResponseFrame(c.stream)
+	if err != nil {
+		c.resetStreamLocked()
+		return 0, fmt.Errorf("读取心跳应答失败: %v", err)
+	}
+	rtt := time.Since(start)
+	if msg.Head.Command != proto.EMM_COMMAND_LINK_HEART_BEAT_ACK {
+		c.resetStreamLocked()
+		return 0, fmt.Errorf("收到非预期的响应命令: %d", msg.Head.Command)
+	}
+	c.metrics.GatewayResult(msg.Head.Command, msg.Head.Result)
+	if msg.Head.Result != proto.AUTH_STATUS_CODE_SUCCESS {
+		return 0, fmt.Errorf("心跳失败，错误码: %d", msg.Head.Result)
+	}
+	return rtt, nil
+}
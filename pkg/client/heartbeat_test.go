@@ -0,0 +1,38 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/laotiannai/quic_gwclient/proto"
+)
+
+func TestTransferClient_Heartbeat(t *testing.T) {
+	c := NewTransferClient("127.0.0.1:1", &Config{})
+	if _, err := c.Heartbeat(context.Background()); err != errNotConnected {
+		t.Errorf("Expected errNotConnected, got %v", err)
+	}
+
+	g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: true})
+	c = g.newTestClient(t, &Config{EnableAES: true})
+	if _, _, err := c.SendInit(); err != nil {
+		t.Fatalf("SendInit failed: %v", err)
+	}
+	rtt, err := c.Heartbeat(context.Background())
+	if err != nil {
+		t.Fatalf("Heartbeat failed: %v", err)
+	}
+	if rtt <= 0 {
+		t.Errorf("Expected positive RTT, got %v", rtt)
+	}
+	headers := g.receivedHeaders()
+	if last := headers[len(headers)-1]; last.Command != proto.EMM_COMMAND_LINK_HEART_BEAT {
+		t.Errorf("Expected LINK_HEART_BEAT, got command %d", last.Command)
+	}
+
+	// 心跳不影响之后的加密请求
+	resp, _, _, err := c.SendTransferBytes(context.Background(), []byte("POST /echo HTTP/1.1\r\nHost: backend\r\nContent-Length: 2\r\n\r\nhb"))
+	if err != nil || len(resp) == 0 {
+		t.Errorf("Request after heartbeat failed: %v", err)
+	}
+}
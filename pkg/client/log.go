@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+)
+
+// LevelTrace 比slog.LevelDebug更详细的日志级别，记录每个帧的内容
+// 只有日志处理器显式启用该级别时，日志中才会出现会话密钥和请求、响应数据，其他级别一律脱敏
+const LevelTrace = slog.LevelDebug - 4
+
+// maxTraceBytes 跟踪日志中每个数据字段最多输出的字节数
+const maxTraceBytes = 256
+
+// defaultLogger Config.Logger为nil时使用的日志，默认不输出
+var defaultLogger atomic.Pointer[slog.Logger]
+
+func init() {
+	defaultLogger.Store(slog.New(discardHandler{}))
+}
+
+// SetLogger 设置Config.Logger为nil时使用的默认日志，只影响之后创建的客户端，nil表示不输出日志
+func SetLogger(logger *slog.Logger) {
+	if logger == nil {
+		logger = slog.New(discardHandler{})
+	}
+	defaultLogger.Store(logger)
+}
+
+// DebugMode 是否启用调试模式
+//
+// Deprecated: 使用Config.Logger或SetLogger
+var DebugMode bool = false
+
+// SetDebugMode 设置调试模式，开启时默认日志以Debug级别输出到标准错误，兼容旧版
+//
+// Deprecated: 使用Config.Logger或SetLogger
+func SetDebugMode(enable bool) {
+	DebugMode = enable
+	if !enable {
+		SetLogger(nil)
+		return
+	}
+	SetLogger(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})))
+}
+
+// newLogger 创建客户端使用的日志，附加会话ID和网关地址，并保证非跟踪级别的日志脱敏
+func newLogger(config *Config, serverAddr string) *slog.Logger {
+	logger := config.Logger
+	if logger == nil {
+		logger = defaultLogger.Load()
+	}
+	return slog.New(redactHandler{logger.Handler()}).With("session_id", config.SessionID, "server", serverAddr)
+}
+
+// sensitive 会话密钥、请求和响应数据等敏感内容，只在LevelTrace及以下的日志中输出，
+// 输出时为十六进制编码，超过maxTraceBytes的部分被截断
+type sensitive []byte
+
+// LogValue 实现slog.LogValuer
+func (s sensitive) LogValue() slog.Value {
+	if len(s) > maxTraceBytes {
+		return slog.StringValue(fmt.Sprintf("%s...(%d bytes)", hex.EncodeToString(s[:maxTraceBytes]), len(s)))
+	}
+	return slog.StringValue(hex.EncodeToString(s))
+}
+
+// redactHandler 将LevelTrace以上级别日志中的sensitive字段替换为长度信息
+type redactHandler struct {
+	slog.Handler
+}
+
+// Handle 实现slog.Handler
+func (h redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level <= LevelTrace {
+		return h.Handler.Handle(ctx, r)
+	}
+	redacted := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, redacted)
+}
+
+// WithAttrs 实现slog.Handler，预先附加的字段对所有级别生效，因此总是脱敏
+func (h redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+	return redactHandler{h.Handler.WithAttrs(redacted)}
+}
+
+// WithGroup 实现slog.Handler
+func (h redactHandler) WithGroup(name string) slog.Handler {
+	return redactHandler{h.Handler.WithGroup(name)}
+}
+
+// redactAttr 替换字段中的敏感内容
+func redactAttr(a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindLogValuer:
+		if s, ok := a.Value.Any().(sensitive); ok {
+			return slog.String(a.Key, fmt.Sprintf("[REDACTED %d bytes]", len(s)))
+		}
+	case slog.KindGroup:
+		group := a.Value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			redacted[i] = redactAttr(ga)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+	}
+	return a
+}
+
+// discardHandler 不输出任何日志
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (d discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return d }
+func (d discardHandler) WithGroup(string) slog.Handler           { return d }
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/utils"
+)
+
+func TestRedactHandler(t *testing.T) {
+	secret := []byte("secret-key")
+	for _, tc := range []struct {
+		name     string
+		level    slog.Level
+		redacted bool
+	}{
+		{"debug", slog.LevelDebug, true},
+		{"trace", LevelTrace, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(redactHandler{slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: LevelTrace})})
+			logger.Log(context.Background(), tc.level, "frame", "payload", sensitive(secret),
+				slog.Group("group", "key", sensitive(secret)))
+
+			out := buf.String()
+			if got := strings.Contains(out, hex.EncodeToString(secret)); got == tc.redacted {
+				t.Errorf("Unexpected payload in output: %s", out)
+			}
+			if got := strings.Contains(out, "[REDACTED 10 bytes]"); got != tc.redacted {
+				t.Errorf("Unexpected redaction in output: %s", out)
+			}
+		})
+	}
+
+	// 预先附加的字段对所有级别生效，即使是跟踪级别也脱敏
+	var buf bytes.Buffer
+	logger := slog.New(redactHandler{slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: LevelTrace})})
+	logger.With("key", sensitive(secret)).Log(context.Background(), LevelTrace, "frame")
+	if strings.Contains(buf.String(), hex.EncodeToString(secret)) {
+		t.Errorf("Expected With attrs to be redacted: %s", buf.String())
+	}
+
+	long := sensitive(bytes.Repeat([]byte{0xab}, maxTraceBytes+1))
+	if v := long.LogValue().String(); !strings.HasSuffix(v, "...(257 bytes)") {
+		t.Errorf("Expected truncated value, got %s", v)
+	}
+}
+
+func TestDefaultLogger(t *testing.T) {
+	c := NewTransferClient("127.0.0.1:1", &Config{})
+	if c.log.Enabled(context.Background(), LevelTrace) || c.log.Enabled(context.Background(), slog.LevelError) {
+		t.Error("Expected no log output by default")
+	}
+
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer SetLogger(nil)
+	c = NewTransferClient("127.0.0.1:1", &Config{SessionID: "s1"})
+	c.log.Info("hello")
+	if !strings.Contains(buf.String(), "session_id=s1") {
+		t.Errorf("Expected default logger to be used: %s", buf.String())
+	}
+}
+
+func TestTransferClient_Logging(t *testing.T) {
+	for _, level := range []slog.Level{slog.LevelDebug, LevelTrace} {
+		t.Run(level.String(), func(t *testing.T) {
+			testLogging(t, level)
+		})
+	}
+}
+
+func testLogging(t *testing.T, level slog.Level) {
+	var buf bytes.Buffer
+	g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: true})
+	c := g.newTestClient(t, &Config{
+		EnableAES:              true,
+		CipherSuite:            utils.CipherGCM,
+		EnableReplayProtection: true,
+		Logger:                 slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: level})),
+	})
+	if _, _, err := c.SendInit(); err != nil {
+		t.Fatalf("SendInit failed: %v", err)
+	}
+
+	body := "top-secret-payload"
+	req, _ := NewHTTPRequest("POST", "http://backend/echo", strings.NewReader(body))
+	payload, _ := req.Bytes()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, _, _, err := c.SendTransferBytes(ctx, payload); err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	key := hex.EncodeToString(c.session.key)
+	c.Close()
+
+	out := buf.String()
+	for _, want := range []string{`"session_id":"test-session"`, `"msg":"已连接网关"`, `"msg":"初始化完成"`, `"stream_id":`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %s in log output:\n%s", want, out)
+		}
+	}
+
+	hasSecrets := strings.Contains(out, key) || strings.Contains(out, "top-secret-payload")
+	if level == LevelTrace && !hasSecrets {
+		t.Errorf("Expected key or payload in trace output:\n%s", out)
+	}
+	if level > LevelTrace && hasSecrets {
+		t.Errorf("Expected key and payload to be redacted:\n%s", out)
+	}
+}
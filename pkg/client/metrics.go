@@ -0,0 +1,42 @@
+package client
+
+import (
+	"time"
+)
+
+// 重试的操作类型，作为Metrics.Retry的参数
+const (
+	RetryConnect  = "connect"  // SendQuicRequest连接失败后重试
+	RetryTransfer = "transfer" // 不加密的传输请求失败后重试
+	RetryDownload = "download" // 下载读取失败后重试
+	Retry0RTT     = "0rtt"     // 网关拒绝0-RTT后在完整握手后重发INIT
+	RetryFailover = "failover" // FailoverClient切换到其他节点重发请求
+)
+
+// Metrics 客户端指标钩子，通过Config.Metrics注入，pkg/prommetrics提供Prometheus实现
+// 方法在客户端持有锁时同步调用，实现需要并发安全且不能阻塞
+// 实现可以嵌入NopMetrics，只覆盖关心的方法，以兼容之后新增的方法
+type Metrics interface {
+	// ConnectDone 一组ALPN协议的握手结束，alpn成功时为协商得到的协议，失败时为尝试的协议列表，以逗号分隔
+	ConnectDone(alpn string, elapsed time.Duration, err error)
+	// GatewayResult 收到网关的INIT、密钥轮换应答，或带错误码的EMM_COMMAND_LINK_CLOSE
+	GatewayResult(command uint16, result uint16)
+	// TransferDone 一次传输请求结束，err为nil表示成功
+	TransferDone(elapsed time.Duration, sent, received int64, err error)
+	// Retry 操作失败后重试，op为Retry开头的常量之一
+	Retry(op string)
+	// StreamActive 正在进行的流式传输数量变化，delta为1或-1
+	StreamActive(delta int)
+	// PoolUsage FailoverClient节点池的状态变化，healthy为可用节点数，total为节点总数
+	PoolUsage(healthy, total int)
+}
+
+// NopMetrics 不记录任何指标，Config.Metrics为nil时使用
+type NopMetrics struct{}
+
+func (NopMetrics) ConnectDone(string, time.Duration, error)        {}
+func (NopMetrics) GatewayResult(uint16, uint16)                    {}
+func (NopMetrics) TransferDone(time.Duration, int64, int64, error) {}
+func (NopMetrics) Retry(string)                                    {}
+func (NopMetrics) StreamActive(int)                                {}
+func (NopMetrics) PoolUsage(int, int)                              {}
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/proto"
+)
+
+// recordingMetrics 记录收到的指标，供测试检查
+type recordingMetrics struct {
+	NopMetrics
+
+	mu        sync.Mutex
+	connects  []string
+	results   [][2]uint16
+	transfers []error
+	sent      int64
+	received  int64
+	retries   []string
+	active    int
+	pool      [2]int
+}
+
+func (m *recordingMetrics) ConnectDone(alpn string, _ time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		m.connects = append(m.connects, alpn)
+	}
+}
+
+func (m *recordingMetrics) GatewayResult(command uint16, result uint16) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.results = append(m.results, [2]uint16{command, result})
+}
+
+func (m *recordingMetrics) TransferDone(_ time.Duration, sent, received int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transfers = append(m.transfers, err)
+	m.sent += sent
+	m.received += received
+}
+
+func (m *recordingMetrics) Retry(op string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retries = append(m.retries, op)
+}
+
+func (m *recordingMetrics) StreamActive(delta int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.active += delta
+}
+
+func (m *recordingMetrics) PoolUsage(healthy, total int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pool = [2]int{healthy, total}
+}
+
+func TestMetrics_Transfer(t *testing.T) {
+	m := &recordingMetrics{}
+	g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: true})
+	c := g.newTestClient(t, &Config{EnableAES: true, Metrics: m})
+	if _, _, err := c.SendInit(); err != nil {
+		t.Fatalf("SendInit failed: %v", err)
+	}
+
+	payload := []byte("POST /echo HTTP/1.1\r\nHost: backend\r\nContent-Length: 7\r\n\r\nmetrics")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, _, _, err := c.SendTransferBytes(ctx, payload); err != nil {
+		t.Fatalf("SendTransferBytes failed: %v", err)
+	}
+	g.backendDown.Store(true)
+	if _, _, _, err := c.SendTransferBytes(ctx, payload); err == nil {
+		t.Fatal("Expected error when backend is down")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.connects) != 1 || m.connects[0] == "" {
+		t.Errorf("Expected one successful connect with ALPN, got %q", m.connects)
+	}
+	for _, want := range [][2]uint16{
+		{proto.EMM_COMMAND_INIT_ACK, proto.AUTH_STATUS_CODE_SUCCESS},
+		{proto.EMM_COMMAND_LINK_CLOSE, proto.AUTH_STATUS_CODE_ERR_CONN_FAILED},
+	} {
+		if !slices.Contains(m.results, want) {
+			t.Errorf("Expected gateway result %v, got %v", want, m.results)
+		}
+	}
+	if len(m.transfers) != 2 || m.transfers[0] != nil || m.transfers[1] == nil {
+		t.Errorf("Expected one successful and one failed transfer, got %v", m.transfers)
+	}
+	if m.sent == 0 || m.received == 0 {
+		t.Errorf("Expected byte counts, got sent=%d received=%d", m.sent, m.received)
+	}
+	if m.active != 0 {
+		t.Errorf("Expected no active streams, got %d", m.active)
+	}
+}
+
+func TestMetrics_Failover(t *testing.T) {
+	m := &recordingMetrics{}
+	g1 := newTestGateway(t, echoHandler)
+	g2 := newTestGateway(t, echoHandler)
+	config, endpoints := failoverTestConfig(g1, g2)
+	config.Metrics = m
+	f, err := NewFailoverClient(endpoints, config, &FailoverOptions{ProbeInterval: -1, MaxFailures: 1})
+	if err != nil {
+		t.Fatalf("NewFailoverClient failed: %v", err)
+	}
+	defer f.Close()
+
+	if err := f.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	g1.backendDown.Store(true)
+	payload := []byte("POST /echo HTTP/1.1\r\nHost: backend\r\nContent-Length: 8\r\n\r\nfailover")
+	if _, _, _, err := f.SendTransferBytes(context.Background(), payload); err != nil {
+		t.Fatalf("SendTransferBytes failed: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !slices.Contains(m.retries, RetryFailover) {
+		t.Errorf("Expected failover retry, got %v", m.retries)
+	}
+	if m.pool != [2]int{1, 2} {
+		t.Errorf("Expected 1/2 healthy endpoints, got %v", m.pool)
+	}
+}
@@ -0,0 +1,329 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Profile 一组网关和应用的连接配置，通过Config和RequestOptions转换为客户端使用的配置
+// 未设置的字段保持零值，转换时使用NewTransferClient和DefaultRequestOptions的默认值
+type Profile struct {
+	// 网关和会话
+	Gateway    string `yaml:"gateway"` // 网关地址host:port
+	ServerID   int    `yaml:"server_id"`
+	ServerName string `yaml:"server_name"`
+	SessionID  string `yaml:"session_id"`
+	// 超时和重试
+	ConnectTimeout     time.Duration `yaml:"connect_timeout"` // 连接网关的超时，包括全部重试
+	ReadTimeout        time.Duration `yaml:"read_timeout"`    // 单个请求的超时
+	MaxRetries         int           `yaml:"max_retries"`
+	RetryInterval      time.Duration `yaml:"retry_interval"`
+	EnableConnectRetry bool          `yaml:"alpn_retry"` // 握手失败时依次尝试其他ALPN协议组合
+	Enable0RTT         bool          `yaml:"enable_0rtt"`
+	// 本地网络
+	LocalAddr      string `yaml:"local_addr"`
+	LocalInterface string `yaml:"local_interface"`
+	// 请求内容
+	LegacyEscapedCRLF bool   `yaml:"legacy_escaped_crlf"`
+	ResponseAssertion string `yaml:"response_assertion"`
+	// 加密会话
+	EnableAES              bool   `yaml:"aes"`
+	CipherSuite            string `yaml:"cipher"` // 加密套件名称，见utils.ParseCipherSuite
+	EnableReplayProtection bool   `yaml:"replay_protection"`
+	// TLS
+	RootCAFile         string   `yaml:"ca_file"`
+	ClientCertFile     string   `yaml:"cert_file"`
+	ClientKeyFile      string   `yaml:"key_file"`
+	TLSServerName      string   `yaml:"tls_server_name"`
+	SPKIPins           []string `yaml:"spki_pins"`
+	InsecureSkipVerify bool     `yaml:"insecure_skip_verify"`
+	// 应用信息，对应RequestOptions和IPSServerInfo中的同名字段
+	AppName    string `yaml:"app_name"`
+	Username   string `yaml:"username"`
+	ClientAddr string `yaml:"client_addr"`
+	DeviceID   string `yaml:"device_id"`
+	DeviceType string `yaml:"device_type"`
+	AppVersion string `yaml:"app_version"`
+	TokenID    string `yaml:"token_id"`
+	JSessionID string `yaml:"jsession_id"`
+	Connectors string `yaml:"connectors"`
+}
+
+// ProfileFile 配置文件，格式为：
+//
+//	default: prod-app1
+//	profiles:
+//	  prod-app1:
+//	    gateway: gw.example.com:8002
+//	    server_id: 12
+//	    server_name: app1
+//	    token_id: ${APP1_TOKEN}
+//	    connect_timeout: 10s
+//
+// 字段值中的${NAME}替换为环境变量NAME的值，${NAME:-默认值}在环境变量未设置或为空时使用默认值，
+// $$表示字面量$；引用的环境变量未设置且没有默认值时加载失败。多个配置的公共部分可以用YAML的锚点和合并键（<<: *base）复用
+type ProfileFile struct {
+	Default  string              `yaml:"default"` // 未指定配置名称时使用的配置
+	Profiles map[string]*Profile `yaml:"profiles"`
+}
+
+// LoadProfiles 读取配置文件
+func LoadProfiles(path string) (*ProfileFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %v", err)
+	}
+	return ParseProfiles(data)
+}
+
+// ParseProfiles 解析YAML格式的配置内容，替换环境变量并检查每个配置
+func ParseProfiles(data []byte) (*ProfileFile, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+	if err := expandNode(&root); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+	// 直接从节点解码，错误中的行号与原文件一致；Node.Decode不检查未知字段，另外以严格模式解码一次
+	file := &ProfileFile{}
+	if err := root.Decode(file); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+	expanded, err := yaml.Marshal(&root)
+	if err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(expanded))
+	dec.KnownFields(true)
+	if err := dec.Decode(&ProfileFile{}); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败，字段名称错误: %v", err)
+	}
+	if len(file.Profiles) == 0 {
+		return nil, fmt.Errorf("配置文件中没有配置")
+	}
+	for name, p := range file.Profiles {
+		if p == nil {
+			return nil, fmt.Errorf("配置%q为空", name)
+		}
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("配置%q: %v", name, err)
+		}
+	}
+	if file.Default != "" && file.Profiles[file.Default] == nil {
+		return nil, fmt.Errorf("默认配置%q不存在", file.Default)
+	}
+	return file, nil
+}
+
+// Names 返回全部配置名称，按字母顺序排列
+func (f *ProfileFile) Names() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Profile 返回名为name的配置，name为空时返回默认配置，没有默认配置时文件中必须只有一个配置
+func (f *ProfileFile) Profile(name string) (*Profile, error) {
+	if name == "" {
+		name = f.Default
+	}
+	if name == "" {
+		if len(f.Profiles) != 1 {
+			return nil, fmt.Errorf("配置文件中有多个配置且没有指定默认配置，可选: %s", strings.Join(f.Names(), ", "))
+		}
+		name = f.Names()[0]
+	}
+	p := f.Profiles[name]
+	if p == nil {
+		return nil, fmt.Errorf("配置%q不存在，可选: %s", name, strings.Join(f.Names(), ", "))
+	}
+	return p, nil
+}
+
+// validate 检查字段的格式
+func (p *Profile) validate() error {
+	if p.Gateway != "" {
+		if _, _, err := net.SplitHostPort(p.Gateway); err != nil {
+			return fmt.Errorf("网关地址格式错误: %v", err)
+		}
+	}
+	if _, err := p.cipherSuite(); err != nil {
+		return err
+	}
+	if p.ServerID < 0 || p.MaxRetries < 0 {
+		return fmt.Errorf("server_id和max_retries不能为负数")
+	}
+	return nil
+}
+
+// cipherSuite 解析加密套件名称，为空时返回utils.CipherLegacyCBC
+func (p *Profile) cipherSuite() (utils.CipherSuite, error) {
+	if p.CipherSuite == "" {
+		return utils.CipherLegacyCBC, nil
+	}
+	return utils.ParseCipherSuite(p.CipherSuite)
+}
+
+// Config 返回对应的客户端配置，网关地址用于NewTransferClient，不在Config中
+func (p *Profile) Config() (*Config, error) {
+	suite, err := p.cipherSuite()
+	if err != nil {
+		return nil, err
+	}
+	return &Config{
+		ServerID:               p.ServerID,
+		ServerName:             p.ServerName,
+		SessionID:              p.SessionID,
+		MaxRetries:             p.MaxRetries,
+		RetryInterval:          p.RetryInterval,
+		EnableConnectRetry:     p.EnableConnectRetry,
+		Enable0RTT:             p.Enable0RTT,
+		LocalAddr:              p.LocalAddr,
+		LocalInterface:         p.LocalInterface,
+		LegacyEscapedCRLF:      p.LegacyEscapedCRLF,
+		EnableAES:              p.EnableAES,
+		CipherSuite:            suite,
+		EnableReplayProtection: p.EnableReplayProtection,
+		RootCAFile:             p.RootCAFile,
+		SPKIPins:               slices.Clone(p.SPKIPins),
+		ClientCertFile:         p.ClientCertFile,
+		ClientKeyFile:          p.ClientKeyFile,
+		TLSServerName:          p.TLSServerName,
+		InsecureSkipVerify:     p.InsecureSkipVerify,
+	}, nil
+}
+
+// RequestOptions 返回对应的请求选项，未设置的字段使用DefaultRequestOptions的值，请求内容需要另外设置
+func (p *Profile) RequestOptions() (*RequestOptions, error) {
+	suite, err := p.cipherSuite()
+	if err != nil {
+		return nil, err
+	}
+	opts := DefaultRequestOptions()
+	if p.Gateway != "" {
+		host, port, err := net.SplitHostPort(p.Gateway)
+		if err != nil {
+			return nil, fmt.Errorf("网关地址格式错误: %v", err)
+		}
+		opts.ServerIP, opts.ServerPort = host, port
+	}
+	if p.ConnectTimeout > 0 {
+		opts.ConnectTimeout = p.ConnectTimeout
+	}
+	if p.ReadTimeout > 0 {
+		opts.ReadTimeout = p.ReadTimeout
+	}
+	if p.MaxRetries > 0 {
+		opts.MaxRetries = p.MaxRetries
+	}
+	opts.EnableConnectRetry = p.EnableConnectRetry
+	opts.ServerID = p.ServerID
+	opts.ServerName = p.ServerName
+	opts.SessionID = p.SessionID
+	opts.LegacyEscapedCRLF = p.LegacyEscapedCRLF
+	opts.EnableAES = p.EnableAES
+	opts.CipherSuite = suite
+	opts.RootCAFile = p.RootCAFile
+	opts.SPKIPins = slices.Clone(p.SPKIPins)
+	opts.ClientCertFile = p.ClientCertFile
+	opts.ClientKeyFile = p.ClientKeyFile
+	opts.TLSServerName = p.TLSServerName
+	opts.InsecureSkipVerify = p.InsecureSkipVerify
+	opts.Enable0RTT = p.Enable0RTT
+	opts.LocalAddr = p.LocalAddr
+	opts.LocalInterface = p.LocalInterface
+	opts.ResponseAssertion = p.ResponseAssertion
+	opts.AppName = p.AppName
+	opts.Username = p.Username
+	opts.ClientAddr = p.ClientAddr
+	opts.DeviceID = p.DeviceID
+	opts.DeviceType = p.DeviceType
+	opts.AppVersion = p.AppVersion
+	opts.TokenID = p.TokenID
+	opts.JSessionID = p.JSessionID
+	opts.Connectors = p.Connectors
+	return opts, nil
+}
+
+// expandNode 替换节点中字段值里的环境变量，映射的键不替换
+func expandNode(n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range n.Content {
+			if err := expandNode(child); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			if err := expandNode(n.Content[i]); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(n.Value, "$") {
+			return nil
+		}
+		value, err := expandEnv(n.Value)
+		if err != nil {
+			return fmt.Errorf("第%d行: %v", n.Line, err)
+		}
+		n.Value = value
+		// 未加引号的值按替换后的内容重新识别类型，如server_id: ${SERVER_ID}
+		if n.Style&(yaml.TaggedStyle|yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			n.Tag = ""
+		}
+	}
+	return nil
+}
+
+// expandEnv 替换s中的${NAME}和${NAME:-默认值}，$$替换为$，其他的$保持不变
+func expandEnv(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("环境变量引用缺少}: %s", s[i:])
+			}
+			expr := s[i+2 : i+2+end]
+			name, def, hasDefault := strings.Cut(expr, ":-")
+			if name == "" {
+				return "", fmt.Errorf("环境变量名称为空: ${%s}", expr)
+			}
+			value, ok := os.LookupEnv(name)
+			switch {
+			case hasDefault && value == "":
+				value = def
+			case !ok:
+				return "", fmt.Errorf("环境变量%s未设置", name)
+			}
+			b.WriteString(value)
+			i += 2 + end
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,162 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/utils"
+)
+
+const testProfiles = `
+default: prod
+profiles:
+  prod: &prod
+    gateway: gw.example.com:8002
+    server_id: ${TEST_SERVER_ID}
+    server_name: app1
+    token_id: "${TEST_TOKEN}"
+    session_id: ${TEST_SESSION:-fixed-session}
+    connect_timeout: 5s
+    max_retries: 2
+    ca_file: /etc/gw/ca.pem
+    aes: true
+    cipher: gcm
+    spki_pins: [pin1, pin2]
+    app_name: 应用1
+  staging:
+    <<: *prod
+    gateway: "[::1]:8002"
+    server_id: 3
+    server_name: app2
+    aes: false
+    read_timeout: 1m
+    response_assertion: "$$ok"
+`
+
+func TestParseProfiles(t *testing.T) {
+	t.Setenv("TEST_SERVER_ID", "12")
+	t.Setenv("TEST_TOKEN", "007")
+
+	file, err := ParseProfiles([]byte(testProfiles))
+	if err != nil {
+		t.Fatalf("ParseProfiles failed: %v", err)
+	}
+	if names := file.Names(); !slices.Equal(names, []string{"prod", "staging"}) {
+		t.Errorf("Names = %v", names)
+	}
+
+	p, err := file.Profile("")
+	if err != nil {
+		t.Fatalf("Profile failed: %v", err)
+	}
+	if p.ServerID != 12 || p.TokenID != "007" || p.SessionID != "fixed-session" || p.ConnectTimeout != 5*time.Second || p.MaxRetries != 2 {
+		t.Errorf("Unexpected default profile %+v", p)
+	}
+
+	config, err := p.Config()
+	if err != nil {
+		t.Fatalf("Config failed: %v", err)
+	}
+	if config.ServerID != 12 || config.ServerName != "app1" || !config.EnableAES || config.CipherSuite != utils.CipherGCM ||
+		config.RootCAFile != "/etc/gw/ca.pem" || !slices.Equal(config.SPKIPins, []string{"pin1", "pin2"}) {
+		t.Errorf("Unexpected config %+v", config)
+	}
+
+	staging, err := file.Profile("staging")
+	if err != nil {
+		t.Fatalf("Profile failed: %v", err)
+	}
+	opts, err := staging.RequestOptions()
+	if err != nil {
+		t.Fatalf("RequestOptions failed: %v", err)
+	}
+	// 合并键引入的字段被staging中的同名字段覆盖
+	if opts.ServerIP != "::1" || opts.ServerPort != "8002" || opts.ServerID != 3 || opts.ReadTimeout != time.Minute ||
+		opts.ConnectTimeout != 5*time.Second || opts.TokenID != "007" || opts.EnableAES || opts.ResponseAssertion != "$ok" {
+		t.Errorf("Unexpected request options %+v", opts)
+	}
+
+	if _, err := file.Profile("missing"); err == nil || !strings.Contains(err.Error(), "staging") {
+		t.Errorf("Expected error listing profiles, got %v", err)
+	}
+}
+
+func TestParseProfiles_RequestOptionsFromIPSFields(t *testing.T) {
+	file, err := ParseProfiles([]byte(`
+profiles:
+  only:
+    gateway: 10.0.0.1:8002
+    server_id: 1
+    server_name: app
+    username: alice
+    device_id: dev-1
+    jsession_id: js
+`))
+	if err != nil {
+		t.Fatalf("ParseProfiles failed: %v", err)
+	}
+	// 只有一个配置时不需要默认配置
+	p, err := file.Profile("")
+	if err != nil {
+		t.Fatalf("Profile failed: %v", err)
+	}
+	opts, err := p.RequestOptions()
+	if err != nil {
+		t.Fatalf("RequestOptions failed: %v", err)
+	}
+	defaults := DefaultRequestOptions()
+	if opts.Username != "alice" || opts.DeviceID != "dev-1" || opts.JSessionID != "js" ||
+		opts.MaxRetries != defaults.MaxRetries || opts.ConnectTimeout != defaults.ConnectTimeout {
+		t.Errorf("Unexpected request options %+v", opts)
+	}
+}
+
+func TestParseProfiles_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"empty", "profiles: {}", "没有配置"},
+		{"missing env", "profiles:\n  a:\n    token_id: ${TEST_PROFILE_UNSET}", "TEST_PROFILE_UNSET"},
+		{"unclosed env", "profiles:\n  a:\n    token_id: ${TEST_PROFILE_UNSET", "缺少}"},
+		{"unknown field", "profiles:\n  a:\n    server: x", "server"},
+		{"bad gateway", "profiles:\n  a:\n    gateway: no-port", "网关地址"},
+		{"bad cipher", "profiles:\n  a:\n    cipher: rot13", "rot13"},
+		{"bad duration", "profiles:\n  a:\n    read_timeout: soon", "line 3"},
+		{"missing default", "default: b\nprofiles:\n  a:\n    server_id: 1", "默认配置"},
+		{"ambiguous", "profiles:\n  a:\n    server_id: 1\n  b:\n    server_id: 2", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := ParseProfiles([]byte(tt.data))
+			if err == nil {
+				_, err = file.Profile("")
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.yaml")
+	if err := os.WriteFile(path, []byte("profiles:\n  a:\n    server_id: ${TEST_PROFILE_ID:-7}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := LoadProfiles(path)
+	if err != nil {
+		t.Fatalf("LoadProfiles failed: %v", err)
+	}
+	if p, _ := file.Profile("a"); p == nil || p.ServerID != 7 {
+		t.Errorf("Unexpected profile %+v", p)
+	}
+	if _, err := LoadProfiles(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
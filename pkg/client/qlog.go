@@ -0,0 +1,61 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/logging"
+	"github.com/quic-go/quic-go/qlog"
+)
+
+// newQlogTracer 返回quic.Config.Tracer，为每个连接在dir下创建<ODCID>_client.sqlog文件
+// 文件创建失败时只记录日志，不影响连接
+func (c *TransferClient) newQlogTracer(dir string) func(context.Context, logging.Perspective, quic.ConnectionID) *logging.ConnectionTracer {
+	return func(_ context.Context, p logging.Perspective, connID quic.ConnectionID) *logging.ConnectionTracer {
+		path := filepath.Join(dir, fmt.Sprintf("%s_client.sqlog", connID))
+		f, err := os.Create(path)
+		if err != nil {
+			c.log.Warn("创建qlog文件失败", "path", path, "error", err)
+			return nil
+		}
+		c.log.Debug("写入qlog", "path", path)
+		return qlog.NewConnectionTracer(&bufferedFile{Writer: bufio.NewWriter(f), f: f}, p, connID)
+	}
+}
+
+// bufferedFile 带缓冲的文件，关闭时先写入缓冲区中的数据
+type bufferedFile struct {
+	*bufio.Writer
+	f *os.File
+}
+
+// Close 实现io.Closer
+func (b *bufferedFile) Close() error {
+	if err := b.Flush(); err != nil {
+		b.f.Close()
+		return err
+	}
+	return b.f.Close()
+}
+
+// keyLogWriterLocked 返回写入Config.KeyLogFile的io.Writer，首次调用时以追加方式打开文件，
+// 文件在Close时关闭，未配置时返回nil，调用方需持有c.mu
+func (c *TransferClient) keyLogWriterLocked() (io.Writer, error) {
+	if c.config.KeyLogFile == "" {
+		return nil, nil
+	}
+	if c.keyLog == nil {
+		f, err := os.OpenFile(c.config.KeyLogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("打开密钥日志文件失败: %v", err)
+		}
+		c.keyLog = f
+		c.log.Warn("TLS会话密钥将写入文件，任何拿到该文件的人都可以解密流量，仅用于调试", "path", c.config.KeyLogFile)
+	}
+	return c.keyLog, nil
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTransferClient_QlogAndKeyLog(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "qlog")
+	keyLog := filepath.Join(t.TempDir(), "keys.log")
+
+	g := newTestGateway(t, echoHandler)
+	c := g.newTestClient(t, &Config{QlogDir: dir, KeyLogFile: keyLog})
+	if _, _, err := c.SendInitRequestNoAES(); err != nil {
+		t.Fatalf("SendInitRequestNoAES failed: %v", err)
+	}
+	c.Close()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*_client.sqlog"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one qlog file, got %v (%v)", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if !bytes.Contains(data, []byte("qlog_version")) || !bytes.Contains(data, []byte("transport:connection_started")) {
+		t.Errorf("Unexpected qlog content: %.200s", data)
+	}
+
+	keys, err := os.ReadFile(keyLog)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	for _, label := range []string{"CLIENT_HANDSHAKE_TRAFFIC_SECRET", "CLIENT_TRAFFIC_SECRET_0"} {
+		if !strings.Contains(string(keys), label) {
+			t.Errorf("Expected %s in key log:\n%s", label, keys)
+		}
+	}
+	if info, err := os.Stat(keyLog); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected key log mode 0600, got %v (%v)", info.Mode(), err)
+	}
+}
+
+func TestTransferClient_QlogDirInvalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := NewTransferClient("127.0.0.1:1", &Config{QlogDir: filepath.Join(file, "qlog")})
+	if _, err := c.newQUICConfig(); err == nil || !strings.Contains(err.Error(), "qlog") {
+		t.Errorf("Expected qlog dir error, got %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// 默认的QUIC传输参数
+const (
+	defaultKeepAlivePeriod      = 2 * time.Second
+	defaultMaxIdleTimeout       = 30 * time.Second
+	defaultHandshakeIdleTimeout = 10 * time.Second
+	defaultMaxIncomingStreams   = 100
+	defaultUDPBufferSize        = 1024 * 1024
+)
+
+// maxReceiveWindow QUIC变长整数可以表示的最大窗口
+const maxReceiveWindow = 1<<62 - 1
+
+// setQUICDefaults 为未设置的QUIC传输参数填充默认值
+func (cfg *Config) setQUICDefaults() {
+	if cfg.KeepAlivePeriod == 0 {
+		cfg.KeepAlivePeriod = defaultKeepAlivePeriod
+	}
+	if cfg.MaxIdleTimeout <= 0 {
+		cfg.MaxIdleTimeout = defaultMaxIdleTimeout
+	}
+	if cfg.HandshakeIdleTimeout <= 0 {
+		cfg.HandshakeIdleTimeout = defaultHandshakeIdleTimeout
+	}
+	if cfg.MaxIncomingStreams == 0 {
+		cfg.MaxIncomingStreams = defaultMaxIncomingStreams
+	}
+	if cfg.UDPReceiveBuffer == 0 {
+		cfg.UDPReceiveBuffer = defaultUDPBufferSize
+	}
+	if cfg.UDPSendBuffer == 0 {
+		cfg.UDPSendBuffer = defaultUDPBufferSize
+	}
+	if len(cfg.QUICVersions) == 0 {
+		cfg.QUICVersions = []quic.Version{quic.Version1}
+	}
+}
+
+// newQUICConfig 校验QUIC传输参数并生成quic.Config
+func (c *TransferClient) newQUICConfig() (*quic.Config, error) {
+	cfg := c.config
+
+	keepAlive := cfg.KeepAlivePeriod
+	if keepAlive < 0 {
+		keepAlive = 0
+	}
+	if keepAlive >= cfg.MaxIdleTimeout {
+		return nil, fmt.Errorf("保活间隔%v必须小于空闲超时%v", keepAlive, cfg.MaxIdleTimeout)
+	}
+	if cfg.MaxIncomingStreams < 0 {
+		return nil, fmt.Errorf("无效的最大并发流数: %d", cfg.MaxIncomingStreams)
+	}
+	if err := checkReceiveWindow("流", cfg.InitialStreamReceiveWindow, cfg.MaxStreamReceiveWindow); err != nil {
+		return nil, err
+	}
+	if err := checkReceiveWindow("连接", cfg.InitialConnectionReceiveWindow, cfg.MaxConnectionReceiveWindow); err != nil {
+		return nil, err
+	}
+	if cfg.UDPReceiveBuffer < 0 || cfg.UDPSendBuffer < 0 {
+		return nil, fmt.Errorf("无效的UDP缓冲区大小: %d/%d", cfg.UDPReceiveBuffer, cfg.UDPSendBuffer)
+	}
+	for _, v := range cfg.QUICVersions {
+		if v != quic.Version1 && v != quic.Version2 {
+			return nil, fmt.Errorf("不支持的QUIC版本: %s", v)
+		}
+	}
+
+	qc := &quic.Config{
+		KeepAlivePeriod:                keepAlive,
+		MaxIdleTimeout:                 cfg.MaxIdleTimeout,
+		HandshakeIdleTimeout:           cfg.HandshakeIdleTimeout,
+		MaxIncomingStreams:             cfg.MaxIncomingStreams,
+		InitialStreamReceiveWindow:     cfg.InitialStreamReceiveWindow,
+		MaxStreamReceiveWindow:         cfg.MaxStreamReceiveWindow,
+		InitialConnectionReceiveWindow: cfg.InitialConnectionReceiveWindow,
+		MaxConnectionReceiveWindow:     cfg.MaxConnectionReceiveWindow,
+		EnableDatagrams:                true,
+		DisablePathMTUDiscovery:        cfg.DisablePathMTUDiscovery,
+		Versions:                       append([]quic.Version(nil), cfg.QUICVersions...),
+	}
+	if cfg.QlogDir != "" {
+		if err := os.MkdirAll(cfg.QlogDir, 0o755); err != nil {
+			return nil, fmt.Errorf("创建qlog目录失败: %v", err)
+		}
+		qc.Tracer = c.newQlogTracer(cfg.QlogDir)
+	}
+	return qc, nil
+}
+
+// checkReceiveWindow 检查初始窗口不超过最大窗口，且都在QUIC允许的范围内
+func checkReceiveWindow(name string, initial, max uint64) error {
+	if initial > maxReceiveWindow || max > maxReceiveWindow {
+		return fmt.Errorf("%s接收窗口超出范围: %d/%d", name, initial, max)
+	}
+	if initial > 0 && max > 0 && initial > max {
+		return fmt.Errorf("%s初始接收窗口%d大于最大接收窗口%d", name, initial, max)
+	}
+	return nil
+}
+
+// ParseQUICVersions 解析逗号分隔的QUIC版本列表，如"1,2"或"v1,v2"
+func ParseQUICVersions(s string) ([]quic.Version, error) {
+	var versions []quic.Version
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimPrefix(strings.TrimSpace(strings.ToLower(field)), "v")
+		if field == "" {
+			continue
+		}
+		switch n, err := strconv.Atoi(field); {
+		case err == nil && n == 1:
+			versions = append(versions, quic.Version1)
+		case err == nil && n == 2:
+			versions = append(versions, quic.Version2)
+		default:
+			return nil, fmt.Errorf("不支持的QUIC版本: %s", field)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("QUIC版本列表为空")
+	}
+	return versions, nil
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+func TestConfig_QUICDefaults(t *testing.T) {
+	c := NewTransferClient("127.0.0.1:8002", &Config{})
+	qc, err := c.newQUICConfig()
+	if err != nil {
+		t.Fatalf("newQUICConfig failed: %v", err)
+	}
+	if qc.KeepAlivePeriod != defaultKeepAlivePeriod || qc.MaxIdleTimeout != defaultMaxIdleTimeout ||
+		qc.HandshakeIdleTimeout != defaultHandshakeIdleTimeout || qc.MaxIncomingStreams != defaultMaxIncomingStreams {
+		t.Errorf("Unexpected defaults %+v", qc)
+	}
+	if !slices.Equal(qc.Versions, []quic.Version{quic.Version1}) || qc.DisablePathMTUDiscovery {
+		t.Errorf("Unexpected versions %v or PMTUD %v", qc.Versions, qc.DisablePathMTUDiscovery)
+	}
+	if c.config.UDPReceiveBuffer != defaultUDPBufferSize || c.config.UDPSendBuffer != defaultUDPBufferSize {
+		t.Errorf("Unexpected UDP buffers %d/%d", c.config.UDPReceiveBuffer, c.config.UDPSendBuffer)
+	}
+
+	// 负的保活间隔表示关闭保活
+	c = NewTransferClient("127.0.0.1:8002", &Config{KeepAlivePeriod: -1})
+	if qc, err := c.newQUICConfig(); err != nil || qc.KeepAlivePeriod != 0 {
+		t.Errorf("Expected keepalive to be disabled, got %v (%v)", qc, err)
+	}
+}
+
+func TestConfig_QUICValidation(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config Config
+	}{
+		{"keepalive not below idle timeout", Config{KeepAlivePeriod: time.Minute, MaxIdleTimeout: 30 * time.Second}},
+		{"negative streams", Config{MaxIncomingStreams: -1}},
+		{"stream window", Config{InitialStreamReceiveWindow: 2 << 20, MaxStreamReceiveWindow: 1 << 20}},
+		{"connection window", Config{InitialConnectionReceiveWindow: 4 << 20, MaxConnectionReceiveWindow: 1 << 20}},
+		{"window out of range", Config{MaxStreamReceiveWindow: 1 << 62}},
+		{"negative buffer", Config{UDPReceiveBuffer: -1}},
+		{"unsupported version", Config{QUICVersions: []quic.Version{0xff00001d}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := tc.config
+			c := NewTransferClient("127.0.0.1:8002", &config)
+			if _, err := c.newQUICConfig(); err == nil {
+				t.Error("Expected validation error")
+			}
+			if err := c.Connect(context.Background()); err == nil {
+				t.Error("Expected Connect to fail")
+			}
+		})
+	}
+}
+
+func TestParseQUICVersions(t *testing.T) {
+	versions, err := ParseQUICVersions("v2, 1")
+	if err != nil || !slices.Equal(versions, []quic.Version{quic.Version2, quic.Version1}) {
+		t.Errorf("Unexpected result %v %v", versions, err)
+	}
+	for _, s := range []string{"", "3", "draft-29", ","} {
+		if _, err := ParseQUICVersions(s); err == nil {
+			t.Errorf("Expected error for %q", s)
+		}
+	}
+}
+
+func TestTransferClient_QUICTuning(t *testing.T) {
+	g := newTestGateway(t, echoHandler)
+	c := g.newTestClient(t, &Config{
+		QUICVersions:                   []quic.Version{quic.Version2},
+		InitialStreamReceiveWindow:     1 << 20,
+		MaxStreamReceiveWindow:         16 << 20,
+		InitialConnectionReceiveWindow: 2 << 20,
+		MaxConnectionReceiveWindow:     32 << 20,
+		DisablePathMTUDiscovery:        true,
+		UDPReceiveBuffer:               256 * 1024,
+		UDPSendBuffer:                  256 * 1024,
+	})
+	if v := c.conn.ConnectionState().Version; v != quic.Version2 {
+		t.Errorf("Expected QUIC v2, got %v", v)
+	}
+	if _, _, err := c.SendInitRequestNoAES(); err != nil {
+		t.Fatalf("SendInitRequestNoAES failed: %v", err)
+	}
+	payload := []byte("POST /echo HTTP/1.1\r\nContent-Length: 5\r\n\r\ntuned")
+	resp, _, _, err := c.SendTransferBytes(context.Background(), payload)
+	if err != nil {
+		t.Fatalf("SendTransferBytes failed: %v", err)
+	}
+	if !bytes.HasSuffix(resp, []byte("tuned")) {
+		t.Errorf("Unexpected response %q", resp)
+	}
+}
@@ -0,0 +1,132 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/pkg/replay"
+)
+
+// recordSession 连接测试网关完成INIT并发送payloads，返回录制的会话和各请求的响应
+func recordSession(t *testing.T, payloads ...string) (*replay.Recording, [][]byte) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	g := newTestGateway(t, echoHandler)
+	c := g.newTestClient(t, &Config{FrameTracer: NewFrameRecorder(&buf)})
+	responses := sendPayloads(t, c, payloads...)
+	c.Close()
+
+	rec, err := replay.Read(&buf)
+	if err != nil {
+		t.Fatalf("Failed to read recording: %v", err)
+	}
+	return rec, responses
+}
+
+// sendPayloads 完成INIT后依次发送payloads并返回响应
+func sendPayloads(t *testing.T, c *TransferClient, payloads ...string) [][]byte {
+	t.Helper()
+
+	if _, _, err := c.SendInit(); err != nil {
+		t.Fatalf("SendInit failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var responses [][]byte
+	for _, payload := range payloads {
+		resp, _, _, err := c.SendTransferBytes(ctx, []byte(payload))
+		if err != nil {
+			t.Fatalf("SendTransferBytes failed: %v", err)
+		}
+		responses = append(responses, resp)
+	}
+	return responses
+}
+
+func TestReplay_Server(t *testing.T) {
+	payloads := []string{
+		"POST /echo HTTP/1.1\r\nHost: backend\r\nContent-Length: 3\r\n\r\none",
+		"POST /echo HTTP/1.1\r\nHost: backend\r\nContent-Length: 3\r\n\r\ntwo",
+	}
+	rec, want := recordSession(t, payloads...)
+
+	srv := replay.NewServer(rec, nil)
+	if err := srv.Start("127.0.0.1:0"); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	c := NewTransferClient(srv.Addr().String(), &Config{ServerID: 1, ServerName: "test-server", SessionID: "test-session", MaxRetries: 1, RootCAs: roots})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Close()
+
+	got := sendPayloads(t, c, payloads...)
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Errorf("Response %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+	if err := srv.Err(); err != nil {
+		t.Errorf("Unexpected replay error: %v", err)
+	}
+}
+
+func TestReplay_ServerMismatch(t *testing.T) {
+	rec, _ := recordSession(t, "POST /echo HTTP/1.1\r\nHost: backend\r\nContent-Length: 3\r\n\r\none")
+
+	srv := replay.NewServer(rec, &replay.ServerOptions{MatchBody: true})
+	if err := srv.Start("127.0.0.1:0"); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	c := NewTransferClient(srv.Addr().String(), &Config{ServerID: 1, ServerName: "test-server", SessionID: "test-session", MaxRetries: 1, RootCAs: roots})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Close()
+
+	// INIT中的请求ID每次都不同，要求数据一致时第一个请求帧就不相符
+	if _, _, err := c.SendInit(); err == nil {
+		t.Error("Expected SendInit to fail")
+	}
+	if srv.Err() == nil {
+		t.Error("Expected mismatch to be reported")
+	}
+}
+
+func TestReplay_Reissue(t *testing.T) {
+	rec, want := recordSession(t, "POST /echo HTTP/1.1\r\nHost: backend\r\nContent-Length: 5\r\n\r\nhello")
+	requests, err := rec.Requests()
+	if err != nil {
+		t.Fatalf("Requests failed: %v", err)
+	}
+	if len(requests) != 1 || !bytes.Equal(requests[0].Response, want[0]) {
+		t.Fatalf("Unexpected recorded requests: %+v", requests)
+	}
+
+	// 向另一个网关重新发送
+	g := newTestGateway(t, echoHandler)
+	c := g.newTestClient(t, nil)
+	if _, _, err := c.SendInit(); err != nil {
+		t.Fatalf("SendInit failed: %v", err)
+	}
+	results := replay.Reissue(context.Background(), c, requests)
+	if len(results) != 1 || results[0].Err != nil || !results[0].Match() {
+		t.Errorf("Unexpected reissue result: %+v", results[0])
+	}
+}
@@ -0,0 +1,261 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// HTTPRequest 透传HTTP请求构造器，用于生成EMM_COMMAND_TRAN帧中携带的原始请求字节
+type HTTPRequest struct {
+	// 请求方法，如GET、POST
+	Method string
+	// 请求路径，如/index.html，可以带原始查询串，为空时使用/
+	Path string
+	// 协议版本，默认HTTP/1.1
+	Proto string
+	// Host头，非空且Header中未设置Host时自动添加
+	Host string
+	// 请求头
+	Header http.Header
+	// 查询参数，会追加到Path已有的查询串之后
+	Query url.Values
+	// 请求体，可为nil
+	Body io.Reader
+	// 请求体长度，-1表示未知，生成请求时会读取Body计算
+	ContentLength int64
+}
+
+// NewHTTPRequest 创建HTTP请求构造器
+// target可以是完整URL（如http://192.168.1.1:8089/index.html?a=1），也可以只是路径（如/index.html）
+func NewHTTPRequest(method string, target string, body io.Reader) (*HTTPRequest, error) {
+	if method == "" {
+		method = http.MethodGet
+	}
+	if !validMethod(method) {
+		return nil, fmt.Errorf("无效的请求方法: %q", method)
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("解析请求地址失败: %v", err)
+	}
+
+	// 原始查询串按原样保留在Path中，不重新排序和转义，Query只包含调用方追加的参数
+	path := u.EscapedPath()
+	if u.RawQuery != "" {
+		if path == "" {
+			path = "/"
+		}
+		path += "?" + u.RawQuery
+	}
+
+	req := &HTTPRequest{
+		Method:        method,
+		Path:          path,
+		Proto:         "HTTP/1.1",
+		Host:          u.Host,
+		Header:        make(http.Header),
+		Query:         make(url.Values),
+		Body:          body,
+		ContentLength: -1,
+	}
+
+	switch v := body.(type) {
+	case nil:
+		req.ContentLength = 0
+	case *bytes.Buffer:
+		req.ContentLength = int64(v.Len())
+	case *bytes.Reader:
+		req.ContentLength = int64(v.Len())
+	case *strings.Reader:
+		req.ContentLength = int64(v.Len())
+	}
+
+	return req, nil
+}
+
+// Bytes 生成完整的请求字节（请求行、请求头和请求体），结果不做任何转义处理
+func (r *HTTPRequest) Bytes() ([]byte, error) {
+	var body []byte
+	if r.Body != nil {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("读取请求体失败: %v", err)
+		}
+		body = data
+		if r.ContentLength >= 0 && int64(len(body)) != r.ContentLength {
+			return nil, fmt.Errorf("请求体长度不匹配: 声明 %d 字节，实际 %d 字节", r.ContentLength, len(body))
+		}
+	}
+
+	head, err := r.head(int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(head, body...), nil
+}
+
+// Reader 返回请求的流式读取器和总长度
+// 请求体长度已知时不会将请求体读入内存，适合上传大文件
+func (r *HTTPRequest) Reader() (io.Reader, int64, error) {
+	if r.Body == nil || r.ContentLength < 0 {
+		data, err := r.Bytes()
+		if err != nil {
+			return nil, 0, err
+		}
+		return bytes.NewReader(data), int64(len(data)), nil
+	}
+
+	head, err := r.head(r.ContentLength)
+	if err != nil {
+		return nil, 0, err
+	}
+	body := &exactReader{r: r.Body, remaining: r.ContentLength}
+	return io.MultiReader(bytes.NewReader(head), body), int64(len(head)) + r.ContentLength, nil
+}
+
+// String 返回请求的文本形式，便于调试；生成失败时返回空字符串
+// 请求体会被读入内存并替换为可以再次读取的副本，调用后仍可正常发送请求
+func (r *HTTPRequest) String() string {
+	cp := *r
+	if r.Body != nil {
+		data, err := io.ReadAll(r.Body)
+		body := io.Reader(bytes.NewReader(data))
+		// 保留原请求体的Close，调用方可能需要关闭文件
+		if closer, ok := r.Body.(io.Closer); ok {
+			body = struct {
+				io.Reader
+				io.Closer
+			}{body, closer}
+		}
+		r.Body = body
+		if err != nil {
+			return ""
+		}
+		cp.Body = bytes.NewReader(data)
+	}
+	data, err := cp.Bytes()
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// head 生成请求行和请求头，bodyLen为请求体长度
+func (r *HTTPRequest) head(bodyLen int64) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	proto := r.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+
+	fmt.Fprintf(buf, "%s %s %s\r\n", r.Method, r.requestURI(), proto)
+
+	header := r.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	if header.Get("Host") == "" && r.Host != "" {
+		header.Set("Host", r.Host)
+	}
+	if header.Get("Content-Length") == "" && header.Get("Transfer-Encoding") == "" {
+		if bodyLen > 0 || methodExpectsBody(r.Method) {
+			header.Set("Content-Length", strconv.FormatInt(bodyLen, 10))
+		}
+	}
+
+	// Host头放在第一行，其余按键名排序输出
+	if host := header.Get("Host"); host != "" {
+		fmt.Fprintf(buf, "Host: %s\r\n", host)
+		header.Del("Host")
+	}
+	if err := header.Write(buf); err != nil {
+		return nil, fmt.Errorf("写入请求头失败: %v", err)
+	}
+	buf.WriteString("\r\n")
+
+	return buf.Bytes(), nil
+}
+
+// requestURI 组合路径和查询参数
+func (r *HTTPRequest) requestURI() string {
+	path := r.Path
+	if path == "" {
+		path = "/"
+	}
+	if len(r.Query) == 0 {
+		return path
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + r.Query.Encode()
+}
+
+var (
+	errBodyTooShort = errors.New("请求体长度小于ContentLength")
+	errBodyTooLong  = errors.New("请求体长度大于ContentLength")
+)
+
+// exactReader 读取固定长度的数据，数据不足时返回errBodyTooShort，有多余数据时返回errBodyTooLong
+type exactReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (e *exactReader) Read(p []byte) (int, error) {
+	if e.remaining <= 0 {
+		// 读满ContentLength后确认没有多余的数据，避免静默截断请求体
+		var b [1]byte
+		n, err := io.ReadFull(e.r, b[:])
+		if n > 0 {
+			return 0, errBodyTooLong
+		}
+		if err != io.EOF {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > e.remaining {
+		p = p[:e.remaining]
+	}
+	n, err := e.r.Read(p)
+	e.remaining -= int64(n)
+	if err == io.EOF && e.remaining > 0 {
+		return n, errBodyTooShort
+	}
+	return n, err
+}
+
+func validMethod(method string) bool {
+	for _, c := range method {
+		if c < 'A' || c > 'Z' {
+			if c != '-' && c != '_' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func methodExpectsBody(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		return true
+	}
+	return false
+}
+
+// fixEscapedCRLF 兼容旧版调用方式：将内容中的字面量\r\n替换为真实的CRLF
+func fixEscapedCRLF(content string) string {
+	return strings.Replace(content, "\\r\\n", "\r\n", -1)
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestHTTPRequest_Bytes(t *testing.T) {
+	req, err := NewHTTPRequest("GET", "http://192.168.247.111:8089/index.html?a=1", nil)
+	if err != nil {
+		t.Fatalf("NewHTTPRequest failed: %v", err)
+	}
+	req.Header.Set("User-Agent", "quic_gwclient")
+	req.Header.Set("Accept", "*/*")
+	req.Query.Add("b", "2")
+
+	data, err := req.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes failed: %v", err)
+	}
+
+	expected := "GET /index.html?a=1&b=2 HTTP/1.1\r\n" +
+		"Host: 192.168.247.111:8089\r\n" +
+		"Accept: */*\r\n" +
+		"User-Agent: quic_gwclient\r\n" +
+		"\r\n"
+	if string(data) != expected {
+		t.Errorf("Unexpected request bytes:\n%q\nexpected:\n%q", data, expected)
+	}
+}
+
+func TestHTTPRequest_RawQueryKept(t *testing.T) {
+	// 原始查询串不重新排序和转义，重复键和无效的转义也原样保留
+	req, err := NewHTTPRequest("GET", "http://backend?z=1&a=%2f&a=b+c&bad=%zz", nil)
+	if err != nil {
+		t.Fatalf("NewHTTPRequest failed: %v", err)
+	}
+	req.Query.Add("x", "1 2")
+
+	data, err := req.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes failed: %v", err)
+	}
+	if line := "GET /?z=1&a=%2f&a=b+c&bad=%zz&x=1+2 HTTP/1.1\r\n"; !strings.HasPrefix(string(data), line) {
+		t.Errorf("Unexpected request line: %q", data)
+	}
+}
+
+func TestHTTPRequest_ReaderBodyLength(t *testing.T) {
+	for _, tt := range []struct {
+		body string
+		want error
+	}{
+		{"hello", nil},
+		{"hell", errBodyTooShort},
+		{"hello!", errBodyTooLong},
+	} {
+		req, _ := NewHTTPRequest("POST", "/upload", strings.NewReader(tt.body))
+		req.ContentLength = 5
+		reader, _, err := req.Reader()
+		if err != nil {
+			t.Fatalf("Reader failed: %v", err)
+		}
+		data, err := io.ReadAll(reader)
+		if err != tt.want {
+			t.Errorf("Body %q: expected %v, got %v", tt.body, tt.want, err)
+		}
+		if tt.want == nil && !bytes.HasSuffix(data, []byte("\r\n\r\nhello")) {
+			t.Errorf("Unexpected request: %q", data)
+		}
+	}
+}
+
+func TestHTTPRequest_BodyKeptVerbatim(t *testing.T) {
+	// 请求体中的字面量\r\n不能被改写
+	body := []byte("line1\\r\\nline2\x00\xff")
+	req, err := NewHTTPRequest("POST", "/upload", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewHTTPRequest failed: %v", err)
+	}
+	req.Host = "example.com"
+
+	data, err := req.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes failed: %v", err)
+	}
+
+	if !bytes.HasSuffix(data, append([]byte("\r\n\r\n"), body...)) {
+		t.Errorf("Body was modified: %q", data)
+	}
+	if !strings.Contains(string(data), "Content-Length: 16\r\n") {
+		t.Errorf("Expected Content-Length header, got %q", data)
+	}
+}
+
+func TestHTTPRequest_EmptyPostHasContentLength(t *testing.T) {
+	req, err := NewHTTPRequest("POST", "/api", nil)
+	if err != nil {
+		t.Fatalf("NewHTTPRequest failed: %v", err)
+	}
+
+	data, err := req.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes failed: %v", err)
+	}
+	if !strings.Contains(string(data), "Content-Length: 0\r\n") {
+		t.Errorf("Expected Content-Length: 0, got %q", data)
+	}
+}
+
+func TestHTTPRequest_StringKeepsBody(t *testing.T) {
+	// 用于调试输出的String不能消耗请求体
+	req, err := NewHTTPRequest("POST", "http://example.com/api", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("NewHTTPRequest failed: %v", err)
+	}
+	expected := "POST /api HTTP/1.1\r\nHost: example.com\r\nContent-Length: 7\r\n\r\npayload"
+	for i := 0; i < 2; i++ {
+		if got := req.String(); got != expected {
+			t.Errorf("String #%d = %q, want %q", i+1, got, expected)
+		}
+	}
+	data, err := req.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes failed: %v", err)
+	}
+	if string(data) != expected {
+		t.Errorf("Bytes after String = %q, want %q", data, expected)
+	}
+}
+
+func TestHTTPRequest_InvalidMethod(t *testing.T) {
+	if _, err := NewHTTPRequest("GET /x", "/", nil); err == nil {
+		t.Error("Expected error for invalid method")
+	}
+}
+
+func TestFixEscapedCRLF(t *testing.T) {
+	if got := fixEscapedCRLF("GET / HTTP/1.1\\r\\n\\r\\n"); got != "GET / HTTP/1.1\r\n\r\n" {
+		t.Errorf("Unexpected result: %q", got)
+	}
+}
@@ -0,0 +1,221 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Resolver 网关节点发现
+type Resolver interface {
+	// Resolve 返回当前的节点列表以及多久之后需要重新解析，0表示不需要刷新
+	Resolve(ctx context.Context) ([]Endpoint, time.Duration, error)
+}
+
+// StaticResolver 固定的节点列表
+type StaticResolver []Endpoint
+
+// Resolve 返回固定的节点列表
+func (r StaticResolver) Resolve(context.Context) ([]Endpoint, time.Duration, error) {
+	if len(r) == 0 {
+		return nil, 0, fmt.Errorf("节点列表为空")
+	}
+	return slices.Clone(r), 0, nil
+}
+
+// defaultSRVRefresh SRVResolver默认的刷新间隔
+const defaultSRVRefresh = time.Minute
+
+// SRVResolver 通过DNS SRV记录发现网关节点，记录的优先级和权重对应Endpoint的Priority和Weight
+// 标准库不返回记录的TTL，按Refresh定期重新解析
+type SRVResolver struct {
+	Service  string        // 服务名，如"emm-gw"，为空时直接查询Name
+	Proto    string        // 协议，默认"udp"
+	Name     string        // 域名，如"example.com"
+	Refresh  time.Duration // 重新解析的间隔，默认1分钟
+	Resolver *net.Resolver // 为nil时使用net.DefaultResolver
+
+	lookupSRV func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// Resolve 查询SRV记录
+func (r *SRVResolver) Resolve(ctx context.Context) ([]Endpoint, time.Duration, error) {
+	lookup := r.lookupSRV
+	if lookup == nil {
+		resolver := r.Resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+		lookup = resolver.LookupSRV
+	}
+	proto := r.Proto
+	if proto == "" {
+		proto = "udp"
+	}
+	refresh := r.Refresh
+	if refresh <= 0 {
+		refresh = defaultSRVRefresh
+	}
+
+	_, records, err := lookup(ctx, r.Service, proto, r.Name)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询SRV记录失败: %v", err)
+	}
+	endpoints := make([]Endpoint, 0, len(records))
+	for _, srv := range records {
+		// 目标为"."表示该服务不可用
+		target := strings.TrimSuffix(srv.Target, ".")
+		if target == "" {
+			continue
+		}
+		endpoints = append(endpoints, Endpoint{
+			Addr:     net.JoinHostPort(target, strconv.Itoa(int(srv.Port))),
+			Weight:   int(srv.Weight),
+			Priority: int(srv.Priority),
+		})
+	}
+	if len(endpoints) == 0 {
+		return nil, 0, fmt.Errorf("SRV记录中没有可用的节点: %s", r.Name)
+	}
+	return endpoints, refresh, nil
+}
+
+// defaultFilePollInterval FileResolver默认的文件检查间隔
+const defaultFilePollInterval = 5 * time.Second
+
+// FileResolver 从YAML或JSON文件读取节点列表，定期检查文件，修改后重新加载
+// 文件扩展名为.json时按JSON解析，否则按YAML解析，格式为：
+//
+//	endpoints:
+//	  - addr: 10.0.0.1:8002
+//	    weight: 2
+//	  - addr: 10.0.0.2:8002
+//	    priority: 1
+type FileResolver struct {
+	Path         string
+	PollInterval time.Duration // 检查文件修改的间隔，默认5秒
+
+	mu        sync.Mutex
+	modTime   time.Time
+	size      int64
+	endpoints []Endpoint
+}
+
+// endpointsFile 节点列表文件的格式
+type endpointsFile struct {
+	Endpoints []Endpoint `json:"endpoints" yaml:"endpoints"`
+}
+
+// Resolve 返回文件中的节点列表，文件未修改时返回上次加载的结果
+func (r *FileResolver) Resolve(context.Context) ([]Endpoint, time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	interval := r.PollInterval
+	if interval <= 0 {
+		interval = defaultFilePollInterval
+	}
+
+	info, err := os.Stat(r.Path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("读取节点列表文件失败: %v", err)
+	}
+	if r.endpoints != nil && info.ModTime().Equal(r.modTime) && info.Size() == r.size {
+		return slices.Clone(r.endpoints), interval, nil
+	}
+
+	data, err := os.ReadFile(r.Path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("读取节点列表文件失败: %v", err)
+	}
+	var file endpointsFile
+	if strings.EqualFold(filepath.Ext(r.Path), ".json") {
+		err = json.Unmarshal(data, &file)
+	} else {
+		err = yaml.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("解析节点列表文件失败: %v", err)
+	}
+	if len(file.Endpoints) == 0 {
+		return nil, 0, fmt.Errorf("节点列表文件中没有节点: %s", r.Path)
+	}
+
+	r.modTime, r.size, r.endpoints = info.ModTime(), info.Size(), file.Endpoints
+	return slices.Clone(r.endpoints), interval, nil
+}
+
+// NewFailoverClientWithResolver 通过resolver发现网关节点并创建多网关客户端
+// resolver返回的刷新间隔大于0时在后台定期重新解析，解析失败时继续使用原有的节点列表
+func NewFailoverClientWithResolver(ctx context.Context, resolver Resolver, config *Config, opts *FailoverOptions) (*FailoverClient, error) {
+	endpoints, ttl, err := resolver.Resolve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("发现网关节点失败: %v", err)
+	}
+	f, err := NewFailoverClient(endpoints, config, opts)
+	if err != nil {
+		return nil, err
+	}
+	f.resolver = resolver
+	if ttl > 0 {
+		f.wg.Add(1)
+		go f.refreshLoop(ttl)
+	}
+	return f, nil
+}
+
+// refreshLoop 按resolver返回的间隔刷新节点列表，直到Close
+func (f *FailoverClient) refreshLoop(ttl time.Duration) {
+	defer f.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-f.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	timer := time.NewTimer(ttl)
+	defer timer.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-timer.C:
+		}
+
+		endpoints, next, err := f.resolver.Resolve(ctx)
+		if err == nil {
+			err = f.setEndpoints(endpoints)
+		}
+		f.stateMu.Lock()
+		f.resolveErr = err
+		f.stateMu.Unlock()
+
+		// 解析失败或未给出间隔时按上次的间隔重试
+		if err == nil && next > 0 {
+			ttl = next
+		}
+		timer.Reset(ttl)
+	}
+}
+
+// ResolveError 返回最近一次刷新节点列表的错误，成功时返回nil
+func (f *FailoverClient) ResolveError() error {
+	f.stateMu.Lock()
+	defer f.stateMu.Unlock()
+	return f.resolveErr
+}
@@ -0,0 +1,168 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStaticResolver(t *testing.T) {
+	r := StaticResolver{{Addr: "a:1"}, {Addr: "b:1", Weight: 3}}
+	endpoints, ttl, err := r.Resolve(context.Background())
+	if err != nil || ttl != 0 || !slices.Equal(endpoints, []Endpoint(r)) {
+		t.Errorf("Unexpected result %v %v %v", endpoints, ttl, err)
+	}
+	if _, _, err := (StaticResolver{}).Resolve(context.Background()); err == nil {
+		t.Error("Expected error for empty list")
+	}
+}
+
+func TestSRVResolver(t *testing.T) {
+	var query string
+	r := &SRVResolver{Service: "emm-gw", Name: "example.com", Refresh: time.Second}
+	r.lookupSRV = func(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		query = fmt.Sprintf("_%s._%s.%s", service, proto, name)
+		return "", []*net.SRV{
+			{Target: "gw1.example.com.", Port: 8002, Priority: 10, Weight: 5},
+			{Target: "gw2.example.com.", Port: 8003, Priority: 20, Weight: 1},
+			{Target: ".", Port: 0},
+		}, nil
+	}
+
+	endpoints, ttl, err := r.Resolve(context.Background())
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if query != "_emm-gw._udp.example.com" {
+		t.Errorf("Unexpected query %s", query)
+	}
+	want := []Endpoint{
+		{Addr: "gw1.example.com:8002", Weight: 5, Priority: 10},
+		{Addr: "gw2.example.com:8003", Weight: 1, Priority: 20},
+	}
+	if !slices.Equal(endpoints, want) || ttl != time.Second {
+		t.Errorf("Unexpected endpoints %v ttl %v", endpoints, ttl)
+	}
+
+	r.lookupSRV = func(context.Context, string, string, string) (string, []*net.SRV, error) {
+		return "", nil, errors.New("no such host")
+	}
+	if _, _, err := r.Resolve(context.Background()); err == nil {
+		t.Error("Expected lookup error")
+	}
+}
+
+func TestFileResolver(t *testing.T) {
+	dir := t.TempDir()
+
+	yamlPath := filepath.Join(dir, "endpoints.yaml")
+	os.WriteFile(yamlPath, []byte("endpoints:\n  - addr: 10.0.0.1:8002\n    weight: 2\n  - addr: 10.0.0.2:8002\n    priority: 1\n"), 0600)
+	r := &FileResolver{Path: yamlPath, PollInterval: time.Second}
+	endpoints, ttl, err := r.Resolve(context.Background())
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	want := []Endpoint{{Addr: "10.0.0.1:8002", Weight: 2}, {Addr: "10.0.0.2:8002", Priority: 1}}
+	if !slices.Equal(endpoints, want) || ttl != time.Second {
+		t.Errorf("Unexpected endpoints %v ttl %v", endpoints, ttl)
+	}
+
+	// 文件修改后重新加载
+	os.WriteFile(yamlPath, []byte("endpoints:\n  - addr: 10.0.0.3:8002\n"), 0600)
+	if endpoints, _, _ := r.Resolve(context.Background()); len(endpoints) != 1 || endpoints[0].Addr != "10.0.0.3:8002" {
+		t.Errorf("Expected reloaded endpoints, got %v", endpoints)
+	}
+
+	jsonPath := filepath.Join(dir, "endpoints.json")
+	os.WriteFile(jsonPath, []byte(`{"endpoints": [{"addr": "[fd00::1]:8002", "weight": 4}]}`), 0600)
+	endpoints, _, err = (&FileResolver{Path: jsonPath}).Resolve(context.Background())
+	if err != nil || len(endpoints) != 1 || endpoints[0] != (Endpoint{Addr: "[fd00::1]:8002", Weight: 4}) {
+		t.Errorf("Unexpected JSON result %v %v", endpoints, err)
+	}
+
+	os.WriteFile(jsonPath, []byte(`{"endpoints": [`), 0600)
+	if _, _, err := (&FileResolver{Path: jsonPath}).Resolve(context.Background()); err == nil {
+		t.Error("Expected parse error")
+	}
+	if _, _, err := (&FileResolver{Path: filepath.Join(dir, "missing.yaml")}).Resolve(context.Background()); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
+
+func TestFailoverClient_Resolver(t *testing.T) {
+	g1 := newTestGateway(t, echoHandler)
+	g2 := newTestGateway(t, echoHandler)
+	path := filepath.Join(t.TempDir(), "endpoints.yaml")
+	writeEndpoints := func(addrs ...string) {
+		content := "endpoints:\n"
+		for _, addr := range addrs {
+			content += fmt.Sprintf("  - addr: %q\n", addr)
+		}
+		os.WriteFile(path, []byte(content), 0600)
+	}
+	writeEndpoints(g1.addr)
+
+	config, _ := failoverTestConfig(g1, g2)
+	f, err := NewFailoverClientWithResolver(context.Background(), &FileResolver{Path: path, PollInterval: 20 * time.Millisecond}, config, &FailoverOptions{ProbeInterval: -1})
+	if err != nil {
+		t.Fatalf("NewFailoverClientWithResolver failed: %v", err)
+	}
+	defer f.Close()
+
+	if err := f.Connect(context.Background()); err != nil || f.Current() != g1.addr {
+		t.Fatalf("Expected connection to %s, got %q (%v)", g1.addr, f.Current(), err)
+	}
+
+	// 文件修改后节点列表随之刷新，请求切换到新节点
+	writeEndpoints(g2.addr)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := f.Endpoints()
+		if len(status) == 1 && status[0].Addr == g2.addr {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Endpoints were not refreshed: %v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	g1.backendDown.Store(true)
+	if _, _, _, err := f.SendTransferBytes(context.Background(), []byte("GET / HTTP/1.1\r\n\r\n")); err != nil {
+		t.Fatalf("SendTransferBytes failed: %v", err)
+	}
+	if f.Current() != g2.addr {
+		t.Errorf("Expected %s, got %s", g2.addr, f.Current())
+	}
+
+	// 文件损坏时保留原有节点列表
+	os.WriteFile(path, []byte("endpoints: ["), 0600)
+	deadline = time.Now().Add(5 * time.Second)
+	for f.ResolveError() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected resolve error for broken file")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := f.Endpoints(); len(status) != 1 || status[0].Addr != g2.addr {
+		t.Errorf("Expected endpoints to be kept, got %v", status)
+	}
+}
+
+func TestFailoverClient_Priority(t *testing.T) {
+	f, _ := NewFailoverClient([]Endpoint{{Addr: "backup:1", Priority: 1}, {Addr: "primary:1"}}, &Config{}, &FailoverOptions{ProbeInterval: -1})
+	for i := 0; i < 3; i++ {
+		if ep := f.pick(nil); ep.Addr != "primary:1" {
+			t.Fatalf("Expected primary endpoint, got %s", ep.Addr)
+		}
+	}
+	f.endpoints[1].Healthy = false
+	if ep := f.pick(nil); ep.Addr != "backup:1" {
+		t.Errorf("Expected backup endpoint when primary is down, got %s", ep.Addr)
+	}
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/quic-go/quic-go"
+)
+
+// defaultSessionCache Config.SessionCache为nil时使用的进程级TLS会话缓存
+// 每次请求都新建客户端的短连接（如SendQuicRequest）也能复用之前连接得到的会话票据
+var defaultSessionCache = tls.NewLRUClientSessionCache(128)
+
+// sessionCache 返回使用的TLS会话缓存
+func (c *TransferClient) sessionCache() tls.ClientSessionCache {
+	if c.config.SessionCache != nil {
+		return c.config.SessionCache
+	}
+	return defaultSessionCache
+}
+
+// dial 按配置选择完整握手或0-RTT方式建立连接
+// 开启Enable0RTT且缓存中有可用的会话票据时，连接在握手完成前返回，之后写入的数据作为早期数据发送
+func (c *TransferClient) dial(ctx context.Context, transport *quic.Transport, raddr net.Addr, tlsConf *tls.Config, quicConfig *quic.Config) (quic.Connection, error) {
+	if !c.config.Enable0RTT {
+		return transport.Dial(ctx, raddr, tlsConf, quicConfig)
+	}
+	return transport.DialEarly(ctx, raddr, tlsConf, quicConfig)
+}
+
+// initWith0RTTFallbackLocked 执行初始化请求，网关拒绝0-RTT时等待完整握手完成后在新的流上重发一次，调用方需持有c.mu
+func (c *TransferClient) initWith0RTTFallbackLocked(ctx context.Context, aes bool, send func(context.Context) (int, int, error)) (sentBytes int, receivedBytes int, err error) {
+	ctx, span := c.startSpan(ctx, spanInit, attrAES.Bool(aes), attr0RTT.Bool(c.early != nil))
+	defer func() {
+		span.SetAttributes(attrSentBytes.Int(sentBytes), attrReceivedBytes.Int(receivedBytes))
+		endSpan(span, err)
+	}()
+
+	sentBytes, receivedBytes, err = send(ctx)
+	if err == nil || c.early == nil || !errors.Is(err, quic.Err0RTTRejected) {
+		return sentBytes, receivedBytes, err
+	}
+
+	// 0-RTT被拒绝后早期数据全部丢弃，原有的流不可再用
+	c.metrics.Retry(Retry0RTT)
+	early := c.early
+	c.early = nil
+	c.stream = nil
+	conn, err := early.NextConnection(ctx)
+	if err != nil {
+		return sentBytes, receivedBytes, fmt.Errorf("0-RTT被拒绝后完成握手失败: %v", err)
+	}
+	c.conn = c.traceConn(conn)
+	if err := c.ensureStreamLocked(ctx); err != nil {
+		return sentBytes, receivedBytes, err
+	}
+
+	s, r, err := send(ctx)
+	return sentBytes + s, receivedBytes + r, err
+}
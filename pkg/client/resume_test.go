@@ -0,0 +1,91 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/laotiannai/quic_gwclient/utils"
+)
+
+// primeSessionCache 完成一次请求使会话票据写入cache，然后断开连接
+func (g *testGateway) primeSessionCache(t *testing.T, config *Config) {
+	t.Helper()
+
+	c := g.newTestClient(t, config)
+	if _, _, err := c.SendInit(); err != nil {
+		t.Fatalf("SendInit failed: %v", err)
+	}
+	if _, _, _, err := c.SendTransferBytes(context.Background(), []byte("GET / HTTP/1.1\r\n\r\n")); err != nil {
+		t.Fatalf("SendTransferBytes failed: %v", err)
+	}
+	if info := c.ConnectionInfo(); info.Resumed || info.Used0RTT {
+		t.Errorf("Expected full handshake on first connection, got %+v", info)
+	}
+	c.Close()
+}
+
+func TestTransferClient_0RTT(t *testing.T) {
+	for _, aes := range []bool{false, true} {
+		name := "plain"
+		if aes {
+			name = "aes"
+		}
+		t.Run(name, func(t *testing.T) {
+			g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: aes})
+			cache := tls.NewLRUClientSessionCache(8)
+			g.primeSessionCache(t, &Config{EnableAES: aes, CipherSuite: utils.CipherGCM, SessionCache: cache})
+
+			c := g.newTestClient(t, &Config{EnableAES: aes, CipherSuite: utils.CipherGCM, SessionCache: cache, Enable0RTT: true})
+			if _, _, err := c.SendInit(); err != nil {
+				t.Fatalf("SendInit over 0-RTT failed: %v", err)
+			}
+			info := c.ConnectionInfo()
+			if !info.Resumed || !info.Used0RTT {
+				t.Errorf("Expected resumed 0-RTT connection, got %+v", info)
+			}
+
+			resp, _, _, err := c.SendTransferBytes(context.Background(), []byte("POST /echo HTTP/1.1\r\nHost: backend\r\nContent-Length: 4\r\n\r\n0rtt"))
+			if err != nil {
+				t.Fatalf("SendTransferBytes failed: %v", err)
+			}
+			if !bytes.HasSuffix(resp, []byte("0rtt")) {
+				t.Errorf("Unexpected response: %q", resp)
+			}
+		})
+	}
+}
+
+func TestTransferClient_0RTTRejected(t *testing.T) {
+	g := newTestGateway(t, echoHandler)
+	cache := tls.NewLRUClientSessionCache(8)
+	g.primeSessionCache(t, &Config{SessionCache: cache})
+
+	// 网关更换票据密钥后无法恢复会话，INIT在完整握手后重发
+	g.reject0RTT.Store(true)
+	c := g.newTestClient(t, &Config{SessionCache: cache, Enable0RTT: true})
+	if _, _, err := c.SendInit(); err != nil {
+		t.Fatalf("SendInit after 0-RTT rejection failed: %v", err)
+	}
+	if info := c.ConnectionInfo(); info.Resumed || info.Used0RTT {
+		t.Errorf("Expected full handshake after rejection, got %+v", info)
+	}
+	if _, _, _, err := c.SendTransferBytes(context.Background(), []byte("GET / HTTP/1.1\r\n\r\n")); err != nil {
+		t.Errorf("SendTransferBytes failed: %v", err)
+	}
+}
+
+func TestTransferClient_SessionResumptionWithout0RTT(t *testing.T) {
+	g := newTestGateway(t, echoHandler)
+	cache := tls.NewLRUClientSessionCache(8)
+	g.primeSessionCache(t, &Config{SessionCache: cache})
+
+	c := g.newTestClient(t, &Config{SessionCache: cache})
+	if _, _, err := c.SendInit(); err != nil {
+		t.Fatalf("SendInit failed: %v", err)
+	}
+	if info := c.ConnectionInfo(); !info.Resumed || info.Used0RTT {
+		t.Errorf("Expected resumed connection without 0-RTT, got %+v", info)
+	}
+}
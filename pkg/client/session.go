@@ -0,0 +1,311 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/proto"
+	"github.com/laotiannai/quic_gwclient/utils"
+
+	"github.com/google/uuid"
+	"github.com/quic-go/quic-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var errSessionNotInitialized = errors.New("加密会话未初始化，请先调用SendInitRequest")
+
+var errFrameSequence = errors.New("响应帧序号错误，可能是重放或乱序的帧")
+
+// aesSession 加密会话，保存INIT阶段协商得到的会话密钥和加密套件
+// 会话建立后所有TRAN请求帧和响应帧都使用同一个密钥加解密，直到密钥轮换
+type aesSession struct {
+	key   []byte
+	suite utils.CipherSuite
+	// 是否协商了OPTION_SEQUENCED：加密数据前8字节为帧序号，并支持密钥轮换
+	sequenced bool
+	// 当前流上下一个发送和期望接收的帧序号，新建流时归零
+	sendSeq uint64
+	recvSeq uint64
+	// 当前密钥的生效时间
+	keyTime time.Time
+}
+
+// option 返回请求帧包头的Option字段
+func (s *aesSession) option() uint8 {
+	option := uint8(s.suite)
+	if s.sequenced {
+		option |= proto.OPTION_SEQUENCED
+	}
+	return option
+}
+
+// resetSequence 新建流时重置帧序号
+func (s *aesSession) resetSequence() {
+	s.sendSeq = 0
+	s.recvSeq = 0
+}
+
+// seal 加密请求帧数据，协商了序号时在数据前附加发送序号
+func (s *aesSession) seal(body []byte) ([]byte, error) {
+	if s.sequenced {
+		buf := make([]byte, 8+len(body))
+		binary.BigEndian.PutUint64(buf, s.sendSeq)
+		copy(buf[8:], body)
+		body = buf
+		s.sendSeq++
+	}
+	return s.suite.Encrypt(s.key, body)
+}
+
+// open 解密响应帧数据，OriginLen有效时按原始长度截断填充
+// 协商了序号时校验帧序号，拒绝重放和乱序的帧
+func (s *aesSession) open(msg *proto.UdpResponseMessage) ([]byte, error) {
+	if len(msg.Body) == 0 {
+		return nil, nil
+	}
+	if msg.Head.Option != s.option() {
+		return nil, fmt.Errorf("响应帧加密选项不一致: %#x", msg.Head.Option)
+	}
+	plain, err := s.suite.Decrypt(s.key, msg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("解密响应失败: %v", err)
+	}
+	if msg.Head.OriginLen > 0 && int(msg.Head.OriginLen) < len(plain) {
+		plain = plain[:msg.Head.OriginLen]
+	}
+	if !s.sequenced {
+		return plain, nil
+	}
+
+	if len(plain) < 8 {
+		return nil, errFrameSequence
+	}
+	if seq := binary.BigEndian.Uint64(plain); seq != s.recvSeq {
+		return nil, fmt.Errorf("%w: 期望 %d，收到 %d", errFrameSequence, s.recvSeq, seq)
+	}
+	s.recvSeq++
+	return plain[8:], nil
+}
+
+// checkClockSkew 检查网关时间戳与本地时间的偏差是否在允许范围内
+func checkClockSkew(timestamp int64, maxSkew time.Duration) error {
+	skew := time.Since(time.Unix(timestamp, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > maxSkew {
+		return fmt.Errorf("网关时间偏差过大: %v，允许范围: %v", skew.Round(time.Second), maxSkew)
+	}
+	return nil
+}
+
+// readTimestamp 读取应答中携带的网关时间戳
+func readTimestamp(body []byte) (int64, error) {
+	if len(body) < 8 {
+		return 0, errors.New("应答中缺少网关时间戳")
+	}
+	return int64(binary.BigEndian.Uint64(body)), nil
+}
+
+// sendInitAESLocked 发送加密的初始化请求并保存协商得到的会话密钥，调用方需持有c.mu
+// 初始化请求体使用utils.InitKey加密，应答及之后的所有帧使用由请求ID和时间戳派生的会话密钥
+// Config.CipherSuite通过包头Option字段提出，网关需在INIT_ACK的Option中确认
+func (c *TransferClient) sendInitAESLocked(ctx context.Context) (int, int, error) {
+	if c.conn == nil {
+		return 0, 0, fmt.Errorf("连接未建立或已关闭")
+	}
+	suite := c.config.CipherSuite
+	if !suite.Valid() {
+		return 0, 0, fmt.Errorf("未知的加密套件: %d", uint8(suite))
+	}
+	// 零填充无法区分帧数据的真实长度，序号校验需要带长度信息的加密套件
+	if c.config.EnableReplayProtection && suite == utils.CipherLegacyCBC {
+		return 0, 0, fmt.Errorf("防重放需要%s或%s加密套件", utils.CipherCBCPKCS7, utils.CipherGCM)
+	}
+	if err := c.ensureStreamLocked(ctx); err != nil {
+		return 0, 0, err
+	}
+
+	reqUUID, err := uuid.NewUUID()
+	if err != nil {
+		return 0, 0, fmt.Errorf("生成请求ID失败: %v", err)
+	}
+	initTime := time.Now().Unix()
+	session := &aesSession{
+		key:       []byte(utils.NewKey(reqUUID.String(), initTime)),
+		suite:     suite,
+		sequenced: c.config.EnableReplayProtection,
+		keyTime:   time.Now(),
+	}
+
+	initBytes, err := c.transferInitByAES(c.config.ServerID, c.config.ProtocolType, c.config.ServerName,
+		"si:"+c.config.SessionID, reqUUID, initTime, utils.InitKey, session.option())
+	if err != nil {
+		return 0, 0, fmt.Errorf("构造初始化请求失败: %v", err)
+	}
+
+	sentBytes, err := c.stream.Write(initBytes)
+	if errors.Is(err, quic.Err0RTTRejected) {
+		return sentBytes, 0, err
+	}
+	if err != nil {
+		c.resetStreamLocked()
+		return sentBytes, 0, fmt.Errorf("发送初始化请求失败: %v", err)
+	}
+
+	c.stream.SetReadDeadline(time.Now().Add(10 * time.Second))
+	msg, err := readResponseFrame(c.stream)
+	if errors.Is(err, quic.Err0RTTRejected) {
+		return sentBytes, 0, err
+	}
+	if err != nil {
+		c.resetStreamLocked()
+		return sentBytes, 0, fmt.Errorf("读取初始化响应失败: %v", err)
+	}
+	c.stream.SetReadDeadline(time.Time{})
+	receivedBytes := msg.Head.Len() + len(msg.Body)
+
+	if msg.Head.Command != proto.EMM_COMMAND_INIT_ACK {
+		return sentBytes, receivedBytes, fmt.Errorf("收到非预期的响应命令: %d", msg.Head.Command)
+	}
+	c.metrics.GatewayResult(msg.Head.Command, msg.Head.Result)
+	trace.SpanFromContext(ctx).SetAttributes(attrResultCode.Int(int(msg.Head.Result)))
+	if msg.Head.Result != proto.AUTH_STATUS_CODE_SUCCESS {
+		return sentBytes, receivedBytes, &GatewayError{Command: msg.Head.Command, Result: msg.Head.Result}
+	}
+	// 不支持该加密套件或序号的旧版网关会返回其他值，不允许静默降级
+	if msg.Head.Option != session.option() {
+		return sentBytes, receivedBytes, fmt.Errorf("网关不支持请求的加密选项%#x（%s），确认的选项为: %#x",
+			session.option(), suite, msg.Head.Option)
+	}
+	// 协商了序号时，应答携带用会话密钥加密的网关时间戳，用于确认密钥和检查时间偏差
+	if session.sequenced {
+		if err := c.verifyTimestampFrame(session, msg); err != nil {
+			return sentBytes, receivedBytes, fmt.Errorf("初始化应答校验失败: %v", err)
+		}
+	}
+
+	c.session = session
+	c.syncDatagramLocked()
+	c.initialized = true
+	c.log.Debug("初始化完成", "command", proto.EMM_COMMAND_INIT, "sent_bytes", sentBytes, "recv_bytes", receivedBytes,
+		"aes", true, "suite", suite.String(), "sequenced", session.sequenced)
+	c.log.Log(context.Background(), LevelTrace, "会话密钥", "key", sensitive(session.key))
+	return sentBytes, receivedBytes, nil
+}
+
+// verifyTimestampFrame 解密应答中的网关时间戳并检查时间偏差
+func (c *TransferClient) verifyTimestampFrame(session *aesSession, msg *proto.UdpResponseMessage) error {
+	plain, err := session.open(msg)
+	if err != nil {
+		return err
+	}
+	timestamp, err := readTimestamp(plain)
+	if err != nil {
+		return err
+	}
+	return checkClockSkew(timestamp, c.config.MaxClockSkew)
+}
+
+// RotateSessionKey 立即轮换加密会话的密钥
+// 客户端用当前密钥发送EMM_COMMAND_KEY_UPDATE，携带新的请求ID和时间戳，双方据此派生新密钥；
+// 网关用新密钥加密应答，客户端校验通过后才切换，需要会话协商了EnableReplayProtection
+func (c *TransferClient) RotateSessionKey(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.rotateKeyLocked(ctx)
+}
+
+// maybeRotateKeyLocked 当前密钥超过KeyRotationInterval时轮换密钥，调用方需持有c.mu
+func (c *TransferClient) maybeRotateKeyLocked(ctx context.Context) error {
+	s := c.session
+	if s == nil || !s.sequenced || c.config.KeyRotationInterval <= 0 {
+		return nil
+	}
+	if time.Since(s.keyTime) < c.config.KeyRotationInterval {
+		return nil
+	}
+	return c.rotateKeyLocked(ctx)
+}
+
+// rotateKeyLocked 发送密钥轮换请求并切换到新密钥，调用方需持有c.mu
+func (c *TransferClient) rotateKeyLocked(ctx context.Context) error {
+	if c.session == nil {
+		return errSessionNotInitialized
+	}
+	if !c.session.sequenced {
+		return errors.New("加密会话未协商序号，不支持密钥轮换")
+	}
+	if err := c.ensureStreamLocked(ctx); err != nil {
+		return err
+	}
+
+	reqUUID, err := uuid.NewUUID()
+	if err != nil {
+		return fmt.Errorf("生成请求ID失败: %v", err)
+	}
+	now := time.Now()
+
+	body := utils.NewEmptyBuffer()
+	body.WriteString(reqUUID.String())
+	body.WriteByte(0)
+	body.WriteUint64(uint64(now.Unix()))
+
+	// 请求用旧密钥加密，序号连续
+	sealed, err := c.session.seal(body.Bytes())
+	if err != nil {
+		return fmt.Errorf("加密密钥轮换请求失败: %v", err)
+	}
+	frame, err := newTransferFrame(proto.EMM_COMMAND_KEY_UPDATE, uint8(proto.PROTO_TYPE_HTTP), c.session.option(), sealed)
+	if err != nil {
+		return err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		c.stream.SetDeadline(deadline)
+	} else {
+		c.stream.SetDeadline(now.Add(10 * time.Second))
+	}
+	defer func() {
+		if c.stream != nil {
+			c.stream.SetDeadline(time.Time{})
+		}
+	}()
+
+	if _, err := c.stream.Write(frame); err != nil {
+		c.resetStreamLocked()
+		return fmt.Errorf("发送密钥轮换请求失败: %v", err)
+	}
+	msg, err := readResponseFrame(c.stream)
+	if err != nil {
+		c.resetStreamLocked()
+		return fmt.Errorf("读取密钥轮换应答失败: %v", err)
+	}
+	if msg.Head.Command != proto.EMM_COMMAND_KEY_UPDATE_ACK {
+		c.resetStreamLocked()
+		return fmt.Errorf("收到非预期的响应命令: %d", msg.Head.Command)
+	}
+	c.metrics.GatewayResult(msg.Head.Command, msg.Head.Result)
+	if msg.Head.Result != proto.AUTH_STATUS_CODE_SUCCESS {
+		c.resetStreamLocked()
+		return fmt.Errorf("密钥轮换失败，错误码: %d", msg.Head.Result)
+	}
+
+	// 应答用新密钥加密，校验通过后再切换
+	next := *c.session
+	next.key = []byte(utils.NewKey(reqUUID.String(), now.Unix()))
+	next.keyTime = now
+	if err := c.verifyTimestampFrame(&next, msg); err != nil {
+		c.resetStreamLocked()
+		return fmt.Errorf("密钥轮换应答校验失败: %v", err)
+	}
+	*c.session = next
+	c.syncDatagramLocked()
+	c.log.Debug("会话密钥已轮换", "command", proto.EMM_COMMAND_KEY_UPDATE)
+	c.log.Log(ctx, LevelTrace, "会话密钥", "key", sensitive(next.key))
+	return nil
+}
@@ -0,0 +1,334 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/laotiannai/quic_gwclient/proto"
+	"github.com/laotiannai/quic_gwclient/utils"
+)
+
+func TestTransferClient_AESSession(t *testing.T) {
+	for _, suite := range []utils.CipherSuite{utils.CipherLegacyCBC, utils.CipherCBCPKCS7, utils.CipherGCM} {
+		t.Run(suite.String(), func(t *testing.T) {
+			testAESSession(t, suite)
+		})
+	}
+}
+
+func testAESSession(t *testing.T, suite utils.CipherSuite) {
+	g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: true})
+	c := g.newTestClient(t, &Config{EnableAES: true, CipherSuite: suite})
+
+	if _, err := c.SendTransferRequest("GET / HTTP/1.1\r\n\r\n"); err != errSessionNotInitialized {
+		t.Fatalf("Expected errSessionNotInitialized, got %v", err)
+	}
+
+	if _, _, err := c.SendInit(); err != nil {
+		t.Fatalf("SendInit failed: %v", err)
+	}
+
+	// 同一会话中的多个请求使用相同的会话密钥
+	for i := 0; i < 2; i++ {
+		body := strings.Repeat("encrypted", 4096)
+		req, _ := NewHTTPRequest("POST", "http://backend/echo", strings.NewReader(body))
+		payload, _ := req.Bytes()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		resp, _, _, err := c.SendTransferBytes(ctx, payload)
+		cancel()
+		if err != nil {
+			t.Fatalf("Request %d failed: %v", i, err)
+		}
+		if !bytes.HasSuffix(resp, []byte(body)) {
+			t.Errorf("Request %d response mismatch, got %d bytes", i, len(resp))
+		}
+	}
+
+	result, err := c.SendTransferRequestWithDownload("POST /echo HTTP/1.1\r\nHost: backend\r\nContent-Length: 5\r\n\r\nhello", nil)
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	if result.HTTPInfo == nil || string(result.HTTPInfo.Body) != "hello" {
+		t.Errorf("Unexpected download result: %+v", result.HTTPInfo)
+	}
+
+	for _, h := range g.receivedHeaders() {
+		if h.Option != uint8(suite) {
+			t.Errorf("Expected Option %d on command %d, got %d", suite, h.Command, h.Option)
+		}
+	}
+}
+
+func TestTransferClient_DownloadReconnectKeepsAES(t *testing.T) {
+	// 加密会话的连接断开后，下载请求重新连接时必须重新完成加密的INIT，不能以明文发送
+	g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: true})
+	c := g.newTestClient(t, &Config{CipherSuite: utils.CipherGCM})
+	if err := c.SendInitRequest(); err != nil {
+		t.Fatalf("SendInitRequest failed: %v", err)
+	}
+
+	c.mu.Lock()
+	c.conn.CloseWithError(0, "connection dropped")
+	c.mu.Unlock()
+
+	result, err := c.SendTransferRequestWithDownload("POST /echo HTTP/1.1\r\nHost: backend\r\nContent-Length: 5\r\n\r\nhello", nil)
+	if err != nil {
+		t.Fatalf("Download after reconnect failed: %v", err)
+	}
+	if result.HTTPInfo == nil || string(result.HTTPInfo.Body) != "hello" {
+		t.Errorf("Unexpected download result: %+v", result.HTTPInfo)
+	}
+
+	var inits int
+	var last *proto.TransferHeader
+	for _, h := range g.receivedHeaders() {
+		if h.Command == proto.EMM_COMMAND_INIT {
+			inits++
+		}
+		last = h
+	}
+	if inits != 2 {
+		t.Errorf("Expected 2 INIT requests, got %d", inits)
+	}
+	if last == nil || last.Command != proto.EMM_COMMAND_TRAN || last.Option&proto.OPTION_CIPHER_MASK != uint8(utils.CipherGCM) {
+		t.Errorf("Expected encrypted TRAN after reconnect, got %+v", last)
+	}
+}
+
+func TestTransferClient_DownloadEncryptedIncomplete(t *testing.T) {
+	// 已收到部分数据后出错时，下载必须失败，不能把被截断的响应当作完整结果保存
+	request := "POST /echo HTTP/1.1\r\nHost: backend\r\nContent-Length: 20480\r\n\r\n" + strings.Repeat("a", 20*1024)
+	tests := []struct {
+		name    string
+		opts    gatewayOptions
+		config  *Config
+		options *DownloadOptions
+		check   func(error) bool
+	}{
+		{"ReplayedFrame", gatewayOptions{aes: true, replayResponse: true}, &Config{CipherSuite: utils.CipherGCM, EnableReplayProtection: true}, DefaultDownloadOptions(),
+			func(err error) bool { return errors.Is(err, errFrameSequence) }},
+		{"Stall", gatewayOptions{aes: true, stall: 500 * time.Millisecond}, &Config{CipherSuite: utils.CipherGCM}, &DownloadOptions{ReadTimeout: 100 * time.Millisecond},
+			func(err error) bool { return errors.Is(err, os.ErrDeadlineExceeded) }},
+		{"MaxDownloadSize", gatewayOptions{aes: true}, &Config{CipherSuite: utils.CipherGCM}, &DownloadOptions{MaxDownloadSize: 1024},
+			func(err error) bool { return err != nil && strings.Contains(err.Error(), "下载大小超过限制") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGatewayWithOptions(t, echoHandler, tt.opts)
+			c := g.newTestClient(t, tt.config)
+			if err := c.SendInitRequest(); err != nil {
+				t.Fatalf("SendInitRequest failed: %v", err)
+			}
+
+			tt.options.SaveToFile = true
+			tt.options.SaveDir = t.TempDir()
+			result, err := c.SendTransferRequestWithDownload(request, tt.options)
+			if !tt.check(err) {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != nil {
+				t.Errorf("Expected no result, got %+v", result)
+			}
+			if files, _ := os.ReadDir(tt.options.SaveDir); len(files) != 0 {
+				t.Errorf("Expected no saved file, got %d", len(files))
+			}
+		})
+	}
+}
+
+func TestTransferClient_AESSuiteDowngrade(t *testing.T) {
+	// 旧版网关只确认CipherLegacyCBC，客户端不能静默降级
+	g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: true, legacyOnly: true})
+	c := g.newTestClient(t, &Config{EnableAES: true, CipherSuite: utils.CipherGCM})
+
+	if _, _, err := c.SendInit(); err == nil {
+		t.Fatal("Expected init to fail when gateway rejects the cipher suite")
+	}
+	if _, err := c.SendTransferRequest("GET / HTTP/1.1\r\n\r\n"); err != errSessionNotInitialized {
+		t.Errorf("Expected errSessionNotInitialized, got %v", err)
+	}
+}
+
+func TestTransferClient_AESInitRejected(t *testing.T) {
+	// 网关按加密会话处理，明文INIT无法解析
+	g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: true})
+	c := g.newTestClient(t, nil)
+
+	if _, _, err := c.SendInitRequestNoAES(); err == nil {
+		t.Fatal("Expected plain init to be rejected")
+	}
+}
+
+func TestTransferClient_KeyRotation(t *testing.T) {
+	for _, suite := range []utils.CipherSuite{utils.CipherCBCPKCS7, utils.CipherGCM} {
+		t.Run(suite.String(), func(t *testing.T) {
+			g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: true})
+			c := g.newTestClient(t, &Config{
+				EnableAES:              true,
+				CipherSuite:            suite,
+				EnableReplayProtection: true,
+				KeyRotationInterval:    time.Nanosecond, // 每次请求前都轮换
+			})
+			if _, _, err := c.SendInit(); err != nil {
+				t.Fatalf("SendInit failed: %v", err)
+			}
+
+			for i := 0; i < 3; i++ {
+				req, _ := NewHTTPRequest("POST", "http://backend/echo", strings.NewReader("rotate"))
+				payload, _ := req.Bytes()
+				resp, _, _, err := c.SendTransferBytes(context.Background(), payload)
+				if err != nil {
+					t.Fatalf("Request %d failed: %v", i, err)
+				}
+				if !bytes.HasSuffix(resp, []byte("rotate")) {
+					t.Errorf("Request %d response mismatch: %q", i, resp)
+				}
+			}
+			if err := c.RotateSessionKey(context.Background()); err != nil {
+				t.Fatalf("RotateSessionKey failed: %v", err)
+			}
+
+			updates := 0
+			for _, h := range g.receivedHeaders() {
+				if h.Command == proto.EMM_COMMAND_KEY_UPDATE {
+					updates++
+				}
+				if h.Option != uint8(suite)|proto.OPTION_SEQUENCED {
+					t.Errorf("Unexpected Option %#x on command %d", h.Option, h.Command)
+				}
+			}
+			if updates != 4 {
+				t.Errorf("Expected 4 key updates, got %d", updates)
+			}
+		})
+	}
+}
+
+func TestTransferClient_ReplayProtection(t *testing.T) {
+	config := func() *Config {
+		return &Config{EnableAES: true, CipherSuite: utils.CipherGCM, EnableReplayProtection: true}
+	}
+	req, _ := NewHTTPRequest("POST", "http://backend/echo", strings.NewReader("payload"))
+	payload, _ := req.Bytes()
+
+	t.Run("replayed response", func(t *testing.T) {
+		g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: true, replayResponse: true})
+		c := g.newTestClient(t, config())
+		if _, _, err := c.SendInit(); err != nil {
+			t.Fatalf("SendInit failed: %v", err)
+		}
+		_, _, _, err := c.SendTransferBytes(context.Background(), payload)
+		if err == nil || !strings.Contains(err.Error(), errFrameSequence.Error()) {
+			t.Errorf("Expected errFrameSequence, got %v", err)
+		}
+	})
+
+	t.Run("reordered request", func(t *testing.T) {
+		g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: true})
+		c := g.newTestClient(t, config())
+		if _, _, err := c.SendInit(); err != nil {
+			t.Fatalf("SendInit failed: %v", err)
+		}
+
+		// 跳过序号，网关应拒绝并关闭链路
+		c.session.sendSeq += 3
+		if _, _, _, err := c.SendTransferBytes(context.Background(), payload); err == nil {
+			t.Fatal("Expected gateway to reject out-of-order frame")
+		}
+
+		// 新流上序号重新开始，客户端可以继续使用
+		resp, _, _, err := c.SendTransferBytes(context.Background(), payload)
+		if err != nil {
+			t.Fatalf("Request after rejection failed: %v", err)
+		}
+		if !bytes.HasSuffix(resp, []byte("payload")) {
+			t.Errorf("Response mismatch: %q", resp)
+		}
+	})
+
+	t.Run("replayed init", func(t *testing.T) {
+		g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: true})
+		c := g.newTestClient(t, config())
+
+		reqUUID := uuid.New()
+		initBytes, err := c.transferInitByAES(1, proto.PROTO_TYPE_HTTP, "test-server", "si:test-session",
+			reqUUID, time.Now().Unix(), utils.InitKey, uint8(utils.CipherGCM)|proto.OPTION_SEQUENCED)
+		if err != nil {
+			t.Fatalf("transferInitByAES failed: %v", err)
+		}
+
+		results := make([]uint16, 0, 2)
+		for i := 0; i < 2; i++ {
+			stream, err := c.conn.OpenStreamSync(context.Background())
+			if err != nil {
+				t.Fatalf("OpenStreamSync failed: %v", err)
+			}
+			stream.Write(initBytes)
+			stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+			msg, err := readResponseFrame(stream)
+			if err != nil {
+				t.Fatalf("readResponseFrame failed: %v", err)
+			}
+			results = append(results, msg.Head.Result)
+			stream.Close()
+		}
+		if results[0] != proto.AUTH_STATUS_CODE_SUCCESS || results[1] == proto.AUTH_STATUS_CODE_SUCCESS {
+			t.Errorf("Expected replayed init to be rejected, got results %v", results)
+		}
+	})
+
+	t.Run("legacy suite", func(t *testing.T) {
+		g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: true})
+		c := g.newTestClient(t, &Config{EnableAES: true, EnableReplayProtection: true})
+		if _, _, err := c.SendInit(); err == nil {
+			t.Error("Expected replay protection to require a non-legacy suite")
+		}
+	})
+
+	t.Run("gateway without sequence support", func(t *testing.T) {
+		g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: true, noSequence: true})
+		c := g.newTestClient(t, config())
+		if _, _, err := c.SendInit(); err == nil {
+			t.Error("Expected init to fail when gateway drops OPTION_SEQUENCED")
+		}
+	})
+}
+
+func TestTransferClient_ClockSkew(t *testing.T) {
+	config := &Config{EnableAES: true, CipherSuite: utils.CipherCBCPKCS7, EnableReplayProtection: true}
+
+	t.Run("rejected by gateway", func(t *testing.T) {
+		g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: true, clockOffset: 10 * time.Minute})
+		c := g.newTestClient(t, &Config{EnableAES: true, CipherSuite: utils.CipherCBCPKCS7, EnableReplayProtection: true, MaxClockSkew: time.Hour})
+		if _, _, err := c.SendInit(); err == nil {
+			t.Error("Expected gateway to reject stale timestamp")
+		}
+	})
+
+	t.Run("rejected by client", func(t *testing.T) {
+		g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: true, clockOffset: 10 * time.Minute, maxSkew: time.Hour})
+		cfg := *config
+		cfg.MaxClockSkew = time.Minute
+		c := g.newTestClient(t, &cfg)
+		_, _, err := c.SendInit()
+		if err == nil || !strings.Contains(err.Error(), "时间偏差") {
+			t.Errorf("Expected clock skew error, got %v", err)
+		}
+	})
+
+	t.Run("within window", func(t *testing.T) {
+		g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: true, clockOffset: 30 * time.Second})
+		cfg := *config
+		c := g.newTestClient(t, &cfg)
+		if _, _, err := c.SendInit(); err != nil {
+			t.Errorf("SendInit failed: %v", err)
+		}
+	})
+}
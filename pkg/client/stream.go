@@ -0,0 +1,265 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/proto"
+	"github.com/quic-go/quic-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TransferResponse 流式传输响应，按帧读取网关返回的数据体
+// 在Close之前客户端处于占用状态，同一客户端上的其他请求会等待
+type TransferResponse struct {
+	c       *TransferClient
+	ctx     context.Context
+	stream  quic.Stream
+	stop    func() bool
+	session *aesSession // 加密会话，nil表示不加密
+	raw     io.Writer   // 可选，记录收到的原始帧
+	start   time.Time
+	span    trace.Span
+
+	pending     []byte // 当前帧尚未读取的数据
+	frames      int
+	sentBytes   int64
+	recvBytes   int64
+	idleTimeout time.Duration
+	err         error
+	reusable    bool // 响应以LINK_CLOSE结束，流可以继续复用
+	closed      bool
+}
+
+// SendTransferStream 将body按帧流式发送给网关，并返回可流式读取的响应
+// body会被切分为多个EMM_COMMAND_TRAN帧，数据按字节原样发送，不做任何转义
+// 已通过SendInitRequest建立加密会话时，请求帧和响应帧使用会话密钥加解密
+func (c *TransferClient) SendTransferStream(ctx context.Context, body io.Reader) (*TransferResponse, error) {
+	return c.SendTransferUpload(ctx, body, nil)
+}
+
+// SendTransferBytes 发送二进制请求并读取完整响应体
+// 返回响应数据、发送字节数、接收字节数以及可能的错误
+func (c *TransferClient) SendTransferBytes(ctx context.Context, payload []byte) ([]byte, int, int, error) {
+	resp, err := c.SendTransferStream(ctx, bytes.NewReader(payload))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer resp.Close()
+
+	data, err := io.ReadAll(resp)
+	if err != nil {
+		return data, int(resp.SentBytes()), int(resp.ReceivedBytes()), fmt.Errorf("读取响应失败: %v", err)
+	}
+	return data, int(resp.SentBytes()), int(resp.ReceivedBytes()), nil
+}
+
+// startTransferLocked 发送请求帧并构造响应读取器，调用方需持有c.mu
+func (c *TransferClient) startTransferLocked(ctx context.Context, body io.Reader, opts *UploadOptions) (_ *TransferResponse, err error) {
+	start := time.Now()
+	ctx, span := c.startSpan(ctx, spanTransfer, attrAES.Bool(c.session != nil))
+	defer func() {
+		if err != nil {
+			c.metrics.TransferDone(time.Since(start), 0, 0, err)
+			endSpan(span, err)
+		}
+	}()
+
+	if c.conn == nil {
+		return nil, fmt.Errorf("连接未建立")
+	}
+	if c.conn.Context().Err() != nil {
+		return nil, fmt.Errorf("连接已关闭: %v", context.Cause(c.conn.Context()))
+	}
+
+	if err := c.maybeRotateKeyLocked(ctx); err != nil {
+		return nil, err
+	}
+	if err := c.ensureStreamLocked(ctx); err != nil {
+		return nil, err
+	}
+	stream := c.stream
+	span.SetAttributes(attrStreamID.Int64(int64(stream.StreamID())))
+
+	// ctx取消时立即中断流上的读写，网关会收到流重置
+	stop := context.AfterFunc(ctx, func() {
+		stream.CancelWrite(0)
+		stream.CancelRead(0)
+	})
+
+	resp := &TransferResponse{
+		c:           c,
+		ctx:         ctx,
+		stream:      stream,
+		stop:        stop,
+		session:     c.session,
+		idleTimeout: c.config.ResponseIdleTimeout,
+		start:       start,
+		span:        span,
+	}
+
+	n, err := writeTransferFrames(ctx, stream, c.injectTraceReader(ctx, body), opts, c.session)
+	resp.sentBytes = n
+	if err != nil {
+		stop()
+		c.resetStreamLocked()
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		span.SetAttributes(attrSentBytes.Int64(n))
+		return nil, fmt.Errorf("发送请求失败: %v", err)
+	}
+	c.metrics.StreamActive(1)
+	c.log.Debug("已发送请求", "stream_id", stream.StreamID(), "command", proto.EMM_COMMAND_TRAN, "bytes", n)
+
+	return resp, nil
+}
+
+// Read 读取响应数据体，网关关闭流或发送EMM_COMMAND_LINK_CLOSE时返回io.EOF
+func (r *TransferResponse) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.nextFrame()
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// nextFrame 读取下一个响应帧
+func (r *TransferResponse) nextFrame() error {
+	r.stream.SetReadDeadline(time.Now().Add(r.idleTimeout))
+
+	msg, err := readResponseFrame(r.stream)
+	if err != nil {
+		if r.ctx.Err() != nil {
+			return r.ctx.Err()
+		}
+		if err == io.EOF {
+			return io.EOF
+		}
+		// 长时间没有新帧时网关可能仍在发送，流上可能残留半个帧或迟到的响应，不再复用
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return fmt.Errorf("等待响应帧超时（%v）: %w", r.idleTimeout, err)
+		}
+		return err
+	}
+
+	r.frames++
+	r.recvBytes += int64(msg.Head.Len() + len(msg.Body))
+	r.c.log.Log(r.ctx, LevelTrace, "收到响应帧", "stream_id", r.stream.StreamID(), "command", msg.Head.Command,
+		"bytes", len(msg.Body), "payload", sensitive(msg.Body))
+	if r.raw != nil {
+		data, _ := msg.Marshal()
+		r.raw.Write(data)
+	}
+
+	if msg.Head.Command == proto.EMM_COMMAND_LINK_CLOSE {
+		// 网关因请求非法（如帧序号错误）关闭链路时会携带错误码
+		if msg.Head.Result != 0 && msg.Head.Result != proto.AUTH_STATUS_CODE_SUCCESS {
+			r.c.metrics.GatewayResult(msg.Head.Command, msg.Head.Result)
+			return &GatewayError{Result: msg.Head.Result}
+		}
+		r.reusable = true
+		return io.EOF
+	}
+
+	if r.session != nil {
+		plain, err := r.session.open(msg)
+		if err != nil {
+			return err
+		}
+		r.pending = plain
+		return nil
+	}
+	r.pending = msg.Body
+	return nil
+}
+
+// GatewayError 网关以错误码拒绝INIT或关闭链路，如后端不可达时返回AUTH_STATUS_CODE_ERR_CONN_FAILED
+type GatewayError struct {
+	Command uint16 // 携带错误码的应答命令，为0时表示EMM_COMMAND_LINK_CLOSE
+	Result  uint16
+}
+
+func (e *GatewayError) Error() string {
+	if e.Command == proto.EMM_COMMAND_INIT_ACK {
+		return fmt.Sprintf("初始化失败，错误码: %d", e.Result)
+	}
+	return fmt.Sprintf("网关关闭链路，错误码: %d", e.Result)
+}
+
+// SentBytes 返回发送的字节数（含包头）
+func (r *TransferResponse) SentBytes() int64 {
+	return r.sentBytes
+}
+
+// ReceivedBytes 返回已接收的字节数（含包头）
+func (r *TransferResponse) ReceivedBytes() int64 {
+	return r.recvBytes
+}
+
+// Close 结束本次传输并释放客户端
+func (r *TransferResponse) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.finishLocked()
+	r.c.mu.Unlock()
+	return nil
+}
+
+// finishLocked 结束本次传输但不释放c.mu，供已持有锁的调用方使用
+func (r *TransferResponse) finishLocked() {
+	r.closed = true
+	err := r.err
+	if err == io.EOF {
+		err = nil
+	}
+	r.c.metrics.StreamActive(-1)
+	r.c.metrics.TransferDone(time.Since(r.start), r.sentBytes, r.recvBytes, err)
+	r.span.SetAttributes(attrSentBytes.Int64(r.sentBytes), attrReceivedBytes.Int64(r.recvBytes), attrFrames.Int(r.frames))
+	endSpan(r.span, err)
+
+	r.stop()
+	if r.reusable && r.ctx.Err() == nil {
+		r.stream.SetDeadline(time.Time{})
+	} else {
+		// 流已被网关关闭或残留未读完的数据，丢弃该流
+		r.c.resetStreamLocked()
+	}
+}
+
+// ensureStreamLocked 当前没有可用的流时新建一个，调用方需持有c.mu
+func (c *TransferClient) ensureStreamLocked(ctx context.Context) error {
+	if c.stream != nil {
+		return nil
+	}
+	stream, err := c.conn.OpenStreamSync(ctx)
+	if err != nil {
+		return fmt.Errorf("无法创建流: %v", err)
+	}
+	c.stream = stream
+	// 帧序号按流计算
+	if c.session != nil {
+		c.session.resetSequence()
+	}
+	return nil
+}
+
+// resetStreamLocked 关闭当前流，下次请求时重新创建，调用方需持有c.mu
+func (c *TransferClient) resetStreamLocked() {
+	if c.stream != nil {
+		c.stream.Close()
+		c.stream = nil
+	}
+}
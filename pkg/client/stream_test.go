@@ -0,0 +1,226 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/proto"
+)
+
+// echoHandler 将请求体原样返回
+var echoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	io.Copy(w, r.Body)
+})
+
+func TestTransferClient_SendTransferBytes(t *testing.T) {
+	g := newTestGateway(t, echoHandler)
+	c := g.newTestClient(t, nil)
+
+	if _, _, err := c.SendInitRequestNoAES(); err != nil {
+		t.Fatalf("SendInitRequestNoAES failed: %v", err)
+	}
+
+	// 包含字面量\r\n和任意二进制数据的请求体
+	body := append([]byte("\\r\\n"), 0x00, 0xff, 0x0d, 0x0a)
+	req, _ := NewHTTPRequest("POST", "http://backend/echo", bytes.NewReader(body))
+	payload, err := req.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, sent, received, err := c.SendTransferBytes(ctx, payload)
+	if err != nil {
+		t.Fatalf("SendTransferBytes failed: %v", err)
+	}
+	if !bytes.HasSuffix(resp, body) {
+		t.Errorf("Response body mismatch: %q", resp)
+	}
+	if sent != len(payload)+proto.REQUEST_HEAD_LEN {
+		t.Errorf("Expected %d sent bytes, got %d", len(payload)+proto.REQUEST_HEAD_LEN, sent)
+	}
+	if received <= len(resp) {
+		t.Errorf("Expected received bytes to include frame headers, got %d", received)
+	}
+}
+
+func TestTransferClient_SendTransferStreamMultiFrame(t *testing.T) {
+	g := newTestGateway(t, echoHandler)
+	c := g.newTestClient(t, nil)
+
+	if _, _, err := c.SendInitRequestNoAES(); err != nil {
+		t.Fatalf("SendInitRequestNoAES failed: %v", err)
+	}
+
+	body := bytes.Repeat([]byte{0x01, 0x02, 0x03, 0x00}, 50*1024)
+	req, _ := NewHTTPRequest("PUT", "http://backend/upload", bytes.NewReader(body))
+	payload, _ := req.Bytes()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := c.SendTransferStream(ctx, bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("SendTransferStream failed: %v", err)
+	}
+	data, err := io.ReadAll(resp)
+	resp.Close()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if !bytes.HasSuffix(data, body) {
+		t.Errorf("Response body mismatch, got %d bytes", len(data))
+	}
+
+	frames := 0
+	for _, h := range g.receivedHeaders() {
+		if h.Command == proto.EMM_COMMAND_TRAN {
+			frames++
+			if h.DataLen > DefaultTransferFrameSize {
+				t.Errorf("Frame too large: %d", h.DataLen)
+			}
+		}
+	}
+	expected := (len(payload) + DefaultTransferFrameSize - 1) / DefaultTransferFrameSize
+	if frames != expected {
+		t.Errorf("Expected %d TRAN frames, got %d", expected, frames)
+	}
+
+	// 同一客户端可以继续发送请求
+	again, _, _, err := c.SendTransferBytes(ctx, payload)
+	if err != nil {
+		t.Fatalf("Second request failed: %v", err)
+	}
+	if !bytes.HasSuffix(again, body) {
+		t.Errorf("Second response body mismatch, got %d bytes", len(again))
+	}
+}
+
+func TestTransferClient_ResponseIdleTimeout(t *testing.T) {
+	g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{stall: 500 * time.Millisecond})
+	c := g.newTestClient(t, &Config{ResponseIdleTimeout: 100 * time.Millisecond})
+
+	if _, _, err := c.SendInitRequestNoAES(); err != nil {
+		t.Fatalf("SendInitRequestNoAES failed: %v", err)
+	}
+
+	// 响应超过一个TRAN_ACK帧，网关发送第一个帧后停顿
+	body := bytes.Repeat([]byte("a"), 20*1024)
+	req, _ := NewHTTPRequest("POST", "http://backend/echo", bytes.NewReader(body))
+	payload, _ := req.Bytes()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := c.SendTransferStream(ctx, bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("SendTransferStream failed: %v", err)
+	}
+	_, err = io.ReadAll(resp)
+	resp.Close()
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Expected idle timeout, got %v", err)
+	}
+
+	// 超时的流已丢弃，下一个请求不会读到上一个响应迟到的帧
+	time.Sleep(500 * time.Millisecond)
+	body = []byte("next")
+	req, _ = NewHTTPRequest("POST", "http://backend/echo", bytes.NewReader(body))
+	payload, _ = req.Bytes()
+	c.config.ResponseIdleTimeout = time.Second
+	again, _, _, err := c.SendTransferBytes(ctx, payload)
+	if err != nil {
+		t.Fatalf("Second request failed: %v", err)
+	}
+	if !bytes.HasSuffix(again, body) {
+		t.Errorf("Second response body mismatch: %q", again)
+	}
+}
+
+func TestTransferClient_SendTransferUpload(t *testing.T) {
+	g := newTestGateway(t, echoHandler)
+	c := g.newTestClient(t, nil)
+
+	if _, _, err := c.SendInitRequestNoAES(); err != nil {
+		t.Fatalf("SendInitRequestNoAES failed: %v", err)
+	}
+
+	body := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	req, _ := NewHTTPRequest("POST", "http://backend/upload", bytes.NewReader(body))
+	reader, total, err := req.Reader()
+	if err != nil {
+		t.Fatalf("Reader failed: %v", err)
+	}
+
+	var lastSent int64
+	var calls int
+	opts := DefaultUploadOptions()
+	opts.FrameSize = 8 * 1024
+	opts.TotalSize = total
+	opts.Progress = func(sent, total int64) {
+		calls++
+		if sent < lastSent || sent > total {
+			t.Errorf("Unexpected progress %d/%d", sent, total)
+		}
+		lastSent = sent
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := c.SendTransferUpload(ctx, reader, opts)
+	if err != nil {
+		t.Fatalf("SendTransferUpload failed: %v", err)
+	}
+	data, err := io.ReadAll(resp)
+	resp.Close()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if !bytes.HasSuffix(data, body) {
+		t.Errorf("Response body mismatch, got %d bytes", len(data))
+	}
+	if lastSent != total {
+		t.Errorf("Expected final progress %d, got %d", total, lastSent)
+	}
+	if expected := int((total + 8*1024 - 1) / (8 * 1024)); calls != expected {
+		t.Errorf("Expected %d progress callbacks, got %d", expected, calls)
+	}
+}
+
+func TestTransferClient_SendTransferUploadCancel(t *testing.T) {
+	g := newTestGateway(t, echoHandler)
+	c := g.newTestClient(t, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := DefaultUploadOptions()
+	opts.FrameSize = 1024
+	opts.MaxBytesPerSecond = 64 * 1024
+	opts.Progress = func(sent, total int64) {
+		if sent >= 4*1024 {
+			cancel()
+		}
+	}
+
+	_, err := c.SendTransferUpload(ctx, bytes.NewReader(make([]byte, 1024*1024)), opts)
+	if err == nil {
+		t.Fatal("Expected upload to be cancelled")
+	}
+
+	// 取消后客户端仍可继续使用
+	if _, _, err := c.SendInitRequestNoAES(); err != nil {
+		t.Errorf("Client unusable after cancel: %v", err)
+	}
+}
+
+func TestUploadOptions_Validate(t *testing.T) {
+	opts := &UploadOptions{FrameSize: MaxTransferFrameSize + 1}
+	if err := opts.validate(); err == nil {
+		t.Error("Expected error for oversized frame")
+	}
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// defaultNextProtos 默认提供的ALPN协议列表
+var defaultNextProtos = []string{
+	"hq-interop",
+	"h3-25",
+	"h3-24",
+	"h3-23",
+	"hq-29",
+	"hq-28",
+	"hq-27",
+	"http/0.9",
+}
+
+var errSPKIPinMismatch = errors.New("网关证书公钥与固定的SPKI指纹不匹配")
+
+// SPKIPin 计算证书公钥的SPKI指纹（SubjectPublicKeyInfo的SHA-256摘要，base64编码），可用于Config.SPKIPins
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// newTLSConfig 根据Config生成连接网关使用的TLS配置，host为连接地址中的主机名
+// 默认校验网关证书，只有显式设置InsecureSkipVerify时才跳过
+func (c *TransferClient) newTLSConfig(host string) (*tls.Config, error) {
+	cfg := c.config
+
+	tlsConf := &tls.Config{
+		NextProtos:         append([]string(nil), defaultNextProtos...),
+		ServerName:         host,
+		RootCAs:            cfg.RootCAs,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS13,
+		MaxVersion:         tls.VersionTLS13,
+	}
+	if cfg.TLSServerName != "" {
+		tlsConf.ServerName = cfg.TLSServerName
+	}
+	if cfg.TLSMinVersion != 0 {
+		if cfg.TLSMinVersion > tls.VersionTLS13 {
+			return nil, fmt.Errorf("不支持的TLS最低版本: %#x", cfg.TLSMinVersion)
+		}
+		tlsConf.MinVersion = cfg.TLSMinVersion
+	}
+
+	if cfg.RootCAFile != "" {
+		pem, err := os.ReadFile(cfg.RootCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取根证书失败: %v", err)
+		}
+		pool := cfg.RootCAs
+		if pool == nil {
+			pool = x509.NewCertPool()
+		} else {
+			pool = pool.Clone()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("根证书文件中没有有效的PEM证书: %s", cfg.RootCAFile)
+		}
+		tlsConf.RootCAs = pool
+	}
+
+	switch {
+	case cfg.ClientCertificate != nil:
+		tlsConf.Certificates = []tls.Certificate{*cfg.ClientCertificate}
+	case cfg.ClientCertFile != "" || cfg.ClientKeyFile != "":
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败: %v", err)
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+
+	pins, err := decodeSPKIPins(cfg.SPKIPins)
+	if err != nil {
+		return nil, err
+	}
+	if len(pins) > 0 || cfg.VerifyConnection != nil {
+		hook := cfg.VerifyConnection
+		tlsConf.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(pins) > 0 {
+				if err := verifySPKIPins(cs, pins); err != nil {
+					return err
+				}
+			}
+			if hook != nil {
+				return hook(cs)
+			}
+			return nil
+		}
+	}
+
+	keyLog, err := c.keyLogWriterLocked()
+	if err != nil {
+		return nil, err
+	}
+	tlsConf.KeyLogWriter = keyLog
+
+	return tlsConf, nil
+}
+
+// decodeSPKIPins 解码base64编码的SPKI指纹
+func decodeSPKIPins(pins []string) ([][]byte, error) {
+	decoded := make([][]byte, 0, len(pins))
+	for _, pin := range pins {
+		sum, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("无效的SPKI指纹: %q", pin)
+		}
+		decoded = append(decoded, sum)
+	}
+	return decoded, nil
+}
+
+// verifySPKIPins 检查证书链中是否有公钥匹配固定的指纹
+// 证书校验开启时检查已验证的证书链，跳过校验时只检查网关的叶子证书
+func verifySPKIPins(cs tls.ConnectionState, pins [][]byte) error {
+	var certs []*x509.Certificate
+	for _, chain := range cs.VerifiedChains {
+		certs = append(certs, chain...)
+	}
+	if len(cs.VerifiedChains) == 0 && len(cs.PeerCertificates) > 0 {
+		certs = cs.PeerCertificates[:1]
+	}
+
+	for _, cert := range certs {
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		for _, pin := range pins {
+			if subtle.ConstantTimeCompare(sum[:], pin) == 1 {
+				return nil
+			}
+		}
+	}
+	return errSPKIPinMismatch
+}
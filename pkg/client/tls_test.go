@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tryConnect 使用config连接测试网关，返回连接错误
+func (g *testGateway) tryConnect(t *testing.T, config *Config) error {
+	t.Helper()
+
+	config.ServerID, config.ServerName, config.SessionID = 1, "test-server", "test-session"
+	c := NewTransferClient(g.addr, config)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := c.Connect(ctx)
+	c.Close()
+	return err
+}
+
+func TestTransferClient_TLSVerification(t *testing.T) {
+	g := newTestGateway(t, echoHandler)
+	pool := x509.NewCertPool()
+	pool.AddCert(g.cert)
+
+	// 默认校验证书，自签名网关无法通过系统根证书校验
+	if err := g.tryConnect(t, &Config{}); err == nil {
+		t.Error("Expected verification failure without RootCAs")
+	}
+	if err := g.tryConnect(t, &Config{InsecureSkipVerify: true}); err != nil {
+		t.Errorf("Insecure connect failed: %v", err)
+	}
+	if err := g.tryConnect(t, &Config{RootCAs: pool}); err != nil {
+		t.Errorf("Connect with RootCAs failed: %v", err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: g.cert.Raw}), 0600)
+	if err := g.tryConnect(t, &Config{RootCAFile: caFile}); err != nil {
+		t.Errorf("Connect with RootCAFile failed: %v", err)
+	}
+	if err := g.tryConnect(t, &Config{RootCAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Error("Expected error for missing RootCAFile")
+	}
+}
+
+func TestTransferClient_TLSServerName(t *testing.T) {
+	g := newTestGateway(t, echoHandler)
+	pool := x509.NewCertPool()
+	pool.AddCert(g.cert)
+
+	var sni string
+	config := &Config{
+		RootCAs:       pool,
+		TLSServerName: "test-gateway",
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			sni = cs.ServerName
+			return nil
+		},
+	}
+	if err := g.tryConnect(t, config); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if sni != "test-gateway" {
+		t.Errorf("Expected SNI test-gateway, got %q", sni)
+	}
+
+	if err := g.tryConnect(t, &Config{RootCAs: pool, TLSServerName: "other.example"}); err == nil {
+		t.Error("Expected verification failure for mismatched server name")
+	}
+
+	hookErr := errors.New("rejected by hook")
+	err := g.tryConnect(t, &Config{RootCAs: pool, VerifyConnection: func(tls.ConnectionState) error { return hookErr }})
+	if err == nil || !strings.Contains(err.Error(), hookErr.Error()) {
+		t.Errorf("Expected hook error, got %v", err)
+	}
+}
+
+func TestTransferClient_SPKIPins(t *testing.T) {
+	g := newTestGateway(t, echoHandler)
+	_, other := newTestCertificate(t)
+
+	if err := g.tryConnect(t, &Config{InsecureSkipVerify: true, SPKIPins: []string{SPKIPin(other), SPKIPin(g.cert)}}); err != nil {
+		t.Errorf("Connect with matching pin failed: %v", err)
+	}
+
+	// 跳过证书校验时SPKI固定仍然生效
+	err := g.tryConnect(t, &Config{InsecureSkipVerify: true, SPKIPins: []string{SPKIPin(other)}})
+	if err == nil || !strings.Contains(err.Error(), errSPKIPinMismatch.Error()) {
+		t.Errorf("Expected pin mismatch, got %v", err)
+	}
+
+	if err := g.tryConnect(t, &Config{InsecureSkipVerify: true, SPKIPins: []string{"not-base64"}}); err == nil {
+		t.Error("Expected error for invalid pin")
+	}
+}
+
+func TestTransferClient_ClientCertificate(t *testing.T) {
+	clientCert, clientLeaf := newTestCertificate(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientLeaf)
+
+	g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{clientCAs: clientCAs})
+
+	// 网关要求客户端证书，没有证书时握手或首次请求失败
+	c := NewTransferClient(g.addr, &Config{ServerID: 1, ServerName: "test-server", SessionID: "test-session", InsecureSkipVerify: true, MaxRetries: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Connect(ctx); err == nil {
+		if _, _, err := c.SendInitRequestNoAES(); err == nil {
+			t.Error("Expected gateway to reject client without certificate")
+		}
+	}
+	c.Close()
+
+	withCert := g.newTestClient(t, &Config{ClientCertificate: &clientCert})
+	if _, _, err := withCert.SendInitRequestNoAES(); err != nil {
+		t.Errorf("SendInitRequestNoAES with client certificate failed: %v", err)
+	}
+}
+
+func TestSendQuicRequestWithIPSInfo(t *testing.T) {
+	g := newTestGateway(t, echoHandler)
+	host, port, _ := net.SplitHostPort(g.addr)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: g.cert.Raw}), 0600)
+	info := &IPSServerInfo{
+		ServerID:       1,
+		ServerName:     "test-server",
+		SessionID:      "test-session",
+		ResponseAssert: "ips",
+		MessageContent: `POST /echo HTTP/1.1\r\nHost: backend\r\nContent-Length: 3\r\n\r\nips`,
+	}
+
+	opts := DefaultRequestOptions()
+	opts.ServerIP, opts.ServerPort = host, port
+	opts.ConnectTimeout, opts.ReadTimeout, opts.MaxRetries = 5*time.Second, 5*time.Second, 1
+	opts.RootCAFile = caFile
+	opts.SPKIPins = []string{SPKIPin(g.cert)}
+	result := SendQuicRequestWithIPSInfo(opts, info)
+	if result.Error != nil || !result.AssertionResult {
+		t.Fatalf("Request failed: %v, response %q", result.Error, result.Response)
+	}
+	if opts.ServerID != 0 || opts.MessageContent != "" {
+		t.Errorf("Options modified: %+v", opts)
+	}
+
+	// SPKI固定不匹配时拒绝连接
+	_, other := newTestCertificate(t)
+	opts.SPKIPins = []string{SPKIPin(other)}
+	if result := SendQuicRequestWithIPSInfo(opts, info); result.Error == nil {
+		t.Error("Expected pin mismatch")
+	}
+}
@@ -0,0 +1,164 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sort"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName 客户端创建span使用的instrumentation名称
+const tracerName = "github.com/laotiannai/quic_gwclient/pkg/client"
+
+// span名称
+const (
+	spanConnect       = "quic_gwclient.connect"
+	spanALPNAttempt   = "quic_gwclient.alpn_attempt"
+	spanInit          = "quic_gwclient.init"
+	spanTransfer      = "quic_gwclient.transfer"
+	spanDownload      = "quic_gwclient.download"
+	spanDownloadRetry = "quic_gwclient.download_retry"
+)
+
+// span属性
+const (
+	attrServerAddr     = attribute.Key("server.address")
+	attrServerID       = attribute.Key("quic_gwclient.server_id")
+	attrServerName     = attribute.Key("quic_gwclient.server_name")
+	attrALPN           = attribute.Key("quic_gwclient.alpn")
+	attrALPNCandidates = attribute.Key("quic_gwclient.alpn_candidates")
+	attrAttempts       = attribute.Key("quic_gwclient.attempts")
+	attrRemoteAddr     = attribute.Key("network.peer.address")
+	attrAES            = attribute.Key("quic_gwclient.aes")
+	attr0RTT           = attribute.Key("quic_gwclient.0rtt")
+	attrResultCode     = attribute.Key("quic_gwclient.result_code")
+	attrSentBytes      = attribute.Key("quic_gwclient.sent_bytes")
+	attrReceivedBytes  = attribute.Key("quic_gwclient.received_bytes")
+	attrFrames         = attribute.Key("quic_gwclient.frames")
+	attrRetry          = attribute.Key("quic_gwclient.retry")
+	attrStreamID       = attribute.Key("quic_gwclient.stream_id")
+)
+
+// maxTracePeek 在流式请求中查找HTTP请求行时最多预读的字节数
+const maxTracePeek = 4096
+
+// newTracer 创建客户端使用的Tracer，Config.TracerProvider为nil时使用otel的全局TracerProvider
+func newTracer(config *Config) trace.Tracer {
+	tp := config.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// propagator 返回注入链路上下文使用的格式，默认W3C Trace Context
+func (c *TransferClient) propagator() propagation.TextMapPropagator {
+	if c.config.Propagator != nil {
+		return c.config.Propagator
+	}
+	return propagation.TraceContext{}
+}
+
+// startSpan 创建span并附加网关地址、ServerID和ServerName
+func (c *TransferClient) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs,
+		attrServerAddr.String(c.serverAddr),
+		attrServerID.Int(c.config.ServerID),
+		attrServerName.String(c.config.ServerName),
+	)
+	return c.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endSpan 记录错误并结束span，网关以错误码关闭链路时同时记录结果码
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		var gwErr *GatewayError
+		if errors.As(err, &gwErr) {
+			span.SetAttributes(attrResultCode.Int(int(gwErr.Result)))
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceHeaders 将ctx中的链路上下文编码为HTTP头部，ctx中没有有效的span时返回nil
+func (c *TransferClient) traceHeaders(ctx context.Context) []byte {
+	carrier := propagation.MapCarrier{}
+	c.propagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	keys := carrier.Keys()
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	for _, key := range keys {
+		buf.WriteString(key)
+		buf.WriteString(": ")
+		buf.WriteString(carrier.Get(key))
+		buf.WriteString("\r\n")
+	}
+	return buf.Bytes()
+}
+
+// traceInsertPos 返回在HTTP请求中插入链路上下文头部的位置，即请求行之后
+// head不是HTTP请求或已经携带traceparent头部时返回-1
+func traceInsertPos(head []byte) int {
+	end := bytes.Index(head, []byte("\r\n"))
+	if end < 0 {
+		return -1
+	}
+	parts := bytes.Split(head[:end], []byte(" "))
+	if len(parts) != 3 || !validMethod(string(parts[0])) || !bytes.HasPrefix(parts[2], []byte("HTTP/1.")) {
+		return -1
+	}
+	headers := head[end:]
+	if i := bytes.Index(headers, []byte("\r\n\r\n")); i >= 0 {
+		headers = headers[:i]
+	}
+	if bytes.Contains(bytes.ToLower(headers), []byte("\r\ntraceparent:")) {
+		return -1
+	}
+	return end + 2
+}
+
+// injectTraceContext payload为HTTP请求时，在请求行之后插入ctx中的链路上下文头部
+func (c *TransferClient) injectTraceContext(ctx context.Context, payload []byte) []byte {
+	headers := c.traceHeaders(ctx)
+	if headers == nil {
+		return payload
+	}
+	at := traceInsertPos(payload)
+	if at < 0 {
+		return payload
+	}
+	out := make([]byte, 0, len(payload)+len(headers))
+	out = append(out, payload[:at]...)
+	out = append(out, headers...)
+	return append(out, payload[at:]...)
+}
+
+// injectTraceReader 与injectTraceContext相同，用于流式请求，最多预读maxTracePeek字节查找请求行
+func (c *TransferClient) injectTraceReader(ctx context.Context, body io.Reader) io.Reader {
+	headers := c.traceHeaders(ctx)
+	if headers == nil {
+		return body
+	}
+	br := bufio.NewReaderSize(body, maxTracePeek)
+	head, _ := br.Peek(maxTracePeek)
+	at := traceInsertPos(head)
+	if at < 0 {
+		return br
+	}
+	line := make([]byte, at)
+	io.ReadFull(br, line)
+	return io.MultiReader(bytes.NewReader(line), bytes.NewReader(headers), br)
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// traceparentHandler 返回请求中的traceparent头部
+var traceparentHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("traceparent=" + r.Header.Get("Traceparent")))
+})
+
+// findSpan 返回名称为name的最后一个span
+func findSpan(t *testing.T, spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	for i := len(spans) - 1; i >= 0; i-- {
+		if spans[i].Name() == name {
+			return spans[i]
+		}
+	}
+	t.Fatalf("Span %s not found", name)
+	return nil
+}
+
+// spanAttr 返回span的属性值
+func spanAttr(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracing_Spans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	g := newTestGatewayWithOptions(t, traceparentHandler, gatewayOptions{aes: true})
+	c := g.newTestClient(t, &Config{EnableAES: true, TracerProvider: tp})
+	if _, _, err := c.SendInit(); err != nil {
+		t.Fatalf("SendInit failed: %v", err)
+	}
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	resp, _, _, err := c.SendTransferBytes(ctx, []byte("GET /trace HTTP/1.1\r\nHost: backend\r\n\r\n"))
+	parent.End()
+	if err != nil {
+		t.Fatalf("SendTransferBytes failed: %v", err)
+	}
+
+	spans := recorder.Ended()
+	connect := findSpan(t, spans, spanConnect)
+	attempt := findSpan(t, spans, spanALPNAttempt)
+	if attempt.Parent().SpanID() != connect.SpanContext().SpanID() {
+		t.Error("Expected ALPN attempt to be a child of connect")
+	}
+	if spanAttr(connect, attrALPN).AsString() == "" || spanAttr(connect, attrServerID).AsInt64() != 1 {
+		t.Errorf("Unexpected connect attributes: %v", connect.Attributes())
+	}
+
+	init := findSpan(t, spans, spanInit)
+	if spanAttr(init, attrResultCode).AsInt64() != 8002 || !spanAttr(init, attrAES).AsBool() {
+		t.Errorf("Unexpected init attributes: %v", init.Attributes())
+	}
+
+	transfer := findSpan(t, spans, spanTransfer)
+	if transfer.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("Expected transfer to be a child of the caller's span")
+	}
+	if spanAttr(transfer, attrSentBytes).AsInt64() == 0 || spanAttr(transfer, attrReceivedBytes).AsInt64() == 0 {
+		t.Errorf("Expected byte counts, got %v", transfer.Attributes())
+	}
+	want := "traceparent=00-" + transfer.SpanContext().TraceID().String() + "-" + transfer.SpanContext().SpanID().String()
+	if !bytes.Contains(resp, []byte(want)) {
+		t.Errorf("Expected %q in response, got %q", want, resp)
+	}
+
+	g.backendDown.Store(true)
+	if _, _, _, err := c.SendTransferBytes(context.Background(), []byte("GET /trace HTTP/1.1\r\n\r\n")); err == nil {
+		t.Fatal("Expected error when backend is down")
+	}
+	failed := findSpan(t, recorder.Ended(), spanTransfer)
+	if failed.Status().Code != codes.Error || spanAttr(failed, attrResultCode).AsInt64() == 0 {
+		t.Errorf("Expected failed span with result code, got %v %v", failed.Status(), failed.Attributes())
+	}
+}
+
+func TestTracing_PlainTransfer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	g := newTestGateway(t, traceparentHandler)
+	c := g.newTestClient(t, &Config{TracerProvider: tp})
+	if _, _, err := c.SendInitRequestNoAES(); err != nil {
+		t.Fatalf("SendInitRequestNoAES failed: %v", err)
+	}
+
+	resp, _, _, err := c.SendTransferRequestNoAES("GET /trace HTTP/1.1\r\nHost: backend\r\n\r\n")
+	if err != nil {
+		t.Fatalf("SendTransferRequestNoAES failed: %v", err)
+	}
+	transfer := findSpan(t, recorder.Ended(), spanTransfer)
+	if !strings.Contains(string(resp), transfer.SpanContext().TraceID().String()) {
+		t.Errorf("Expected trace ID in response, got %q", resp)
+	}
+}
+
+func TestTraceInsertPos(t *testing.T) {
+	for _, tc := range []struct {
+		payload string
+		want    int
+	}{
+		{"GET / HTTP/1.1\r\nHost: a\r\n\r\n", 16},
+		{"POST /upload HTTP/1.0\r\n\r\nbody", 23},
+		{"GET / HTTP/1.1\r\nTraceparent: 00-x\r\n\r\n", -1},
+		{"GET / HTTP/1.1\r\n\r\ntraceparent: in body", 16},
+		{"\x00\x01binary\r\n", -1},
+		{"GET / HTTP/1.1", -1},
+	} {
+		if got := traceInsertPos([]byte(tc.payload)); got != tc.want {
+			t.Errorf("traceInsertPos(%q) = %d, want %d", tc.payload, got, tc.want)
+		}
+	}
+
+	// 没有有效的span时请求保持不变
+	c := NewTransferClient("127.0.0.1:1", &Config{})
+	payload := []byte("GET / HTTP/1.1\r\n\r\n")
+	if got := c.injectTraceContext(context.Background(), payload); !bytes.Equal(got, payload) {
+		t.Errorf("Expected payload unchanged, got %q", got)
+	}
+}
@@ -0,0 +1,181 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/quic-go/quic-go"
+)
+
+var errNotConnected = errors.New("未连接到网关")
+
+// newTransport 在本地地址laddr上创建network（udp4或udp6）套接字，laddr为nil时由系统选择地址和端口
+func (c *TransferClient) newTransport(network string, laddr *net.UDPAddr) (*quic.Transport, error) {
+	udpConn, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		return nil, fmt.Errorf("创建UDP连接失败: %v", err)
+	}
+
+	// 设置缓冲区失败时继续执行
+	udpConn.SetReadBuffer(c.config.UDPReceiveBuffer)
+	udpConn.SetWriteBuffer(c.config.UDPSendBuffer)
+
+	return &quic.Transport{Conn: udpConn}, nil
+}
+
+// closeTransport 关闭Transport及其UDP套接字，Transport不会关闭调用方传入的套接字
+func closeTransport(t *quic.Transport) {
+	t.Close()
+	t.Conn.Close()
+}
+
+// localUDPAddr 根据LocalAddr和LocalInterface配置返回绑定的本地地址，都未配置时返回nil由系统选择
+func (c *TransferClient) localUDPAddr(raddr *net.UDPAddr) (*net.UDPAddr, error) {
+	if c.config.LocalAddr != "" {
+		return resolveLocalAddr(c.config.LocalAddr)
+	}
+	if c.config.LocalInterface != "" {
+		ip, err := interfaceIP(c.config.LocalInterface, raddr.IP.To4() != nil)
+		if err != nil {
+			return nil, err
+		}
+		return &net.UDPAddr{IP: ip}, nil
+	}
+	return nil, nil
+}
+
+// resolveLocalAddr 解析本地地址，可以只写IP而省略端口
+func resolveLocalAddr(addr string) (*net.UDPAddr, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "0")
+	}
+	laddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("解析本地地址失败: %v", err)
+	}
+	return laddr, nil
+}
+
+// interfaceIP 返回网络接口上第一个可用的IPv4或IPv6地址，跳过链路本地地址
+func interfaceIP(name string, ipv4 bool) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("获取网络接口失败: %v", err)
+	}
+	if iface.Flags&net.FlagUp == 0 {
+		return nil, fmt.Errorf("网络接口未启用: %s", name)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("获取网络接口地址失败: %v", err)
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if (ipNet.IP.To4() != nil) == ipv4 {
+			return ipNet.IP, nil
+		}
+	}
+	return nil, fmt.Errorf("网络接口%s上没有可用的地址", name)
+}
+
+// Migrate 将连接切换到新的本地地址，如Wi-Fi与移动网络切换后调用，localAddr为空时由系统选择
+// 这不是QUIC的连接迁移（quic-go v0.50.1不支持在已有连接上切换路径），而是从新地址重新建立连接并重新INIT，
+// 网关看到的是一个新的QUIC连接。原连接已完成INIT时在新连接上以原有方式（加密或明文）用相同的ServerID、ServerName和SessionID重新初始化，
+// 网关侧的会话得以延续，加密会话会协商新的会话密钥。新连接建立并初始化成功后才关闭原有连接及其数据报通道，
+// 任一步骤失败时关闭新连接，原有连接和会话保持可用
+func (c *TransferClient) Migrate(ctx context.Context, localAddr string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return errNotConnected
+	}
+
+	var laddr *net.UDPAddr
+	if localAddr != "" {
+		var err error
+		if laddr, err = resolveLocalAddr(localAddr); err != nil {
+			return err
+		}
+	}
+	host, _, err := net.SplitHostPort(c.serverAddr)
+	if err != nil {
+		return fmt.Errorf("解析服务器地址失败: %v", err)
+	}
+	raddr, ok := c.conn.RemoteAddr().(*net.UDPAddr)
+	if !ok {
+		return fmt.Errorf("不支持的网关地址类型: %T", c.conn.RemoteAddr())
+	}
+
+	// 迁移时继续使用当前的网关地址，新连接初始化完成前原有连接不关闭
+	old := c.detachLocked()
+	bind := func(*net.UDPAddr) (*net.UDPAddr, error) { return laddr, nil }
+	if err := c.connectFromLocked(ctx, host, []*net.UDPAddr{raddr}, bind); err != nil {
+		c.restoreLocked(old)
+		return fmt.Errorf("连接迁移失败: %v", err)
+	}
+	if old.initialized {
+		if _, _, err := c.reinitLocked(ctx, old.session != nil); err != nil {
+			c.closeLocked("migration reinitialization failed")
+			c.restoreLocked(old)
+			return fmt.Errorf("连接迁移后重新初始化失败: %v", err)
+		}
+	}
+	old.close("migrated")
+	return nil
+}
+
+// connState 一个连接及其上的会话状态，迁移时用于保存原有连接
+type connState struct {
+	conn        quic.Connection
+	stream      quic.Stream
+	transport   *quic.Transport
+	early       quic.EarlyConnection
+	session     *aesSession
+	initialized bool
+	info        *ConnectionInfo
+	datagram    *DatagramConn
+}
+
+// detachLocked 取出当前连接的状态而不关闭连接，之后客户端处于未连接状态，调用方需持有c.mu
+func (c *TransferClient) detachLocked() *connState {
+	s := &connState{
+		conn:        c.conn,
+		stream:      c.stream,
+		transport:   c.transport,
+		early:       c.early,
+		session:     c.session,
+		initialized: c.initialized,
+		info:        c.info,
+		datagram:    c.datagram,
+	}
+	c.conn, c.stream, c.transport, c.early = nil, nil, nil, nil
+	c.session, c.initialized, c.info, c.datagram = nil, false, nil, nil
+	return s
+}
+
+// restoreLocked 恢复detachLocked取出的连接状态，调用方需持有c.mu并已关闭当前连接
+func (c *TransferClient) restoreLocked(s *connState) {
+	c.conn, c.stream, c.transport, c.early = s.conn, s.stream, s.transport, s.early
+	c.session, c.initialized, c.info, c.datagram = s.session, s.initialized, s.info, s.datagram
+}
+
+// close 关闭保存的数据报通道、流、连接和UDP套接字
+func (s *connState) close(reason string) {
+	if s.datagram != nil {
+		s.datagram.Close()
+	}
+	if s.stream != nil {
+		s.stream.Close()
+	}
+	s.conn.CloseWithError(0, reason)
+	if s.transport != nil {
+		closeTransport(s.transport)
+	}
+}
@@ -0,0 +1,174 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/proto"
+	"github.com/laotiannai/quic_gwclient/utils"
+	"github.com/quic-go/quic-go"
+)
+
+// loopbackInterface 返回回环网络接口名
+func loopbackInterface(t *testing.T) string {
+	t.Helper()
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatalf("net.Interfaces failed: %v", err)
+	}
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+			return iface.Name
+		}
+	}
+	t.Skip("no loopback interface")
+	return ""
+}
+
+func TestTransferClient_LocalAddr(t *testing.T) {
+	g := newTestGateway(t, echoHandler)
+
+	c := g.newTestClient(t, &Config{LocalAddr: "127.0.0.1"})
+	local := c.ConnectionInfo().LocalAddr.(*net.UDPAddr)
+	if !local.IP.Equal(net.IPv4(127, 0, 0, 1)) || local.Port == 0 {
+		t.Errorf("Unexpected local address %v", local)
+	}
+
+	c = g.newTestClient(t, &Config{LocalInterface: loopbackInterface(t)})
+	if local := c.ConnectionInfo().LocalAddr.(*net.UDPAddr); !local.IP.IsLoopback() {
+		t.Errorf("Expected loopback local address, got %v", local)
+	}
+
+	if err := g.tryConnect(t, &Config{InsecureSkipVerify: true, LocalInterface: "no-such-iface0"}); err == nil {
+		t.Error("Expected error for unknown interface")
+	}
+	if err := g.tryConnect(t, &Config{InsecureSkipVerify: true, LocalAddr: "not an address"}); err == nil {
+		t.Error("Expected error for invalid local address")
+	}
+}
+
+func TestTransferClient_Migrate(t *testing.T) {
+	for _, aes := range []bool{false, true} {
+		name := "plain"
+		if aes {
+			name = "aes"
+		}
+		t.Run(name, func(t *testing.T) {
+			g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: aes})
+			c := g.newTestClient(t, &Config{EnableAES: aes, CipherSuite: utils.CipherGCM, LocalAddr: "127.0.0.1:0"})
+			if _, _, err := c.SendInit(); err != nil {
+				t.Fatalf("SendInit failed: %v", err)
+			}
+			before := c.ConnectionInfo().LocalAddr.String()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := c.Migrate(ctx, "127.0.0.1:0"); err != nil {
+				t.Fatalf("Migrate failed: %v", err)
+			}
+			if after := c.ConnectionInfo().LocalAddr.String(); after == before {
+				t.Errorf("Expected new local address after migration, still %s", after)
+			}
+
+			// 迁移后无需再次调用SendInit
+			resp, _, _, err := c.SendTransferBytes(ctx, []byte("POST /echo HTTP/1.1\r\nHost: backend\r\nContent-Length: 7\r\n\r\nmigrate"))
+			if err != nil {
+				t.Fatalf("Request after migration failed: %v", err)
+			}
+			if !bytes.HasSuffix(resp, []byte("migrate")) {
+				t.Errorf("Unexpected response: %q", resp)
+			}
+
+			inits := 0
+			for _, h := range g.receivedHeaders() {
+				if h.Command == proto.EMM_COMMAND_INIT {
+					inits++
+				}
+			}
+			if inits != 2 {
+				t.Errorf("Expected 2 INIT requests, got %d", inits)
+			}
+		})
+	}
+}
+
+func TestTransferClient_MigrateFailure(t *testing.T) {
+	c := NewTransferClient("127.0.0.1:1", &Config{})
+	if err := c.Migrate(context.Background(), ""); err != errNotConnected {
+		t.Errorf("Expected errNotConnected, got %v", err)
+	}
+
+	// 新地址不可用时保留原有连接
+	g := newTestGateway(t, echoHandler)
+	c = g.newTestClient(t, nil)
+	if _, _, err := c.SendInit(); err != nil {
+		t.Fatalf("SendInit failed: %v", err)
+	}
+	err := c.Migrate(context.Background(), "192.0.2.1:0")
+	if err == nil || !strings.Contains(err.Error(), "连接迁移失败") {
+		t.Fatalf("Expected migration failure, got %v", err)
+	}
+	if _, _, _, err := c.SendTransferBytes(context.Background(), []byte("GET / HTTP/1.1\r\n\r\n")); err != nil {
+		t.Errorf("Request on original connection failed: %v", err)
+	}
+}
+
+func TestTransferClient_MigrateReinitFailure(t *testing.T) {
+	// 新连接上重新INIT失败时保留原有连接和会话
+	for _, aes := range []bool{false, true} {
+		g := newTestGatewayWithOptions(t, echoHandler, gatewayOptions{aes: aes})
+		c := g.newTestClient(t, &Config{EnableAES: aes, CipherSuite: utils.CipherGCM, LocalAddr: "127.0.0.1:0"})
+		if _, _, err := c.SendInit(); err != nil {
+			t.Fatalf("SendInit failed: %v", err)
+		}
+		before := c.ConnectionInfo().LocalAddr.String()
+
+		g.rejectInit.Store(true)
+		err := c.Migrate(context.Background(), "127.0.0.1:0")
+		if err == nil || !strings.Contains(err.Error(), "连接迁移后重新初始化失败") {
+			t.Fatalf("aes=%v: expected reinitialization failure, got %v", aes, err)
+		}
+		g.rejectInit.Store(false)
+		if after := c.ConnectionInfo().LocalAddr.String(); after != before {
+			t.Errorf("aes=%v: local address changed to %s after failed migration", aes, after)
+		}
+		resp, _, _, err := c.SendTransferBytes(context.Background(), []byte("POST /echo HTTP/1.1\r\nHost: backend\r\nContent-Length: 4\r\n\r\nkept"))
+		if err != nil || !bytes.HasSuffix(resp, []byte("kept")) {
+			t.Errorf("aes=%v: request on original connection failed: %v, %q", aes, err, resp)
+		}
+		headers := g.receivedHeaders()
+		if last := headers[len(headers)-1]; aes && last.Option&proto.OPTION_CIPHER_MASK != uint8(utils.CipherGCM) {
+			t.Errorf("Expected encrypted request on original session, option %#x", last.Option)
+		}
+	}
+}
+
+func TestTransferClient_OpenStreamFailure(t *testing.T) {
+	// 网关不允许客户端打开流，握手成功但打开流超时
+	cert, _ := newTestCertificate(t)
+	tlsConf := &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"hq-interop", "hq-29", "h3-25", "http/0.9"}}
+	ln, err := quic.ListenAddr("127.0.0.1:0", tlsConf, &quic.Config{MaxIncomingStreams: -1})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	c := NewTransferClient(ln.Addr().String(), &Config{ServerID: 1, ServerName: "test-server", InsecureSkipVerify: true, LocalAddr: "127.0.0.1:0", MaxRetries: 1})
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	err = c.Connect(ctx)
+	if err == nil || !strings.Contains(err.Error(), "打开QUIC流失败") {
+		t.Fatalf("Expected stream open failure, got %v", err)
+	}
+	// 新连接及其UDP套接字已关闭，不留下失效的连接
+	if c.conn != nil || c.transport != nil || c.stream != nil {
+		t.Errorf("Client kept state of failed connection: conn=%v transport=%v stream=%v", c.conn, c.transport, c.stream)
+	}
+}
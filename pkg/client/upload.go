@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/proto"
+)
+
+// UploadOptions 上传选项，控制请求体的分帧、流控、进度和取消
+type UploadOptions struct {
+	// 单个EMM_COMMAND_TRAN帧携带的最大数据长度，默认DefaultTransferFrameSize，最大MaxTransferFrameSize
+	FrameSize int
+	// 请求体总长度，仅用于进度回调，未知时为-1
+	TotalSize int64
+	// 进度回调，sent为已发送的请求体字节数（不含包头），total为TotalSize
+	Progress func(sent int64, total int64)
+	// 发送速率上限（字节/秒），0表示不限制
+	MaxBytesPerSecond int64
+	// 单帧写入超时，网关长时间不开放流控窗口时上传失败，默认30s
+	WriteTimeout time.Duration
+}
+
+// DefaultUploadOptions 返回默认的上传选项
+func DefaultUploadOptions() *UploadOptions {
+	return &UploadOptions{
+		FrameSize:         DefaultTransferFrameSize,
+		TotalSize:         -1,
+		Progress:          nil,
+		MaxBytesPerSecond: 0,
+		WriteTimeout:      30 * time.Second,
+	}
+}
+
+// validate 检查并补全上传选项
+func (o *UploadOptions) validate() error {
+	if o.FrameSize <= 0 {
+		o.FrameSize = DefaultTransferFrameSize
+	}
+	if o.FrameSize > MaxTransferFrameSize {
+		return fmt.Errorf("帧大小超过限制: %d > %d 字节", o.FrameSize, MaxTransferFrameSize)
+	}
+	if o.MaxBytesPerSecond < 0 {
+		return fmt.Errorf("发送速率上限不能为负数: %d", o.MaxBytesPerSecond)
+	}
+	if o.WriteTimeout <= 0 {
+		o.WriteTimeout = 30 * time.Second
+	}
+	return nil
+}
+
+// SendTransferUpload 按UploadOptions将大型请求体（如几百MB的multipart POST）切分为多个EMM_COMMAND_TRAN帧上传
+// QUIC流控窗口耗尽时写入会阻塞，超过WriteTimeout仍无法写入则上传失败；ctx取消时立即中止上传
+func (c *TransferClient) SendTransferUpload(ctx context.Context, body io.Reader, opts *UploadOptions) (*TransferResponse, error) {
+	if opts == nil {
+		opts = DefaultUploadOptions()
+	}
+	o := *opts
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+
+	resp, err := c.startTransferLocked(ctx, body, &o)
+	if err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// frameStream 上传所需的流操作
+type frameStream interface {
+	io.Writer
+	SetWriteDeadline(t time.Time) error
+}
+
+// writeTransferFrames 将r中的数据按opts.FrameSize切分为多个EMM_COMMAND_TRAN帧写入w，返回写入的总字节数（含包头）
+// session不为nil时每帧数据单独加密
+func writeTransferFrames(ctx context.Context, w frameStream, r io.Reader, opts *UploadOptions, session *aesSession) (int64, error) {
+	var written, sent int64
+	var frames int
+	start := time.Now()
+	buf := make([]byte, opts.FrameSize)
+	var option uint8
+	if session != nil {
+		option = session.option()
+	}
+
+	defer w.SetWriteDeadline(time.Time{})
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+
+		n, readErr := io.ReadFull(r, buf)
+		// 空请求体也需要发送一个空帧，网关才会开始处理
+		if n > 0 || (frames == 0 && readErr == io.EOF) {
+			frames++
+			data := buf[:n]
+			if session != nil {
+				sealed, err := session.seal(data)
+				if err != nil {
+					return written, fmt.Errorf("加密请求失败: %v", err)
+				}
+				data = sealed
+			}
+			frame, err := newTransferFrame(proto.EMM_COMMAND_TRAN, uint8(proto.PROTO_TYPE_HTTP), option, data)
+			if err != nil {
+				return written, err
+			}
+
+			w.SetWriteDeadline(time.Now().Add(opts.WriteTimeout))
+			m, err := w.Write(frame)
+			written += int64(m)
+			if err != nil {
+				return written, err
+			}
+
+			sent += int64(n)
+			if opts.Progress != nil {
+				opts.Progress(sent, opts.TotalSize)
+			}
+
+			if err := throttle(ctx, start, sent, opts.MaxBytesPerSecond); err != nil {
+				return written, err
+			}
+		}
+
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			return written, nil
+		}
+		if readErr != nil {
+			return written, fmt.Errorf("读取请求体失败: %v", readErr)
+		}
+	}
+}
+
+// throttle 按速率上限等待，使平均发送速率不超过rate
+func throttle(ctx context.Context, start time.Time, sent int64, rate int64) error {
+	if rate <= 0 {
+		return nil
+	}
+	expected := time.Duration(float64(sent) / float64(rate) * float64(time.Second))
+	wait := expected - time.Since(start)
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,345 @@
+// Package loadtest 通过网关对后端服务进行压力测试
+//
+// 支持两种负载模型：Rate为0时为闭环模型，Concurrency个并发各自连续发送请求，上一个请求完成后立即发送下一个；
+// Rate大于0时为开环模型，按固定速率发出请求，与响应快慢无关，最多Concurrency个请求同时进行，
+// 耗时从计划发出的时间开始计算，包括等待空闲连接的时间，避免网关变慢时低估耗时。
+//
+//	mix, _ := loadtest.LoadMix("mix.yaml")
+//	opts := loadtest.DefaultOptions()
+//	opts.Concurrency = 50
+//	opts.Duration = time.Minute
+//	report, err := loadtest.Run(ctx, loadtest.ClientDialer(addr, config), mix, opts)
+//	report.WriteText(os.Stdout)
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/pkg/client"
+)
+
+// 失败的类型，用于Report.Errors
+const (
+	ErrConnect       = "connect"        // 连接网关或INIT失败，网关拒绝INIT时错误码见Report.ResultCodes
+	ErrTimeout       = "timeout"        // 请求超时
+	ErrGateway       = "gateway"        // 网关以错误码关闭链路，错误码见Report.ResultCodes
+	ErrTransfer      = "transfer"       // 发送请求或读取响应的其他错误
+	ErrAssertStatus  = "assert_status"  // HTTP状态码与断言不符
+	ErrAssertBody    = "assert_body"    // 响应内容与断言不符
+	ErrAssertLatency = "assert_latency" // 耗时超过断言
+)
+
+// connectBackoff 连接失败后等待的时间，避免网关不可用时闭环模型空转
+const connectBackoff = 100 * time.Millisecond
+
+// Options 压测选项
+type Options struct {
+	Concurrency int           // 闭环模型的并发数，开环模型的最大同时请求数，也是建立的连接数
+	Rate        float64       // 每秒发出的请求数，0表示闭环模型
+	Duration    time.Duration // 发出新请求的持续时间，已发出的请求在之后完成，0表示只受Requests限制
+	Requests    int           // 最多发出的请求数，0表示只受Duration限制
+	RampUp      time.Duration // 预热时间，闭环模型在这段时间内逐个启动并发，开环模型的速率从0线性增加到Rate
+	Timeout     time.Duration // 单个请求的超时，0表示不限制
+	// 进度回调，非nil时每ProgressInterval调用一次
+	Progress         func(*Progress)
+	ProgressInterval time.Duration // 默认1秒
+}
+
+// DefaultOptions 返回默认的压测选项：10个并发的闭环模型，持续10秒
+func DefaultOptions() *Options {
+	return &Options{
+		Concurrency:      10,
+		Duration:         10 * time.Second,
+		Timeout:          30 * time.Second,
+		ProgressInterval: time.Second,
+	}
+}
+
+// Progress 压测进度
+type Progress struct {
+	Elapsed   time.Duration
+	Completed int64 // 已完成的请求数
+	Failed    int64 // 其中失败的请求数
+	InFlight  int64 // 正在进行的请求数
+}
+
+// Sample 一个请求的结果
+type Sample struct {
+	Request  *Request
+	Start    time.Time     // 开环模型为计划发出的时间
+	Latency  time.Duration // 从Start到收到完整响应
+	Received int           // 响应字节数
+	Status   int           // HTTP响应状态码，不是HTTP响应时为0
+	Result   uint16        // 网关拒绝INIT或关闭链路的错误码，ErrGateway和网关拒绝INIT的ErrConnect时有效
+	Kind     string        // 失败的类型，成功时为空
+	Err      error
+}
+
+// Run 按opts发送mix中的请求，完成后返回报告
+// ctx取消时停止发出新请求并中断进行中的请求，已完成的请求仍然计入报告
+func Run(ctx context.Context, dial Dialer, mix []*Request, opts *Options) (*Report, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if len(mix) == 0 {
+		return nil, fmt.Errorf("没有要发送的请求")
+	}
+	for i, r := range mix {
+		if err := r.prepare(i); err != nil {
+			return nil, fmt.Errorf("请求%d: %v", i+1, err)
+		}
+	}
+	if opts.Concurrency <= 0 {
+		return nil, fmt.Errorf("并发数必须大于0")
+	}
+	if opts.Duration <= 0 && opts.Requests <= 0 {
+		return nil, fmt.Errorf("需要指定持续时间或请求数")
+	}
+	if opts.Rate < 0 || math.IsInf(opts.Rate, 0) || math.IsNaN(opts.Rate) {
+		return nil, fmt.Errorf("无效的请求速率: %v", opts.Rate)
+	}
+
+	r := &runner{
+		dial:    dial,
+		opts:    opts,
+		picker:  newPicker(mix),
+		collect: newCollector(mix),
+		start:   time.Now(),
+		slots:   make(chan *slot, opts.Concurrency),
+	}
+	for i := 0; i < opts.Concurrency; i++ {
+		r.slots <- &slot{}
+	}
+	// 停止发出新请求的时间
+	r.stop, r.cancelStop = context.WithCancel(ctx)
+	if opts.Duration > 0 {
+		r.stop, r.cancelStop = context.WithDeadline(ctx, r.start.Add(opts.Duration))
+	}
+	defer r.cancelStop()
+
+	stopProgress := r.reportProgress()
+	if opts.Rate > 0 {
+		r.runOpen(ctx)
+	} else {
+		r.runClosed(ctx)
+	}
+	stopProgress()
+
+	// 关闭全部连接
+	close(r.slots)
+	for s := range r.slots {
+		s.close()
+	}
+	return r.collect.report(r.start, time.Now()), nil
+}
+
+// runner 一次压测的状态
+type runner struct {
+	dial    Dialer
+	opts    *Options
+	picker  *picker
+	collect *collector
+	start   time.Time
+	slots   chan *slot // 空闲的连接
+
+	stop       context.Context // 取消后不再发出新请求
+	cancelStop context.CancelFunc
+	issued     atomic.Int64
+	inFlight   atomic.Int64
+}
+
+// next 报告是否可以发出下一个请求，并计入已发出的请求数
+func (r *runner) next() bool {
+	if r.stop.Err() != nil {
+		return false
+	}
+	if r.opts.Requests > 0 && r.issued.Add(1) > int64(r.opts.Requests) {
+		return false
+	}
+	return true
+}
+
+// runClosed 闭环模型：每个并发取得一个连接，连续发送请求
+func (r *runner) runClosed(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < r.opts.Concurrency; i++ {
+		delay := r.opts.RampUp * time.Duration(i) / time.Duration(r.opts.Concurrency)
+		s := <-r.slots
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { r.slots <- s }()
+			if !sleepUntil(r.stop, r.start.Add(delay)) {
+				return
+			}
+			for r.next() {
+				r.send(ctx, s, time.Now())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// runOpen 开环模型：按计划的时间发出请求，使用空闲的连接发送
+func (r *runner) runOpen(ctx context.Context) {
+	var wg sync.WaitGroup
+	for k := 0; ; k++ {
+		at := r.start.Add(arrivalTime(k, r.opts.Rate, r.opts.RampUp))
+		if !sleepUntil(r.stop, at) || !r.next() {
+			break
+		}
+		var s *slot
+		select {
+		case s = <-r.slots:
+		case <-r.stop.Done():
+		}
+		if s == nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { r.slots <- s }()
+			r.send(ctx, s, at)
+		}()
+	}
+	wg.Wait()
+}
+
+// arrivalTime 返回开环模型中第k个请求相对于开始的计划时间
+// 预热期间速率从0线性增加到rate，到达的请求数为rate*t²/(2*rampUp)，之后按rate均匀到达
+func arrivalTime(k int, rate float64, rampUp time.Duration) time.Duration {
+	ramp := rampUp.Seconds()
+	rampRequests := rate * ramp / 2
+	var t float64
+	if float64(k) < rampRequests {
+		t = math.Sqrt(2 * ramp * float64(k) / rate)
+	} else {
+		t = ramp + (float64(k)-rampRequests)/rate
+	}
+	return time.Duration(t * float64(time.Second))
+}
+
+// sleepUntil 等待到t，ctx先结束时返回false
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// send 使用连接s发送一个请求并记录结果，start为计算耗时的起点
+func (r *runner) send(ctx context.Context, s *slot, start time.Time) {
+	r.inFlight.Add(1)
+	defer r.inFlight.Add(-1)
+
+	req := r.picker.pick()
+	sample := &Sample{Request: req, Start: start}
+	defer func() { r.collect.add(sample) }()
+
+	if s.sender == nil {
+		sender, err := r.dial(ctx)
+		if err != nil {
+			sample.Latency = time.Since(start)
+			sample.Kind, sample.Err = ErrConnect, err
+			var gwErr *client.GatewayError
+			if errors.As(err, &gwErr) {
+				sample.Result = gwErr.Result
+			}
+			sleepUntil(r.stop, time.Now().Add(connectBackoff))
+			return
+		}
+		s.sender = sender
+	}
+
+	reqCtx, cancel := ctx, context.CancelFunc(func() {})
+	if r.opts.Timeout > 0 {
+		reqCtx, cancel = context.WithTimeout(ctx, r.opts.Timeout)
+	}
+	resp, err := s.sender.Send(reqCtx, req.payload)
+	cancel()
+	sample.Latency = time.Since(start)
+	sample.Received = len(resp)
+	if err != nil {
+		// 出错后连接的状态未知，下次使用时重新建立
+		s.close()
+		sample.Kind, sample.Err = classify(reqCtx, err)
+		var gwErr *client.GatewayError
+		if errors.As(err, &gwErr) {
+			sample.Result = gwErr.Result
+		}
+		return
+	}
+	sample.Status = httpStatus(resp)
+	sample.Kind, sample.Err = req.Assert.check(resp, sample.Status, sample.Latency)
+}
+
+// classify 返回请求错误的类型
+func classify(ctx context.Context, err error) (string, error) {
+	var gwErr *client.GatewayError
+	switch {
+	case errors.As(err, &gwErr):
+		return ErrGateway, err
+	case errors.Is(ctx.Err(), context.DeadlineExceeded), errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return ErrTimeout, err
+	}
+	return ErrTransfer, err
+}
+
+// reportProgress 启动进度回调，返回的函数停止回调
+func (r *runner) reportProgress() func() {
+	if r.opts.Progress == nil {
+		return func() {}
+	}
+	interval := r.opts.ProgressInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				completed, failed := r.collect.counts()
+				r.opts.Progress(&Progress{Elapsed: time.Since(r.start), Completed: completed, Failed: failed, InFlight: r.inFlight.Load()})
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// slot 一个连接，sender为nil时在下次使用前建立
+type slot struct {
+	sender Sender
+}
+
+func (s *slot) close() {
+	if s.sender != nil {
+		s.sender.Close()
+		s.sender = nil
+	}
+}
@@ -0,0 +1,393 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/pkg/client"
+	"github.com/laotiannai/quic_gwclient/proto"
+)
+
+// fakeSender 调用send处理请求的Sender
+type fakeSender struct {
+	send   func(ctx context.Context, payload []byte) ([]byte, error)
+	closed atomic.Bool
+}
+
+func (s *fakeSender) Send(ctx context.Context, payload []byte) ([]byte, error) {
+	if s.closed.Load() {
+		return nil, fmt.Errorf("sender已关闭")
+	}
+	return s.send(ctx, payload)
+}
+
+func (s *fakeSender) Close() error {
+	s.closed.Store(true)
+	return nil
+}
+
+// fakeDialer 返回创建fakeSender的Dialer，并记录创建的Sender
+type fakeDialer struct {
+	mu      sync.Mutex
+	send    func(ctx context.Context, payload []byte) ([]byte, error)
+	senders []*fakeSender
+}
+
+func (d *fakeDialer) dial(ctx context.Context) (Sender, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := &fakeSender{send: d.send}
+	d.senders = append(d.senders, s)
+	return s, nil
+}
+
+func okResponse(ctx context.Context, payload []byte) ([]byte, error) {
+	return []byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"), nil
+}
+
+func TestRun_Closed(t *testing.T) {
+	d := &fakeDialer{send: func(ctx context.Context, payload []byte) ([]byte, error) {
+		time.Sleep(time.Millisecond)
+		return okResponse(ctx, payload)
+	}}
+	mix := []*Request{{URL: "backend/", Assert: Assertion{Status: 200, Contains: "ok"}}}
+	opts := DefaultOptions()
+	opts.Concurrency = 4
+	opts.Duration = 0
+	opts.Requests = 100
+
+	report, err := Run(context.Background(), d.dial, mix, opts)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if report.Requests != 100 || report.Succeeded != 100 || report.Failed != 0 {
+		t.Errorf("Requests = %d, succeeded = %d, failed = %d", report.Requests, report.Succeeded, report.Failed)
+	}
+	if report.StatusCodes[200] != 100 {
+		t.Errorf("StatusCodes = %v", report.StatusCodes)
+	}
+	if len(d.senders) != 4 {
+		t.Errorf("Created %d senders, want 4", len(d.senders))
+	}
+	for i, s := range d.senders {
+		if !s.closed.Load() {
+			t.Errorf("Sender %d not closed", i)
+		}
+	}
+	if mix[0].Name != "GET backend/" || report.PerRequest[0].Name != mix[0].Name {
+		t.Errorf("Name = %q", mix[0].Name)
+	}
+	if want := int64(100 * len(mix[0].payload)); report.Sent != want {
+		t.Errorf("Sent = %d, want %d", report.Sent, want)
+	}
+}
+
+func TestRun_Duration(t *testing.T) {
+	d := &fakeDialer{send: func(ctx context.Context, payload []byte) ([]byte, error) {
+		time.Sleep(5 * time.Millisecond)
+		return okResponse(ctx, payload)
+	}}
+	opts := DefaultOptions()
+	opts.Concurrency = 2
+	opts.Duration = 100 * time.Millisecond
+
+	start := time.Now()
+	report, err := Run(context.Background(), d.dial, []*Request{{Payload: "ping"}}, opts)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Run took %v", elapsed)
+	}
+	// 每个并发每5毫秒完成一个请求
+	if report.Requests < 10 || report.Requests > 50 {
+		t.Errorf("Requests = %d", report.Requests)
+	}
+	if report.Latency.Min < 5*time.Millisecond {
+		t.Errorf("Min latency = %v", report.Latency.Min)
+	}
+	if report.PerRequest[0].Name != "request-1" {
+		t.Errorf("Name = %q", report.PerRequest[0].Name)
+	}
+}
+
+func TestRun_Open(t *testing.T) {
+	d := &fakeDialer{send: okResponse}
+	opts := DefaultOptions()
+	opts.Concurrency = 2
+	opts.Rate = 200
+	opts.Duration = 0
+	opts.Requests = 20
+
+	start := time.Now()
+	report, err := Run(context.Background(), d.dial, []*Request{{Payload: "ping"}}, opts)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if report.Requests != 20 || report.Failed != 0 {
+		t.Errorf("Requests = %d, failed = %d", report.Requests, report.Failed)
+	}
+	// 第20个请求计划在95毫秒时发出
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Run took %v, requests were not paced", elapsed)
+	}
+}
+
+func TestArrivalTime(t *testing.T) {
+	tests := []struct {
+		k      int
+		rate   float64
+		rampUp time.Duration
+		want   time.Duration
+	}{
+		{0, 10, 0, 0},
+		{5, 10, 0, 500 * time.Millisecond},
+		// 预热2秒期间共发出10个请求，第k个请求在sqrt(0.4k)秒
+		{0, 10, 2 * time.Second, 0},
+		{10, 10, 2 * time.Second, 2 * time.Second},
+		{20, 10, 2 * time.Second, 3 * time.Second},
+	}
+	for _, tt := range tests {
+		got := arrivalTime(tt.k, tt.rate, tt.rampUp)
+		if diff := got - tt.want; diff < -time.Microsecond || diff > time.Microsecond {
+			t.Errorf("arrivalTime(%d, %v, %v) = %v, want %v", tt.k, tt.rate, tt.rampUp, got, tt.want)
+		}
+	}
+	if got := arrivalTime(1, 10, 2*time.Second); got <= 0 || got >= 2*time.Second/3 {
+		t.Errorf("arrivalTime(1) = %v, expected slower start during ramp-up", got)
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	var n atomic.Int64
+	d := &fakeDialer{send: func(ctx context.Context, payload []byte) ([]byte, error) {
+		switch n.Add(1) % 4 {
+		case 1:
+			return nil, fmt.Errorf("读取响应失败: %w", &client.GatewayError{Result: proto.AUTH_STATUS_CODE_ERR_CONN_FAILED})
+		case 2:
+			<-ctx.Done()
+			return nil, ctx.Err()
+		case 3:
+			return []byte("HTTP/1.1 503 Service Unavailable\r\n\r\n"), nil
+		}
+		return okResponse(ctx, payload)
+	}}
+	opts := DefaultOptions()
+	opts.Concurrency = 1
+	opts.Duration = 0
+	opts.Requests = 8
+	opts.Timeout = 10 * time.Millisecond
+
+	report, err := Run(context.Background(), d.dial, []*Request{{URL: "backend/", Assert: Assertion{Status: 200}}}, opts)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if report.Succeeded != 2 || report.Failed != 6 {
+		t.Errorf("Succeeded = %d, failed = %d", report.Succeeded, report.Failed)
+	}
+	wantErrors := map[string]int{ErrGateway: 2, ErrTimeout: 2, ErrAssertStatus: 2}
+	if fmt.Sprint(report.Errors) != fmt.Sprint(wantErrors) {
+		t.Errorf("Errors = %v, want %v", report.Errors, wantErrors)
+	}
+	if report.ResultCodes[proto.AUTH_STATUS_CODE_ERR_CONN_FAILED] != 2 || len(report.ResultCodes) != 1 {
+		t.Errorf("ResultCodes = %v", report.ResultCodes)
+	}
+	if report.StatusCodes[503] != 2 || report.StatusCodes[200] != 2 {
+		t.Errorf("StatusCodes = %v", report.StatusCodes)
+	}
+	// 每次请求出错后重新建立连接
+	if len(d.senders) != 5 {
+		t.Errorf("Created %d senders, want 5", len(d.senders))
+	}
+}
+
+func TestRun_ConnectError(t *testing.T) {
+	dial := func(ctx context.Context) (Sender, error) {
+		return nil, errors.New("connection refused")
+	}
+	opts := DefaultOptions()
+	opts.Concurrency = 2
+	opts.Duration = 0
+	opts.Requests = 4
+
+	report, err := Run(context.Background(), dial, []*Request{{Payload: "ping"}}, opts)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if report.Failed != 4 || report.Errors[ErrConnect] != 4 {
+		t.Errorf("Failed = %d, errors = %v", report.Failed, report.Errors)
+	}
+}
+
+func TestRun_Cancel(t *testing.T) {
+	d := &fakeDialer{send: func(ctx context.Context, payload []byte) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	opts := DefaultOptions()
+	opts.Concurrency = 3
+
+	start := time.Now()
+	report, err := Run(ctx, d.dial, []*Request{{Payload: "ping"}}, opts)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Run took %v after cancel", elapsed)
+	}
+	if report.Requests != 3 || report.Errors[ErrTimeout] != 3 {
+		t.Errorf("Requests = %d, errors = %v", report.Requests, report.Errors)
+	}
+}
+
+func TestRun_Progress(t *testing.T) {
+	d := &fakeDialer{send: func(ctx context.Context, payload []byte) ([]byte, error) {
+		time.Sleep(time.Millisecond)
+		return okResponse(ctx, payload)
+	}}
+	var calls atomic.Int64
+	opts := DefaultOptions()
+	opts.Duration = 60 * time.Millisecond
+	opts.ProgressInterval = 10 * time.Millisecond
+	opts.Progress = func(p *Progress) {
+		calls.Add(1)
+		if p.Completed < p.Failed || p.InFlight < 0 {
+			t.Errorf("Unexpected progress %+v", p)
+		}
+	}
+	if _, err := Run(context.Background(), d.dial, []*Request{{Payload: "ping"}}, opts); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if calls.Load() == 0 {
+		t.Error("Progress was not called")
+	}
+}
+
+func TestRun_InvalidOptions(t *testing.T) {
+	d := &fakeDialer{send: okResponse}
+	mix := []*Request{{Payload: "ping"}}
+	tests := []struct {
+		name string
+		mix  []*Request
+		opts Options
+	}{
+		{"empty mix", nil, Options{Concurrency: 1, Requests: 1}},
+		{"invalid request", []*Request{{}}, Options{Concurrency: 1, Requests: 1}},
+		{"no concurrency", mix, Options{Requests: 1}},
+		{"unbounded", mix, Options{Concurrency: 1}},
+		{"negative rate", mix, Options{Concurrency: 1, Requests: 1, Rate: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Run(context.Background(), d.dial, tt.mix, &tt.opts); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestLatencyStats(t *testing.T) {
+	latencies := make([]time.Duration, 1000)
+	for i := range latencies {
+		// 倒序，验证会先排序
+		latencies[i] = time.Duration(1000-i) * time.Millisecond
+	}
+	got := latencyStats(latencies)
+	want := LatencyStats{
+		Min:  time.Millisecond,
+		Mean: 500500 * time.Microsecond,
+		Max:  time.Second,
+		P50:  500 * time.Millisecond,
+		P90:  900 * time.Millisecond,
+		P95:  950 * time.Millisecond,
+		P99:  990 * time.Millisecond,
+		P999: 999 * time.Millisecond,
+	}
+	if got != want {
+		t.Errorf("latencyStats = %+v, want %+v", got, want)
+	}
+	if got := latencyStats([]time.Duration{3 * time.Millisecond}); got.P50 != 3*time.Millisecond || got.P999 != 3*time.Millisecond {
+		t.Errorf("Single sample stats = %+v", got)
+	}
+	if got := latencyStats(nil); got != (LatencyStats{}) {
+		t.Errorf("Empty stats = %+v", got)
+	}
+}
+
+func TestReport_Write(t *testing.T) {
+	mix := []*Request{{Name: "a", Payload: "a"}, {Name: "b", Payload: "bb"}}
+	for i, r := range mix {
+		if err := r.prepare(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := newCollector(mix)
+	c.add(&Sample{Request: mix[0], Latency: 10 * time.Millisecond, Received: 5, Status: 200})
+	c.add(&Sample{Request: mix[1], Latency: 30 * time.Millisecond, Kind: ErrGateway, Result: proto.AUTH_STATUS_CODE_ERR_TENNEL_FORBIDDEN})
+	start := time.Now()
+	report := c.report(start, start.Add(2*time.Second))
+
+	if report.Throughput != 1 || report.Sent != 3 || report.Received != 5 {
+		t.Errorf("Throughput = %v, sent = %d, received = %d", report.Throughput, report.Sent, report.Received)
+	}
+
+	var text bytes.Buffer
+	if err := report.WriteText(&text); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	for _, want := range []string{"请求:     2，成功1，失败1 (50.00%)", "gateway: 1", "8001: 1", "200: 1", "b: 1，失败1"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("Text report does not contain %q:\n%s", want, text.String())
+		}
+	}
+
+	var js bytes.Buffer
+	if err := report.WriteJSON(&js); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	var decoded struct {
+		Requests    int            `json:"requests"`
+		ResultCodes map[string]int `json:"result_codes"`
+		PerRequest  []struct {
+			Name    string `json:"name"`
+			Latency struct {
+				P50 int64 `json:"p50"`
+			} `json:"latency"`
+		} `json:"per_request"`
+	}
+	if err := json.Unmarshal(js.Bytes(), &decoded); err != nil {
+		t.Fatalf("Invalid JSON: %v\n%s", err, js.String())
+	}
+	if decoded.Requests != 2 || decoded.ResultCodes["8001"] != 1 || len(decoded.PerRequest) != 2 ||
+		decoded.PerRequest[1].Latency.P50 != int64(30*time.Millisecond) {
+		t.Errorf("Unexpected JSON report:\n%s", js.String())
+	}
+
+	var out bytes.Buffer
+	if err := report.WriteCSV(&out); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("Invalid CSV: %v", err)
+	}
+	if len(records) != 4 || len(records[0]) != len(csvHeader) {
+		t.Fatalf("Unexpected CSV:\n%v", records)
+	}
+	total := records[3]
+	if total[0] != "total" || total[1] != "2" || total[4] != "0.5000" || total[11] != "10.000" ||
+		total[16] != "gateway:1" || total[17] != "8001:1" {
+		t.Errorf("Total row = %v", total)
+	}
+}
@@ -0,0 +1,222 @@
+package loadtest
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/pkg/client"
+	"gopkg.in/yaml.v3"
+)
+
+// Request 请求组合中的一种请求
+// 通过Method、URL、Header和Body（或BodyFile）构造HTTP请求，或者通过Payload（或PayloadFile）指定原始请求
+type Request struct {
+	Name   string `yaml:"name"`   // 报告中的名称，默认为方法和URL
+	Weight int    `yaml:"weight"` // 被选中的权重，默认1
+	// HTTP请求
+	Method   string            `yaml:"method"` // 默认GET，有请求体时为POST
+	URL      string            `yaml:"url"`
+	Header   map[string]string `yaml:"header"`
+	Body     string            `yaml:"body"`
+	BodyFile string            `yaml:"body_file"` // 相对路径相对于组合文件所在的目录
+	// 原始请求
+	Payload           string `yaml:"payload"`
+	PayloadFile       string `yaml:"payload_file"`
+	LegacyEscapedCRLF bool   `yaml:"legacy_escaped_crlf"` // 将原始请求中的字面量\r\n替换为CRLF
+	// 响应断言
+	Assert Assertion `yaml:"assert"`
+
+	payload []byte
+}
+
+// Assertion 对单个响应的断言，零值的条件不检查
+type Assertion struct {
+	Status      int           `yaml:"status"`       // 期望的HTTP响应状态码
+	Contains    string        `yaml:"contains"`     // 响应中必须包含的内容，与RequestOptions.ResponseAssertion相同
+	NotContains string        `yaml:"not_contains"` // 响应中不能包含的内容
+	MaxLatency  time.Duration `yaml:"max_latency"`  // 最大允许的耗时
+}
+
+// mixFile 请求组合文件的格式
+type mixFile struct {
+	Requests []*Request `yaml:"requests"`
+}
+
+// LoadMix 读取YAML格式的请求组合文件，格式为：
+//
+//	requests:
+//	  - name: index
+//	    weight: 3
+//	    url: http://backend/index.html
+//	    header: {Accept: text/html}
+//	    assert: {status: 200, contains: "<html", max_latency: 500ms}
+//	  - name: upload
+//	    method: PUT
+//	    url: http://backend/upload
+//	    body_file: data.bin
+//	  - name: legacy
+//	    payload_file: request.txt
+//	    legacy_escaped_crlf: true
+func LoadMix(path string) ([]*Request, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取请求组合文件失败: %v", err)
+	}
+	var file mixFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("解析请求组合文件失败: %v", err)
+	}
+	if len(file.Requests) == 0 {
+		return nil, fmt.Errorf("请求组合文件中没有请求")
+	}
+	dir := filepath.Dir(path)
+	for i, r := range file.Requests {
+		if r == nil {
+			return nil, fmt.Errorf("第%d个请求为空", i+1)
+		}
+		r.BodyFile = resolvePath(dir, r.BodyFile)
+		r.PayloadFile = resolvePath(dir, r.PayloadFile)
+	}
+	return file.Requests, nil
+}
+
+// resolvePath 将相对路径转换为相对于dir的路径
+func resolvePath(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// prepare 检查请求并生成发送的数据，index用于生成默认名称
+func (r *Request) prepare(index int) error {
+	if r.Weight < 0 {
+		return fmt.Errorf("权重不能为负数")
+	}
+	if r.Weight == 0 {
+		r.Weight = 1
+	}
+	raw := r.Payload != "" || r.PayloadFile != ""
+	switch {
+	case raw && r.URL != "":
+		return fmt.Errorf("url和payload不能同时指定")
+	case r.Payload != "" && r.PayloadFile != "":
+		return fmt.Errorf("payload和payload_file不能同时指定")
+	case r.Body != "" && r.BodyFile != "":
+		return fmt.Errorf("body和body_file不能同时指定")
+	case raw:
+		payload := []byte(r.Payload)
+		if r.PayloadFile != "" {
+			data, err := os.ReadFile(r.PayloadFile)
+			if err != nil {
+				return fmt.Errorf("读取原始请求失败: %v", err)
+			}
+			payload = data
+		}
+		if r.LegacyEscapedCRLF {
+			payload = bytes.ReplaceAll(payload, []byte(`\r\n`), []byte("\r\n"))
+		}
+		r.payload = payload
+		if r.Name == "" {
+			r.Name = "request-" + strconv.Itoa(index+1)
+		}
+		return nil
+	case r.URL == "":
+		return fmt.Errorf("需要指定url或payload")
+	}
+
+	body := []byte(r.Body)
+	if r.BodyFile != "" {
+		data, err := os.ReadFile(r.BodyFile)
+		if err != nil {
+			return fmt.Errorf("读取请求体失败: %v", err)
+		}
+		body = data
+	}
+	method := r.Method
+	if method == "" && len(body) > 0 {
+		method = "POST"
+	}
+	target := r.URL
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+	req, err := client.NewHTTPRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range r.Header {
+		req.Header.Set(name, value)
+	}
+	payload, err := req.Bytes()
+	if err != nil {
+		return err
+	}
+	r.payload = payload
+	if r.Name == "" {
+		r.Name = req.Method + " " + r.URL
+	}
+	return nil
+}
+
+// check 按断言检查响应，返回失败的类型，通过时返回空字符串
+func (a *Assertion) check(resp []byte, status int, latency time.Duration) (string, error) {
+	switch {
+	case a.Status != 0 && status != a.Status:
+		return ErrAssertStatus, fmt.Errorf("HTTP状态码为%d，期望%d", status, a.Status)
+	case a.Contains != "" && !bytes.Contains(resp, []byte(a.Contains)):
+		return ErrAssertBody, fmt.Errorf("响应中不包含%q", a.Contains)
+	case a.NotContains != "" && bytes.Contains(resp, []byte(a.NotContains)):
+		return ErrAssertBody, fmt.Errorf("响应中包含%q", a.NotContains)
+	case a.MaxLatency > 0 && latency > a.MaxLatency:
+		return ErrAssertLatency, fmt.Errorf("耗时%v超过%v", latency, a.MaxLatency)
+	}
+	return "", nil
+}
+
+// httpStatus 返回HTTP响应的状态码，不是HTTP响应时返回0
+func httpStatus(resp []byte) int {
+	line, _, _ := bytes.Cut(resp, []byte("\r\n"))
+	fields := strings.Fields(string(line))
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "HTTP/") {
+		return 0
+	}
+	status, _ := strconv.Atoi(fields[1])
+	return status
+}
+
+// picker 按权重随机选择请求
+type picker struct {
+	requests []*Request
+	total    int
+}
+
+func newPicker(requests []*Request) *picker {
+	p := &picker{requests: requests}
+	for _, r := range requests {
+		p.total += r.Weight
+	}
+	return p
+}
+
+func (p *picker) pick() *Request {
+	if len(p.requests) == 1 {
+		return p.requests[0]
+	}
+	n := rand.IntN(p.total)
+	for _, r := range p.requests {
+		if n < r.Weight {
+			return r
+		}
+		n -= r.Weight
+	}
+	return p.requests[len(p.requests)-1]
+}
@@ -0,0 +1,171 @@
+package loadtest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadMix(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "data.bin"), []byte("payload"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "request.txt"), []byte(`GET /legacy HTTP/1.1\r\nHost: backend\r\n\r\n`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "mix.yaml")
+	mix := `requests:
+  - name: index
+    weight: 3
+    url: http://backend/index.html
+    header: {Accept: text/html}
+    assert: {status: 200, contains: "<html", max_latency: 500ms}
+  - method: PUT
+    url: backend/upload
+    body_file: data.bin
+  - payload_file: request.txt
+    legacy_escaped_crlf: true
+`
+	if err := os.WriteFile(path, []byte(mix), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	requests, err := LoadMix(path)
+	if err != nil {
+		t.Fatalf("LoadMix failed: %v", err)
+	}
+	if len(requests) != 3 {
+		t.Fatalf("Loaded %d requests, want 3", len(requests))
+	}
+	for i, r := range requests {
+		if err := r.prepare(i); err != nil {
+			t.Fatalf("prepare %d failed: %v", i, err)
+		}
+	}
+
+	index := requests[0]
+	if index.Weight != 3 || index.Assert != (Assertion{Status: 200, Contains: "<html", MaxLatency: 500 * time.Millisecond}) {
+		t.Errorf("Unexpected request %+v", index)
+	}
+	if want := "GET /index.html HTTP/1.1\r\nHost: backend\r\nAccept: text/html\r\n\r\n"; string(index.payload) != want {
+		t.Errorf("Payload = %q, want %q", index.payload, want)
+	}
+
+	upload := requests[1]
+	if upload.Name != "PUT backend/upload" || upload.Weight != 1 {
+		t.Errorf("Name = %q, weight = %d", upload.Name, upload.Weight)
+	}
+	if want := "PUT /upload HTTP/1.1\r\nHost: backend\r\nContent-Length: 7\r\n\r\npayload"; string(upload.payload) != want {
+		t.Errorf("Payload = %q, want %q", upload.payload, want)
+	}
+
+	legacy := requests[2]
+	if legacy.Name != "request-3" || string(legacy.payload) != "GET /legacy HTTP/1.1\r\nHost: backend\r\n\r\n" {
+		t.Errorf("Name = %q, payload = %q", legacy.Name, legacy.payload)
+	}
+}
+
+func TestLoadMix_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unknown field", "requests:\n  - url: backend/\n    methd: GET\n", "methd"},
+		{"empty", "requests: []\n", "没有请求"},
+		{"null request", "requests:\n  -\n", "第1个请求为空"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "mix.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadMix(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Error = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequest_PrepareInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		r    Request
+	}{
+		{"nothing", Request{}},
+		{"url and payload", Request{URL: "backend/", Payload: "x"}},
+		{"payload and file", Request{Payload: "x", PayloadFile: "x.txt"}},
+		{"body and file", Request{URL: "backend/", Body: "x", BodyFile: "x.txt"}},
+		{"negative weight", Request{Payload: "x", Weight: -1}},
+		{"missing file", Request{PayloadFile: filepath.Join(t.TempDir(), "missing")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.r.prepare(0); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestAssertion_Check(t *testing.T) {
+	resp := []byte("HTTP/1.1 200 OK\r\n\r\nhello")
+	tests := []struct {
+		name    string
+		a       Assertion
+		status  int
+		latency time.Duration
+		want    string
+	}{
+		{"empty", Assertion{}, 0, time.Second, ""},
+		{"all pass", Assertion{Status: 200, Contains: "hello", NotContains: "error", MaxLatency: time.Second}, 200, time.Millisecond, ""},
+		{"status", Assertion{Status: 200}, 500, 0, ErrAssertStatus},
+		{"contains", Assertion{Contains: "world"}, 200, 0, ErrAssertBody},
+		{"not contains", Assertion{NotContains: "hello"}, 200, 0, ErrAssertBody},
+		{"latency", Assertion{MaxLatency: time.Millisecond}, 200, time.Second, ErrAssertLatency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, err := tt.a.check(resp, tt.status, tt.latency)
+			if kind != tt.want || (err != nil) != (tt.want != "") {
+				t.Errorf("check = %q, %v, want %q", kind, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		resp string
+		want int
+	}{
+		{"HTTP/1.1 404 Not Found\r\n\r\n", 404},
+		{"HTTP/1.0 200", 200},
+		{"raw response", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := httpStatus([]byte(tt.resp)); got != tt.want {
+			t.Errorf("httpStatus(%q) = %d, want %d", tt.resp, got, tt.want)
+		}
+	}
+}
+
+func TestPicker(t *testing.T) {
+	a, b := &Request{Weight: 1}, &Request{Weight: 3}
+	p := newPicker([]*Request{a, b})
+	counts := map[*Request]int{}
+	for i := 0; i < 4000; i++ {
+		counts[p.pick()]++
+	}
+	// 期望比例1:3，容许较大的随机误差
+	if counts[a] < 700 || counts[a] > 1300 || counts[a]+counts[b] != 4000 {
+		t.Errorf("Picked a %d times, b %d times", counts[a], counts[b])
+	}
+}
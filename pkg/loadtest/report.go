@@ -0,0 +1,306 @@
+package loadtest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Report 压测报告
+type Report struct {
+	Start      time.Time     `json:"start"`
+	Elapsed    time.Duration `json:"elapsed"`    // 从开始到最后一个请求完成
+	Throughput float64       `json:"throughput"` // 每秒完成的请求数，包括失败的请求
+	Summary
+	PerRequest []*Summary `json:"per_request"` // 按请求组合的顺序
+}
+
+// Summary 一组请求的统计
+type Summary struct {
+	Name      string       `json:"name"`
+	Requests  int          `json:"requests"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Sent      int64        `json:"sent_bytes"`
+	Received  int64        `json:"received_bytes"`
+	Latency   LatencyStats `json:"latency"` // 所有请求的耗时，包括失败的请求
+	// 失败的类型及次数
+	Errors map[string]int `json:"errors,omitempty"`
+	// 网关拒绝INIT或关闭链路的错误码及次数
+	ResultCodes map[uint16]int `json:"result_codes,omitempty"`
+	// HTTP响应状态码及次数
+	StatusCodes map[int]int `json:"status_codes,omitempty"`
+
+	latencies []time.Duration
+}
+
+// LatencyStats 耗时统计，百分位数按最近秩法计算
+type LatencyStats struct {
+	Min  time.Duration `json:"min"`
+	Mean time.Duration `json:"mean"`
+	Max  time.Duration `json:"max"`
+	P50  time.Duration `json:"p50"`
+	P90  time.Duration `json:"p90"`
+	P95  time.Duration `json:"p95"`
+	P99  time.Duration `json:"p99"`
+	P999 time.Duration `json:"p999"`
+}
+
+// ErrorRate 返回失败请求的比例
+func (s *Summary) ErrorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Failed) / float64(s.Requests)
+}
+
+func (s *Summary) add(sample *Sample) {
+	s.Requests++
+	s.Sent += int64(len(sample.Request.payload))
+	s.Received += int64(sample.Received)
+	s.latencies = append(s.latencies, sample.Latency)
+	if sample.Status != 0 {
+		if s.StatusCodes == nil {
+			s.StatusCodes = make(map[int]int)
+		}
+		s.StatusCodes[sample.Status]++
+	}
+	if sample.Kind == "" {
+		s.Succeeded++
+		return
+	}
+	s.Failed++
+	if s.Errors == nil {
+		s.Errors = make(map[string]int)
+	}
+	s.Errors[sample.Kind]++
+	if sample.Result != 0 {
+		if s.ResultCodes == nil {
+			s.ResultCodes = make(map[uint16]int)
+		}
+		s.ResultCodes[sample.Result]++
+	}
+}
+
+// finish 计算耗时统计
+func (s *Summary) finish() {
+	s.Latency = latencyStats(s.latencies)
+	s.latencies = nil
+}
+
+// latencyStats 计算耗时统计，会对latencies排序
+func latencyStats(latencies []time.Duration) LatencyStats {
+	if len(latencies) == 0 {
+		return LatencyStats{}
+	}
+	slices.Sort(latencies)
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+	return LatencyStats{
+		Min:  latencies[0],
+		Mean: total / time.Duration(len(latencies)),
+		Max:  latencies[len(latencies)-1],
+		P50:  percentile(latencies, 50),
+		P90:  percentile(latencies, 90),
+		P95:  percentile(latencies, 95),
+		P99:  percentile(latencies, 99),
+		P999: percentile(latencies, 99.9),
+	}
+}
+
+// percentile 返回已排序的sorted的第p百分位数
+// 减去一个极小值，避免99.9/100*1000这样的浮点误差使秩多1
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p/100*float64(len(sorted)) - 1e-9))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// collector 收集请求结果，可以并发调用
+type collector struct {
+	mu         sync.Mutex
+	total      Summary
+	perRequest map[*Request]*Summary
+	order      []*Summary
+}
+
+func newCollector(mix []*Request) *collector {
+	c := &collector{perRequest: make(map[*Request]*Summary)}
+	c.total.Name = "total"
+	for _, r := range mix {
+		s := &Summary{Name: r.Name}
+		c.perRequest[r] = s
+		c.order = append(c.order, s)
+	}
+	return c
+}
+
+func (c *collector) add(sample *Sample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.total.add(sample)
+	c.perRequest[sample.Request].add(sample)
+}
+
+// counts 返回已完成和失败的请求数
+func (c *collector) counts() (completed, failed int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return int64(c.total.Requests), int64(c.total.Failed)
+}
+
+func (c *collector) report(start, end time.Time) *Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := &Report{
+		Start:      start,
+		Elapsed:    end.Sub(start),
+		Summary:    c.total,
+		PerRequest: c.order,
+	}
+	r.Summary.finish()
+	for _, s := range r.PerRequest {
+		s.finish()
+	}
+	if r.Elapsed > 0 {
+		r.Throughput = float64(r.Requests) / r.Elapsed.Seconds()
+	}
+	return r
+}
+
+// WriteText 输出可读的报告
+func (r *Report) WriteText(w io.Writer) error {
+	ew := &errWriter{w: w}
+	ew.printf("耗时:     %v\n", r.Elapsed.Round(time.Millisecond))
+	ew.printf("请求:     %d，成功%d，失败%d (%.2f%%)\n", r.Requests, r.Succeeded, r.Failed, r.ErrorRate()*100)
+	ew.printf("吞吐量:   %.2f 请求/秒\n", r.Throughput)
+	if r.Elapsed > 0 {
+		ew.printf("流量:     发送%d字节，接收%d字节 (%.2f KB/秒)\n", r.Sent, r.Received, float64(r.Received)/1024/r.Elapsed.Seconds())
+	}
+	l := r.Latency
+	ew.printf("耗时分布: min %v  mean %v  max %v\n", round(l.Min), round(l.Mean), round(l.Max))
+	ew.printf("          p50 %v  p90 %v  p95 %v  p99 %v  p99.9 %v\n", round(l.P50), round(l.P90), round(l.P95), round(l.P99), round(l.P999))
+	if len(r.StatusCodes) > 0 {
+		ew.printf("HTTP状态码:\n")
+		for _, code := range sortedKeys(r.StatusCodes) {
+			ew.printf("  %d: %d\n", code, r.StatusCodes[code])
+		}
+	}
+	if len(r.Errors) > 0 {
+		ew.printf("失败:\n")
+		for _, kind := range sortedKeys(r.Errors) {
+			ew.printf("  %s: %d\n", kind, r.Errors[kind])
+		}
+	}
+	if len(r.ResultCodes) > 0 {
+		ew.printf("网关错误码:\n")
+		for _, code := range sortedKeys(r.ResultCodes) {
+			ew.printf("  %d: %d\n", code, r.ResultCodes[code])
+		}
+	}
+	if len(r.PerRequest) > 1 {
+		ew.printf("按请求:\n")
+		for _, s := range r.PerRequest {
+			ew.printf("  %s: %d，失败%d，p50 %v  p99 %v\n", s.Name, s.Requests, s.Failed, round(s.Latency.P50), round(s.Latency.P99))
+		}
+	}
+	return ew.err
+}
+
+// WriteJSON 输出JSON格式的报告，耗时的单位为纳秒
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// csvHeader WriteCSV输出的列，耗时的单位为毫秒
+var csvHeader = []string{
+	"name", "requests", "succeeded", "failed", "error_rate", "throughput", "sent_bytes", "received_bytes",
+	"min_ms", "mean_ms", "max_ms", "p50_ms", "p90_ms", "p95_ms", "p99_ms", "p999_ms", "errors", "result_codes",
+}
+
+// WriteCSV 输出CSV格式的报告，每种请求一行，最后一行为全部请求
+// errors和result_codes列的格式为"类型:次数"，以空格分隔
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, s := range append(slices.Clone(r.PerRequest), &r.Summary) {
+		var throughput float64
+		if r.Elapsed > 0 {
+			throughput = float64(s.Requests) / r.Elapsed.Seconds()
+		}
+		l := s.Latency
+		record := []string{
+			s.Name,
+			strconv.Itoa(s.Requests),
+			strconv.Itoa(s.Succeeded),
+			strconv.Itoa(s.Failed),
+			strconv.FormatFloat(s.ErrorRate(), 'f', 4, 64),
+			strconv.FormatFloat(throughput, 'f', 2, 64),
+			strconv.FormatInt(s.Sent, 10),
+			strconv.FormatInt(s.Received, 10),
+		}
+		for _, d := range []time.Duration{l.Min, l.Mean, l.Max, l.P50, l.P90, l.P95, l.P99, l.P999} {
+			record = append(record, strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64))
+		}
+		record = append(record, joinCounts(s.Errors), joinCounts(s.ResultCodes))
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// joinCounts 将次数格式化为"键:次数 键:次数"
+func joinCounts[K string | uint16](counts map[K]int) string {
+	var out []byte
+	for _, k := range sortedKeys(counts) {
+		if len(out) > 0 {
+			out = append(out, ' ')
+		}
+		out = fmt.Appendf(out, "%v:%d", k, counts[k])
+	}
+	return string(out)
+}
+
+func sortedKeys[K string | uint16 | int](m map[K]int) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// round 按耗时的量级取整，便于阅读
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+// errWriter 记录第一个写入错误
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...any) {
+	if ew.err == nil {
+		_, ew.err = fmt.Fprintf(ew.w, format, args...)
+	}
+}
@@ -0,0 +1,61 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/laotiannai/quic_gwclient/pkg/client"
+)
+
+// Sender 发送请求并返回完整响应的连接，每个Sender同一时间只发送一个请求
+// 网关以错误码关闭链路时返回的错误需要能通过errors.As得到*client.GatewayError
+type Sender interface {
+	Send(ctx context.Context, payload []byte) ([]byte, error)
+	Close() error
+}
+
+// Dialer 创建新的Sender，压测开始时和Sender出错后调用
+type Dialer func(ctx context.Context) (Sender, error)
+
+// ClientDialer 返回连接网关addr并完成INIT的Dialer，每个Sender使用独立的连接
+// 网关拒绝INIT时返回的错误可以通过errors.As得到*client.GatewayError
+// config在每次创建时复制，Logger、Metrics等引用类型的字段在连接之间共享
+func ClientDialer(addr string, config *client.Config) Dialer {
+	return func(ctx context.Context) (Sender, error) {
+		cfg := *config
+		c := client.NewTransferClient(addr, &cfg)
+		if err := c.Connect(ctx); err != nil {
+			return nil, fmt.Errorf("连接网关失败: %w", err)
+		}
+		if _, _, err := c.SendInit(); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("初始化失败: %w", err)
+		}
+		return &clientSender{c: c}, nil
+	}
+}
+
+// clientSender 使用TransferClient发送请求
+type clientSender struct {
+	c *client.TransferClient
+}
+
+// Send 流式发送并读取响应，与SendTransferBytes不同，返回的错误保留*client.GatewayError
+func (s *clientSender) Send(ctx context.Context, payload []byte) ([]byte, error) {
+	resp, err := s.c.SendTransferStream(ctx, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+	data, err := io.ReadAll(resp)
+	if err != nil {
+		return data, fmt.Errorf("读取响应失败: %w", err)
+	}
+	return data, nil
+}
+
+func (s *clientSender) Close() error {
+	return s.c.Close()
+}
@@ -0,0 +1,97 @@
+package loadtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/pkg/client"
+	"github.com/laotiannai/quic_gwclient/pkg/replay"
+	"github.com/laotiannai/quic_gwclient/proto"
+)
+
+// newRecording 构造在一个流上完成INIT并依次应答results的录制，result为0时返回response
+func newRecording(response string, results ...uint16) *replay.Recording {
+	now := time.Now()
+	sent := func(cmd uint16) *replay.Frame {
+		return &replay.Frame{Time: now, Direction: replay.Sent,
+			Request: &proto.TransferHeader{Tag: proto.HEAD_TAG, Command: cmd}}
+	}
+	received := func(cmd, result uint16, body string) *replay.Frame {
+		return &replay.Frame{Time: now, Direction: replay.Received, Body: []byte(body),
+			Response: &proto.ResponseHeader{Tag: proto.HEAD_TAG, Command: cmd, Result: result, DataLen: uint32(len(body))}}
+	}
+	frames := []*replay.Frame{sent(proto.EMM_COMMAND_INIT), received(proto.EMM_COMMAND_INIT_ACK, proto.AUTH_STATUS_CODE_SUCCESS, "")}
+	for _, result := range results {
+		frames = append(frames, sent(proto.EMM_COMMAND_TRAN))
+		if result == 0 {
+			frames = append(frames,
+				received(proto.EMM_COMMAND_TRAN_ACK, 0, response),
+				received(proto.EMM_COMMAND_LINK_CLOSE, proto.AUTH_STATUS_CODE_SUCCESS, ""))
+		} else {
+			frames = append(frames, received(proto.EMM_COMMAND_LINK_CLOSE, result, ""))
+		}
+	}
+	return &replay.Recording{Frames: frames}
+}
+
+func TestClientDialer(t *testing.T) {
+	response := "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"
+	srv := replay.NewServer(newRecording(response, 0, 0, proto.AUTH_STATUS_CODE_ERR_CONN_FAILED), nil)
+	if err := srv.Start("127.0.0.1:0"); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer srv.Close()
+
+	config := &client.Config{ServerID: 1, ServerName: "test-server", InsecureSkipVerify: true, MaxRetries: 1}
+
+	opts := DefaultOptions()
+	opts.Concurrency = 1
+	opts.Duration = 0
+	opts.Requests = 3
+	opts.Timeout = 5 * time.Second
+	mix := []*Request{{URL: "backend/", Assert: Assertion{Status: 200, Contains: "ok"}}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	report, err := Run(ctx, ClientDialer(srv.Addr().String(), config), mix, opts)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if report.Succeeded != 2 || report.Errors[ErrGateway] != 1 || report.ResultCodes[proto.AUTH_STATUS_CODE_ERR_CONN_FAILED] != 1 {
+		t.Errorf("Succeeded = %d, errors = %v, result codes = %v", report.Succeeded, report.Errors, report.ResultCodes)
+	}
+	if report.Received != int64(2*len(response)) {
+		t.Errorf("Received = %d, want %d", report.Received, 2*len(response))
+	}
+	if err := srv.Err(); err != nil {
+		t.Errorf("Unexpected replay error: %v", err)
+	}
+}
+
+func TestClientDialer_InitRejected(t *testing.T) {
+	rec := newRecording("")
+	rec.Frames[1].Response.Result = proto.AUTH_STATUS_CODE_ERR_TENNEL_FORBIDDEN
+	srv := replay.NewServer(rec, nil)
+	if err := srv.Start("127.0.0.1:0"); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer srv.Close()
+
+	config := &client.Config{ServerID: 1, ServerName: "test-server", InsecureSkipVerify: true, MaxRetries: 1}
+	opts := DefaultOptions()
+	opts.Concurrency = 1
+	opts.Duration = 0
+	opts.Requests = 1
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	report, err := Run(ctx, ClientDialer(srv.Addr().String(), config), []*Request{{URL: "backend/"}}, opts)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	// 网关拒绝INIT计为连接失败，同时按错误码统计
+	if report.Errors[ErrConnect] != 1 || report.ResultCodes[proto.AUTH_STATUS_CODE_ERR_TENNEL_FORBIDDEN] != 1 {
+		t.Errorf("Errors = %v, result codes = %v", report.Errors, report.ResultCodes)
+	}
+}
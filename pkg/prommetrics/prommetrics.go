@@ -0,0 +1,182 @@
+// Package prommetrics 将客户端指标导出为Prometheus格式
+//
+//	m := prommetrics.New(nil)
+//	prometheus.MustRegister(m)
+//	config.Metrics = m
+package prommetrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/pkg/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Options 指标选项
+type Options struct {
+	Namespace       string            // 指标名称前缀，默认quic_gwclient
+	ConstLabels     prometheus.Labels // 附加到所有指标的固定标签，如区分不同网关集群
+	ConnectBuckets  []float64         // 握手耗时直方图的桶，单位秒
+	TransferBuckets []float64         // 传输耗时直方图的桶，单位秒
+}
+
+// DefaultOptions 返回默认的指标选项
+func DefaultOptions() *Options {
+	return &Options{
+		Namespace:       "quic_gwclient",
+		ConnectBuckets:  []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		TransferBuckets: prometheus.ExponentialBuckets(.005, 2, 14),
+	}
+}
+
+// Collector 实现client.Metrics和prometheus.Collector，注册到Registry后设置为Config.Metrics
+// 多个客户端可以共享同一个Collector，节点池指标以最近一次报告为准
+type Collector struct {
+	connectDuration  *prometheus.HistogramVec
+	gatewayResults   *prometheus.CounterVec
+	transferDuration *prometheus.HistogramVec
+	sentBytes        prometheus.Counter
+	receivedBytes    prometheus.Counter
+	retries          *prometheus.CounterVec
+	activeStreams    prometheus.Gauge
+	poolEndpoints    *prometheus.GaugeVec
+}
+
+var (
+	_ client.Metrics       = (*Collector)(nil)
+	_ prometheus.Collector = (*Collector)(nil)
+)
+
+// New 创建指标收集器，opts为nil时使用默认选项
+func New(opts *Options) *Collector {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	defaults := DefaultOptions()
+	if opts.Namespace == "" {
+		opts.Namespace = defaults.Namespace
+	}
+	if len(opts.ConnectBuckets) == 0 {
+		opts.ConnectBuckets = defaults.ConnectBuckets
+	}
+	if len(opts.TransferBuckets) == 0 {
+		opts.TransferBuckets = defaults.TransferBuckets
+	}
+
+	return &Collector{
+		connectDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Name:        "connect_duration_seconds",
+			Help:        "QUIC握手耗时，按ALPN和结果区分",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     opts.ConnectBuckets,
+		}, []string{"alpn", "result"}),
+		gatewayResults: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        "gateway_results_total",
+			Help:        "网关INIT、密钥轮换应答和链路关闭的结果码",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"command", "code"}),
+		transferDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Name:        "transfer_duration_seconds",
+			Help:        "传输请求耗时，按结果区分",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     opts.TransferBuckets,
+		}, []string{"result"}),
+		sentBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        "sent_bytes_total",
+			Help:        "传输请求发送的字节数",
+			ConstLabels: opts.ConstLabels,
+		}),
+		receivedBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        "received_bytes_total",
+			Help:        "传输请求接收的字节数",
+			ConstLabels: opts.ConstLabels,
+		}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        "retries_total",
+			Help:        "失败后的重试次数，按操作区分",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"op"}),
+		activeStreams: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   opts.Namespace,
+			Name:        "active_streams",
+			Help:        "正在进行的流式传输数量",
+			ConstLabels: opts.ConstLabels,
+		}),
+		poolEndpoints: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   opts.Namespace,
+			Name:        "pool_endpoints",
+			Help:        "FailoverClient节点池中的节点数，按状态区分",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"state"}),
+	}
+}
+
+// collectors 返回全部指标
+func (m *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.connectDuration, m.gatewayResults, m.transferDuration, m.sentBytes,
+		m.receivedBytes, m.retries, m.activeStreams, m.poolEndpoints,
+	}
+}
+
+// Describe 实现prometheus.Collector
+func (m *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect 实现prometheus.Collector
+func (m *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// ConnectDone 实现client.Metrics
+func (m *Collector) ConnectDone(alpn string, elapsed time.Duration, err error) {
+	m.connectDuration.WithLabelValues(alpn, result(err)).Observe(elapsed.Seconds())
+}
+
+// GatewayResult 实现client.Metrics
+func (m *Collector) GatewayResult(command uint16, code uint16) {
+	m.gatewayResults.WithLabelValues(strconv.Itoa(int(command)), strconv.Itoa(int(code))).Inc()
+}
+
+// TransferDone 实现client.Metrics
+func (m *Collector) TransferDone(elapsed time.Duration, sent, received int64, err error) {
+	m.transferDuration.WithLabelValues(result(err)).Observe(elapsed.Seconds())
+	m.sentBytes.Add(float64(sent))
+	m.receivedBytes.Add(float64(received))
+}
+
+// Retry 实现client.Metrics
+func (m *Collector) Retry(op string) {
+	m.retries.WithLabelValues(op).Inc()
+}
+
+// StreamActive 实现client.Metrics
+func (m *Collector) StreamActive(delta int) {
+	m.activeStreams.Add(float64(delta))
+}
+
+// PoolUsage 实现client.Metrics
+func (m *Collector) PoolUsage(healthy, total int) {
+	m.poolEndpoints.WithLabelValues("healthy").Set(float64(healthy))
+	m.poolEndpoints.WithLabelValues("unhealthy").Set(float64(total - healthy))
+}
+
+// result 将错误转换为result标签的取值
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
@@ -0,0 +1,70 @@
+package prommetrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestCollector(t *testing.T) {
+	m := New(&Options{ConstLabels: prometheus.Labels{"cluster": "test"}})
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(m); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	m.ConnectDone("hq-interop", 20*time.Millisecond, nil)
+	m.ConnectDone("h3", time.Second, errors.New("timeout"))
+	m.GatewayResult(3, 8002)
+	m.TransferDone(50*time.Millisecond, 100, 2048, nil)
+	m.TransferDone(time.Second, 10, 0, errors.New("reset"))
+	m.Retry("download")
+	m.StreamActive(1)
+	m.StreamActive(1)
+	m.StreamActive(-1)
+	m.PoolUsage(2, 3)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	got := make(map[string]*dto.MetricFamily)
+	for _, f := range families {
+		got[f.GetName()] = f
+	}
+
+	for name, want := range map[string]float64{
+		"quic_gwclient_sent_bytes_total":     110,
+		"quic_gwclient_received_bytes_total": 2048,
+		"quic_gwclient_active_streams":       1,
+	} {
+		f := got[name]
+		if f == nil {
+			t.Errorf("Metric %s not found", name)
+			continue
+		}
+		metric := f.GetMetric()[0]
+		value := metric.GetCounter().GetValue() + metric.GetGauge().GetValue()
+		if value != want {
+			t.Errorf("%s = %v, want %v", name, value, want)
+		}
+		if labels := metric.GetLabel(); len(labels) == 0 || labels[0].GetValue() != "test" {
+			t.Errorf("%s missing const label: %v", name, labels)
+		}
+	}
+
+	for name, want := range map[string]int{
+		"quic_gwclient_connect_duration_seconds":  2,
+		"quic_gwclient_gateway_results_total":     1,
+		"quic_gwclient_transfer_duration_seconds": 2,
+		"quic_gwclient_retries_total":             1,
+		"quic_gwclient_pool_endpoints":            2,
+	} {
+		if f := got[name]; f == nil || len(f.GetMetric()) != want {
+			t.Errorf("Expected %d series for %s, got %v", want, name, f)
+		}
+	}
+}
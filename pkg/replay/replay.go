@@ -0,0 +1,304 @@
+// Package replay 读取client.NewFrameRecorder录制的网关会话并重放
+//
+// 录制的会话可以用两种方式重放：Server作为模拟网关，按录制的顺序应答客户端的请求，
+// 用于在测试和离线环境中复现网关的行为；Reissue将录制中的请求重新发送给其他网关，对比两次的响应
+//
+//	f, _ := os.Create("session.jsonl")
+//	config.FrameTracer = client.NewFrameRecorder(f)
+//	// ... 正常使用客户端 ...
+//
+//	rec, _ := replay.Load("session.jsonl")
+//	srv := replay.NewServer(rec, nil)
+//	srv.Start("127.0.0.1:0")
+//
+// 加密会话的帧数据是以当次会话密钥加密的密文，Server只能原样重放，客户端无法解密；
+// Reissue只支持不加密的会话。数据报上的帧会被读取，但不参与重放
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/proto"
+)
+
+// 帧的方向，与client.FrameSent和client.FrameReceived相同
+const (
+	Sent     = "send"
+	Received = "recv"
+)
+
+// maxLineSize 录制文件中单行的最大长度，帧数据按十六进制编码，长度为数据的两倍
+const maxLineSize = 256 * 1024 * 1024
+
+// Frame 录制的一个EMM帧
+type Frame struct {
+	Time      time.Time
+	Direction string                // Sent或Received
+	Conn      uint64                // 录制时的连接序号
+	StreamID  int64                 // 录制时的流ID，数据报为-1
+	Datagram  bool                  // 帧通过QUIC数据报收发
+	Request   *proto.TransferHeader // 请求帧的包头，Direction为Sent时有效
+	Response  *proto.ResponseHeader // 响应帧的包头，Direction为Received时有效
+	Body      []byte
+}
+
+// Command 返回帧的命令字
+func (f *Frame) Command() uint16 {
+	if f.Request != nil {
+		return f.Request.Command
+	}
+	return f.Response.Command
+}
+
+// Stream 录制中一个流上按时间顺序收发的帧
+type Stream struct {
+	Conn   uint64
+	ID     int64
+	Frames []*Frame
+}
+
+// Recording 录制的网关会话
+type Recording struct {
+	Frames []*Frame // 按录制顺序排列的全部帧
+}
+
+// record 录制文件中的一行，字段与client.FrameTraceWriter的JSON格式一致
+type record struct {
+	Time          string  `json:"time"`
+	Direction     string  `json:"dir"`
+	Conn          uint64  `json:"conn"`
+	StreamID      int64   `json:"stream_id"`
+	Datagram      bool    `json:"datagram"`
+	Command       *uint16 `json:"command"`
+	Version       uint16  `json:"version"`
+	ProtoType     uint8   `json:"proto_type"`
+	Result        uint16  `json:"result"`
+	Option        uint8   `json:"option"`
+	Reserve       uint16  `json:"reserve"`
+	DataLen       uint32  `json:"data_len"`
+	Crc           uint32  `json:"crc"`
+	OriginLen     uint32  `json:"origin_len"`
+	Body          string  `json:"body"`
+	BodyTruncated bool    `json:"body_truncated"`
+	Error         string  `json:"error"`
+}
+
+// Load 读取录制文件
+func Load(path string) (*Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开录制文件失败: %v", err)
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Read 读取JSON Lines格式的录制内容，录制时需要输出完整的帧数据
+// 无法完整解析的帧（记录中带有error）被跳过
+func Read(r io.Reader) (*Recording, error) {
+	rec := &Recording{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		frame, err := parseRecord(data)
+		if err != nil {
+			return nil, fmt.Errorf("录制文件第%d行: %v", line, err)
+		}
+		if frame != nil {
+			rec.Frames = append(rec.Frames, frame)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取录制文件失败: %v", err)
+	}
+	return rec, nil
+}
+
+// parseRecord 解析一行记录，无法完整解析的帧返回nil
+func parseRecord(data []byte) (*Frame, error) {
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("不是JSON格式的帧记录，录制时需要使用JSON格式: %v", err)
+	}
+	if r.Error != "" {
+		return nil, nil
+	}
+	if r.Command == nil {
+		return nil, fmt.Errorf("缺少命令字")
+	}
+	if r.BodyTruncated {
+		return nil, fmt.Errorf("帧数据被截断，录制时需要输出完整的帧数据")
+	}
+	body, err := hex.DecodeString(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("帧数据格式错误: %v", err)
+	}
+	if len(body) != int(r.DataLen) {
+		return nil, fmt.Errorf("帧数据长度为%d字节，与包头中的%d字节不一致，录制时需要输出完整的帧数据", len(body), r.DataLen)
+	}
+	t, err := time.Parse(time.RFC3339Nano, r.Time)
+	if err != nil {
+		return nil, fmt.Errorf("时间格式错误: %v", err)
+	}
+
+	f := &Frame{
+		Time:      t,
+		Direction: r.Direction,
+		Conn:      r.Conn,
+		StreamID:  r.StreamID,
+		Datagram:  r.Datagram,
+		Body:      body,
+	}
+	switch r.Direction {
+	case Sent:
+		f.Request = &proto.TransferHeader{
+			Tag:       proto.HEAD_TAG,
+			Version:   r.Version,
+			Command:   *r.Command,
+			ProtoType: r.ProtoType,
+			Option:    r.Option,
+			Reserve:   r.Reserve,
+			DataLen:   r.DataLen,
+			Crc:       r.Crc,
+		}
+	case Received:
+		f.Response = &proto.ResponseHeader{
+			Tag:       proto.HEAD_TAG,
+			Version:   r.Version,
+			Command:   *r.Command,
+			Result:    r.Result,
+			Option:    r.Option,
+			Reserve:   uint8(r.Reserve),
+			DataLen:   r.DataLen,
+			OriginLen: r.OriginLen,
+		}
+	default:
+		return nil, fmt.Errorf("未知的帧方向: %q", r.Direction)
+	}
+	return f, nil
+}
+
+// Conns 返回录制中的连接序号，按第一次出现的顺序排列
+func (r *Recording) Conns() []uint64 {
+	var conns []uint64
+	seen := make(map[uint64]bool)
+	for _, f := range r.Frames {
+		if !seen[f.Conn] {
+			seen[f.Conn] = true
+			conns = append(conns, f.Conn)
+		}
+	}
+	return conns
+}
+
+// Streams 返回连接conn上的流，按第一帧出现的顺序排列，不包括数据报
+func (r *Recording) Streams(conn uint64) []*Stream {
+	var streams []*Stream
+	index := make(map[int64]*Stream)
+	for _, f := range r.Frames {
+		if f.Conn != conn || f.Datagram {
+			continue
+		}
+		s := index[f.StreamID]
+		if s == nil {
+			s = &Stream{Conn: conn, ID: f.StreamID}
+			index[f.StreamID] = s
+			streams = append(streams, s)
+		}
+		s.Frames = append(s.Frames, f)
+	}
+	return streams
+}
+
+// Request 录制中的一次传输请求，由流上连续的EMM_COMMAND_TRAN帧组成
+type Request struct {
+	Conn     uint64
+	StreamID int64
+	Time     time.Time // 第一个请求帧的时间
+	Payload  []byte    // 请求数据
+	Response []byte    // 录制时网关以EMM_COMMAND_TRAN_ACK返回的数据
+	Result   uint16    // 录制时响应以EMM_COMMAND_LINK_CLOSE结束时的结果码，否则为0
+}
+
+// Requests 按录制顺序返回全部传输请求，录制的是加密会话时返回错误
+func (r *Recording) Requests() ([]*Request, error) {
+	var requests []*Request
+	for _, conn := range r.Conns() {
+		for _, s := range r.Streams(conn) {
+			var cur *Request
+			answered := false // 当前请求已收到响应，之后的请求帧属于下一个请求
+			for _, f := range s.Frames {
+				switch {
+				case f.Direction == Sent && f.Command() == proto.EMM_COMMAND_TRAN:
+					if f.Request.Option != 0 {
+						return nil, fmt.Errorf("连接%d流%d的请求已加密，无法重新发送", conn, s.ID)
+					}
+					if cur == nil || answered {
+						cur = &Request{Conn: conn, StreamID: s.ID, Time: f.Time}
+						requests = append(requests, cur)
+						answered = false
+					}
+					cur.Payload = append(cur.Payload, f.Body...)
+				case cur == nil || f.Direction == Sent:
+				case f.Command() == proto.EMM_COMMAND_TRAN_ACK:
+					cur.Response = append(cur.Response, f.Body...)
+					answered = true
+				case f.Command() == proto.EMM_COMMAND_LINK_CLOSE:
+					cur.Result = f.Response.Result
+					answered = true
+				}
+			}
+		}
+	}
+	// 不同流上的请求按发出的时间排序
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].Time.Before(requests[j].Time)
+	})
+	return requests, nil
+}
+
+// Sender 重新发送请求使用的客户端，*client.TransferClient实现了该接口
+type Sender interface {
+	SendTransferBytes(ctx context.Context, payload []byte) ([]byte, int, int, error)
+}
+
+// Result 重新发送一个请求的结果
+type Result struct {
+	Request  *Request
+	Response []byte
+	Elapsed  time.Duration
+	Err      error
+}
+
+// Match 响应与录制时的响应完全相同
+func (r *Result) Match() bool {
+	return r.Err == nil && bytes.Equal(r.Response, r.Request.Response)
+}
+
+// Reissue 依次重新发送请求，某个请求失败不影响后续请求，ctx取消时停止发送
+// sender需要已完成INIT，请求中的数据按字节原样发送
+func Reissue(ctx context.Context, sender Sender, requests []*Request) []*Result {
+	results := make([]*Result, 0, len(requests))
+	for _, req := range requests {
+		if ctx.Err() != nil {
+			break
+		}
+		start := time.Now()
+		resp, _, _, err := sender.SendTransferBytes(ctx, req.Payload)
+		results = append(results, &Result{Request: req, Response: resp, Elapsed: time.Since(start), Err: err})
+	}
+	return results
+}
@@ -0,0 +1,146 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/pkg/client"
+	"github.com/laotiannai/quic_gwclient/proto"
+)
+
+// newRecording 以client.NewFrameRecorder的格式录制帧
+func newRecording(t *testing.T, events ...*client.FrameEvent) *Recording {
+	t.Helper()
+	var buf bytes.Buffer
+	w := client.NewFrameRecorder(&buf)
+	for _, ev := range events {
+		w.TraceFrame(ev)
+	}
+	rec, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	return rec
+}
+
+func sent(conn uint64, stream int64, command uint16, body string) *client.FrameEvent {
+	return &client.FrameEvent{
+		Time: time.Now(), Direction: client.FrameSent, Conn: conn, StreamID: stream,
+		Request: &proto.TransferHeader{Tag: proto.HEAD_TAG, Command: command, DataLen: uint32(len(body))},
+		Body:    []byte(body),
+	}
+}
+
+func received(conn uint64, stream int64, command, result uint16, body string) *client.FrameEvent {
+	return &client.FrameEvent{
+		Time: time.Now(), Direction: client.FrameReceived, Conn: conn, StreamID: stream,
+		Response: &proto.ResponseHeader{Tag: proto.HEAD_TAG, Command: command, Result: result, DataLen: uint32(len(body))},
+		Body:     []byte(body),
+	}
+}
+
+func TestRequests(t *testing.T) {
+	rec := newRecording(t,
+		sent(1, 0, proto.EMM_COMMAND_INIT, "init"),
+		received(1, 0, proto.EMM_COMMAND_INIT_ACK, 8002, ""),
+		sent(1, 0, proto.EMM_COMMAND_TRAN, "GET / "),
+		sent(1, 0, proto.EMM_COMMAND_TRAN, "HTTP/1.1\r\n\r\n"),
+		received(1, 0, proto.EMM_COMMAND_TRAN_ACK, 0, "HTTP/1.1 200 OK\r\n"),
+		received(1, 0, proto.EMM_COMMAND_TRAN_ACK, 0, "\r\n"),
+		received(1, 0, proto.EMM_COMMAND_LINK_CLOSE, 8002, ""),
+		sent(1, 0, proto.EMM_COMMAND_TRAN, "second"),
+		received(1, 0, proto.EMM_COMMAND_LINK_CLOSE, 5003, ""),
+		&client.FrameEvent{Time: time.Now(), Direction: client.FrameReceived, Conn: 1, StreamID: 0, Body: []byte{1}, Err: errors.New("unexpected EOF")},
+		sent(2, 0, proto.EMM_COMMAND_TRAN, "after reconnect"),
+	)
+
+	if len(rec.Frames) != 10 {
+		t.Fatalf("Expected incomplete frame to be skipped, got %d frames", len(rec.Frames))
+	}
+	if conns := rec.Conns(); len(conns) != 2 || conns[0] != 1 || conns[1] != 2 {
+		t.Errorf("Unexpected connections: %v", conns)
+	}
+
+	requests, err := rec.Requests()
+	if err != nil {
+		t.Fatalf("Requests failed: %v", err)
+	}
+	if len(requests) != 3 {
+		t.Fatalf("Expected 3 requests, got %d", len(requests))
+	}
+	if r := requests[0]; string(r.Payload) != "GET / HTTP/1.1\r\n\r\n" || string(r.Response) != "HTTP/1.1 200 OK\r\n\r\n" || r.Result != 8002 {
+		t.Errorf("Unexpected first request: %+v", r)
+	}
+	if r := requests[1]; string(r.Payload) != "second" || r.Response != nil || r.Result != 5003 {
+		t.Errorf("Unexpected second request: %+v", r)
+	}
+	if r := requests[2]; r.Conn != 2 || string(r.Payload) != "after reconnect" {
+		t.Errorf("Unexpected third request: %+v", r)
+	}
+}
+
+func TestRequests_Encrypted(t *testing.T) {
+	ev := sent(1, 0, proto.EMM_COMMAND_TRAN, "ciphertext")
+	ev.Request.Option = 1
+	if _, err := newRecording(t, ev).Requests(); err == nil {
+		t.Error("Expected error for encrypted requests")
+	}
+}
+
+func TestRead_Errors(t *testing.T) {
+	var text bytes.Buffer
+	client.NewFrameTraceWriter(&text, nil).TraceFrame(sent(1, 0, proto.EMM_COMMAND_TRAN, "x"))
+	var truncated bytes.Buffer
+	client.NewFrameTraceWriter(&truncated, &client.FrameTraceOptions{Format: client.FrameTraceJSON, DumpBody: true, MaxBodyBytes: 1}).
+		TraceFrame(sent(1, 0, proto.EMM_COMMAND_TRAN, "hello"))
+	var headers bytes.Buffer
+	client.NewFrameTraceWriter(&headers, &client.FrameTraceOptions{Format: client.FrameTraceJSON}).
+		TraceFrame(sent(1, 0, proto.EMM_COMMAND_TRAN, "hello"))
+
+	for name, input := range map[string]string{
+		"text":      text.String(),
+		"truncated": truncated.String(),
+		"headers":   headers.String(),
+	} {
+		if _, err := Read(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+// echoSender 将请求原样作为响应返回
+type echoSender struct{ calls int }
+
+func (s *echoSender) SendTransferBytes(ctx context.Context, payload []byte) ([]byte, int, int, error) {
+	s.calls++
+	if bytes.Equal(payload, []byte("fail")) {
+		return nil, len(payload), 0, errors.New("failed")
+	}
+	return payload, len(payload), len(payload), nil
+}
+
+func TestReissue(t *testing.T) {
+	requests := []*Request{
+		{Payload: []byte("same"), Response: []byte("same")},
+		{Payload: []byte("fail")},
+		{Payload: []byte("new"), Response: []byte("old")},
+	}
+	sender := &echoSender{}
+	results := Reissue(context.Background(), sender, requests)
+	if len(results) != 3 || sender.calls != 3 {
+		t.Fatalf("Expected all requests to be sent, got %d results", len(results))
+	}
+	if !results[0].Match() || results[1].Err == nil || results[1].Match() || results[2].Match() {
+		t.Errorf("Unexpected results: %+v %+v %+v", results[0], results[1], results[2])
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if results := Reissue(ctx, sender, requests); len(results) != 0 {
+		t.Errorf("Expected no requests after cancel, got %d", len(results))
+	}
+}
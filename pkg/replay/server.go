@@ -0,0 +1,263 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/laotiannai/quic_gwclient/proto"
+	"github.com/quic-go/quic-go"
+)
+
+// maxRequestFrameSize 请求帧允许的最大数据长度，与client.MaxTransferFrameSize相同
+const maxRequestFrameSize = 16 * 1024 * 1024
+
+// DefaultNextProtos 模拟网关接受的ALPN协议，覆盖client.DefaultALPNProtocols中的每组协议
+var DefaultNextProtos = []string{"hq-interop", "hq-29", "h3-25", "http/0.9"}
+
+// ServerOptions 模拟网关选项
+type ServerOptions struct {
+	TLSConfig      *tls.Config // 为nil时使用自签名证书，见Server.Certificate，NextProtos为空时使用DefaultNextProtos
+	MatchBody      bool        // 请求帧的数据必须与录制时相同，默认只比较命令字，INIT中的请求ID和时间戳每次都不同
+	PreserveTiming bool        // 按录制时的帧间隔发送响应帧，默认收到请求后立即应答
+}
+
+// DefaultServerOptions 返回默认的模拟网关选项
+func DefaultServerOptions() *ServerOptions {
+	return &ServerOptions{}
+}
+
+// Server 按录制内容应答客户端请求的模拟网关
+// 客户端的连接和流按建立的顺序依次对应录制中的连接和流，每收到一个与录制相符的请求帧，
+// 发送录制中该帧之后、下一个请求帧之前网关返回的帧；请求帧与录制不符时重置该流，并通过Err报告
+type Server struct {
+	streams [][]*Stream // 录制中每个连接上的流
+	opts    ServerOptions
+	ln      *quic.Listener
+	cert    *x509.Certificate
+
+	mu       sync.Mutex
+	nextConn int
+	errs     []error
+}
+
+// NewServer 创建模拟网关，opts为nil时使用DefaultServerOptions
+func NewServer(rec *Recording, opts *ServerOptions) *Server {
+	if opts == nil {
+		opts = DefaultServerOptions()
+	}
+	s := &Server{opts: *opts}
+	for _, conn := range rec.Conns() {
+		if streams := rec.Streams(conn); len(streams) > 0 {
+			s.streams = append(s.streams, streams)
+		}
+	}
+	return s
+}
+
+// Start 在addr上监听并在后台应答，端口为0时由系统分配，通过Addr获取实际地址
+func (s *Server) Start(addr string) error {
+	tlsConf := s.opts.TLSConfig
+	if tlsConf == nil {
+		cert, err := newCertificate()
+		if err != nil {
+			return fmt.Errorf("生成自签名证书失败: %v", err)
+		}
+		s.cert = cert.Leaf
+		tlsConf = &tls.Config{Certificates: []tls.Certificate{cert}}
+	} else {
+		tlsConf = tlsConf.Clone()
+	}
+	if len(tlsConf.NextProtos) == 0 {
+		tlsConf.NextProtos = DefaultNextProtos
+	}
+
+	ln, err := quic.ListenAddr(addr, tlsConf, &quic.Config{EnableDatagrams: true})
+	if err != nil {
+		return fmt.Errorf("监听失败: %v", err)
+	}
+	s.ln = ln
+	go s.serve()
+	return nil
+}
+
+// Addr 返回监听地址
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Certificate 返回自签名证书，客户端将其加入Config.RootCAs后可以正常校验，使用ServerOptions.TLSConfig时为nil
+func (s *Server) Certificate() *x509.Certificate {
+	return s.cert
+}
+
+// Close 停止监听，已建立的连接随之关闭
+func (s *Server) Close() error {
+	return s.ln.Close()
+}
+
+// Err 返回客户端请求与录制不符的全部错误，没有时返回nil
+func (s *Server) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return errors.Join(s.errs...)
+}
+
+func (s *Server) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errs = append(s.errs, err)
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.ln.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		i := s.nextConn
+		s.nextConn++
+		s.mu.Unlock()
+		if i >= len(s.streams) {
+			s.fail(fmt.Errorf("客户端建立了第%d个连接，录制中只有%d个连接", i+1, len(s.streams)))
+			conn.CloseWithError(0, "no more recorded connections")
+			continue
+		}
+		go s.serveConn(conn, i, s.streams[i])
+	}
+}
+
+func (s *Server) serveConn(conn quic.Connection, index int, streams []*Stream) {
+	for next := 0; ; next++ {
+		stream, err := conn.AcceptStream(conn.Context())
+		if err != nil {
+			return
+		}
+		if next >= len(streams) {
+			s.fail(fmt.Errorf("连接%d: 客户端打开了第%d个流，录制中只有%d个流", index+1, next+1, len(streams)))
+			stream.CancelRead(0)
+			stream.CancelWrite(0)
+			continue
+		}
+		go s.serveStream(stream, streams[next])
+	}
+}
+
+// serveStream 按录制的顺序读取请求帧并发送之后的响应帧
+func (s *Server) serveStream(stream quic.Stream, rs *Stream) {
+	defer stream.Close()
+
+	frames := rs.Frames
+	for i := 0; ; {
+		// 发送下一个请求帧之前录制的响应帧
+		for ; i < len(frames) && frames[i].Direction == Received; i++ {
+			if s.opts.PreserveTiming && i > 0 {
+				time.Sleep(frames[i].Time.Sub(frames[i-1].Time))
+			}
+			if err := writeFrame(stream, frames[i]); err != nil {
+				return
+			}
+		}
+		if i >= len(frames) {
+			return
+		}
+
+		msg, err := readRequestFrame(stream)
+		if err != nil {
+			return
+		}
+		if err := s.match(frames[i], msg); err != nil {
+			s.fail(fmt.Errorf("连接%d流%d第%d帧: %v", rs.Conn, rs.ID, i+1, err))
+			stream.CancelRead(0)
+			stream.CancelWrite(0)
+			return
+		}
+		i++
+	}
+}
+
+// match 检查收到的请求帧与录制的请求帧是否相符
+func (s *Server) match(want *Frame, got *proto.UdpMessage) error {
+	if got.Head.Command != want.Request.Command {
+		return fmt.Errorf("命令字为%d，录制中为%d", got.Head.Command, want.Request.Command)
+	}
+	if s.opts.MatchBody && !bytes.Equal(got.Body, want.Body) {
+		return fmt.Errorf("请求数据与录制不同")
+	}
+	return nil
+}
+
+// writeFrame 发送录制的响应帧
+func writeFrame(w io.Writer, f *Frame) error {
+	head, err := f.Response.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(head, f.Body...))
+	return err
+}
+
+// readRequestFrame 读取一个完整的请求帧
+func readRequestFrame(r io.Reader) (*proto.UdpMessage, error) {
+	headBuf := make([]byte, proto.REQUEST_HEAD_LEN)
+	if _, err := io.ReadFull(r, headBuf); err != nil {
+		return nil, err
+	}
+	msg := &proto.UdpMessage{}
+	if err := msg.ParseHead(headBuf); err != nil {
+		return nil, err
+	}
+	if msg.Head.Tag != proto.HEAD_TAG {
+		return nil, fmt.Errorf("请求帧包头标志错误")
+	}
+	if msg.Head.DataLen > maxRequestFrameSize {
+		return nil, fmt.Errorf("请求帧数据长度过大: %d 字节", msg.Head.DataLen)
+	}
+	msg.Body = make([]byte, msg.Head.DataLen)
+	if _, err := io.ReadFull(r, msg.Body); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// newCertificate 生成本机地址使用的自签名证书
+func newCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "quic_gwclient replay"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
@@ -16,12 +16,21 @@ const (
 	EMM_COMMAND_TRAN     uint16 = 6 // 透传请求
 	EMM_COMMAND_TRAN_ACK uint16 = 7 // 透传应答
 
+	EMM_COMMAND_KEY_UPDATE     uint16 = 8 // 会话密钥轮换请求，仅在协商了OPTION_SEQUENCED的加密会话中使用
+	EMM_COMMAND_KEY_UPDATE_ACK uint16 = 9 // 会话密钥轮换应答
+
 	EMM_COMMAND_LINK_CLOSE          uint16 = 200 // 断开链路消息
 	EMM_COMMAND_LINK_CLOSE_ACK      uint16 = 201 // 断开链路消息
 	EMM_COMMAND_LINK_HEART_BEAT     uint16 = 202 // 链路心跳消息
 	EMM_COMMAND_LINK_HEART_BEAT_ACK uint16 = 203 // 链路心跳应答消息
 )
 
+// 包头Option字段
+const (
+	OPTION_CIPHER_MASK uint8 = 0x0F // 低4位为加密套件，见utils.CipherSuite
+	OPTION_SEQUENCED   uint8 = 0x10 // 加密帧携带序号，支持防重放和会话密钥轮换
+)
+
 // 协议类型
 const (
 	PROTO_TYPE_TCP   int = 0x01 //TCP协议
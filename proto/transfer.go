@@ -12,7 +12,7 @@ type TransferHeader struct {
 	Version   uint16 // 版本号
 	Command   uint16 // 命令字
 	ProtoType uint8  // 协议类型, ProtoTypeV2枚举定义
-	Option    uint8  // 保留字段
+	Option    uint8  // 加密套件，见utils.CipherSuite，不加密时为0
 	Reserve   uint16 // 可选配置项
 	DataLen   uint32 // 数据长度
 	Crc       uint32 // crc校验码
@@ -124,7 +124,7 @@ type ResponseHeader struct {
 	Version   uint16 // 版本号
 	Command   uint16 // 命令字
 	Result    uint16 // 结果值
-	Option    uint8  // 可选配置
+	Option    uint8  // 可选配置，INIT_ACK中为网关确认的加密套件
 	Reserve   uint8  // 保留字段
 	DataLen   uint32 // 数据长度
 	OriginLen uint32 // 原始数据长度
@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// CipherSuite 加密套件，取值即TransferHeader.Option字段，INIT阶段由客户端提出、网关在INIT_ACK中确认
+type CipherSuite uint8
+
+const (
+	// CipherLegacyCBC 零填充、零IV的AES-CBC，兼容旧版网关，密钥长度不合法时使用MD5处理
+	CipherLegacyCBC CipherSuite = 0
+	// CipherCBCPKCS7 PKCS#7填充的AES-CBC，每次加密使用随机IV，密文格式为IV(16)+密文
+	CipherCBCPKCS7 CipherSuite = 1
+	// CipherGCM 带认证的AES-GCM，每次加密使用随机nonce，密文格式为nonce(12)+密文+认证标签(16)
+	CipherGCM CipherSuite = 2
+)
+
+var (
+	errInvalidKeySize  = errors.New("密钥长度必须为16、24或32字节")
+	errInvalidPadding  = errors.New("PKCS#7填充错误")
+	errCiphertextShort = errors.New("密文长度不足")
+)
+
+// String 返回加密套件名称
+func (s CipherSuite) String() string {
+	switch s {
+	case CipherLegacyCBC:
+		return "legacy-cbc"
+	case CipherCBCPKCS7:
+		return "cbc-pkcs7"
+	case CipherGCM:
+		return "gcm"
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(s))
+}
+
+// Valid 判断是否为已知的加密套件
+func (s CipherSuite) Valid() bool {
+	return s <= CipherGCM
+}
+
+// ParseCipherSuite 按名称解析加密套件，名称与String的返回值一致
+func ParseCipherSuite(name string) (CipherSuite, error) {
+	for _, s := range []CipherSuite{CipherLegacyCBC, CipherCBCPKCS7, CipherGCM} {
+		if s.String() == name {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("未知的加密套件: %q", name)
+}
+
+// Encrypt 使用该加密套件加密明文
+func (s CipherSuite) Encrypt(key []byte, plaintext []byte) ([]byte, error) {
+	switch s {
+	case CipherLegacyCBC:
+		return EncryptAES(key, plaintext)
+	case CipherCBCPKCS7:
+		iv := make([]byte, aes.BlockSize)
+		if _, err := rand.Read(iv); err != nil {
+			return nil, err
+		}
+		return encryptCBCPKCS7(key, iv, plaintext)
+	case CipherGCM:
+		nonce := make([]byte, 12)
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		return sealGCM(key, nonce, plaintext)
+	}
+	return nil, fmt.Errorf("未知的加密套件: %d", uint8(s))
+}
+
+// Decrypt 使用该加密套件解密密文
+// CipherLegacyCBC无法区分零填充和数据，返回的明文包含填充，调用方需按原始长度截断
+func (s CipherSuite) Decrypt(key []byte, ciphertext []byte) ([]byte, error) {
+	switch s {
+	case CipherLegacyCBC:
+		return DecryptAES(key, ciphertext)
+	case CipherCBCPKCS7:
+		return decryptCBCPKCS7(key, ciphertext)
+	case CipherGCM:
+		return openGCM(key, ciphertext)
+	}
+	return nil, fmt.Errorf("未知的加密套件: %d", uint8(s))
+}
+
+// newBlock 创建AES分组密码，密钥长度不合法时返回错误而不是隐式处理
+func newBlock(key []byte) (cipher.Block, error) {
+	switch len(key) {
+	case 16, 24, 32:
+		return aes.NewCipher(key)
+	}
+	return nil, errInvalidKeySize
+}
+
+func encryptCBCPKCS7(key []byte, iv []byte, plaintext []byte) ([]byte, error) {
+	block, err := newBlock(key)
+	if err != nil {
+		return nil, err
+	}
+
+	padLen := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := append(append([]byte{}, plaintext...), bytes.Repeat([]byte{byte(padLen)}, padLen)...)
+
+	out := make([]byte, aes.BlockSize+len(padded))
+	copy(out, iv)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out[aes.BlockSize:], padded)
+	return out, nil
+}
+
+func decryptCBCPKCS7(key []byte, ciphertext []byte) ([]byte, error) {
+	block, err := newBlock(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < 2*aes.BlockSize || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errCiphertextShort
+	}
+
+	iv, data := ciphertext[:aes.BlockSize], ciphertext[aes.BlockSize:]
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	padLen := int(plain[len(plain)-1])
+	if padLen == 0 || padLen > aes.BlockSize {
+		return nil, errInvalidPadding
+	}
+	for _, b := range plain[len(plain)-padLen:] {
+		if int(b) != padLen {
+			return nil, errInvalidPadding
+		}
+	}
+	return plain[:len(plain)-padLen], nil
+}
+
+func sealGCM(key []byte, nonce []byte, plaintext []byte) ([]byte, error) {
+	block, err := newBlock(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(append([]byte{}, nonce...), nonce, plaintext, nil), nil
+}
+
+func openGCM(key []byte, ciphertext []byte) ([]byte, error) {
+	block, err := newBlock(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize()+aead.Overhead() {
+		return nil, errCiphertextShort
+	}
+	nonce, data := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("认证失败: %v", err)
+	}
+	return plain, nil
+}
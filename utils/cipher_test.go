@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex %q: %v", s, err)
+	}
+	return b
+}
+
+// 测试向量来自NIST SP 800-38A（CBC）和GCM规范测试用例3，PKCS#7填充块按标准计算
+func TestCipherSuite_Vectors(t *testing.T) {
+	tests := []struct {
+		name       string
+		suite      CipherSuite
+		key        string
+		plaintext  string
+		ciphertext string
+		// Decrypt后的期望明文，为空时与plaintext相同
+		decrypted string
+	}{
+		{
+			name:       "legacy full block",
+			suite:      CipherLegacyCBC,
+			key:        "2b7e151628aed2a6abf7158809cf4f3c",
+			plaintext:  "6bc1bee22e409f96e93d7e117393172a",
+			ciphertext: "3ad77bb40d7a3660a89ecaf32466ef97",
+		},
+		{
+			name:       "legacy keeps zero padding and trailing 0x01",
+			suite:      CipherLegacyCBC,
+			key:        "2b7e151628aed2a6abf7158809cf4f3c",
+			plaintext:  "ab01",
+			ciphertext: "fd4972d47784d044766cf5aac90d1642",
+			decrypted:  "ab010000000000000000000000000000",
+		},
+		{
+			name:       "cbc-pkcs7 full block",
+			suite:      CipherCBCPKCS7,
+			key:        "2b7e151628aed2a6abf7158809cf4f3c",
+			plaintext:  "6bc1bee22e409f96e93d7e117393172a",
+			ciphertext: "000102030405060708090a0b0c0d0e0f" + "7649abac8119b246cee98e9b12e9197d" + "8964e0b149c10b7b682e6e39aaeb731c",
+		},
+		{
+			name:       "cbc-pkcs7 short",
+			suite:      CipherCBCPKCS7,
+			key:        "2b7e151628aed2a6abf7158809cf4f3c",
+			plaintext:  "454d4d",
+			ciphertext: "000102030405060708090a0b0c0d0e0f" + "9aefe771cb98b7dd503686bd7c6ed43b",
+		},
+		{
+			name:  "gcm",
+			suite: CipherGCM,
+			key:   "feffe9928665731c6d6a8f9467308308",
+			plaintext: "d9313225f88406e5a55909c5aff5269a86a7a9531534f7da2e4c303d8a318a72" +
+				"1c3c0c95956809532fcf0e2449a6b525b16aedf5aa0de657ba637b391aafd255",
+			ciphertext: "cafebabefacedbaddecaf888" +
+				"42831ec2217774244b7221b784d0d49ce3aa212f2c02a4e035c17e2329aca12e" +
+				"21d514b25466931c7d8f6a5aac84aa051ba30b396a0aac973d58e091473f5985" +
+				"4d5c2af327cd64a62cf35abd2ba6fab4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := mustHex(t, tt.key)
+			plaintext := mustHex(t, tt.plaintext)
+			ciphertext := mustHex(t, tt.ciphertext)
+
+			var got []byte
+			var err error
+			switch tt.suite {
+			case CipherCBCPKCS7:
+				got, err = encryptCBCPKCS7(key, ciphertext[:16], plaintext)
+			case CipherGCM:
+				got, err = sealGCM(key, ciphertext[:12], plaintext)
+			default:
+				got, err = tt.suite.Encrypt(key, plaintext)
+			}
+			if err != nil {
+				t.Fatalf("Encrypt failed: %v", err)
+			}
+			if !bytes.Equal(got, ciphertext) {
+				t.Errorf("Encrypt = %x, want %x", got, ciphertext)
+			}
+
+			want := plaintext
+			if tt.decrypted != "" {
+				want = mustHex(t, tt.decrypted)
+			}
+			plain, err := tt.suite.Decrypt(key, ciphertext)
+			if err != nil {
+				t.Fatalf("Decrypt failed: %v", err)
+			}
+			if !bytes.Equal(plain, want) {
+				t.Errorf("Decrypt = %x, want %x", plain, want)
+			}
+		})
+	}
+}
+
+func TestCipherSuite_RoundTrip(t *testing.T) {
+	key := []byte(NewKey("round-trip", 1700000000))
+	// 以0x01结尾的数据不能被误当作填充
+	plaintext := []byte{0x00, 0x10, 0x01}
+
+	for _, suite := range []CipherSuite{CipherCBCPKCS7, CipherGCM} {
+		first, err := suite.Encrypt(key, plaintext)
+		if err != nil {
+			t.Fatalf("%s: Encrypt failed: %v", suite, err)
+		}
+		second, _ := suite.Encrypt(key, plaintext)
+		if bytes.Equal(first, second) {
+			t.Errorf("%s: expected random IV to produce different ciphertexts", suite)
+		}
+
+		plain, err := suite.Decrypt(key, first)
+		if err != nil {
+			t.Fatalf("%s: Decrypt failed: %v", suite, err)
+		}
+		if !bytes.Equal(plain, plaintext) {
+			t.Errorf("%s: Decrypt = %x, want %x", suite, plain, plaintext)
+		}
+	}
+}
+
+func TestCipherSuite_Errors(t *testing.T) {
+	key := mustHex(t, "feffe9928665731c6d6a8f9467308308")
+
+	sealed, _ := CipherGCM.Encrypt(key, []byte("payload"))
+	sealed[len(sealed)-1] ^= 0xff
+	if _, err := CipherGCM.Decrypt(key, sealed); err == nil {
+		t.Error("Expected GCM authentication failure")
+	}
+
+	// 非法填充
+	bad, _ := encryptCBCPKCS7(key, make([]byte, 16), []byte("payload"))
+	bad[len(bad)-17] ^= 0x01
+	if _, err := CipherCBCPKCS7.Decrypt(key, bad); err == nil {
+		t.Error("Expected padding error")
+	}
+
+	if _, err := CipherCBCPKCS7.Encrypt([]byte("short"), []byte("payload")); err != errInvalidKeySize {
+		t.Errorf("Expected errInvalidKeySize, got %v", err)
+	}
+	if _, err := CipherSuite(9).Encrypt(key, nil); err == nil {
+		t.Error("Expected unknown suite error")
+	}
+	if _, err := DecryptAES(key, make([]byte, 20)); err == nil {
+		t.Error("Expected error for partial block")
+	}
+}
+
+func TestParseCipherSuite(t *testing.T) {
+	for _, suite := range []CipherSuite{CipherLegacyCBC, CipherCBCPKCS7, CipherGCM} {
+		got, err := ParseCipherSuite(suite.String())
+		if err != nil || got != suite {
+			t.Errorf("ParseCipherSuite(%q) = %v, %v", suite.String(), got, err)
+		}
+	}
+	if _, err := ParseCipherSuite("des"); err == nil {
+		t.Error("Expected error for unknown suite")
+	}
+}